@@ -0,0 +1,71 @@
+// Package accesslog writes a line in logfmt per request to the servers of
+// the module, e.g.
+//
+//	time=2024-05-01T12:00:00Z client=certbot remote=192.0.2.7:53211 method=POST path=/update status=200 bytes=57 duration=412ms
+package accesslog
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6/httpauth"
+)
+
+// Handler returns h, logging every request to l. The client is the
+// httpauth ID of the sender, or "-" if it wasn't authenticated. A nil l
+// returns h unchanged.
+func Handler(l *log.Logger, h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		client := httpauth.ClientID(r.Context())
+		if client == "" {
+			client = "-"
+		}
+		Print(l, "time", start.UTC().Format(time.RFC3339), "client", client, "remote", r.RemoteAddr,
+			"method", r.Method, "path", r.URL.Path, "status", rec.status, "bytes", rec.bytes,
+			"duration", time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// Print writes the key value pairs to l as a line in logfmt.
+func Print(l *log.Logger, kv ...interface{}) {
+	var b strings.Builder
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		v := fmt.Sprint(kv[i+1])
+		if v == "" || strings.ContainsAny(v, " \"=") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, "%s=%s", kv[i], v)
+	}
+	l.Print(b.String())
+}
+
+// recorder captures the status and size of a response.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
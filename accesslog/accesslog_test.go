@@ -0,0 +1,33 @@
+package accesslog
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := Handler(log.New(&buf, "", 0), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	r := httptest.NewRequest("POST", "/register?x=1", nil)
+	r.RemoteAddr = "192.0.2.1:1000"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	want := regexp.MustCompile(`^time=\S+ client=- remote=192.0.2.1:1000 method=POST path=/register status=201 bytes=5 duration=\S+\n$`)
+	if !want.MatchString(buf.String()) {
+		t.Fatalf("unexpected line %q", buf.String())
+	}
+}
+
+func TestPrint(t *testing.T) {
+	var buf bytes.Buffer
+	Print(log.New(&buf, "", 0), "msg", "two words", "empty", "", "n", 3)
+	if got, want := buf.String(), "msg=\"two words\" empty=\"\" n=3\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
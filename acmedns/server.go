@@ -0,0 +1,415 @@
+// Package acmedns implements the HTTP API of acme-dns
+// (https://github.com/joohoi/acme-dns) on top of a libdns provider, so ACME
+// clients which only know how to talk to acme-dns can complete DNS-01
+// challenges on dynv6 zones.
+//
+// Every registered account gets a random subdomain of Zone. Users point
+// _acme-challenge.<their domain> at that subdomain with a CNAME record and the
+// client publishes challenge tokens through the /update endpoint, which are
+// stored as TXT records in the dynv6 zone.
+package acmedns
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/accesslog"
+	"github.com/libdns/dynv6/health"
+	"github.com/libdns/dynv6/httpauth"
+	"github.com/libdns/dynv6/ratelimit"
+	"github.com/libdns/libdns"
+)
+
+// Provider is the set of libdns interfaces the server needs to publish
+// challenge tokens.
+type Provider interface {
+	libdns.RecordAppender
+	libdns.RecordDeleter
+}
+
+// Server serves the acme-dns /register, /update and /health endpoints.
+type Server struct {
+	// Provider publishes the TXT records. It is required.
+	Provider Provider
+
+	// Zone is the dynv6 zone in which the account subdomains are created,
+	// e.g. "acme.example.dynv6.net". It is required.
+	Zone string
+
+	// Store persists the registered accounts. Defaults to an in-memory store.
+	Store Store
+
+	// DisableRegistration turns off the /register endpoint, so only
+	// already known accounts can be used.
+	DisableRegistration bool
+
+	// TTL of the published TXT records. Defaults to 60 seconds.
+	TTL time.Duration
+
+	// AdjustTTL publishes records with dynv6.SuggestedChallengeTTL if TTL
+	// is above dynv6.MaxChallengeTTL, instead of only warning about it.
+	AdjustTTL bool
+
+	// OnWarning, if set, is called when a TTL is long enough for resolvers
+	// to serve an old token to the CA, see dynv6.CheckTTL. Warnings are
+	// also written to ErrorLog.
+	OnWarning func(dynv6.Warning)
+
+	// ErrorLog receives errors returned by the provider and store. If nil,
+	// the standard logger is used.
+	ErrorLog *log.Logger
+
+	// Health, if set, serves /healthz and /readyz.
+	Health *health.Checker
+
+	// Auth, if set, requires a bearer token or signature on top of the
+	// acme-dns credentials, e.g. to keep hosts on a LAN from registering
+	// accounts. The health endpoints are served without it, and the ID of
+	// the client is included in the logged errors of its requests.
+	Auth *httpauth.Authenticator
+
+	// TLSConfig, if set, makes ListenAndServe serve HTTPS with its
+	// certificates.
+	TLSConfig *tls.Config
+
+	// AccessLog, if set, receives a line per request, see the accesslog
+	// package. The health endpoints aren't logged.
+	AccessLog *log.Logger
+
+	// RateLimit, if set, limits the requests of each client, so a
+	// misbehaving one can't use up the dynv6 API quota of the others.
+	RateLimit *ratelimit.Limiter
+
+	// DrainTimeout is how long requests in progress may take to finish
+	// once ListenAndServe is stopped. Defaults to 10 seconds.
+	DrainTimeout time.Duration
+
+	initOnce sync.Once
+	mux      *http.ServeMux
+	handler  http.Handler
+	updateMu sync.Mutex
+}
+
+// keptValues is the number of TXT values acme-dns keeps per subdomain, which
+// allows certificates for a name and its wildcard to be issued together.
+const keptValues = 2
+
+// ListenAndServe serves the API on addr until ctx is canceled.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	if s.Provider == nil || s.Zone == "" {
+		return errors.New("acmedns: provider and zone are required")
+	}
+	srv := &http.Server{Addr: addr, Handler: s, TLSConfig: s.TLSConfig}
+	errc := make(chan error, 1)
+	go func() {
+		if s.TLSConfig != nil {
+			errc <- srv.ListenAndServeTLS("", "")
+		} else {
+			errc <- srv.ListenAndServe()
+		}
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	timeout := s.DrainTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("acmedns: drain timeout of %v exceeded: %w", timeout, err)
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.initOnce.Do(func() {
+		if s.Store == nil {
+			s.Store = &FileStore{}
+		}
+		s.mux = http.NewServeMux()
+		s.mux.HandleFunc("/register", s.handleRegister)
+		s.mux.HandleFunc("/update", s.handleUpdate)
+		s.mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		if s.Health != nil {
+			s.Health.Register(s.mux)
+		}
+		s.handler = s.Auth.Handler(accesslog.Handler(s.AccessLog, s.RateLimit.Handler(s.mux)))
+	})
+	switch r.URL.Path {
+	case "/health", "/healthz", "/readyz":
+		s.mux.ServeHTTP(w, r)
+	default:
+		s.handler.ServeHTTP(w, r)
+	}
+}
+
+type registerRequest struct {
+	AllowFrom []string `json:"allowfrom"`
+}
+
+type registerResponse struct {
+	Username   string   `json:"username"`
+	Password   string   `json:"password"`
+	FullDomain string   `json:"fulldomain"`
+	Subdomain  string   `json:"subdomain"`
+	AllowFrom  []string `json:"allowfrom"`
+}
+
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+		return
+	}
+	if s.DisableRegistration {
+		writeError(w, http.StatusNotFound, "registration_disabled")
+		return
+	}
+	var req registerRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "malformed_json_payload")
+			return
+		}
+	}
+	for _, cidr := range req.AllowFrom {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_allowfrom_cidr")
+			return
+		}
+	}
+	password := randomString(40)
+	acct := &Account{
+		Username:     randomUUID(),
+		PasswordHash: hashPassword(password),
+		Subdomain:    randomUUID(),
+		AllowFrom:    req.AllowFrom,
+	}
+	if err := s.Store.Put(acct); err != nil {
+		s.requestf(r, "storing account: %v", err)
+		writeError(w, http.StatusInternalServerError, "db_error")
+		return
+	}
+	allowFrom := acct.AllowFrom
+	if allowFrom == nil {
+		allowFrom = []string{}
+	}
+	writeJSON(w, http.StatusCreated, registerResponse{
+		Username:   acct.Username,
+		Password:   password,
+		FullDomain: acct.Subdomain + "." + strings.TrimSuffix(s.Zone, "."),
+		Subdomain:  acct.Subdomain,
+		AllowFrom:  allowFrom,
+	})
+}
+
+type updateRequest struct {
+	Subdomain string `json:"subdomain"`
+	TXT       string `json:"txt"`
+}
+
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed")
+		return
+	}
+	acct, err := s.Store.Get(r.Header.Get("X-Api-User"))
+	if err != nil {
+		s.requestf(r, "loading account: %v", err)
+		writeError(w, http.StatusInternalServerError, "db_error")
+		return
+	}
+	if acct == nil || !checkPassword(acct.PasswordHash, r.Header.Get("X-Api-Key")) {
+		writeError(w, http.StatusUnauthorized, "forbidden")
+		return
+	}
+	if !allowedFrom(acct.AllowFrom, r.RemoteAddr) {
+		writeError(w, http.StatusUnauthorized, "forbidden")
+		return
+	}
+	var req updateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "malformed_json_payload")
+		return
+	}
+	if req.Subdomain != acct.Subdomain {
+		writeError(w, http.StatusUnauthorized, "forbidden")
+		return
+	}
+	if !validTXT(req.TXT) {
+		writeError(w, http.StatusBadRequest, "bad_txt")
+		return
+	}
+	if err := s.publish(r.Context(), req.TXT, acct); err != nil {
+		s.requestf(r, "publishing TXT for %s: %v", acct.Subdomain, err)
+		writeError(w, http.StatusInternalServerError, "db_error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"txt": req.TXT})
+}
+
+// publish adds the new TXT value for the account and removes values older
+// than the last keptValues updates.
+func (s *Server) publish(ctx context.Context, txt string, acct *Account) error {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	// re-read the account so concurrent updates don't lose values
+	current, err := s.Store.Get(acct.Username)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		acct = current
+	}
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = 60 * time.Second
+	}
+	zone := strings.TrimSuffix(s.Zone, ".") + "."
+	rec := libdns.TXT{Name: acct.Subdomain, TTL: ttl, Text: txt}
+	if w := dynv6.CheckTTL(dynv6.PurposeChallenge, zone, rec); w != nil {
+		if s.AdjustTTL {
+			rec.TTL = w.SuggestedTTL
+			w.Message += fmt.Sprintf(", publishing with %v instead", w.SuggestedTTL)
+		}
+		s.logf("%s", w.Message)
+		if s.OnWarning != nil {
+			s.OnWarning(*w)
+		}
+	}
+	_, err = s.Provider.AppendRecords(ctx, zone, []libdns.Record{rec})
+	if err != nil {
+		return err
+	}
+	acct.TXT = append(acct.TXT, txt)
+	if n := len(acct.TXT) - keptValues; n > 0 {
+		var stale []libdns.Record
+		for _, v := range acct.TXT[:n] {
+			stale = append(stale, libdns.TXT{Name: acct.Subdomain, Text: v})
+		}
+		if _, err := s.Provider.DeleteRecords(ctx, zone, stale); err != nil {
+			// keep the stale values so the next update retries the deletion
+			s.logf("acmedns: removing old TXT values for %s: %v", acct.Subdomain, err)
+		} else {
+			acct.TXT = acct.TXT[n:]
+		}
+	}
+	return s.Store.Put(acct)
+}
+
+// requestf logs an error of a request, with the ID of the client if it
+// was authenticated.
+func (s *Server) requestf(r *http.Request, format string, args ...interface{}) {
+	prefix := "acmedns: "
+	if id := httpauth.ClientID(r.Context()); id != "" {
+		prefix += "client " + id + ": "
+	}
+	s.logf(prefix+format, args...)
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// validTXT reports whether v looks like an ACME DNS-01 key authorization
+// digest, which is a 43 character unpadded base64url string.
+func validTXT(v string) bool {
+	if len(v) != 43 {
+		return false
+	}
+	for _, c := range v {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func allowedFrom(cidrs []string, remoteAddr string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if _, n, err := net.ParseCIDR(cidr); err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashPassword hashes the randomly generated passwords. A fast hash is
+// sufficient because the passwords are long random strings, not user chosen.
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func checkPassword(hash, password string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashPassword(password))) == 1
+}
+
+const passwordAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = passwordAlphabet[int(b[i])%len(passwordAlphabet)]
+	}
+	return string(b)
+}
+
+func randomUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,182 @@
+package acmedns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/httpauth"
+	"github.com/libdns/libdns"
+)
+
+type fakeProvider struct {
+	mu   sync.Mutex
+	recs []libdns.RR
+}
+
+func (f *fakeProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range recs {
+		f.recs = append(f.recs, r.RR())
+	}
+	return recs, nil
+}
+
+func (f *fakeProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range recs {
+		for i, v := range f.recs {
+			if v.Name == r.RR().Name && v.Data == r.RR().Data {
+				f.recs = append(f.recs[:i], f.recs[i+1:]...)
+				break
+			}
+		}
+	}
+	return recs, nil
+}
+
+func TestRegisterAndUpdate(t *testing.T) {
+	p := &fakeProvider{}
+	srv := httptest.NewServer(&Server{Provider: p, Zone: "acme.example.dynv6.net"})
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/register", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reg registerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&reg); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("register: unexpected status %s", resp.Status)
+	}
+	if reg.FullDomain != reg.Subdomain+".acme.example.dynv6.net" {
+		t.Fatalf("unexpected fulldomain %q", reg.FullDomain)
+	}
+
+	update := func(key, txt string) int {
+		body, _ := json.Marshal(updateRequest{Subdomain: reg.Subdomain, TXT: txt})
+		req, _ := http.NewRequest("POST", srv.URL+"/update", bytes.NewReader(body))
+		req.Header.Set("X-Api-User", reg.Username)
+		req.Header.Set("X-Api-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	values := []string{strings.Repeat("a", 43), strings.Repeat("b", 43), strings.Repeat("c", 43)}
+	if status := update("wrong", values[0]); status != http.StatusUnauthorized {
+		t.Fatalf("update with wrong key: got status %d", status)
+	}
+	if status := update(reg.Password, "short"); status != http.StatusBadRequest {
+		t.Fatalf("update with bad txt: got status %d", status)
+	}
+	for _, v := range values {
+		if status := update(reg.Password, v); status != http.StatusOK {
+			t.Fatalf("update: got status %d", status)
+		}
+	}
+	// only the two most recent values are kept
+	if len(p.recs) != 2 || p.recs[0].Data != values[1] || p.recs[1].Data != values[2] {
+		t.Fatalf("unexpected records %+v", p.recs)
+	}
+	if p.recs[0].Name != reg.Subdomain || p.recs[0].Type != "TXT" {
+		t.Fatalf("unexpected record %+v", p.recs[0])
+	}
+}
+
+func TestAdjustTTL(t *testing.T) {
+	p := &fakeProvider{}
+	var warnings []dynv6.Warning
+	s := &Server{
+		Provider:  p,
+		Zone:      "acme.example.dynv6.net",
+		Store:     &FileStore{},
+		TTL:       time.Hour,
+		AdjustTTL: true,
+		ErrorLog:  log.New(ioutil.Discard, "", 0),
+		OnWarning: func(w dynv6.Warning) { warnings = append(warnings, w) },
+	}
+	acct := &Account{Username: "user", Subdomain: "sub"}
+	if err := s.publish(context.Background(), strings.Repeat("a", 43), acct); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || warnings[0].Code != dynv6.WarnChallengeTTL {
+		t.Fatalf("got warnings %+v", warnings)
+	}
+	if ttl := p.recs[0].TTL; ttl != dynv6.SuggestedChallengeTTL {
+		t.Fatalf("published TTL %v, want %v", ttl, dynv6.SuggestedChallengeTTL)
+	}
+}
+
+func TestAllowFrom(t *testing.T) {
+	tests := []struct {
+		cidrs  []string
+		remote string
+		want   bool
+	}{
+		{nil, "192.0.2.1:1234", true},
+		{[]string{"192.0.2.0/24"}, "192.0.2.1:1234", true},
+		{[]string{"192.0.2.0/24"}, "198.51.100.1:1234", false},
+		{[]string{"2001:db8::/32"}, "[2001:db8::1]:1234", true},
+	}
+	for _, test := range tests {
+		if got := allowedFrom(test.cidrs, test.remote); got != test.want {
+			t.Errorf("allowedFrom(%v, %s) = %v, want %v", test.cidrs, test.remote, got, test.want)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	srv := httptest.NewServer(&Server{
+		Provider: &fakeProvider{},
+		Zone:     "acme.example.dynv6.net",
+		Auth: &httpauth.Authenticator{
+			Clients:  []httpauth.Client{{ID: "lan", Token: "s3cret"}},
+			ErrorLog: log.New(ioutil.Discard, "", 0),
+		},
+	})
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/register", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("register without token: got %d", resp.StatusCode)
+	}
+	req, _ := http.NewRequest("POST", srv.URL+"/register", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("register with token: got %d", resp.StatusCode)
+	}
+	resp, err = http.Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("health: got %d", resp.StatusCode)
+	}
+}
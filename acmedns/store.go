@@ -0,0 +1,95 @@
+package acmedns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Account is a registered acme-dns client.
+type Account struct {
+	Username string `json:"username"`
+	// PasswordHash is the hex encoded SHA-256 of the password.
+	PasswordHash string   `json:"password_hash"`
+	Subdomain    string   `json:"subdomain"`
+	AllowFrom    []string `json:"allowfrom,omitempty"`
+	// TXT holds the currently published challenge values, oldest first.
+	TXT []string `json:"txt,omitempty"`
+}
+
+// Store persists accounts.
+type Store interface {
+	// Get returns the account with the given username, or nil if there is none.
+	Get(username string) (*Account, error)
+	// Put creates or replaces an account.
+	Put(acct *Account) error
+}
+
+// FileStore keeps accounts in memory and, if Path is set, in a JSON file.
+type FileStore struct {
+	Path string
+
+	mu       sync.Mutex
+	loaded   bool
+	accounts map[string]*Account
+}
+
+func (s *FileStore) load() error {
+	if s.loaded {
+		return nil
+	}
+	s.accounts = map[string]*Account{}
+	if s.Path != "" {
+		b, err := ioutil.ReadFile(s.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if len(b) > 0 {
+			if err := json.Unmarshal(b, &s.accounts); err != nil {
+				return err
+			}
+		}
+	}
+	s.loaded = true
+	return nil
+}
+
+// Get implements Store.
+func (s *FileStore) Get(username string) (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	acct, ok := s.accounts[username]
+	if !ok {
+		return nil, nil
+	}
+	cp := *acct
+	cp.TXT = append([]string(nil), acct.TXT...)
+	return &cp, nil
+}
+
+// Put implements Store.
+func (s *FileStore) Put(acct *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	cp := *acct
+	s.accounts[acct.Username] = &cp
+	if s.Path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.accounts, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
@@ -0,0 +1,118 @@
+package dynv6
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+)
+
+// UpsertAddress points fqdn at addrs, the one call most dynamic DNS clients
+// need: it resolves the zone containing fqdn with ResolveZoneID, replaces
+// the A records of fqdn with the IPv4 addresses and its AAAA records with the
+// IPv6 addresses, and deletes the records of a family without addresses.
+// dynv6 serves the A and AAAA records of the apex from the addresses of the
+// zone, so at the apex the zone is updated instead, which takes at most one
+// address per family and keeps the other family unchanged if it has none.
+// It returns the address records of fqdn, relative to the zone.
+func (p *Provider) UpsertAddress(ctx context.Context, fqdn string, addrs []netip.Addr) ([]libdns.Record, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("No addresses for %s", fqdn)
+	}
+	var v4, v6 []libdns.Record
+	for _, addr := range addrs {
+		if !addr.IsValid() {
+			return nil, fmt.Errorf("Invalid address for %s", fqdn)
+		}
+		addr = addr.Unmap()
+		if addr.Is4() {
+			v4 = append(v4, libdns.Address{IP: addr})
+		} else {
+			v6 = append(v6, libdns.Address{IP: addr})
+		}
+	}
+	_, zone, err := p.ResolveZoneID(ctx, fqdn)
+	if err != nil {
+		return nil, err
+	}
+	name := libdns.RelativeName(strings.ToLower(fqdn), strings.ToLower(zone))
+	if name == "@" {
+		return p.upsertApex(ctx, zone, v4, v6)
+	}
+	var results []libdns.Record
+	for _, fam := range []struct {
+		typ  string
+		recs []libdns.Record
+	}{{"A", v4}, {"AAAA", v6}} {
+		if len(fam.recs) == 0 {
+			existing, err := p.GetRecordsByNameAndType(ctx, zone, name, fam.typ)
+			if err != nil {
+				return results, err
+			}
+			if len(existing) > 0 {
+				if _, err := p.DeleteRecords(ctx, zone, existing); err != nil {
+					return results, err
+				}
+			}
+			continue
+		}
+		for i := range fam.recs {
+			a := fam.recs[i].(libdns.Address)
+			a.Name, a.TTL = name, p.TTL
+			fam.recs[i] = a
+		}
+		set, err := p.SetRecords(ctx, zone, fam.recs)
+		results = append(results, set...)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// upsertApex sets the addresses of the zone.
+func (p *Provider) upsertApex(ctx context.Context, zone string, v4, v6 []libdns.Record) ([]libdns.Record, error) {
+	if len(v4) > 1 || len(v6) > 1 {
+		return nil, fmt.Errorf("The apex of %s takes one address per family, got %d IPv4 and %d IPv6 addresses", zone, len(v4), len(v6))
+	}
+	if err := p.checkPolicy(zone, "write", append(append([]libdns.Record(nil), v4...), v6...)); err != nil {
+		return nil, err
+	}
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	// the addresses are compared with a fresh copy of the zone, as the
+	// cached one misses changes made elsewhere, e.g. in the web UI
+	z, err := p.client().GetZoneByName(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	p.storeZones(*z)
+	var update dynv6api.ZoneUpdate
+	var results []libdns.Record
+	if len(v4) == 1 {
+		ip := v4[0].(libdns.Address).IP
+		if z.IPv4Address != ip.String() {
+			update.IPv4Address = ip.String()
+		}
+		results = append(results, libdns.Address{Name: "@", TTL: p.TTL, IP: ip})
+	}
+	if len(v6) == 1 {
+		ip := v6[0].(libdns.Address).IP
+		if current, err := netip.ParseAddr(z.IPv6Prefix); err != nil || current != ip {
+			update.IPv6Prefix = ip.String()
+		}
+		results = append(results, libdns.Address{Name: "@", TTL: p.TTL, IP: ip})
+	}
+	if update == (dynv6api.ZoneUpdate{}) || optionsFrom(ctx).dryRun {
+		return results, nil
+	}
+	updated, err := p.client().UpdateZone(ctx, z.ID, update)
+	if err != nil {
+		return nil, err
+	}
+	p.storeZones(*updated)
+	return results, nil
+}
@@ -0,0 +1,175 @@
+package dynv6
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libdns/libdns"
+)
+
+// Kinds of an Operation.
+const (
+	OpAppend = "append"
+	OpSet    = "set"
+	OpDelete = "delete"
+)
+
+// Operation is a single AppendRecords, SetRecords or DeleteRecords call of
+// a batch passed to Apply.
+type Operation struct {
+	Kind    string
+	Zone    string
+	Records []libdns.Record
+}
+
+// ApplyError is returned by Apply. It tells exactly which operations of the
+// batch were committed before the failure.
+type ApplyError struct {
+	// Index of the operation which failed.
+	Index int
+	// Validation is set if the batch was rejected before anything was
+	// written.
+	Validation bool
+	// Committed are the operations which were fully applied.
+	Committed []Operation
+	// Partial are the records the failed operation changed before it
+	// failed.
+	Partial []libdns.Record
+	Err     error
+}
+
+func (e *ApplyError) Error() string {
+	if e.Validation {
+		return fmt.Sprintf("Operation %d is invalid, nothing was applied: %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("Operation %d failed after %d operation(s) and %d record(s) of it were applied: %v", e.Index, len(e.Committed), len(e.Partial), e.Err)
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// Apply runs a batch of operations, approximating a transaction on an API
+// which has none. Every operation is validated first: its zone must exist,
+// its records must convert to dynv6 records, it must not touch records
+// protected by dynv6 or the dangerous-delete guard, and deleted records must
+// exist once the earlier operations are applied. Only then are the
+// operations executed in order. Execution stops at the first failure; the
+// returned *ApplyError reports which operations were committed.
+func (p *Provider) Apply(ctx context.Context, ops []Operation) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	ctx = p.withRetryBudget(ctx)
+	if i, err := p.validate(ctx, ops); err != nil {
+		return &ApplyError{Index: i, Validation: true, Err: err}
+	}
+	for i, op := range ops {
+		var results []libdns.Record
+		var err error
+		switch op.Kind {
+		case OpAppend:
+			results, err = p.AppendRecords(ctx, op.Zone, op.Records)
+		case OpSet:
+			results, err = p.SetRecords(ctx, op.Zone, op.Records)
+		case OpDelete:
+			results, err = p.DeleteRecords(ctx, op.Zone, op.Records)
+		}
+		if err != nil {
+			return &ApplyError{Index: i, Committed: ops[:i:i], Partial: results, Err: err}
+		}
+	}
+	return nil
+}
+
+// validate checks the operations against a simulation of the zones. It
+// returns the index of the first invalid operation.
+func (p *Provider) validate(ctx context.Context, ops []Operation) (int, error) {
+	m := p.matcher(ctx)
+	zones := map[string][]libdns.RR{}
+	for i, op := range ops {
+		key := zoneKey(op.Zone)
+		current, ok := zones[key]
+		if !ok {
+			z, err := p.zone(ctx, op.Zone)
+			if err != nil {
+				return i, err
+			}
+			recs, err := p.records(ctx, z.ID)
+			if err != nil {
+				return i, err
+			}
+			for j := range recs {
+				current = append(current, toLibdnsRecord(&recs[j]).RR())
+			}
+		}
+		var err error
+		switch op.Kind {
+		case OpAppend, OpSet:
+			if err = p.checkWrites(op.Zone, op.Records); err != nil {
+				return i, err
+			}
+			if op.Kind == OpSet {
+				current = withoutRRSets(current, op.Records)
+			}
+			for _, r := range op.Records {
+				current = append(current, r.RR())
+			}
+		case OpDelete:
+			if err = p.checkDeletes(op.Records); err != nil {
+				return i, err
+			}
+			for _, r := range op.Records {
+				j := matchIndex(m, current, r.RR())
+				if j < 0 {
+					return i, fmt.Errorf("Record not found: %+v", r)
+				}
+				if err = p.checkPolicy(op.Zone, "delete", []libdns.Record{current[j]}); err != nil {
+					return i, err
+				}
+				current = append(current[:j], current[j+1:]...)
+			}
+		default:
+			return i, fmt.Errorf("Unknown operation %q", op.Kind)
+		}
+		zones[key] = current
+	}
+	return 0, nil
+}
+
+// checkWrites returns an error for the first record that can't be written.
+func (p *Provider) checkWrites(zone string, recs []libdns.Record) error {
+	recs = p.mapSPF(zone, recs)
+	if err := p.checkPolicy(zone, "write", recs); err != nil {
+		return err
+	}
+	for i := range recs {
+		if _, err := fromLibdnsRecord(zone, &recs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutRRSets removes the RRsets of recs from current.
+func withoutRRSets(current []libdns.RR, recs []libdns.Record) []libdns.RR {
+	replaced := map[rrsetKey]bool{}
+	for _, r := range recs {
+		replaced[keyOf(r.RR())] = true
+	}
+	var out []libdns.RR
+	for _, rr := range current {
+		if !replaced[keyOf(rr)] {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+func matchIndex(m Matcher, recs []libdns.RR, rr libdns.RR) int {
+	for i := range recs {
+		if m.Match(recs[i], rr) {
+			return i
+		}
+	}
+	return -1
+}
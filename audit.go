@@ -0,0 +1,174 @@
+package dynv6
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// Audit statuses of an RRset at a nameserver.
+const (
+	AuditOK       = "ok"       // the nameserver serves the records of the API
+	AuditMissing  = "missing"  // the nameserver serves no records of the RRset
+	AuditMismatch = "mismatch" // the nameserver serves other records
+	AuditError    = "error"    // the nameserver didn't answer
+)
+
+// AuditFinding compares an RRset of the API with the answer of a
+// nameserver.
+type AuditFinding struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Server string `json:"server"`
+	Status string `json:"status"`
+	// Want is the data of the RRset in the API, Got the data served.
+	Want  []string `json:"want"`
+	Got   []string `json:"got,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// AuditReport is the result of Audit.
+type AuditReport struct {
+	Zone     string         `json:"zone"`
+	Servers  []string       `json:"servers"`
+	Findings []AuditFinding `json:"findings"`
+}
+
+// OK reports whether every nameserver serves every RRset as the API
+// returns it.
+func (r *AuditReport) OK() bool {
+	for _, f := range r.Findings {
+		if f.Status != AuditOK {
+			return false
+		}
+	}
+	return true
+}
+
+// Problems returns the findings which aren't OK.
+func (r *AuditReport) Problems() []AuditFinding {
+	var problems []AuditFinding
+	for _, f := range r.Findings {
+		if f.Status != AuditOK {
+			problems = append(problems, f)
+		}
+	}
+	return problems
+}
+
+// Audit compares the records of the zone in the API with the answers of
+// nameservers, to find stale secondaries and serving issues. Every RRset
+// is queried at every resolver. Without resolvers, the nameservers the
+// zone's NS records at the dynv6 nameserver name are asked, or the dynv6
+// nameserver itself if those can't be found.
+func (p *Provider) Audit(ctx context.Context, zone string, resolvers []Resolver) (*AuditReport, error) {
+	recs, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	fqdn := dns.CanonicalName(zone)
+	if len(resolvers) == 0 {
+		resolvers = zoneNameservers(ctx, fqdn)
+	}
+	report := &AuditReport{Zone: strings.TrimSuffix(fqdn, ".")}
+	for i, r := range resolvers {
+		report.Servers = append(report.Servers, resolverName(r, i))
+	}
+	for _, s := range GroupRRSets(recs) {
+		qtype, ok := dns.StringToType[strings.ToUpper(s.Type)]
+		if !ok {
+			continue
+		}
+		var want []string
+		for _, r := range s.Records {
+			want = append(want, normalizeData(s.Type, r.RR().Data))
+		}
+		sort.Strings(want)
+		want = dedupe(want)
+		for i, resolver := range resolvers {
+			f := AuditFinding{Name: s.Name, Type: s.Type, Server: report.Servers[i], Want: want}
+			got, err := servedData(ctx, resolver, libdns.AbsoluteName(s.Name, fqdn), qtype)
+			switch {
+			case err != nil:
+				f.Status, f.Error = AuditError, err.Error()
+			case len(got) == 0:
+				f.Status = AuditMissing
+			case strings.Join(got, "\n") != strings.Join(want, "\n"):
+				f.Status, f.Got = AuditMismatch, got
+			default:
+				f.Status, f.Got = AuditOK, got
+			}
+			report.Findings = append(report.Findings, f)
+		}
+	}
+	return report, nil
+}
+
+// servedData returns the sorted, normalized data of the answers of type
+// qtype for name.
+func servedData(ctx context.Context, resolver Resolver, name string, qtype uint16) ([]string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	resp, err := resolver.Exchange(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("%s", dns.RcodeToString[resp.Rcode])
+	}
+	typ := dns.TypeToString[qtype]
+	var got []string
+	for _, ans := range resp.Answer {
+		if ans.Header().Rrtype == qtype {
+			got = append(got, normalizeData(typ, answerData(ans)))
+		}
+	}
+	sort.Strings(got)
+	return dedupe(got), nil
+}
+
+// zoneNameservers returns resolvers for the nameservers of zone, as named
+// by the dynv6 nameserver.
+func zoneNameservers(ctx context.Context, zone string) []Resolver {
+	fallback := []Resolver{DNSResolver(propagationServer)}
+	m := new(dns.Msg)
+	m.SetQuestion(zone, dns.TypeNS)
+	resp, err := DNSResolver(propagationServer).Exchange(ctx, m)
+	if err != nil {
+		return fallback
+	}
+	hosts := nsHosts(resp.Answer, zone)
+	if len(hosts) == 0 {
+		return fallback
+	}
+	resolvers := make([]Resolver, len(hosts))
+	for i, h := range hosts {
+		resolvers[i] = DNSResolver(h + ":53")
+	}
+	return resolvers
+}
+
+func resolverName(r Resolver, i int) string {
+	switch r := r.(type) {
+	case DNSResolver:
+		return string(r)
+	case fmt.Stringer:
+		return r.String()
+	}
+	return fmt.Sprintf("resolver %d", i+1)
+}
+
+// dedupe removes adjacent duplicates from sorted.
+func dedupe(sorted []string) []string {
+	out := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
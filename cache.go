@@ -0,0 +1,329 @@
+package dynv6
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+// defaultZoneCacheTTL is used when Provider.ZoneCacheTTL is zero. Zone IDs
+// practically never change, so they can be cached for a long time; a zone
+// the API no longer knows by its ID is evicted.
+const defaultZoneCacheTTL = time.Hour
+
+type cachedZone struct {
+	zone    dynv6api.Zone
+	expires time.Time
+}
+
+type cachedRecords struct {
+	records []dynv6api.Record
+	expires time.Time
+}
+
+// cache holds zone lookups and, if enabled, record listings.
+type cache struct {
+	mu      sync.Mutex
+	zones   map[string]cachedZone
+	records map[int64]cachedRecords
+	// gens counts the invalidations of the records of each zone, so a
+	// listing which was in flight during a change isn't cached.
+	gens    map[int64]uint64
+	flights flightGroup
+}
+
+// sharedCaches holds the caches of providers with SharedCache set, by token.
+var sharedCaches = struct {
+	sync.Mutex
+	byToken map[string]*cache
+}{byToken: map[string]*cache{}}
+
+// getCache returns the provider's cache, or the cache shared by all
+// providers with the same token.
+func (p *Provider) getCache() *cache {
+	if !p.SharedCache {
+		return &p.cache
+	}
+	sharedCaches.Lock()
+	defer sharedCaches.Unlock()
+	c, ok := sharedCaches.byToken[p.Token]
+	if !ok {
+		c = new(cache)
+		sharedCaches.byToken[p.Token] = c
+	}
+	return c
+}
+
+func zoneKey(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+func (p *Provider) zoneCacheTTL() time.Duration {
+	if p.ZoneCacheTTL == 0 {
+		return defaultZoneCacheTTL
+	}
+	return p.ZoneCacheTTL
+}
+
+// zone returns the zone with the given name, from the cache if possible.
+func (p *Provider) zone(ctx context.Context, name string) (*dynv6api.Zone, error) {
+	c := p.getCache()
+	key := zoneKey(name)
+	if ttl := p.zoneCacheTTL(); ttl > 0 {
+		c.mu.Lock()
+		cz, ok := c.zones[key]
+		c.mu.Unlock()
+		if ok && p.now().Before(cz.expires) {
+			p.stats.hit()
+			z := cz.zone
+			return &z, nil
+		}
+		p.stats.miss()
+	}
+	v, err, shared := c.flights.do(ctx, "zone:"+key, func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := p.withDeadline(ctx)
+		defer cancel()
+		return p.client().GetZoneByName(ctx, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if shared {
+		p.stats.coalesce()
+	}
+	z := *v.(*dynv6api.Zone)
+	p.storeZones(z)
+	return &z, nil
+}
+
+// ResolveZoneID returns the ID and name of the zone containing name, which
+// may be the zone itself or any name below it, e.g.
+// "_acme-challenge.www.example.dynv6.net". If several zones of the account
+// match, the longest wins. Resolved zones are cached like the lookups of the
+// libdns methods, so tools using the dynv6api client directly don't have to
+// list the zones before every request. The error is
+// dynv6api.ErrZoneNotFound if no zone matches.
+func (p *Provider) ResolveZoneID(ctx context.Context, name string) (int64, string, error) {
+	key := zoneKey(name)
+	if z, ok := p.cachedZoneOf(key); ok {
+		p.stats.hit()
+		return z.ID, z.Name, nil
+	}
+	p.stats.miss()
+	c := p.getCache()
+	v, err, shared := c.flights.do(ctx, "zones", func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := p.withDeadline(ctx)
+		defer cancel()
+		return p.client().ListZones(ctx)
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	if shared {
+		p.stats.coalesce()
+	}
+	zones := v.([]dynv6api.Zone)
+	p.storeZones(zones...)
+	var best *dynv6api.Zone
+	for i, z := range zones {
+		if inZone(key, zoneKey(z.Name)) && (best == nil || len(z.Name) > len(best.Name)) {
+			best = &zones[i]
+		}
+	}
+	if best == nil {
+		return 0, "", fmt.Errorf("No zone contains %s: %w", name, dynv6api.ErrZoneNotFound)
+	}
+	return best.ID, best.Name, nil
+}
+
+// cachedZoneOf returns the longest unexpired cached zone containing the
+// name key.
+func (p *Provider) cachedZoneOf(key string) (dynv6api.Zone, bool) {
+	if p.zoneCacheTTL() <= 0 {
+		return dynv6api.Zone{}, false
+	}
+	c := p.getCache()
+	now := p.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for suffix := key; suffix != ""; {
+		if cz, ok := c.zones[suffix]; ok && now.Before(cz.expires) {
+			return cz.zone, true
+		}
+		i := strings.IndexByte(suffix, '.')
+		if i < 0 {
+			break
+		}
+		suffix = suffix[i+1:]
+	}
+	return dynv6api.Zone{}, false
+}
+
+// inZone reports whether the name key is zone or below it.
+func inZone(key, zone string) bool {
+	return key == zone || strings.HasSuffix(key, "."+zone)
+}
+
+func (p *Provider) storeZones(zones ...dynv6api.Zone) {
+	c := p.getCache()
+	ttl := p.zoneCacheTTL()
+	if ttl <= 0 {
+		return
+	}
+	expires := p.now().Add(ttl)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.zones == nil {
+		c.zones = map[string]cachedZone{}
+	}
+	for _, z := range zones {
+		c.zones[zoneKey(z.Name)] = cachedZone{zone: z, expires: expires}
+	}
+}
+
+// records returns the records of a zone, from the cache if record caching
+// is enabled.
+func (p *Provider) records(ctx context.Context, zoneID int64) ([]dynv6api.Record, error) {
+	c := p.getCache()
+	if p.RecordCacheTTL > 0 {
+		c.mu.Lock()
+		cr, ok := c.records[zoneID]
+		c.mu.Unlock()
+		if ok && p.now().Before(cr.expires) {
+			p.stats.hit()
+			return append([]dynv6api.Record(nil), cr.records...), nil
+		}
+		p.stats.miss()
+	}
+	gen := p.recordsGen(zoneID)
+	v, err, shared := c.flights.do(ctx, recordsKey(zoneID), func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := p.withDeadline(ctx)
+		defer cancel()
+		return p.client().ListRecords(ctx, zoneID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	recs := v.([]dynv6api.Record)
+	if shared {
+		p.stats.coalesce()
+	}
+	p.storeRecords(zoneID, gen, recs)
+	// callers may modify the records, so each gets a copy and the cache
+	// keeps the listing
+	return append([]dynv6api.Record(nil), recs...), nil
+}
+
+func recordsKey(zoneID int64) string {
+	return "records:" + strconv.FormatInt(zoneID, 10)
+}
+
+// recordsGen returns the invalidation generation of the records of a zone,
+// to be passed to storeRecords.
+func (p *Provider) recordsGen(zoneID int64) uint64 {
+	c := p.getCache()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gens[zoneID]
+}
+
+// storeRecords caches the records of a zone, unless they were invalidated
+// since gen was taken before listing them. recs must not be modified
+// afterwards.
+func (p *Provider) storeRecords(zoneID int64, gen uint64, recs []dynv6api.Record) {
+	c := p.getCache()
+	if p.RecordCacheTTL <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gens[zoneID] != gen {
+		return
+	}
+	if c.records == nil {
+		c.records = map[int64]cachedRecords{}
+	}
+	c.records[zoneID] = cachedRecords{
+		records: recs,
+		expires: p.now().Add(p.RecordCacheTTL),
+	}
+}
+
+// evictStaleZones is a middleware dropping the cached zone and records of
+// a zone ID the API doesn't know, so a zone which was deleted and created
+// again is looked up by name on the next call instead of failing until the
+// cached ID expires.
+func (p *Provider) evictStaleZones(next dynv6api.Handler) dynv6api.Handler {
+	return func(call *dynv6api.Call) (*http.Response, error) {
+		resp, err := next(call)
+		if err == nil && resp.StatusCode == http.StatusNotFound {
+			parts := strings.Split(strings.Trim(call.Path, "/"), "/")
+			// /zones/{id} and /zones/{id}/records, not a single record
+			if len(parts) <= 3 && len(parts) >= 2 && parts[0] == "zones" {
+				if id, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+					p.evictZone(id)
+				}
+			}
+		}
+		return resp, err
+	}
+}
+
+// evictZone drops the cached zone with the ID and its records.
+func (p *Provider) evictZone(zoneID int64) {
+	c := p.getCache()
+	c.mu.Lock()
+	for key, cz := range c.zones {
+		if cz.zone.ID == zoneID {
+			delete(c.zones, key)
+		}
+	}
+	c.mu.Unlock()
+	p.invalidateRecords(zoneID)
+}
+
+// invalidateRecords drops the cached records of a zone after it was changed.
+func (p *Provider) invalidateRecords(zoneID int64) {
+	c := p.getCache()
+	c.mu.Lock()
+	delete(c.records, zoneID)
+	if c.gens == nil {
+		c.gens = map[int64]uint64{}
+	}
+	c.gens[zoneID]++
+	c.mu.Unlock()
+	c.flights.forget(recordsKey(zoneID))
+}
+
+// PrewarmZones fetches the zone list and caches it, so later calls don't
+// have to look up zone IDs. If record caching is enabled (RecordCacheTTL),
+// the records of every zone are fetched and cached as well. It is useful for
+// latency-sensitive callers, e.g. to avoid lookups during certificate
+// issuance.
+func (p *Provider) PrewarmZones(ctx context.Context) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	zones, err := p.client().ListZones(ctx)
+	if err != nil {
+		return err
+	}
+	p.storeZones(zones...)
+	if p.RecordCacheTTL <= 0 {
+		return nil
+	}
+	for _, z := range zones {
+		gen := p.recordsGen(z.ID)
+		recs, err := p.client().ListRecords(ctx, z.ID)
+		if err != nil {
+			return err
+		}
+		p.storeRecords(z.ID, gen, recs)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package dynv6
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// Capability is something the token can do, as probed by
+// VerifyCapabilities.
+type Capability string
+
+const (
+	// CapabilityRead is listing zones and records.
+	CapabilityRead Capability = "read"
+	// CapabilityWrite is creating records below the apex.
+	CapabilityWrite Capability = "write"
+	// CapabilityDelete is deleting records.
+	CapabilityDelete Capability = "delete"
+	// CapabilityApexWrite is creating records at the apex, e.g. for ACME
+	// challenges of the zone itself or SPF.
+	CapabilityApexWrite Capability = "apex-write"
+)
+
+// Capabilities are the capabilities in the order they are probed.
+var Capabilities = []Capability{CapabilityRead, CapabilityWrite, CapabilityDelete, CapabilityApexWrite}
+
+// ProbeRecordName is the name of the TXT records written by
+// VerifyCapabilities.
+const ProbeRecordName = "_dynv6-probe"
+
+// CapabilityReport is the result of VerifyCapabilities.
+type CapabilityReport struct {
+	// Zones are the accessible zones.
+	Zones []string
+
+	// TestZone is the zone the probe records were written to.
+	TestZone string
+
+	// Errors holds why each missing capability is missing. Capabilities
+	// which depend on a missing one aren't probed and are reported missing
+	// too.
+	Errors map[Capability]error
+}
+
+// Has reports whether the token has the capability.
+func (r *CapabilityReport) Has(c Capability) bool {
+	_, missing := r.Errors[c]
+	return !missing
+}
+
+// Err returns an error listing the missing capabilities, or nil if there
+// are none.
+func (r *CapabilityReport) Err() error {
+	var missing []string
+	for _, c := range Capabilities {
+		if err, ok := r.Errors[c]; ok {
+			missing = append(missing, fmt.Sprintf("%s: %v", c, err))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("Missing capabilities: %s", strings.Join(missing, "; "))
+}
+
+// VerifyCapabilities checks what the token may do before going live: it
+// lists the zones and the records of testZone, then creates and deletes a
+// TXT record named ProbeRecordName and one at the apex of testZone. Use a
+// zone dedicated to testing; testZone is required, so records are never
+// written to a production zone by accident. The returned error is the
+// report's Err.
+func (p *Provider) VerifyCapabilities(ctx context.Context, testZone string) (*CapabilityReport, error) {
+	if testZone == "" {
+		return nil, fmt.Errorf("A test zone is required to verify the capabilities, the probe records are written to it")
+	}
+	r := &CapabilityReport{TestZone: testZone, Errors: map[Capability]error{}}
+	// without reading, nothing else is probed
+	noRead := func(err error) (*CapabilityReport, error) {
+		for _, c := range Capabilities {
+			r.Errors[c] = err
+		}
+		return r, r.Err()
+	}
+	zones, err := p.ListZones(ctx)
+	if err != nil {
+		return noRead(err)
+	}
+	for _, z := range zones {
+		r.Zones = append(r.Zones, strings.TrimSuffix(z.Name, "."))
+	}
+	sort.Strings(r.Zones)
+	if _, err := p.GetRecords(ctx, r.TestZone); err != nil {
+		return noRead(err)
+	}
+
+	if err := p.probe(ctx, r.TestZone, ProbeRecordName); err != nil {
+		if _, deleting := err.(probeDeleteError); deleting {
+			r.Errors[CapabilityDelete] = err
+		} else {
+			r.Errors[CapabilityWrite] = err
+			r.Errors[CapabilityDelete] = fmt.Errorf("Not probed, creating the probe record failed")
+		}
+		r.Errors[CapabilityApexWrite] = fmt.Errorf("Not probed, %s failed", ProbeRecordName)
+		return r, r.Err()
+	}
+	if err := p.probe(ctx, r.TestZone, "@"); err != nil {
+		if _, deleting := err.(probeDeleteError); deleting {
+			err = fmt.Errorf("Deleting the probe record at the apex failed, it is left over: %v", err)
+		}
+		r.Errors[CapabilityApexWrite] = err
+	}
+	return r, r.Err()
+}
+
+type probeDeleteError struct{ error }
+
+// probe creates and deletes a TXT record with a random text.
+func (p *Provider) probe(ctx context.Context, zone, name string) error {
+	b := make([]byte, 8)
+	rand.Read(b)
+	rec := libdns.TXT{Name: name, Text: "dynv6 capability probe " + hex.EncodeToString(b)}
+	if _, err := p.AppendRecords(ctx, zone, []libdns.Record{rec}); err != nil {
+		return err
+	}
+	if _, err := p.DeleteRecords(ctx, zone, []libdns.Record{rec}); err != nil {
+		return probeDeleteError{err}
+	}
+	return nil
+}
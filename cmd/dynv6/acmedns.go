@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libdns/dynv6/acmedns"
+	"github.com/libdns/dynv6/health"
+)
+
+func runACMEDNS(ctx context.Context, args []string) error {
+	fs := newFlagSet("acme-dns")
+	p := providerFlags(fs)
+	listen := fs.String("listen", ":8080", "address to serve the acme-dns API on")
+	sf := addServerFlags(fs)
+	zone := fs.String("zone", "", "dynv6 zone in which account subdomains are created")
+	store := fs.String("store", "acme-dns.json", "file the registered accounts are stored in")
+	ttl := fs.Duration("ttl", 0, "TTL of the published TXT records (default 1m)")
+	adjustTTL := fs.Bool("adjust-ttl", false, "lower a TTL too long for challenges instead of only warning")
+	drainTimeout := fs.Duration("drain-timeout", 30*time.Second, "how long requests in progress may take to finish after SIGTERM")
+	noRegister := fs.Bool("disable-registration", false, "disable the /register endpoint")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	if *zone == "" {
+		return fmt.Errorf("no zone given, use -zone")
+	}
+	cfg, err := sf.tlsConfig()
+	if err != nil {
+		return err
+	}
+	srv := &acmedns.Server{
+		Provider:            p,
+		Zone:                *zone,
+		Store:               &acmedns.FileStore{Path: *store},
+		DisableRegistration: *noRegister,
+		TTL:                 *ttl,
+		AdjustTTL:           *adjustTTL,
+		Health:              &health.Checker{API: p},
+		Auth:                sf.auth(),
+		TLSConfig:           cfg,
+		AccessLog:           sf.logger(),
+		RateLimit:           sf.limiter(),
+		DrainTimeout:        *drainTimeout,
+	}
+	return srv.ListenAndServe(ctx, *listen)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/libdns/dynv6"
+)
+
+func runAudit(ctx context.Context, args []string) error {
+	fs := newFlagSet("audit")
+	p := providerFlags(fs)
+	format := fs.String("format", "text", "output format: text, listing the problems, or json, the whole report")
+	var resolvers stringsFlag
+	fs.Var(&resolvers, "resolver", "nameserver or DNS-over-HTTPS URL to compare with (repeatable, default the nameservers of the zone)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dynv6 audit [flags] <zone>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	args = zoneArgs(fs, 1)
+	if len(args) != 1 {
+		fs.Usage()
+		return usageErrorf("expected exactly one zone")
+	}
+	switch *format {
+	case "text", "json":
+	default:
+		return usageErrorf("unknown format %q", *format)
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	var rs []dynv6.Resolver
+	for _, r := range resolvers {
+		rs = append(rs, dynv6.ParseResolver(r))
+	}
+	report, err := p.Audit(ctx, args[0], rs)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printAudit(os.Stdout, report)
+	}
+	if problems := report.Problems(); len(problems) > 0 {
+		return withCode(exitDrift, fmt.Errorf("%d of %d answers differ from the API", len(problems), len(report.Findings)))
+	}
+	return nil
+}
+
+func printAudit(w io.Writer, r *dynv6.AuditReport) {
+	for _, f := range r.Problems() {
+		fmt.Fprintf(w, "%s %s at %s: %s", f.Name, f.Type, f.Server, f.Status)
+		switch f.Status {
+		case dynv6.AuditError:
+			fmt.Fprintf(w, ": %s", f.Error)
+		case dynv6.AuditMismatch:
+			fmt.Fprintf(w, ", API has %s, served %s", strings.Join(f.Want, ", "), strings.Join(f.Got, ", "))
+		case dynv6.AuditMissing:
+			fmt.Fprintf(w, ", API has %s", strings.Join(f.Want, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%d answers from %s checked, %d problems\n", len(r.Findings), strings.Join(r.Servers, ", "), len(r.Problems()))
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+// benchOp collects the latencies of one operation of dynv6 bench.
+type benchOp struct {
+	name    string
+	times   []time.Duration
+	errors  int
+	lastErr error
+}
+
+func (o *benchOp) run(f func() error) error {
+	start := time.Now()
+	err := f()
+	o.times = append(o.times, time.Since(start))
+	if err != nil {
+		o.errors++
+		o.lastErr = err
+	}
+	return err
+}
+
+// percentile returns the q-th quantile of the sorted durations, by the
+// nearest rank.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func printBench(w io.Writer, ops []*benchOp) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATION\tN\tERRORS\tMIN\tMEDIAN\tP90\tMAX")
+	for _, o := range ops {
+		if len(o.times) == 0 {
+			continue
+		}
+		sorted := append([]time.Duration(nil), o.times...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%v\t%v\t%v\t%v\n", o.name, len(sorted), o.errors,
+			sorted[0].Round(time.Millisecond), percentile(sorted, 0.5).Round(time.Millisecond),
+			percentile(sorted, 0.9).Round(time.Millisecond), sorted[len(sorted)-1].Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, o := range ops {
+		if o.lastErr != nil {
+			fmt.Fprintf(w, "last %s error: %v\n", o.name, o.lastErr)
+		}
+	}
+	return nil
+}
+
+func runBench(ctx context.Context, args []string) error {
+	fs := newFlagSet("bench")
+	p := providerFlags(fs)
+	n := fs.Int("n", 10, "number of iterations")
+	noWrite := fs.Bool("no-write", false, "skip creating, updating and deleting a TXT record")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dynv6 bench [flags] <zone>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	args = zoneArgs(fs, 1)
+	if len(args) != 1 {
+		fs.Usage()
+		return usageErrorf("expected exactly one zone")
+	}
+	if *n < 1 {
+		return usageErrorf("-n must be at least 1")
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	zone := strings.TrimSuffix(args[0], ".")
+	// requests aren't retried, so the errors and latencies are those of
+	// single requests
+	c := &dynv6api.Client{Token: p.Token, BaseURL: p.BaseURL, Version: p.APIVersion, Middleware: p.Middleware, RetryPolicy: dynv6api.NoRetry}
+	base := p.BaseURL
+	if base == "" {
+		base = dynv6api.DefaultBaseURL
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return usageErrorf("invalid base URL: %v", err)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var (
+		connect = &benchOp{name: "tcp connect"}
+		lookup  = &benchOp{name: "zone lookup"}
+		list    = &benchOp{name: "record list"}
+		create  = &benchOp{name: "record create"}
+		update  = &benchOp{name: "record update"}
+		del     = &benchOp{name: "record delete"}
+	)
+	ops := []*benchOp{connect, lookup, list, create, update, del}
+	var zoneID int64
+	for i := 0; i < *n && ctx.Err() == nil; i++ {
+		// the connect time is the round trip of the network, without dynv6
+		connect.run(func() error {
+			conn, err := (&net.Dialer{Timeout: 10 * time.Second}).DialContext(ctx, "tcp", addr)
+			if err == nil {
+				conn.Close()
+			}
+			return err
+		})
+		lookup.run(func() error {
+			z, err := c.GetZoneByName(ctx, zone)
+			if err == nil {
+				zoneID = z.ID
+			}
+			return err
+		})
+		if zoneID == 0 {
+			continue
+		}
+		list.run(func() error {
+			_, err := c.ListRecords(ctx, zoneID)
+			return err
+		})
+		if *noWrite {
+			continue
+		}
+		var rec *dynv6api.Record
+		if create.run(func() error {
+			var err error
+			rec, err = c.CreateRecord(ctx, zoneID, dynv6api.Record{Type: "TXT", Name: "_dynv6-bench", Data: benchToken()})
+			return err
+		}) != nil {
+			continue
+		}
+		update.run(func() error {
+			_, err := c.UpdateRecord(ctx, zoneID, rec.ID, dynv6api.Record{Type: "TXT", Name: "_dynv6-bench", Data: benchToken()})
+			return err
+		})
+		del.run(func() error {
+			// delete the record even if the benchmark was interrupted
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			return c.DeleteRecord(ctx, zoneID, rec.ID)
+		})
+	}
+	if err := printBench(os.Stdout, ops); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var failed, total int
+	for _, o := range ops[1:] {
+		failed += o.errors
+		total += len(o.times)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d requests failed", failed, total)
+	}
+	return nil
+}
+
+func benchToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
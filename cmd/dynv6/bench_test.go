@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/dynv6/testutil"
+)
+
+func TestBench(t *testing.T) {
+	api, url := testutil.NewServer(t)
+	api.AddZone(1, "example.dynv6.net")
+	if err := runBench(context.Background(), []string{"-token", "test", "-base-url", url, "-n", "3", "example.dynv6.net"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.CallCount("POST /zones/1/records"); got != 3 {
+		t.Errorf("got %d records created, want 3", got)
+	}
+	api.Lock()
+	left := api.Records[1]
+	api.Unlock()
+	if len(left) != 0 {
+		t.Errorf("bench left records behind: %v", left)
+	}
+
+	if err := runBench(context.Background(), []string{"-token", "test", "-base-url", url, "-n", "1", "missing.dynv6.net"}); err == nil {
+		t.Error("got no error for a missing zone")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if got := percentile(sorted, 0.5); got != 5 {
+		t.Errorf("median: got %d", got)
+	}
+	if got := percentile(sorted, 0.9); got != 9 {
+		t.Errorf("p90: got %d", got)
+	}
+	if got := percentile(sorted[:1], 0.9); got != 1 {
+		t.Errorf("p90 of one: got %d", got)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+// diskCache keeps zone and record listings between invocations, so scripts
+// calling the CLI repeatedly don't list the zones on every run.
+type diskCache struct {
+	path    string
+	ttl     time.Duration
+	read    bool // use cached entries
+	write   bool // store fetched entries
+	changed bool
+
+	Zones   *cachedZones             `json:"zones,omitempty"`
+	Records map[string]cachedRecords `json:"records,omitempty"`
+}
+
+type cachedZones struct {
+	Fetched time.Time       `json:"fetched"`
+	Zones   []dynv6api.Zone `json:"zones"`
+}
+
+type cachedRecords struct {
+	Fetched time.Time         `json:"fetched"`
+	ZoneID  int64             `json:"zone_id"`
+	Records []dynv6api.Record `json:"records"`
+}
+
+type cacheFlags struct {
+	noCache bool
+	refresh bool
+	ttl     time.Duration
+}
+
+func addCacheFlags(fs *flag.FlagSet) *cacheFlags {
+	cf := new(cacheFlags)
+	fs.BoolVar(&cf.noCache, "no-cache", false, "neither read nor write the on-disk cache")
+	fs.BoolVar(&cf.refresh, "refresh", false, "ignore cached entries and refresh them")
+	fs.DurationVar(&cf.ttl, "cache-ttl", 5*time.Minute, "how long cached listings are used")
+	return cf
+}
+
+// openCache loads the cache file for the given token. Errors reading the
+// cache are ignored; the cache is only an optimization.
+func (cf *cacheFlags) open(token string) *diskCache {
+	c := &diskCache{
+		ttl:   cf.ttl,
+		read:  !cf.noCache && !cf.refresh,
+		write: !cf.noCache,
+	}
+	if cf.noCache {
+		return c
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		c.write = false
+		return c
+	}
+	// one file per token, so accounts don't mix
+	sum := sha256.Sum256([]byte(token))
+	c.path = filepath.Join(dir, "dynv6", "cache-"+hex.EncodeToString(sum[:8])+".json")
+	if b, err := ioutil.ReadFile(c.path); err == nil {
+		json.Unmarshal(b, c)
+	}
+	return c
+}
+
+func (c *diskCache) fresh(fetched time.Time) bool {
+	return c.read && time.Since(fetched) < c.ttl
+}
+
+func (c *diskCache) zones() ([]dynv6api.Zone, bool) {
+	if c.Zones == nil || !c.fresh(c.Zones.Fetched) {
+		return nil, false
+	}
+	return c.Zones.Zones, true
+}
+
+func (c *diskCache) putZones(zones []dynv6api.Zone) {
+	c.Zones = &cachedZones{Fetched: time.Now(), Zones: zones}
+	c.changed = true
+}
+
+// zoneID returns the cached ID of the named zone.
+func (c *diskCache) zoneID(name string) (int64, bool) {
+	zones, ok := c.zones()
+	if !ok {
+		return 0, false
+	}
+	name = strings.TrimSuffix(name, ".")
+	for _, z := range zones {
+		if strings.EqualFold(z.Name, name) {
+			return z.ID, true
+		}
+	}
+	return 0, false
+}
+
+func (c *diskCache) records(zone string) (cachedRecords, bool) {
+	cr, ok := c.Records[strings.TrimSuffix(zone, ".")]
+	if !ok || !c.fresh(cr.Fetched) {
+		return cachedRecords{}, false
+	}
+	return cr, true
+}
+
+func (c *diskCache) putRecords(zone string, zoneID int64, recs []dynv6api.Record) {
+	if c.Records == nil {
+		c.Records = map[string]cachedRecords{}
+	}
+	c.Records[strings.TrimSuffix(zone, ".")] = cachedRecords{Fetched: time.Now(), ZoneID: zoneID, Records: recs}
+	c.changed = true
+}
+
+// invalidate drops the cached records of a zone after it was changed.
+func (c *diskCache) invalidate(zone string) {
+	if _, ok := c.Records[strings.TrimSuffix(zone, ".")]; ok {
+		delete(c.Records, strings.TrimSuffix(zone, "."))
+		c.changed = true
+	}
+}
+
+// save writes the cache file if anything changed.
+func (c *diskCache) save() error {
+	if !c.write || !c.changed || c.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
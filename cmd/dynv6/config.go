@@ -0,0 +1,315 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The configuration file defines named profiles, e.g. one per dynv6
+// account. It is written in YAML or, with a .toml extension, TOML; only
+// mappings of plain values are supported:
+//
+//	default: home
+//	profiles:
+//	  home:
+//	    token_file: ~/.config/dynv6/home.token
+//	    zone: home.dynv6.net
+//	  work:
+//	    token_env: WORK_DYNV6_TOKEN
+//	    error_format: json
+//
+// A profile may set its token directly with token, or read it from a file
+// (token_file) or an environment variable (token_env). zone is used by
+// commands when the zone argument is omitted. The other keys are the names
+// of command line flags except the explicitFlags, with underscores instead
+// of dashes; flags given on the command line take precedence.
+
+// defaultZone is the zone of the selected profile.
+var defaultZone string
+
+type config struct {
+	path     string
+	Default  string
+	Profiles map[string]map[string]string
+}
+
+func configPath() string {
+	if path := os.Getenv("DYNV6_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"config.yaml", "config.yml", "config.toml"} {
+		path := filepath.Join(dir, "dynv6", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadConfig reads the configuration file. A missing file is an empty
+// configuration.
+func loadConfig(path string) (*config, error) {
+	c := &config{path: path, Profiles: map[string]map[string]string{}}
+	if path == "" {
+		return c, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && os.Getenv("DYNV6_CONFIG") == "" {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]configValue
+	if strings.HasSuffix(path, ".toml") {
+		values, err = parseTOML(string(b))
+	} else {
+		values, err = parseYAML(string(b))
+	}
+	if err != nil {
+		return nil, validationError(fmt.Errorf("%s:%v", path, err))
+	}
+	for key, v := range values {
+		parts := strings.SplitN(key, ".", 3)
+		switch {
+		case key == "default":
+			c.Default = v.value
+		case len(parts) == 3 && parts[0] == "profiles":
+			if c.Profiles[parts[1]] == nil {
+				c.Profiles[parts[1]] = map[string]string{}
+			}
+			c.Profiles[parts[1]][parts[2]] = v.value
+		default:
+			return nil, validationError(fmt.Errorf("%s:%d: unknown setting %q", path, v.line, key))
+		}
+	}
+	return c, nil
+}
+
+// envName returns the environment variable setting a flag, e.g.
+// DYNV6_RETRY_BUDGET for -retry-budget.
+func envName(flagName string) string {
+	return "DYNV6_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// explicitFlags skip the confirmation or allow destructive changes. They
+// are only taken from the command line, so a variable left over in a shell
+// or a container, or a default profile, can't turn them on for every
+// invocation.
+var explicitFlags = map[string]bool{"yes": true, "prune": true, "allow-dangerous": true}
+
+// applyEnv sets the flags of fs which weren't given on the command line
+// from their environment variables, except the explicitFlags, whose
+// variables are an error. It returns the flags it set.
+func applyEnv(fs *flag.FlagSet, set map[string]bool) (map[string]bool, error) {
+	fromEnv := map[string]bool{}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v := os.Getenv(envName(f.Name))
+		if set[f.Name] || v == "" || err != nil {
+			return
+		}
+		if explicitFlags[f.Name] {
+			err = usageErrorf("%s: -%s can only be given on the command line", envName(f.Name), f.Name)
+			return
+		}
+		if setErr := fs.Set(f.Name, v); setErr != nil {
+			err = usageErrorf("%s: %v", envName(f.Name), setErr)
+		}
+		fromEnv[f.Name] = true
+	})
+	return fromEnv, err
+}
+
+// applyProfile sets the flags of fs from the selected profile. Flags given
+// on the command line win over the profile. Environment variables win over
+// the default profile, but not over a profile selected explicitly.
+func applyProfile(fs *flag.FlagSet, set, fromEnv map[string]bool) error {
+	name := fs.Lookup("profile").Value.String()
+	explicit := set["profile"] || fromEnv["profile"]
+	c, err := loadConfig(configPath())
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = c.Default
+	}
+	if name == "" {
+		return nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return usageErrorf("unknown profile %q", name)
+	}
+	keys := make([]string, 0, len(profile))
+	for key := range profile {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := profile[key]
+		switch key {
+		case "zone":
+			defaultZone = value
+			continue
+		case "token_file":
+			b, err := ioutil.ReadFile(expandHome(value))
+			if err != nil {
+				return err
+			}
+			key, value = "token", strings.TrimSpace(string(b))
+		case "token_env":
+			key, value = "token", os.Getenv(value)
+		}
+		flagName := strings.ReplaceAll(key, "_", "-")
+		if fs.Lookup(flagName) == nil {
+			// settings of other commands
+			continue
+		}
+		if explicitFlags[flagName] {
+			return usageErrorf("profile %s: %s: -%s can only be given on the command line", name, key, flagName)
+		}
+		given, env := set[flagName], fromEnv[flagName]
+		if flagName == "token" {
+			given = given || set["token-file"]
+			env = env || fromEnv["token-file"]
+		}
+		if given || env && !explicit {
+			continue
+		}
+		if err := fs.Set(flagName, value); err != nil {
+			return usageErrorf("profile %s: %s: %v", name, key, err)
+		}
+	}
+	return nil
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// zoneArgs returns the arguments of a command taking the zone as its first
+// of n arguments. If the zone is omitted, the zone of the profile is used.
+func zoneArgs(fs *flag.FlagSet, n int) []string {
+	args := fs.Args()
+	if len(args) == n-1 && defaultZone != "" {
+		args = append([]string{defaultZone}, args...)
+	}
+	return args
+}
+
+type configValue struct {
+	value string
+	line  int
+}
+
+// parseYAML parses nested mappings of plain values into dotted keys.
+func parseYAML(s string) (map[string]configValue, error) {
+	values := map[string]configValue{}
+	type level struct {
+		indent int
+		key    string
+	}
+	var stack []level
+	for i, line := range strings.Split(s, "\n") {
+		text := strings.TrimRight(stripComment(line), " \t\r")
+		if strings.TrimSpace(text) == "" || text == "---" {
+			continue
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		text = strings.TrimSpace(text)
+		if strings.HasPrefix(text, "- ") || strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("%d: lists and tabs are not supported", i+1)
+		}
+		colon := strings.Index(text, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("%d: expected key: value", i+1)
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		key := unquoteConfig(strings.TrimSpace(text[:colon]))
+		value := strings.TrimSpace(text[colon+1:])
+		if value == "" {
+			stack = append(stack, level{indent, key})
+			continue
+		}
+		path := key
+		for j := len(stack) - 1; j >= 0; j-- {
+			path = stack[j].key + "." + path
+		}
+		values[path] = configValue{unquoteConfig(value), i + 1}
+	}
+	return values, nil
+}
+
+// parseTOML parses tables of plain values into dotted keys.
+func parseTOML(s string) (map[string]configValue, error) {
+	values := map[string]configValue{}
+	var table string
+	for i, line := range strings.Split(s, "\n") {
+		text := strings.TrimSpace(stripComment(line))
+		switch {
+		case text == "":
+			continue
+		case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+			table = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		}
+		eq := strings.Index(text, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("%d: expected key = value", i+1)
+		}
+		key := unquoteConfig(strings.TrimSpace(text[:eq]))
+		if table != "" {
+			key = table + "." + key
+		}
+		values[key] = configValue{unquoteConfig(strings.TrimSpace(text[eq+1:])), i + 1}
+	}
+	return values, nil
+}
+
+// stripComment removes a # comment which isn't part of a quoted value.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquoteConfig(s string) string {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1]
+	}
+	if len(s) >= 2 && s[0] == '"' {
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+	}
+	return s
+}
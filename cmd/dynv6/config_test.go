@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+func TestParseConfig(t *testing.T) {
+	yaml := `# accounts
+default: home
+profiles:
+  home:
+    token: "abc#def" # quoted, the # is part of the token
+    zone: home.dynv6.net
+  work:
+    token_env: WORK_TOKEN
+`
+	toml := `default = "home"
+
+[profiles.home]
+token = "abc#def" # quoted, the # is part of the token
+zone = 'home.dynv6.net'
+
+[profiles.work]
+token_env = "WORK_TOKEN"
+`
+	want := map[string]string{
+		"default":                 "home",
+		"profiles.home.token":     "abc#def",
+		"profiles.home.zone":      "home.dynv6.net",
+		"profiles.work.token_env": "WORK_TOKEN",
+	}
+	for name, parse := range map[string]func(string) (map[string]configValue, error){"yaml": parseYAML, "toml": parseTOML} {
+		src := yaml
+		if name == "toml" {
+			src = toml
+		}
+		values, err := parse(src)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got := map[string]string{}
+		for k, v := range values {
+			got[k] = v.value
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+	if _, err := parseYAML("profiles:\n  - home\n"); err == nil {
+		t.Error("accepted a list")
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	tokenFile := filepath.Join(dir, "work.token")
+	ioutil.WriteFile(tokenFile, []byte("work-token\n"), 0o600)
+	ioutil.WriteFile(path, []byte("default: home\nprofiles:\n  home:\n    token: home-token\n    zone: home.dynv6.net\n  work:\n    token_file: "+tokenFile+"\n    retry_budget: 3\n  careless:\n    token: x\n    yes: true\n"), 0o600)
+	t.Setenv("DYNV6_CONFIG", path)
+	t.Setenv("DYNV6_TOKEN", "")
+	t.Setenv("DYNV6_PROFILE", "")
+	defer func() { defaultZone = "" }()
+
+	fs := newFlagSet("test")
+	p := providerFlags(fs)
+	if err := parseFlags(fs, nil); err != nil {
+		t.Fatal(err)
+	}
+	if p.Token != "home-token" || defaultZone != "home.dynv6.net" {
+		t.Fatalf("default profile not applied: token %q, zone %q", p.Token, defaultZone)
+	}
+
+	fs = newFlagSet("test")
+	p = providerFlags(fs)
+	if err := parseFlags(fs, []string{"-profile", "work", "-retry-budget", "7"}); err != nil {
+		t.Fatal(err)
+	}
+	if p.Token != "work-token" || p.RetryBudget != 7 {
+		t.Fatalf("got token %q, retry budget %d", p.Token, p.RetryBudget)
+	}
+
+	fs = newFlagSet("test")
+	providerFlags(fs)
+	yes := fs.Bool("yes", false, "")
+	if err := parseFlags(fs, []string{"-profile", "careless"}); exitCode(err) != exitUsage || *yes {
+		t.Fatalf("got %v, %v for yes in a profile", err, *yes)
+	}
+
+	fs = newFlagSet("test")
+	providerFlags(fs)
+	if err := parseFlags(fs, []string{"-profile", "missing"}); exitCode(err) != exitUsage {
+		t.Fatalf("got %v for an unknown profile", err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	ioutil.WriteFile(path, nil, 0o600)
+	t.Setenv("DYNV6_CONFIG", path)
+	t.Setenv("DYNV6_TOKEN", "env-token")
+	t.Setenv("DYNV6_RETRY_MAX_ATTEMPTS", "2")
+	t.Setenv("DYNV6_BASE_URL", "http://localhost/api")
+	fs := newFlagSet("test")
+	p := providerFlags(fs)
+	if err := parseFlags(fs, []string{"-retry-max-attempts", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	backoff := p.RetryPolicy.(*dynv6api.ExponentialBackoff)
+	if p.Token != "env-token" || p.BaseURL != "http://localhost/api" || backoff.MaxAttempts != 3 {
+		t.Fatalf("got token %q, base URL %q, %d attempts", p.Token, p.BaseURL, backoff.MaxAttempts)
+	}
+
+	t.Setenv("DYNV6_RETRY_BUDGET", "many")
+	if err := parseFlags(newFlagSetWithProvider(), nil); exitCode(err) != exitUsage {
+		t.Fatalf("got %v for an invalid variable", err)
+	}
+	t.Setenv("DYNV6_RETRY_BUDGET", "")
+
+	// confirmations and destructive switches must be given explicitly
+	for _, name := range []string{"yes", "prune", "allow-dangerous"} {
+		t.Setenv(envName(name), "true")
+		fs := newFlagSetWithProvider()
+		v := fs.Bool(name, false, "")
+		if err := parseFlags(fs, nil); exitCode(err) != exitUsage || *v {
+			t.Fatalf("%s: got %v, %v from the environment", name, err, *v)
+		}
+		if err := parseFlags(fs, []string{"-" + name}); err != nil || !*v {
+			t.Fatalf("-%s: got %v, %v on the command line", name, err, *v)
+		}
+		t.Setenv(envName(name), "")
+	}
+}
+
+func newFlagSetWithProvider() *flag.FlagSet {
+	fs := newFlagSet("test")
+	providerFlags(fs)
+	return fs
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/libdns/dynv6/accesslog"
+	"github.com/libdns/dynv6/health"
+	"github.com/libdns/dynv6/httpauth"
+	"github.com/libdns/dynv6/internal/servetls"
+	"github.com/libdns/dynv6/manifest"
+	"github.com/libdns/dynv6/metrics"
+	"github.com/libdns/dynv6/ratelimit"
+)
+
+// runDaemon runs the reconciler until the context is done. With addr set,
+// its metrics and health checks are served on /metrics, /healthz and
+// /readyz, next to the handlers already registered on mux, secured by sf.
+func runDaemon(ctx context.Context, r *manifest.Reconciler, addr string, mux *http.ServeMux, sf *serverFlags) error {
+	m := &manifest.Metrics{Provider: r.Provider}
+	hc := &health.Checker{API: r.Provider, MaxAge: 3 * r.Interval}
+	onReport := r.OnReport
+	r.OnReport = func(rep manifest.Report) {
+		if onReport != nil {
+			onReport(rep)
+		}
+		m.Observe(rep)
+		hc.Observe(rep.Err)
+	}
+	mux.Handle("/metrics", metrics.Handler(m.Collect))
+	hc.Register(mux)
+	cfg, err := sf.tlsConfig()
+	if err != nil {
+		return err
+	}
+	return serveWhile(ctx, addr, sf.handler(mux), cfg, r.Run)
+}
+
+// serveWhile calls run and, with addr set, serves handler on addr until
+// run returns, with TLS if cfg is set. A canceled context is a normal
+// shutdown.
+func serveWhile(ctx context.Context, addr string, handler http.Handler, cfg *tls.Config, run func(context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var srv *http.Server
+	errc := make(chan error, 1)
+	if addr != "" {
+		srv = &http.Server{Addr: addr, Handler: handler, TLSConfig: cfg}
+		go func() {
+			if cfg != nil {
+				errc <- srv.ListenAndServeTLS("", "")
+			} else {
+				errc <- srv.ListenAndServe()
+			}
+			cancel()
+		}()
+	}
+	err := run(ctx)
+	if srv != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+		if serveErr := <-errc; serveErr != http.ErrServerClosed {
+			return serveErr
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// trafficFlags are the flags logging and limiting the requests to the
+// server of a command.
+type trafficFlags struct {
+	accessLog bool
+	rate      float64
+	burst     int
+}
+
+func addTrafficFlags(fs *flag.FlagSet) *trafficFlags {
+	f := new(trafficFlags)
+	fs.BoolVar(&f.accessLog, "access-log", false, "log every request to stderr in logfmt")
+	fs.Float64Var(&f.rate, "rate-limit", 0, "requests per second allowed per client, 0 for no limit")
+	fs.IntVar(&f.burst, "rate-burst", 0, "requests a client may send at once (default -rate-limit rounded up)")
+	return f
+}
+
+// logger returns the access log, or nil if disabled.
+func (f *trafficFlags) logger() *log.Logger {
+	if !f.accessLog {
+		return nil
+	}
+	return log.New(os.Stderr, "", 0)
+}
+
+// limiter returns the rate limiter, or nil if disabled.
+func (f *trafficFlags) limiter() *ratelimit.Limiter {
+	if f.rate <= 0 {
+		return nil
+	}
+	return &ratelimit.Limiter{Rate: f.rate, Burst: f.burst}
+}
+
+// serverFlags are the flags securing the HTTP server of a command.
+type serverFlags struct {
+	*trafficFlags
+	clients []httpauth.Client
+	tls     servetls.Options
+	// exempt are further paths served without authentication, because
+	// their handlers check a secret of their own
+	exempt []string
+}
+
+// addServerFlags adds the flags authenticating the clients of the HTTP
+// server of a command and serving it with TLS.
+func addServerFlags(fs *flag.FlagSet) *serverFlags {
+	f := &serverFlags{trafficFlags: addTrafficFlags(fs)}
+	add := func(v string, secret bool) error {
+		id, cred, err := httpauth.ParseClient(v)
+		if err != nil {
+			return err
+		}
+		c := httpauth.Client{ID: id, Token: cred}
+		if secret {
+			c = httpauth.Client{ID: id, Secret: cred}
+		}
+		f.clients = append(f.clients, c)
+		return nil
+	}
+	fs.Func("auth-token", "require requests to carry a bearer token, as client-id=token (repeatable)", func(v string) error {
+		return add(v, false)
+	})
+	fs.Func("auth-secret", "require requests to be signed with a shared HMAC secret, as client-id=secret (repeatable)", func(v string) error {
+		return add(v, true)
+	})
+	fs.StringVar(&f.tls.CertFile, "tls-cert", "", "serve HTTPS with the certificate chain in this PEM file")
+	fs.StringVar(&f.tls.KeyFile, "tls-key", "", "PEM file of the key of -tls-cert")
+	fs.BoolVar(&f.tls.SelfSigned, "tls-self-signed", false, "serve HTTPS with a generated self-signed certificate, stored in -tls-cert and -tls-key if given")
+	return f
+}
+
+// auth returns the authenticator of the clients, or nil if none was given.
+// The health checks and the exempt paths are served without
+// authentication.
+func (f *serverFlags) auth() *httpauth.Authenticator {
+	if len(f.clients) == 0 {
+		return nil
+	}
+	return &httpauth.Authenticator{Clients: f.clients, Exempt: append([]string{"/healthz", "/readyz"}, f.exempt...)}
+}
+
+// handler returns h behind the authentication, access log and rate limit
+// of the flags.
+func (f *serverFlags) handler(h http.Handler) http.Handler {
+	return f.auth().Handler(accesslog.Handler(f.logger(), f.limiter().Handler(h)))
+}
+
+// tlsConfig returns the TLS configuration of the server, or nil to serve
+// plain HTTP. The fingerprint of a self-signed certificate is logged, for
+// clients to pin.
+func (f *serverFlags) tlsConfig() (*tls.Config, error) {
+	cfg, err := servetls.Config(f.tls)
+	if err != nil {
+		return nil, usageErrorf("%v", err)
+	}
+	if f.tls.SelfSigned {
+		log.Printf("serving a self-signed certificate with SHA-256 fingerprint %s", servetls.Fingerprint(cfg))
+	}
+	return cfg, nil
+}
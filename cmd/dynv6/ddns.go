@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/ddns"
+	"github.com/libdns/dynv6/health"
+	"github.com/libdns/libdns"
+)
+
+func runDDNS(ctx context.Context, args []string) error {
+	fs := newFlagSet("ddns")
+	p := providerFlags(fs)
+	var names, networks stringsFlag
+	fs.Var(&names, "name", "record name relative to the zone (repeatable, default @)")
+	fs.Var(&networks, "network", "address family to update, ip4 or ip6 (repeatable, default both)")
+	interval := fs.Duration("interval", 5*time.Minute, "time between updates")
+	maxInterval := fs.Duration("max-interval", time.Hour, "longest time between updates while they keep failing")
+	ttl := fs.Duration("ttl", 0, "TTL of the records (default the provider's)")
+	adjustTTL := fs.Bool("adjust-ttl", false, "lower a TTL too long for dynamic addresses instead of only warning")
+	queue := fs.String("queue", defaultCachePath("ddns-queue.json"), "file keeping failed updates for replay, empty to keep them in memory")
+	state := fs.String("state", defaultCachePath("ddns-state.json"), "file keeping the published addresses to skip unchanged ones after restarts, empty to keep them in memory")
+	stateMaxAge := fs.Duration("state-max-age", 24*time.Hour, "write all records again once the -state is this old, to repair records changed elsewhere")
+	once := fs.Bool("once", false, "update once and exit")
+	drainTimeout := fs.Duration("drain-timeout", 30*time.Second, "how long operations in progress may take to finish after SIGTERM")
+	listen := fs.String("listen", "", "serve /healthz and /readyz on this address, e.g. :9154")
+	lockTimeout := fs.Duration("lock-timeout", time.Minute, "how long to wait for other invocations changing the zone")
+	sf := addServerFlags(fs)
+	consensus := fs.Bool("consensus", false, "ask several public services and use the address most of them report")
+	var stun stringsFlag
+	fs.Var(&stun, "stun", "also ask this STUN server, host:port (repeatable, implies -consensus)")
+	quorum := fs.Int("quorum", 0, "how many detectors must agree with -consensus (default a majority)")
+	iface := fs.String("interface", "", "take the addresses from this network interface instead of asking services")
+	ifaceNetwork := fs.String("interface-network", "", "only take addresses of this family, ip4 or ip6, from -interface")
+	includePrivate := fs.Bool("include-private", false, "allow private and unique local addresses of -interface")
+	includeTemporary := fs.Bool("include-temporary", false, "allow temporary IPv6 privacy addresses of -interface")
+	includeDeprecated := fs.Bool("include-deprecated", false, "allow deprecated addresses of -interface")
+	nf := addNotifyFlags(fs, "address changes and failing updates")
+	hostID := fs.String("host-id", "", "point the AAAA records at the host with this interface ID or MAC address in the detected /64")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	args = zoneArgs(fs, 1)
+	if len(args) != 1 {
+		return usageErrorf("expected exactly one zone")
+	}
+	u := &ddns.Updater{
+		Provider:     &lockedProvider{Provider: p, timeout: *lockTimeout},
+		Zone:         args[0],
+		Names:        names,
+		Networks:     networks,
+		Interval:     *interval,
+		MaxInterval:  *maxInterval,
+		TTL:          *ttl,
+		AdjustTTL:    *adjustTTL,
+		DrainTimeout: *drainTimeout,
+		StateMaxAge:  *stateMaxAge,
+		Notifier:     nf.eventNotifier(),
+	}
+	if *consensus || len(stun) > 0 {
+		c := ddns.Consensus{Detectors: ddns.PublicDetectors(), Quorum: *quorum}
+		for _, server := range stun {
+			c.Detectors = append(c.Detectors, ddns.STUNDetector{Server: server})
+		}
+		u.Detector = c
+	}
+	if *iface != "" {
+		d := ddns.InterfaceDetector{
+			Interface:         *iface,
+			IncludePrivate:    *includePrivate,
+			IncludeTemporary:  *includeTemporary,
+			IncludeDeprecated: *includeDeprecated,
+		}
+		switch *ifaceNetwork {
+		case "":
+			u.Detector = d
+		case "ip4":
+			u.Detector = ddns.ByNetwork{IP4: d, IP6: u.Detector}
+		case "ip6":
+			u.Detector = ddns.ByNetwork{IP4: u.Detector, IP6: d}
+		default:
+			return usageErrorf("-interface-network must be ip4 or ip6")
+		}
+	}
+	if *hostID != "" {
+		id, err := parseHostID(*hostID)
+		if err != nil {
+			return usageErrorf("-host-id: %v", err)
+		}
+		u.Detector = ddns.PrefixDetector{Detector: u.Detector, ID: id}
+	}
+	if *queue != "" {
+		q, err := ddns.OpenQueue(*queue)
+		if err != nil {
+			return err
+		}
+		u.Queue = q
+	}
+	if *state != "" {
+		st, err := ddns.OpenState(*state)
+		if err != nil {
+			return err
+		}
+		u.State = st
+	}
+	if *once {
+		return u.Update(ctx)
+	}
+	// a run is due within the interval, or the maximum one while backing off
+	maxAge := 3 * *interval
+	if d := *maxInterval + *interval; d > maxAge {
+		maxAge = d
+	}
+	hc := &health.Checker{API: p, MaxAge: maxAge}
+	u.OnUpdate = hc.Observe
+	mux := http.NewServeMux()
+	hc.Register(mux)
+	cfg, err := sf.tlsConfig()
+	if err != nil {
+		return err
+	}
+	return serveWhile(ctx, *listen, sf.handler(mux), cfg, u.Run)
+}
+
+// lockedProvider takes the lock of the zone around every write, like the
+// other writing commands, but only for the write, so the long-running
+// updater doesn't lock them out.
+type lockedProvider struct {
+	*dynv6.Provider
+	timeout time.Duration
+}
+
+func (p *lockedProvider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	lock, err := lockZone(ctx, zone, p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	return p.Provider.SetRecords(ctx, zone, recs)
+}
+
+func (p *lockedProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	lock, err := lockZone(ctx, zone, p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	return p.Provider.AppendRecords(ctx, zone, recs)
+}
+
+func (p *lockedProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	lock, err := lockZone(ctx, zone, p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	return p.Provider.DeleteRecords(ctx, zone, recs)
+}
+
+func (p *lockedProvider) UpsertAddress(ctx context.Context, fqdn string, addrs []netip.Addr) ([]libdns.Record, error) {
+	_, zone, err := p.ResolveZoneID(ctx, fqdn)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := lockZone(ctx, zone, p.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	return p.Provider.UpsertAddress(ctx, fqdn, addrs)
+}
+
+// parseHostID parses an interface ID, or a MAC address to derive the
+// EUI-64 interface ID from.
+func parseHostID(s string) (ddns.InterfaceID, error) {
+	if mac, err := net.ParseMAC(s); err == nil {
+		return ddns.EUI64(mac)
+	}
+	return ddns.ParseInterfaceID(s)
+}
+
+// defaultCachePath returns the path of a file in the cache directory of the
+// user, or "" if it is unknown.
+func defaultCachePath(name string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dynv6", name)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/libdns"
+)
+
+// dynv6Nameserver is queried directly to measure propagation of the probe
+// record.
+const dynv6Nameserver = "ns1.dynv6.com:53"
+
+type report struct {
+	w      io.Writer
+	failed bool
+}
+
+func (r *report) ok(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "[ ok ] "+format+"\n", args...)
+}
+
+func (r *report) warn(format string, args ...interface{}) {
+	fmt.Fprintf(r.w, "[warn] "+format+"\n", args...)
+}
+
+func (r *report) fail(format string, args ...interface{}) {
+	r.failed = true
+	fmt.Fprintf(r.w, "[FAIL] "+format+"\n", args...)
+}
+
+func runDoctor(ctx context.Context, args []string) error {
+	fs := newFlagSet("doctor")
+	p := providerFlags(fs)
+	probeZone := fs.String("zone", "", "zone to write the probe record to (default first zone)")
+	noWrite := fs.Bool("no-write", false, "skip writing and deleting the probe record")
+	timeout := fs.Duration("propagation-timeout", 2*time.Minute, "how long to wait for the probe record to be served")
+	var resolvers stringsFlag
+	fs.Var(&resolvers, "resolver", "nameserver or DNS-over-HTTPS URL to check propagation with (repeatable, default "+dynv6Nameserver+")")
+	quorum := fs.Int("quorum", 0, "how many resolvers must serve the probe record (default all)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	r := &report{w: os.Stdout}
+
+	zones, err := p.ListZones(ctx)
+	if err != nil {
+		r.fail("token: listing zones failed: %v", err)
+		return fmt.Errorf("health check failed")
+	}
+	r.ok("token: valid, %d zone(s) accessible", len(zones))
+	if err := p.Detect(ctx); err != nil {
+		r.fail("api: %v", err)
+	} else {
+		r.ok("api: responds as expected")
+	}
+	for _, z := range zones {
+		r.ok("zone: %s", z.Name)
+	}
+
+	for _, z := range zones {
+		checkDelegation(ctx, r, z.Name)
+	}
+
+	if !*noWrite {
+		zone := *probeZone
+		if zone == "" && len(zones) > 0 {
+			zone = zones[0].Name
+		}
+		if zone == "" {
+			r.warn("probe: no zone to write the probe record to")
+		} else {
+			probe(ctx, r, p, zone, resolvers, *quorum, *timeout)
+		}
+	}
+
+	if r.failed {
+		return fmt.Errorf("health check failed")
+	}
+	return nil
+}
+
+func checkDelegation(ctx context.Context, r *report, zone string) {
+	d, err := dynv6.CheckDelegation(ctx, zone)
+	switch {
+	case err != nil:
+		r.fail("delegation: %s: %v", zone, err)
+	case len(d.Nameservers) == 0 || len(d.Foreign) == len(d.Nameservers):
+		r.fail("delegation: %s", d.Problem())
+	case len(d.Foreign) > 0:
+		r.warn("delegation: %s", d.Problem())
+	default:
+		r.ok("delegation: %s -> %s (by %s)", zone, strings.Join(d.Nameservers, ", "), d.Parent)
+	}
+}
+
+func probe(ctx context.Context, r *report, p libdnsProvider, zone string, resolverNames []string, quorum int, timeout time.Duration) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	rec := libdns.TXT{Name: "_dynv6-doctor", Text: hex.EncodeToString(b)}
+
+	start := time.Now()
+	if _, err := p.AppendRecords(ctx, zone, []libdns.Record{rec}); err != nil {
+		r.fail("probe: writing TXT %s in %s: %v", rec.Name, zone, err)
+		return
+	}
+	r.ok("probe: wrote TXT %s in %s (%s)", rec.Name, zone, time.Since(start).Round(time.Millisecond))
+
+	if len(resolverNames) == 0 {
+		resolverNames = []string{dynv6Nameserver}
+	}
+	var resolvers []dynv6.Resolver
+	for _, name := range resolverNames {
+		resolvers = append(resolvers, dynv6.ParseResolver(name))
+	}
+	start = time.Now()
+	if err := dynv6.WaitForQuorum(ctx, resolvers, quorum, zone, []libdns.Record{rec}, timeout); err != nil {
+		r.warn("propagation: %v", err)
+	} else {
+		r.ok("propagation: served by %s after %s", strings.Join(resolverNames, ", "), time.Since(start).Round(time.Millisecond))
+	}
+
+	start = time.Now()
+	if _, err := p.DeleteRecords(ctx, zone, []libdns.Record{rec}); err != nil {
+		r.fail("probe: deleting TXT %s in %s: %v", rec.Name, zone, err)
+		return
+	}
+	r.ok("probe: deleted TXT %s in %s (%s)", rec.Name, zone, time.Since(start).Round(time.Millisecond))
+}
+
+type libdnsProvider interface {
+	libdns.RecordAppender
+	libdns.RecordDeleter
+}
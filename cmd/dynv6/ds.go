@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/libdns/dynv6"
+)
+
+func runDS(ctx context.Context, args []string) error {
+	fs := newFlagSet("ds")
+	format := fs.String("format", "text", "output format: text, one DS record in zone file format per line, table or json")
+	resolver := fs.String("resolver", "", "nameserver or DNS-over-HTTPS URL to query the DNSKEY records at (default the dynv6 nameserver)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dynv6 ds [flags] <zone>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) != 1 {
+		fs.Usage()
+		return usageErrorf("expected exactly one zone")
+	}
+	var r dynv6.Resolver
+	if *resolver != "" {
+		r = dynv6.ParseResolver(*resolver)
+	}
+	switch *format {
+	case "text", "table", "json":
+	default:
+		return usageErrorf("unknown format %q", *format)
+	}
+	dss, err := dynv6.LookupDS(ctx, r, args[0])
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(dss)
+	case "table":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY TAG\tALGORITHM\tDIGEST TYPE\tDIGEST")
+		for _, ds := range dss {
+			fmt.Fprintf(tw, "%d\t%d (%s)\t%d (%s)\t%s\n", ds.KeyTag, ds.Algorithm, ds.AlgorithmName(), ds.DigestType, ds.DigestTypeName(), ds.Digest)
+		}
+		return tw.Flush()
+	}
+	for _, ds := range dss {
+		fmt.Println(ds)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+// Exit codes of the CLI. They are part of its interface, so scripts and CI
+// pipelines can branch on the outcome of a command.
+const (
+	exitOK           = 0
+	exitError        = 1  // any error not covered by a more specific code
+	exitDrift        = 2  // live records differ from the desired state
+	exitAuth         = 3  // missing, invalid or insufficient token, or denied by the policy
+	exitZoneNotFound = 4  // the zone does not exist in the account
+	exitValidation   = 5  // invalid input, e.g. malformed record data
+	exitPartial      = 6  // some, but not all, changes were applied
+	exitUnavailable  = 7  // the API sent a maintenance or captive portal page
+	exitUsage        = 64 // invalid command line
+)
+
+var exitKinds = map[int]string{
+	exitOK:           "ok",
+	exitError:        "error",
+	exitDrift:        "drift",
+	exitAuth:         "auth",
+	exitZoneNotFound: "zone_not_found",
+	exitValidation:   "validation",
+	exitPartial:      "partial_failure",
+	exitUnavailable:  "unavailable",
+	exitUsage:        "usage",
+}
+
+// cliError attaches an exit code to an error.
+type cliError struct {
+	code int
+	err  error
+}
+
+func (e *cliError) Error() string { return e.err.Error() }
+func (e *cliError) Unwrap() error { return e.err }
+
+func withCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &cliError{code: code, err: err}
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return withCode(exitUsage, fmt.Errorf(format, args...))
+}
+
+func validationError(err error) error {
+	return withCode(exitValidation, err)
+}
+
+// partialError reports an error of a write that already applied some of
+// its changes. It returns nil if err is nil.
+func partialError(applied int, err error) error {
+	if applied == 0 || err == nil {
+		return err
+	}
+	return withCode(exitPartial, fmt.Errorf("%d change(s) applied before failure: %w", applied, err))
+}
+
+// exitCode maps an error returned by a command to the exit code.
+func exitCode(err error) int {
+	var ce *cliError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	var applyErr *dynv6.ApplyError
+	if errors.As(err, &applyErr) && !applyErr.Validation && (len(applyErr.Committed) > 0 || len(applyErr.Partial) > 0) {
+		return exitPartial
+	}
+	var typeErr *dynv6.UnsupportedTypeError
+	var dangerErr *dynv6.DangerousDeleteError
+	if errors.As(err, &typeErr) || errors.As(err, &dangerErr) {
+		return exitValidation
+	}
+	var authErr *dynv6api.AuthError
+	var policyErr *dynv6.PolicyError
+	if errors.As(err, &authErr) || errors.As(err, &policyErr) {
+		return exitAuth
+	}
+	if errors.Is(err, dynv6api.ErrUpstreamUnavailable) {
+		return exitUnavailable
+	}
+	if errors.Is(err, dynv6api.ErrZoneNotFound) {
+		return exitZoneNotFound
+	}
+	var apiErr *dynv6api.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == 401 || apiErr.StatusCode == 403:
+			return exitAuth
+		case apiErr.StatusCode == 422:
+			return exitValidation
+		}
+	}
+	return exitError
+}
+
+// errorFormat selects how errors are printed, "text" or "json". It is set by
+// the -error-format flag every command accepts.
+var errorFormat = "text"
+
+func printError(w io.Writer, err error, code int) {
+	if errorFormat == "json" {
+		json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+			Code  int    `json:"code"`
+			Kind  string `json:"kind"`
+		}{err.Error(), code, exitKinds[code]})
+		return
+	}
+	fmt.Fprintln(w, "dynv6:", err)
+}
+
+// newFlagSet returns a flag set for a command with the flags shared by all
+// commands.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Func("error-format", `format of error output, "text" or "json"`, func(v string) error {
+		if v != "text" && v != "json" {
+			return fmt.Errorf("unknown error format %q", v)
+		}
+		errorFormat = v
+		return nil
+	})
+	return fs
+}
+
+// parseFlags parses the arguments of a command. The flag package already
+// printed the usage when an error is returned.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return withCode(exitUsage, err)
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	fromEnv, err := applyEnv(fs, set)
+	if err != nil {
+		return err
+	}
+	if fs.Lookup("profile") != nil {
+		return applyProfile(fs, set, fromEnv)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/libdns/dynv6"
+)
+
+func runExport(ctx context.Context, args []string) error {
+	fs := newFlagSet("export")
+	p := providerFlags(fs)
+	format := fs.String("format", "json", "output format; json is a versioned backup with record IDs and zone metadata, restored by dynv6 sync, csv the records for spreadsheets, hosts the A and AAAA records in /etc/hosts format")
+	output := fs.String("o", "", "write to this file instead of stdout")
+	match := fs.String("match", "", "with -format hosts, only write the records whose name matches this shell pattern, e.g. '*.home'")
+	var replace stringsFlag
+	fs.Var(&replace, "replace", "with -format hosts, write an address as another, e.g. the public one as the LAN one: `old=new` (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dynv6 export [flags] <zone>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	args = zoneArgs(fs, 1)
+	if len(args) != 1 {
+		fs.Usage()
+		return usageErrorf("expected exactly one zone")
+	}
+	switch *format {
+	case "json", "csv", "hosts":
+	default:
+		return usageErrorf("unknown format %q", *format)
+	}
+	hosts := dynv6.HostsOptions{Pattern: *match, Replace: map[netip.Addr]netip.Addr{}}
+	if _, err := path.Match(*match, ""); err != nil {
+		return usageErrorf("invalid -match pattern: %v", err)
+	}
+	for _, r := range replace {
+		i := strings.Index(r, "=")
+		if i < 0 {
+			return usageErrorf("invalid -replace %q, expected old=new", r)
+		}
+		from, err1 := netip.ParseAddr(r[:i])
+		to, err2 := netip.ParseAddr(r[i+1:])
+		if err1 != nil || err2 != nil || from.Is4() != to.Is4() {
+			return usageErrorf("invalid -replace %q, expected two addresses of the same family", r)
+		}
+		hosts.Replace[from] = to
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	e, err := p.Export(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return writeOutput(*output, func(w io.Writer) error {
+		switch *format {
+		case "csv":
+			return e.WriteCSV(w)
+		case "hosts":
+			return e.WriteHosts(w, hosts)
+		}
+		_, err := e.WriteTo(w)
+		return err
+	})
+}
+
+// writeOutput calls write with stdout, or with a file replacing path once
+// write succeeded, so a failed export doesn't clobber the last one.
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "" {
+		return write(os.Stdout)
+	}
+	path = expandHome(path)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6/manifest"
+)
+
+type gitFlags struct {
+	url, branch, dir, webhookSecret string
+	poll                            time.Duration
+}
+
+func addGitFlags(fs *flag.FlagSet) *gitFlags {
+	gf := &gitFlags{}
+	fs.StringVar(&gf.url, "git-url", "", "sync the manifest of a Git repository, at the path given by -manifest (default dynv6.json)")
+	fs.StringVar(&gf.branch, "git-branch", "", "branch of -git-url to follow (default the repository's default branch)")
+	fs.StringVar(&gf.dir, "git-dir", "", "local clone of -git-url (default in the user cache directory)")
+	fs.DurationVar(&gf.poll, "git-poll", time.Minute, "how often -daemon fetches -git-url for new commits")
+	fs.StringVar(&gf.webhookSecret, "git-webhook-secret", "", "secret of push webhooks to /hooks/git on -listen, checked as GitHub signature or GitLab token")
+	return gf
+}
+
+// source returns the Git source of the flags, reading the manifest at path.
+func (gf *gitFlags) source(path string) *manifest.GitSource {
+	dir := gf.dir
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			base = os.TempDir()
+		}
+		// one clone per repository and branch
+		sum := sha256.Sum256([]byte(gf.url + "#" + gf.branch))
+		dir = filepath.Join(base, "dynv6", "git", hex.EncodeToString(sum[:8]))
+	}
+	return &manifest.GitSource{URL: gf.url, Branch: gf.branch, Dir: expandHome(dir), Path: path}
+}
+
+// loadGitManifest is loadManifest for the commit last pulled by g.
+func loadGitManifest(g *manifest.GitSource, vars map[string]string, prune bool) (*manifest.Manifest, error) {
+	data, revision, err := g.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	path := g.Path
+	if path == "" {
+		path = "dynv6.json"
+	}
+	m, err := parseManifest(path+"@"+shortRevision(revision), data, vars, prune)
+	if err != nil {
+		return nil, err
+	}
+	m.Revision = revision
+	return m, nil
+}
+
+func shortRevision(revision string) string {
+	if len(revision) > 12 {
+		return revision[:12]
+	}
+	return revision
+}
+
+// pollGit pulls g every interval and whenever kick receives, and triggers
+// a reconcile when a new commit was checked out.
+func pollGit(ctx context.Context, g *manifest.GitSource, interval time.Duration, kick <-chan struct{}, trigger chan<- struct{}, logger *log.Logger) {
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-kick:
+			timer.Stop()
+		}
+		revision, changed, err := g.Pull(ctx)
+		switch {
+		case err != nil:
+			logger.Printf("level=error msg=%q err=%q", "git pull failed", err)
+		case changed:
+			logger.Printf("level=info msg=%q revision=%s", "new commit", revision)
+			select {
+			case trigger <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// gitWebhook accepts push webhooks and kicks the poller. With secret set,
+// requests must carry a GitHub X-Hub-Signature-256 or X-Gitlab-Token
+// header matching it.
+func gitWebhook(secret string, kick chan<- struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "reading body failed", http.StatusBadRequest)
+			return
+		}
+		if secret != "" && !validWebhook(r.Header, body, secret) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		select {
+		case kick <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func validWebhook(h http.Header, body []byte, secret string) bool {
+	if token := h.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+	sig := strings.TrimPrefix(h.Get("X-Hub-Signature-256"), "sha256=")
+	got, err := hex.DecodeString(sig)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/libdns/dynv6/httpauth"
+)
+
+func TestGitWebhook(t *testing.T) {
+	kick := make(chan struct{}, 1)
+	h := gitWebhook("s3cret", kick)
+	body := `{"ref": "refs/heads/main"}`
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(body))
+	for _, test := range []struct {
+		header, value string
+		want          int
+	}{
+		{"X-Hub-Signature-256", "sha256=" + hex.EncodeToString(mac.Sum(nil)), http.StatusAccepted},
+		{"X-Hub-Signature-256", "sha256=00", http.StatusUnauthorized},
+		{"X-Gitlab-Token", "s3cret", http.StatusAccepted},
+		{"X-Gitlab-Token", "wrong", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("POST", "/hooks/git", strings.NewReader(body))
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != test.want {
+			t.Errorf("%s %q: got status %d, want %d", test.header, test.value, rec.Code, test.want)
+		}
+		if rec.Code == http.StatusAccepted {
+			select {
+			case <-kick:
+			default:
+				t.Errorf("%s: poller not kicked", test.header)
+			}
+		}
+	}
+}
+
+func TestGitWebhookAuth(t *testing.T) {
+	sf := &serverFlags{trafficFlags: &trafficFlags{}, clients: []httpauth.Client{{ID: "ci", Token: "t0ken"}}}
+	mux := http.NewServeMux()
+	mux.Handle("/hooks/git", gitWebhook("", make(chan struct{}, 1)))
+	post := func() int {
+		rec := httptest.NewRecorder()
+		sf.handler(mux).ServeHTTP(rec, httptest.NewRequest("POST", "/hooks/git", strings.NewReader("{}")))
+		return rec.Code
+	}
+	// without a secret of its own, the webhook requires the clients' auth
+	if code := post(); code != http.StatusUnauthorized {
+		t.Fatalf("unprotected webhook: got status %d, want 401", code)
+	}
+	sf.exempt = []string{"/hooks/git"}
+	if code := post(); code != http.StatusAccepted {
+		t.Fatalf("exempt webhook: got status %d, want 202", code)
+	}
+}
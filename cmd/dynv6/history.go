@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6/journal"
+	"github.com/libdns/dynv6/manifest"
+	"github.com/libdns/libdns"
+)
+
+func defaultJournalPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "dynv6", "journal.jsonl")
+}
+
+// addJournalFlag registers the -journal flag and returns the journal it
+// configures, nil if it is disabled.
+func addJournalFlag(fs *flag.FlagSet) func() *journal.Journal {
+	path := fs.String("journal", defaultJournalPath(), "file recording every change for dynv6 history, empty to disable")
+	return func() *journal.Journal {
+		if *path == "" {
+			return nil
+		}
+		return &journal.Journal{Path: expandHome(*path)}
+	}
+}
+
+// recordChange adds a change to the journal. Failing to record it doesn't
+// fail the command, which already changed the zone.
+func recordChange(j *journal.Journal, command, zone string, before, after []libdns.Record, err error) {
+	if j == nil || len(before)+len(after) == 0 {
+		return
+	}
+	e := journal.Entry{
+		Command: command,
+		Zone:    zone,
+		Before:  journal.FromLibdns(before),
+		After:   journal.FromLibdns(after),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if _, err := j.Record(e); err != nil {
+		fmt.Fprintln(os.Stderr, "dynv6: recording the change in the journal failed:", err)
+	}
+}
+
+// recordReport adds the changed zones of a reconciler run to the journal.
+func recordReport(j *journal.Journal, rep manifest.Report) {
+	for _, res := range rep.Results {
+		recordChange(j, "sync -daemon", res.Zone, res.Plan.Delete, res.Plan.Create, res.Err)
+	}
+}
+
+// rrsetsOf returns the records of current which are in the RRsets of recs.
+func rrsetsOf(current, recs []libdns.Record) []libdns.Record {
+	var out []libdns.Record
+	for _, c := range current {
+		crr := c.RR()
+		for _, r := range recs {
+			rr := r.RR()
+			if strings.EqualFold(crr.Name, rr.Name) && strings.EqualFold(crr.Type, rr.Type) {
+				out = append(out, c)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func runHistory(ctx context.Context, args []string) error {
+	fs := newFlagSet("history")
+	openJournal := addJournalFlag(fs)
+	since := fs.Duration("since", 0, "only show changes made within this duration, e.g. 24h")
+	limit := fs.Int("limit", 0, "only show the most recent changes")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dynv6 history [flags] [zone]")
+		fmt.Fprintln(fs.Output(), "\nShows the changes recorded in the journal, oldest first, for one zone or all zones.")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	args = zoneArgs(fs, 1)
+	if len(args) > 1 {
+		fs.Usage()
+		return usageErrorf("expected at most one zone")
+	}
+	j := openJournal()
+	if j == nil {
+		return usageErrorf("the journal is disabled")
+	}
+	var zone string
+	if len(args) == 1 {
+		zone = args[0]
+	}
+	entries, err := j.Entries(zone)
+	if err != nil {
+		return err
+	}
+	if *since > 0 {
+		cutoff := time.Now().Add(-*since)
+		for len(entries) > 0 && entries[0].Time.Before(cutoff) {
+			entries = entries[1:]
+		}
+	}
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+	for _, e := range entries {
+		printEntry(os.Stdout, e)
+	}
+	return nil
+}
+
+// printEntry writes the header of an entry and its changes.
+func printEntry(f *os.File, e journal.Entry) {
+	fmt.Fprintf(f, "%s  %s  %s  %s  %s\n", e.ID, e.Time.Local().Format(time.RFC3339), e.User, e.Command, e.Zone)
+	if e.Error != "" {
+		fmt.Fprintf(f, "  failed: %s\n", e.Error)
+	}
+	printPlan(f, e.Plan())
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// zoneLock is an advisory lock serializing read-modify-write cycles of
+// concurrent CLI invocations on the same zone and host.
+type zoneLock struct {
+	f *os.File
+}
+
+// lockZone acquires the lock of a zone, waiting up to timeout for other
+// invocations to release it.
+func lockZone(ctx context.Context, zone string, timeout time.Duration) (*zoneLock, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	dir = filepath.Join(dir, "dynv6", "locks")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, strings.ToLower(strings.TrimSuffix(zone, "."))+".lock")
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := tryLock(path)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			return &zoneLock{f: f}, nil
+		}
+		if err != errLocked {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("zone %s is locked by another dynv6 process (%s)", zone, path)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// Unlock releases the lock.
+func (l *zoneLock) Unlock() error {
+	return unlock(l.f)
+}
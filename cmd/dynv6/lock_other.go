@@ -0,0 +1,30 @@
+//go:build windows || plan9 || js || wasip1
+// +build windows plan9 js wasip1
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errLocked = errors.New("locked")
+
+// tryLock falls back to an exclusively created lock file on platforms
+// without flock. A lock file left behind by a crashed process has to be
+// removed manually.
+func tryLock(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func unlock(f *os.File) error {
+	f.Close()
+	return os.Remove(f.Name())
+}
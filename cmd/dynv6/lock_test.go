@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLockZone(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	ctx := context.Background()
+	l, err := lockZone(ctx, "example.dynv6.net.", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockZone(ctx, "example.dynv6.net", 300*time.Millisecond); err == nil {
+		t.Fatal("second lock of the same zone succeeded")
+	}
+	other, err := lockZone(ctx, "other.dynv6.net", time.Second)
+	if err != nil {
+		t.Fatalf("locking another zone: %v", err)
+	}
+	other.Unlock()
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = lockZone(ctx, "example.dynv6.net", time.Second)
+	if err != nil {
+		t.Fatalf("locking after unlock: %v", err)
+	}
+	l.Unlock()
+}
@@ -0,0 +1,160 @@
+// Command dynv6 provides command line tools and server modes built on top of
+// the dynv6 libdns provider.
+//
+// Exit codes:
+//
+//	0   success
+//	1   error not covered by a more specific code
+//	2   drift detected: live records differ from the desired state, or
+//	    nameservers serve other records than the API returns, or
+//	    monitor -once found missing records
+//	3   authentication or authorization failure, or denied by -policy
+//	4   zone not found
+//	5   validation error, e.g. malformed record data
+//	6   partial failure: some changes were applied before an error
+//	7   the API is unavailable, e.g. it sent a maintenance page
+//	64  invalid command line
+//
+// With -error-format json, errors are printed to stderr as a JSON object
+// with the fields "error", "code" and "kind".
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"zones", "list the zones of the account", runZones},
+	{"records", "list the records of a zone", runRecords},
+	{"append", "add a record to a zone", runWrite("append", func(p *dynv6.Provider) writeFunc { return p.AppendRecords })},
+	{"set", "create or replace a record of a zone", runWrite("set", func(p *dynv6.Provider) writeFunc { return p.SetRecords })},
+	{"delete", "delete a record from a zone", runWrite("delete", func(p *dynv6.Provider) writeFunc { return p.DeleteRecords })},
+	{"sync", "make a zone match the records of a file", runSync},
+	{"export", "write a zone as a versioned JSON backup", runExport},
+	{"history", "show the changes recorded in the local journal", runHistory},
+	{"rollback", "undo the changes made to a zone since a point in time", runRollback},
+	{"doctor", "check token, zones, delegation and write access", runDoctor},
+	{"bench", "measure the latency and error rate of API requests", runBench},
+	{"audit", "compare the records of a zone with the answers of its nameservers", runAudit},
+	{"monitor", "alert when records vanish from the API or stop resolving", runMonitor},
+	{"ds", "print the DS records to enter at the registrar for DNSSEC", runDS},
+	{"acme-dns", "serve an acme-dns compatible API backed by dynv6 TXT records", runACMEDNS},
+	{"ddns", "keep address records pointed at the public addresses of this host", runDDNS},
+	{"rfc2136", "serve RFC 2136 dynamic updates and apply them to dynv6 zones", runRFC2136},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			err := cmd.run(ctx, os.Args[2:])
+			switch {
+			case err == nil:
+			case errors.Is(err, flag.ErrHelp):
+			default:
+				code := exitCode(err)
+				printError(os.Stderr, err, code)
+				stop()
+				os.Exit(code)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(exitUsage)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dynv6 <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+// providerFlags registers the flags shared by all commands talking to the
+// dynv6 API and returns the provider they configure.
+func providerFlags(fs *flag.FlagSet) *dynv6.Provider {
+	p := new(dynv6.Provider)
+	fs.StringVar(&p.Token, "token", "", "dynv6 REST API token (default $DYNV6_TOKEN)")
+	fs.Func("token-file", "read the token from a file, e.g. a Docker secret", func(path string) error {
+		b, err := ioutil.ReadFile(path)
+		p.Token = strings.TrimSpace(string(b))
+		return err
+	})
+	fs.StringVar(&p.BaseURL, "base-url", "", "base URL of the dynv6 REST API")
+	fs.StringVar(&p.APIVersion, "api-version", "", "version of the dynv6 REST API used with the default base URL (default "+dynv6api.DefaultAPIVersion+")")
+	fs.String("profile", "", "profile of the configuration file to use (default $DYNV6_PROFILE or the file's default)")
+	fs.DurationVar(&p.OperationTimeout, "operation-timeout", 0, "time limit of each provider call (default 30s)")
+	backoff := dynv6api.DefaultRetryPolicy.(dynv6api.ExponentialBackoff)
+	p.RetryPolicy = &backoff
+	fs.IntVar(&backoff.MaxAttempts, "retry-max-attempts", backoff.MaxAttempts, "attempts per API request")
+	fs.DurationVar(&backoff.BaseDelay, "retry-base-delay", backoff.BaseDelay, "delay before the first retry, doubled for every further retry")
+	fs.DurationVar(&backoff.MaxDelay, "retry-max-delay", backoff.MaxDelay, "maximum delay between retries")
+	fs.IntVar(&p.RetryBudget, "retry-budget", 0, "retries allowed per command (default 10, negative for unlimited)")
+	fs.IntVar(&p.RateLimitReserve, "rate-limit-reserve", 0, "remaining API quota below which requests are spaced out (default 5, negative disables)")
+	fs.Func("policy", "JSON file of a policy restricting the records commands may change", func(path string) error {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		p.Policy = new(dynv6.Policy)
+		if err := json.Unmarshal(b, p.Policy); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		return p.Policy.Validate()
+	})
+	fs.StringVar(&p.ManagedSuffix, "managed-suffix", "", "refuse changing records outside this domain, e.g. .k8s.example.dynv6.net")
+	fs.Func("log-level", "log API calls to stderr: errors, calls or bodies", func(v string) error {
+		level, err := dynv6.ParseLogLevel(v)
+		if err != nil {
+			return err
+		}
+		p.Middleware = append(p.Middleware, dynv6api.Logging(nil, level))
+		return nil
+	})
+	return p
+}
+
+func checkToken(p *dynv6.Provider) error {
+	if p.Token == "" {
+		return withCode(exitAuth, fmt.Errorf("no token given, use -token, set DYNV6_TOKEN or configure a profile"))
+	}
+	return nil
+}
+
+// stringsFlag collects the values of a flag that may be given multiple times.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
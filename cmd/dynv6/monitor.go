@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/health"
+	"github.com/libdns/dynv6/monitor"
+)
+
+func runMonitor(ctx context.Context, args []string) error {
+	fs := newFlagSet("monitor")
+	p := providerFlags(fs)
+	manifestPath := fs.String("manifest", "", "monitor all records of a JSON manifest instead of a file of a single zone")
+	vars := varsFlag{}
+	fs.Var(vars, "var", "set a manifest variable, as `name=value`; may be repeated")
+	var resolvers stringsFlag
+	fs.Var(&resolvers, "resolver", "nameserver or DNS-over-HTTPS URL to resolve the records at (repeatable, default the dynv6 nameserver)")
+	interval := fs.Duration("interval", time.Minute, "time between checks")
+	failures := fs.Int("failures", 2, "consecutive failed checks before a record is alerted about")
+	once := fs.Bool("once", false, "check once, list the problems and exit with status 2 if there are any")
+	listen := fs.String("listen", "", "serve /healthz and /readyz on this address, e.g. :9155")
+	sf := addServerFlags(fs)
+	nf := addNotifyFlags(fs, "missing and unresolvable records")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dynv6 monitor [flags] <zone> <file>")
+		fmt.Fprintln(fs.Output(), "       dynv6 monitor [flags] -manifest <file>")
+		fmt.Fprintln(fs.Output(), "\nThe file has one record per line: <name> <type> <data>. Lines starting with # are ignored.")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	var load func() ([]monitor.Target, error)
+	if *manifestPath != "" {
+		if fs.NArg() != 0 {
+			fs.Usage()
+			return usageErrorf("unexpected arguments with -manifest")
+		}
+		load = func() ([]monitor.Target, error) {
+			m, err := loadManifest(*manifestPath, vars, false)
+			if err != nil {
+				return nil, err
+			}
+			return monitor.Targets(m)
+		}
+	} else {
+		args = zoneArgs(fs, 2)
+		if len(args) != 2 {
+			fs.Usage()
+			return usageErrorf("expected a zone and a file")
+		}
+		zone, path := args[0], args[1]
+		load = func() ([]monitor.Target, error) {
+			recs, err := readRecordsFile(path)
+			if err != nil {
+				return nil, err
+			}
+			targets := make([]monitor.Target, len(recs))
+			for i, r := range recs {
+				targets[i] = monitor.Target{Zone: zone, Record: r}
+			}
+			return targets, nil
+		}
+	}
+	// catch a broken file before the first check
+	targets, err := load()
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return validationError(fmt.Errorf("no records to monitor"))
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	m := &monitor.Monitor{
+		Provider: p,
+		Load:     load,
+		Interval: *interval,
+		Failures: *failures,
+		Notifier: nf.eventNotifier(),
+		Log:      log.New(os.Stderr, "", log.LstdFlags),
+	}
+	for _, r := range resolvers {
+		m.Resolvers = append(m.Resolvers, dynv6.ParseResolver(r))
+	}
+	if *once {
+		report := m.Check(ctx)
+		for _, p := range report.Problems {
+			fmt.Println(p)
+		}
+		if report.Err != nil {
+			return report.Err
+		}
+		if len(report.Problems) > 0 {
+			return withCode(exitDrift, fmt.Errorf("%d problem(s) with %d record(s)", len(report.Problems), report.Checked))
+		}
+		return nil
+	}
+	hc := &health.Checker{API: p, MaxAge: 3 * *interval}
+	m.OnReport = func(rep monitor.Report) { hc.Observe(rep.Err) }
+	mux := http.NewServeMux()
+	hc.Register(mux)
+	cfg, err := sf.tlsConfig()
+	if err != nil {
+		return err
+	}
+	return serveWhile(ctx, *listen, sf.handler(mux), cfg, m.Run)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+// Output formats of the listing commands.
+const (
+	outputPlain = "plain" // columns without a header, for scripts
+	outputTable = "table" // aligned columns with a header
+	outputWide  = "wide"  // table with all the fields
+)
+
+// addOutputFlag registers the -output flag of the listing commands.
+func addOutputFlag(fs *flag.FlagSet) *string {
+	output := outputPlain
+	fs.Func("output", "output format: plain, table or wide (default plain)", func(v string) error {
+		switch v {
+		case outputPlain, outputTable, outputWide:
+			output = v
+			return nil
+		}
+		return fmt.Errorf("unknown output format %q", v)
+	})
+	return &output
+}
+
+func printZones(w io.Writer, zones []dynv6api.Zone, output string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	switch output {
+	case outputTable:
+		fmt.Fprintln(tw, "ID\tNAME\tIPV4 ADDRESS\tIPV6 PREFIX")
+	case outputWide:
+		fmt.Fprintln(tw, "ID\tNAME\tIPV4 ADDRESS\tIPV6 PREFIX\tCREATED\tUPDATED")
+	}
+	for _, z := range zones {
+		if output == outputWide {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", z.ID, z.Name, orDash(z.IPv4Address), orDash(z.IPv6Prefix), formatTime(z.CreatedAt), formatTime(z.UpdatedAt))
+			continue
+		}
+		if output == outputTable {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", z.ID, z.Name, orDash(z.IPv4Address), orDash(z.IPv6Prefix))
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", z.ID, z.Name, z.IPv4Address, z.IPv6Prefix)
+	}
+	return tw.Flush()
+}
+
+// printRecords lists records. dynv6 doesn't store TTLs, ttl is the one the
+// provider reports, if any.
+func printRecords(w io.Writer, recs []dynv6api.Record, ttl time.Duration, output string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	switch output {
+	case outputTable:
+		fmt.Fprintln(tw, "ID\tNAME\tTYPE\tTTL\tDATA")
+	case outputWide:
+		fmt.Fprintln(tw, "ID\tNAME\tTYPE\tTTL\tPRIORITY\tWEIGHT\tPORT\tFLAGS\tTAG\tDATA\tEXPANDED DATA")
+	}
+	ttlText := "-"
+	if ttl > 0 {
+		ttlText = strconv.Itoa(int(ttl / time.Second))
+	}
+	for _, r := range recs {
+		name := r.Name
+		if name == "" {
+			name = "@"
+		}
+		switch output {
+		case outputTable:
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", r.ID, name, r.Type, ttlText, r.Data)
+		case outputWide:
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.ID, name, r.Type, ttlText,
+				intOrDash(r.Priority), intOrDash(r.Weight), intOrDash(r.Port), intOrDash(r.Flags), orDash(r.Tag), r.Data, orDash(r.ExpandedData))
+		default:
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", name, r.Type, r.Data)
+		}
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func intOrDash(v *int) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.Itoa(*v)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
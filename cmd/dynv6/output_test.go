@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/dynv6/journal"
+)
+
+func TestPrintRecords(t *testing.T) {
+	prio := 10
+	recs := []dynv6api.Record{
+		{ID: 1, Name: "", Type: "MX", Data: "mail", Priority: &prio, ExpandedData: "mail.example.dynv6.net"},
+		{ID: 2, Name: "www", Type: "A", Data: "192.0.2.1"},
+	}
+	tests := []struct {
+		output string
+		want   []string
+	}{
+		{outputPlain, []string{"@    MX  mail", "www  A   192.0.2.1"}},
+		{outputTable, []string{"ID  NAME  TYPE  TTL  DATA", "1   @     MX    60   mail", "2   www   A     60   192.0.2.1"}},
+		{outputWide, []string{
+			"ID  NAME  TYPE  TTL  PRIORITY  WEIGHT  PORT  FLAGS  TAG  DATA       EXPANDED DATA",
+			"1   @     MX    60   10        -       -     -      -    mail       mail.example.dynv6.net",
+			"2   www   A     60   -         -       -     -      -    192.0.2.1  -",
+		}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := printRecords(&buf, recs, time.Minute, test.output); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+		for i := range lines {
+			lines[i] = strings.TrimRight(lines[i], " ")
+		}
+		if got, want := strings.Join(lines, "\n"), strings.Join(test.want, "\n"); got != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.output, got, want)
+		}
+	}
+}
+
+func TestOutputFlag(t *testing.T) {
+	fs := newFlagSet("zones")
+	output := addOutputFlag(fs)
+	if err := parseFlags(fs, []string{"-output", "wide"}); err != nil || *output != outputWide {
+		t.Fatalf("got %q, %v", *output, err)
+	}
+	fs = newFlagSet("zones")
+	addOutputFlag(fs)
+	if err := parseFlags(fs, []string{"-output", "yaml"}); exitCode(err) != exitUsage {
+		t.Fatalf("got %v, want a usage error", err)
+	}
+}
+
+func TestPrintEntry(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "history.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	printEntry(f, journal.Entry{
+		ID: "c0ffee", Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), User: "alice@laptop", Command: "set", Zone: "example.dynv6.net",
+		Before: []journal.Record{{Name: "www", Type: "A", Data: "192.0.2.1"}},
+		After:  []journal.Record{{Name: "www", Type: "A", Data: "192.0.2.2"}},
+	})
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// journal entries are rendered like the plans of sync
+	if !strings.Contains(string(b), "~ A www: '192.0.2.1' -> '192.0.2.2'\n") {
+		t.Fatalf("unexpected output:\n%s", b)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+)
+
+func runZones(ctx context.Context, args []string) error {
+	fs := newFlagSet("zones")
+	p := providerFlags(fs)
+	cf := addCacheFlags(fs)
+	output := addOutputFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	cache := cf.open(p.Token)
+	zones, ok := cache.zones()
+	if !ok {
+		var err error
+		zones, err = dynv6api.NewClient(p.Token).ListZones(ctx)
+		if err != nil {
+			return err
+		}
+		cache.putZones(zones)
+	}
+	if err := printZones(os.Stdout, zones, *output); err != nil {
+		return err
+	}
+	return cache.save()
+}
+
+func runRecords(ctx context.Context, args []string) error {
+	fs := newFlagSet("records")
+	p := providerFlags(fs)
+	cf := addCacheFlags(fs)
+	output := addOutputFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dynv6 records [flags] <zone>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	args = zoneArgs(fs, 1)
+	if len(args) != 1 {
+		fs.Usage()
+		return usageErrorf("expected exactly one zone")
+	}
+	zone := args[0]
+	cache := cf.open(p.Token)
+	recs, err := listRecords(ctx, dynv6api.NewClient(p.Token), cache, zone)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(recs, func(i, j int) bool {
+		return dynv6.CompareRecords(libdns.RR{Name: recs[i].Name, Type: recs[i].Type, Data: recs[i].Data},
+			libdns.RR{Name: recs[j].Name, Type: recs[j].Type, Data: recs[j].Data}) < 0
+	})
+	if err := printRecords(os.Stdout, recs, p.TTL, *output); err != nil {
+		return err
+	}
+	return cache.save()
+}
+
+// listRecords returns the records of a zone, using the cache for the zone ID
+// and the listing where possible.
+func listRecords(ctx context.Context, c *dynv6api.Client, cache *diskCache, zone string) ([]dynv6api.Record, error) {
+	if cr, ok := cache.records(zone); ok {
+		return cr.Records, nil
+	}
+	zoneID, ok := cache.zoneID(zone)
+	if !ok {
+		z, err := c.GetZoneByName(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+		zoneID = z.ID
+	}
+	recs, err := c.ListRecords(ctx, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	cache.putRecords(zone, zoneID, recs)
+	return recs, nil
+}
+
+// writeFunc is the signature of the libdns methods changing records.
+type writeFunc func(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error)
+
+// runWrite returns the run function of a command changing a single record
+// through the given provider method.
+func runWrite(name string, write func(p *dynv6.Provider) writeFunc) func(ctx context.Context, args []string) error {
+	return func(ctx context.Context, args []string) error {
+		fs := newFlagSet(name)
+		p := providerFlags(fs)
+		cf := addCacheFlags(fs)
+		openJournal := addJournalFlag(fs)
+		lockTimeout := fs.Duration("lock-timeout", time.Minute, "how long to wait for other invocations changing the zone")
+		var verify bool
+		if name == "delete" {
+			fs.BoolVar(&p.AllowDangerous, "allow-dangerous", false, "allow deleting the NS and SOA records at the apex")
+		} else {
+			fs.BoolVar(&verify, "verify", false, "read the record back and fail if dynv6 stored something else")
+		}
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "usage: dynv6 %s [flags] <zone> <name> <type> <data>\n", name)
+			fs.PrintDefaults()
+		}
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		if err := checkToken(p); err != nil {
+			return err
+		}
+		args = zoneArgs(fs, 4)
+		if len(args) != 4 {
+			fs.Usage()
+			return usageErrorf("expected zone, name, type and data")
+		}
+		zone := args[0]
+		rec, err := libdns.RR{Name: args[1], Type: strings.ToUpper(args[2]), Data: args[3]}.Parse()
+		if err != nil {
+			return validationError(err)
+		}
+		lock, err := lockZone(ctx, zone, *lockTimeout)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+		if verify {
+			ctx = dynv6.WithOptions(ctx, dynv6.Verify())
+		}
+		j := openJournal()
+		var replaced []libdns.Record
+		if name == "set" && j != nil {
+			current, err := p.GetRecords(ctx, zone)
+			if err != nil {
+				return err
+			}
+			replaced = rrsetsOf(current, []libdns.Record{rec})
+		}
+		results, err := write(p)(ctx, zone, []libdns.Record{rec})
+		if name == "delete" {
+			recordChange(j, name, zone, results, nil, err)
+		} else {
+			recordChange(j, name, zone, replaced, results, err)
+		}
+		err = partialError(len(results), err)
+		cache := cf.open(p.Token)
+		cache.invalidate(zone)
+		if saveErr := cache.save(); err == nil {
+			err = saveErr
+		}
+		for _, r := range results {
+			rr := r.RR()
+			fmt.Printf("%s\t%s\t%s\n", rr.Name, rr.Type, rr.Data)
+		}
+		return err
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6/rfc2136"
+)
+
+func runRFC2136(ctx context.Context, args []string) error {
+	fs := newFlagSet("rfc2136")
+	p := providerFlags(fs)
+	listen := fs.String("listen", ":53", "address to listen on for UDP and TCP")
+	drainTimeout := fs.Duration("drain-timeout", 30*time.Second, "how long updates in progress may take to finish after SIGTERM")
+	lockTimeout := fs.Duration("lock-timeout", time.Minute, "how long to wait for other invocations changing the zone")
+	tf := addTrafficFlags(fs)
+	var keys, zones stringsFlag
+	fs.Var(&keys, "key", "TSIG key as name:base64secret (repeatable)")
+	fs.Var(&zones, "zone", "zone that may be updated (repeatable, default all)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	srv := &rfc2136.Server{
+		Provider:     &lockedProvider{Provider: p, timeout: *lockTimeout},
+		Keys:         map[string]string{},
+		Zones:        zones,
+		DrainTimeout: *drainTimeout,
+		AccessLog:    tf.logger(),
+		RateLimit:    tf.limiter(),
+	}
+	for _, k := range keys {
+		name, secret := splitKey(k)
+		if name == "" || secret == "" {
+			return fmt.Errorf("invalid TSIG key %q, expected name:secret", k)
+		}
+		srv.Keys[name] = secret
+	}
+	return srv.ListenAndServe(ctx, *listen)
+}
+
+func splitKey(k string) (string, string) {
+	i := strings.Index(k, ":")
+	if i < 0 {
+		return "", ""
+	}
+	return k[:i], k[i+1:]
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/journal"
+)
+
+func runRollback(ctx context.Context, args []string) error {
+	fs := newFlagSet("rollback")
+	p := providerFlags(fs)
+	cf := addCacheFlags(fs)
+	openJournal := addJournalFlag(fs)
+	to := fs.String("to", "", "restore the state right after the change with this ID, or at this time (RFC 3339 or \"2006-01-02 15:04:05\")")
+	yes := fs.Bool("yes", false, "apply the changes without asking for confirmation")
+	dryRun := fs.Bool("dry-run", false, "only show the changes")
+	lockTimeout := fs.Duration("lock-timeout", time.Minute, "how long to wait for other invocations changing the zone")
+	fs.BoolVar(&p.AllowDangerous, "allow-dangerous", false, "allow deleting the NS and SOA records at the apex")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dynv6 rollback [flags] -to <change-id|time> <zone>")
+		fmt.Fprintln(fs.Output(), "\nUndoes the changes recorded in the journal after the given change or time.")
+		fmt.Fprintln(fs.Output(), "Records changed outside the journal are kept.")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	args = zoneArgs(fs, 1)
+	if len(args) != 1 || *to == "" {
+		fs.Usage()
+		return usageErrorf("expected -to and exactly one zone")
+	}
+	zone := args[0]
+	j := openJournal()
+	if j == nil {
+		return usageErrorf("rollback needs the journal, which is disabled")
+	}
+	entries, err := j.Entries(zone)
+	if err != nil {
+		return err
+	}
+	undo, err := journal.Since(entries, *to)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	if len(undo) == 0 {
+		fmt.Printf("%s: no changes after %s\n", zone, *to)
+		return nil
+	}
+	switch {
+	case *dryRun:
+		ctx = dynv6.WithOptions(ctx, dynv6.DryRun())
+	case !*yes:
+		ctx = dynv6.WithOptions(ctx, dynv6.Confirm(func(ctx context.Context, plan dynv6.Plan) (bool, error) {
+			fmt.Fprintf(os.Stderr, "%s: undoing %d change(s) since %s:\n", plan.Zone, len(undo), undo[0].Time.Local().Format(time.RFC3339))
+			printPlan(os.Stderr, plan)
+			return prompt(os.Stdin, os.Stderr, "Roll back?")
+		}))
+	}
+	lock, err := lockZone(ctx, zone, *lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	current, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return err
+	}
+	// the undone state covers all records, so RRsets absent from it were
+	// created by the undone changes and are pruned
+	plan, err := p.Sync(ctx, zone, journal.Undo(current, undo), true)
+	cache := cf.open(p.Token)
+	cache.invalidate(zone)
+	if saveErr := cache.save(); err == nil {
+		err = saveErr
+	}
+	if errors.Is(err, dynv6.ErrNotConfirmed) {
+		return err
+	}
+	if !*dryRun {
+		recordChange(j, "rollback", zone, plan.Delete, plan.Create, err)
+	}
+	if *dryRun || *yes {
+		printPlan(os.Stdout, plan)
+	}
+	return err
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/journal"
+	"github.com/libdns/dynv6/manifest"
+	"github.com/libdns/dynv6/notify"
+	"github.com/libdns/dynv6/render"
+	"github.com/libdns/libdns"
+)
+
+func runSync(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "validate" {
+		return runSyncValidate(ctx, args[1:])
+	}
+	if len(args) > 0 && args[0] == "import" {
+		return runSyncImport(args[1:])
+	}
+	if len(args) > 0 && args[0] == "schema" {
+		_, err := os.Stdout.Write(manifest.Schema())
+		return err
+	}
+	fs := newFlagSet("sync")
+	p := providerFlags(fs)
+	cf := addCacheFlags(fs)
+	openJournal := addJournalFlag(fs)
+	prune := fs.Bool("prune", false, "delete RRsets which are not in the file")
+	owner := fs.String("owner", "", "mark the written RRsets as owned by this ID with TXT records, and only prune RRsets marked as owned by it")
+	pruneJournal := fs.Bool("prune-journal", false, "only prune RRsets the journal recorded as created by this tool")
+	manifestPath := fs.String("manifest", "", "sync all zones of a JSON manifest instead of a single zone")
+	vars := varsFlag{}
+	fs.Var(vars, "var", "set a manifest variable, as `name=value`; may be repeated")
+	nf := addNotifyFlags(fs, "detected drift")
+	gf := addGitFlags(fs)
+	yes := fs.Bool("yes", false, "apply the changes without asking for confirmation")
+	dryRun := fs.Bool("dry-run", false, "only show the changes")
+	check := fs.Bool("check", false, "only check for drift: show the changes and exit with status 2 if there are any, 0 otherwise")
+	daemon := fs.Bool("daemon", false, "keep reconciling the zones of -manifest at -interval")
+	interval := fs.Duration("interval", 5*time.Minute, "time between reconciles with -daemon")
+	drainTimeout := fs.Duration("drain-timeout", 30*time.Second, "how long operations in progress may take to finish after SIGTERM")
+	listen := fs.String("listen", "", "serve /metrics, /healthz and /readyz on this address with -daemon, e.g. :9153")
+	sf := addServerFlags(fs)
+	lockTimeout := fs.Duration("lock-timeout", time.Minute, "how long to wait for other invocations changing the zone")
+	fs.BoolVar(&p.AllowDangerous, "allow-dangerous", false, "allow deleting the NS and SOA records at the apex")
+	var csvColumns *dynv6.CSVColumns
+	fs.Func("csv-columns", "read the file as CSV, mapping record fields to its columns by header or number, e.g. `name=Host,type=Type,data=Value` (default for .csv files: name, type, data and ttl)", func(v string) error {
+		c, err := dynv6.ParseCSVColumns(v)
+		csvColumns = &c
+		return err
+	})
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dynv6 sync [flags] <zone> <file>")
+		fmt.Fprintln(fs.Output(), "       dynv6 sync [flags] -manifest <file>")
+		fmt.Fprintln(fs.Output(), "       dynv6 sync [flags] -daemon -manifest <file>")
+		fmt.Fprintln(fs.Output(), "       dynv6 sync [flags] [-daemon] -git-url <repository> [-manifest <path in repository>]")
+		fmt.Fprintln(fs.Output(), "       dynv6 sync -check [flags] <zone> <file> | -manifest <file>")
+		fmt.Fprintln(fs.Output(), "       dynv6 sync validate [flags] <manifest>")
+		fmt.Fprintln(fs.Output(), "       dynv6 sync import [flags] <zone> <file>")
+		fmt.Fprintln(fs.Output(), "       dynv6 sync schema")
+		fmt.Fprintln(fs.Output(), "\nThe file has one record per line: <name> <type> <data>. Lines starting with # are ignored.")
+		fmt.Fprintln(fs.Output(), "A .csv file, or any file with -csv-columns, is read as CSV with a header row.")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkToken(p); err != nil {
+		return err
+	}
+	if *check {
+		if *daemon {
+			return usageErrorf("-check can't be combined with -daemon")
+		}
+		*dryRun = true
+	}
+	var opts []dynv6.Option
+	switch {
+	case *dryRun:
+		opts = append(opts, dynv6.DryRun())
+	case !*yes && !*daemon:
+		opts = append(opts, dynv6.Confirm(func(ctx context.Context, plan dynv6.Plan) (bool, error) {
+			fmt.Fprintf(os.Stderr, "%s:\n", plan.Zone)
+			printPlan(os.Stderr, plan)
+			return prompt(os.Stdin, os.Stderr, "Apply these changes?")
+		}))
+	}
+	j := openJournal()
+	if *owner != "" {
+		opts = append(opts, dynv6.OwnershipTXT(*owner))
+	}
+	if *pruneJournal {
+		if j == nil {
+			return usageErrorf("-prune-journal requires -journal")
+		}
+		opts = append(opts, dynv6.PruneOnly(j.Written()))
+	}
+	ctx = dynv6.WithOptions(ctx, opts...)
+	if *dryRun {
+		j = nil
+	}
+	load := func() (*manifest.Manifest, error) {
+		return loadManifest(*manifestPath, vars, *prune)
+	}
+	var git *manifest.GitSource
+	if gf.url != "" {
+		if fs.NArg() != 0 {
+			fs.Usage()
+			return usageErrorf("unexpected arguments with -git-url")
+		}
+		git = gf.source(*manifestPath)
+		if _, _, err := git.Pull(ctx); err != nil {
+			return err
+		}
+		load = func() (*manifest.Manifest, error) {
+			return loadGitManifest(git, vars, *prune)
+		}
+	} else if *manifestPath == "" && *daemon {
+		fs.Usage()
+		return usageErrorf("-daemon requires -manifest or -git-url")
+	}
+	if *daemon {
+		if fs.NArg() != 0 {
+			fs.Usage()
+			return usageErrorf("unexpected arguments with -daemon")
+		}
+		logger := log.New(os.Stderr, "", log.LstdFlags)
+		r := &manifest.Reconciler{
+			Provider:     p,
+			Load:         load,
+			Interval:     *interval,
+			Notifier:     nf.notifier(),
+			Log:          logger,
+			DrainTimeout: *drainTimeout,
+			// like the one-shot sync, so the runs of the daemon and the
+			// other commands don't interleave
+			Lock: func(ctx context.Context, zone string) (func(), error) {
+				lock, err := lockZone(ctx, zone, *lockTimeout)
+				if err != nil {
+					return nil, err
+				}
+				return func() {
+					cache := cf.open(p.Token)
+					cache.invalidate(zone)
+					if err := cache.save(); err != nil {
+						logger.Printf("level=error msg=\"saving the cache failed\" zone=%s err=%q", zone, err)
+					}
+					lock.Unlock()
+				}, nil
+			},
+		}
+		if j != nil {
+			r.OnReport = func(rep manifest.Report) { recordReport(j, rep) }
+		}
+		mux := http.NewServeMux()
+		if git != nil {
+			trigger := make(chan struct{}, 1)
+			r.Trigger = trigger
+			kick := make(chan struct{}, 1)
+			mux.Handle("/hooks/git", gitWebhook(gf.webhookSecret, kick))
+			if gf.webhookSecret != "" {
+				// git hosts can't authenticate otherwise, the secret does
+				sf.exempt = append(sf.exempt, "/hooks/git")
+			}
+			go pollGit(ctx, git, gf.poll, kick, trigger, r.Log)
+		}
+		return runDaemon(ctx, r, *listen, mux, sf)
+	}
+	if *manifestPath != "" || git != nil {
+		if fs.NArg() != 0 {
+			fs.Usage()
+			return usageErrorf("unexpected arguments with -manifest")
+		}
+		results, err := syncManifest(ctx, p, cf, j, nf.notifier(), load, *lockTimeout, *dryRun, *dryRun || *yes)
+		if err == nil && *check && results.Created()+results.Deleted() > 0 {
+			return withCode(exitDrift, fmt.Errorf("drift detected: %d record(s) to create, %d to delete", results.Created(), results.Deleted()))
+		}
+		return err
+	}
+	args = zoneArgs(fs, 2)
+	if len(args) != 2 {
+		fs.Usage()
+		return usageErrorf("expected zone and file")
+	}
+	zone := args[0]
+	if csvColumns == nil && strings.HasSuffix(strings.ToLower(args[1]), ".csv") {
+		csvColumns = &dynv6.CSVColumns{}
+	}
+	var desired []libdns.Record
+	var err error
+	if csvColumns != nil {
+		desired, err = readCSVFile(args[1], *csvColumns)
+	} else {
+		desired, err = readRecordsFile(args[1])
+	}
+	if err != nil {
+		return err
+	}
+	lock, err := lockZone(ctx, zone, *lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	plan, err := p.Sync(ctx, zone, desired, *prune)
+	cache := cf.open(p.Token)
+	cache.invalidate(zone)
+	if saveErr := cache.save(); err == nil {
+		err = saveErr
+	}
+	notifyDrift(ctx, nf.notifier(), plan)
+	if errors.Is(err, dynv6.ErrNotConfirmed) {
+		return err
+	}
+	recordChange(j, "sync", zone, plan.Delete, plan.Create, err)
+	if *dryRun || *yes {
+		printPlan(os.Stdout, plan)
+	}
+	if err == nil && *check && !plan.Empty() {
+		return withCode(exitDrift, fmt.Errorf("drift detected in %s: %d record(s) to create, %d to delete", zone, len(plan.Create), len(plan.Delete)))
+	}
+	return err
+}
+
+// syncManifest syncs all zones of a manifest and reports the outcome per
+// zone. Changes are recorded in j unless it is nil. With dryRun, ctx must
+// carry dynv6.DryRun.
+func syncManifest(ctx context.Context, p *dynv6.Provider, cf *cacheFlags, j *journal.Journal, n notify.Notifier, load func() (*manifest.Manifest, error), lockTimeout time.Duration, dryRun, showPlans bool) (manifest.Results, error) {
+	m, err := load()
+	if err != nil {
+		return nil, err
+	}
+	zones := make([]string, 0, len(m.Zones))
+	for _, z := range m.Zones {
+		zones = append(zones, z.Zone)
+	}
+	// lock in a fixed order, so concurrent runs can't deadlock
+	sort.Strings(zones)
+	for _, zone := range zones {
+		lock, err := lockZone(ctx, zone, lockTimeout)
+		if err != nil {
+			return nil, err
+		}
+		defer lock.Unlock()
+	}
+	results, err := manifest.Sync(ctx, p, m)
+	recordReport(j, manifest.Report{Results: results})
+	cache := cf.open(p.Token)
+	for _, zone := range zones {
+		cache.invalidate(zone)
+	}
+	if saveErr := cache.save(); err == nil {
+		err = saveErr
+	}
+	for _, r := range results {
+		if r.Err == nil {
+			notifyDrift(ctx, n, r.Plan)
+		}
+		switch {
+		case r.Err != nil:
+			fmt.Printf("%s: failed: %v\n", r.Zone, r.Err)
+		case showPlans:
+			fmt.Printf("%s:\n", r.Zone)
+			printPlan(os.Stdout, r.Plan)
+		default:
+			fmt.Printf("%s: %d created, %d deleted\n", r.Zone, len(r.Plan.Create), len(r.Plan.Delete))
+		}
+	}
+	fmt.Printf("%d zone(s): %d record(s) created, %d deleted, %d zone(s) failed\n", len(results), results.Created(), results.Deleted(), len(results.Failed()))
+	applied := results.Created() + results.Deleted()
+	if dryRun {
+		// the plans of the other zones weren't applied, so a failed zone
+		// is an ordinary failure
+		applied = 0
+	}
+	return results, partialError(applied, err)
+}
+
+func runSyncValidate(ctx context.Context, args []string) error {
+	fs := newFlagSet("sync validate")
+	p := providerFlags(fs)
+	vars := varsFlag{}
+	fs.Var(vars, "var", "set a manifest variable, as `name=value`; may be repeated")
+	offline := fs.Bool("offline", false, "don't check that the zones exist in the account")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dynv6 sync validate [flags] <manifest>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return usageErrorf("expected manifest")
+	}
+	path := fs.Arg(0)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	m, problems := manifest.Validate(data, vars)
+	if len(problems) == 0 && !*offline {
+		if err := checkToken(p); err != nil {
+			return err
+		}
+		if problems, err = m.CheckZones(ctx, p); err != nil {
+			return err
+		}
+	}
+	for _, problem := range problems {
+		fmt.Printf("%s:%s\n", path, problem)
+	}
+	if len(problems) > 0 {
+		return validationError(fmt.Errorf("%s: %d problem(s) found", path, len(problems)))
+	}
+	fmt.Printf("%s: %d zone(s) OK\n", path, len(m.Zones))
+	return nil
+}
+
+func runSyncImport(args []string) error {
+	fs := newFlagSet("sync import")
+	format := fs.String("format", "bind", "format of the file: bind, a zone file as exported by Cloudflare, or octodns, an octoDNS YAML zone file")
+	prune := fs.Bool("prune", false, "set prune in the manifest")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dynv6 sync import [flags] <zone> <file>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return usageErrorf("expected zone and file")
+	}
+	zone, path := fs.Arg(0), fs.Arg(1)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var imp *manifest.Import
+	switch *format {
+	case "bind":
+		imp, err = manifest.ImportBIND(bytes.NewReader(data), zone)
+	case "octodns":
+		imp, err = manifest.ImportOctoDNS(data, zone)
+	default:
+		return usageErrorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return validationError(fmt.Errorf("%s: %v", path, err))
+	}
+	for _, skipped := range imp.Skipped {
+		fmt.Fprintf(os.Stderr, "skipped %s\n", skipped)
+	}
+	imp.Zone.Prune = *prune
+	b, err := json.MarshalIndent(manifest.Manifest{Zones: []manifest.Zone{imp.Zone}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", b)
+	return err
+}
+
+type notifyFlags struct {
+	webhook, ntfy, ntfyToken, exec string
+}
+
+// addNotifyFlags adds the flags of the notifiers of what, e.g. "detected
+// drift".
+func addNotifyFlags(fs *flag.FlagSet, what string) *notifyFlags {
+	nf := &notifyFlags{}
+	fs.StringVar(&nf.webhook, "notify-webhook", "", "post "+what+" as JSON to this URL")
+	fs.StringVar(&nf.ntfy, "notify-ntfy", "", "publish "+what+" to this ntfy topic URL")
+	fs.StringVar(&nf.ntfyToken, "notify-ntfy-token", "", "access token of the ntfy server")
+	fs.StringVar(&nf.exec, "notify-exec", "", "run this command for "+what+", with the details in DYNV6_* variables")
+	return nf
+}
+
+func (nf *notifyFlags) multi() notify.Multi {
+	var m notify.Multi
+	if nf.webhook != "" {
+		m = append(m, notify.Webhook{URL: nf.webhook})
+	}
+	if nf.ntfy != "" {
+		m = append(m, notify.Ntfy{URL: nf.ntfy, Token: nf.ntfyToken})
+	}
+	if nf.exec != "" {
+		m = append(m, notify.Exec{Command: strings.Fields(nf.exec)})
+	}
+	return m
+}
+
+// notifier returns the configured notifiers, or nil if there are none.
+func (nf *notifyFlags) notifier() notify.Notifier {
+	if m := nf.multi(); len(m) > 0 {
+		return m
+	}
+	return nil
+}
+
+// eventNotifier returns the configured notifiers, or nil if there are none.
+func (nf *notifyFlags) eventNotifier() notify.EventNotifier {
+	if m := nf.multi(); len(m) > 0 {
+		return m
+	}
+	return nil
+}
+
+// notifyDrift reports a non-empty plan, i.e. records differing from the
+// declared state. Failing to notify doesn't fail the command.
+func notifyDrift(ctx context.Context, n notify.Notifier, plan dynv6.Plan) {
+	if n == nil || plan.Empty() {
+		return
+	}
+	if err := n.Notify(ctx, notify.NewDrift(plan)); err != nil {
+		fmt.Fprintln(os.Stderr, "dynv6: sending the drift notification failed:", err)
+	}
+}
+
+// loadManifest reads and validates a manifest and expands its variables.
+// With prune set, all zones are pruned.
+func loadManifest(path string, vars map[string]string, prune bool) (*manifest.Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(path, data, vars, prune)
+}
+
+// parseManifest is loadManifest for a manifest read from path.
+func parseManifest(path string, data []byte, vars map[string]string, prune bool) (*manifest.Manifest, error) {
+	m, problems := manifest.Validate(data, vars)
+	if len(problems) > 0 {
+		return nil, validationError(fmt.Errorf("%s:%v", path, problems))
+	}
+	if err := m.Expand(vars); err != nil {
+		return nil, validationError(fmt.Errorf("%s: %v", path, err))
+	}
+	for i := range m.Zones {
+		m.Zones[i].Prune = m.Zones[i].Prune || prune
+	}
+	return m, nil
+}
+
+// varsFlag collects name=value flags.
+type varsFlag map[string]string
+
+func (v varsFlag) String() string { return "" }
+
+func (v varsFlag) Set(s string) error {
+	eq := strings.Index(s, "=")
+	if eq <= 0 {
+		return errors.New("expected name=value")
+	}
+	v[s[:eq]] = s[eq+1:]
+	return nil
+}
+
+// readRecordsFile parses a file with one record per line, or an export
+// written by dynv6 export.
+func readRecordsFile(path string) ([]libdns.Record, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		e, err := dynv6.ReadExport(bytes.NewReader(data))
+		if err != nil {
+			return nil, validationError(fmt.Errorf("%s: %v", path, err))
+		}
+		recs, err := e.Parse()
+		if err != nil {
+			return nil, validationError(fmt.Errorf("%s: %v", path, err))
+		}
+		return recs, nil
+	}
+	var recs []libdns.Record
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, validationError(fmt.Errorf("%s:%d: expected name, type and data", path, line))
+		}
+		// the data is the rest of the line and may contain spaces
+		data := strings.TrimSpace(text[len(fields[0]):])
+		data = strings.TrimSpace(data[len(fields[1]):])
+		rec, err := libdns.RR{Name: fields[0], Type: strings.ToUpper(fields[1]), Data: data}.Parse()
+		if err != nil {
+			return nil, validationError(fmt.Errorf("%s:%d: %v", path, line, err))
+		}
+		recs = append(recs, rec)
+	}
+	return recs, s.Err()
+}
+
+// readCSVFile reads the records of a CSV file, see dynv6.ReadCSV.
+func readCSVFile(path string, columns dynv6.CSVColumns) ([]libdns.Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	recs, err := dynv6.ReadCSV(f, columns)
+	if err != nil {
+		return nil, validationError(fmt.Errorf("%s: %v", path, err))
+	}
+	return recs, nil
+}
+
+// printPlan writes the plan, colored if f is a terminal.
+func printPlan(f *os.File, plan dynv6.Plan) {
+	render.Options{Color: render.ColorEnabled(f)}.Plan(f, plan)
+}
+
+// prompt asks a yes/no question. Anything but "y" or "yes", including the
+// end of the input, is a no.
+func prompt(r io.Reader, w io.Writer, question string) (bool, error) {
+	fmt.Fprintf(w, "%s [y/N] ", question)
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+func TestReadRecordsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records")
+	content := "# web\nwww A 192.0.2.1\n\ntxt TXT hello world\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := readRecordsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[1].RR().Data != "hello world" {
+		t.Fatalf("unexpected records %+v", recs)
+	}
+
+	ioutil.WriteFile(path, []byte("www A\n"), 0o600)
+	if _, err := readRecordsFile(path); err == nil || exitCode(err) != exitValidation || !strings.Contains(err.Error(), ":1:") {
+		t.Fatalf("got %v, want a validation error for line 1", err)
+	}
+
+	// exports are read as well
+	export := `{"version": 1, "zone": {"id": 1, "name": "example.dynv6.net"}, "records": [{"id": 7, "name": "@", "type": "MX", "data": "10 mail.example.org."}]}`
+	ioutil.WriteFile(path, []byte(export), 0o600)
+	recs, err = readRecordsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].RR().Type != "MX" || recs[0].RR().Data != "10 mail.example.org." {
+		t.Fatalf("unexpected records %+v", recs)
+	}
+	ioutil.WriteFile(path, []byte(`{"version": 2, "records": []}`), 0o600)
+	if _, err := readRecordsFile(path); err == nil || exitCode(err) != exitValidation {
+		t.Fatalf("got %v, want a validation error for a newer export", err)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	for input, want := range map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "": false, "maybe\n": false} {
+		var out strings.Builder
+		got, err := prompt(strings.NewReader(input), &out, "Apply?")
+		if err != nil || got != want {
+			t.Errorf("prompt(%q) = %v, %v, want %v", input, got, err, want)
+		}
+	}
+}
+
+func TestSyncCheck(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method != "GET":
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+			http.Error(w, "read only", http.StatusMethodNotAllowed)
+		case r.URL.Path == "/zones":
+			json.NewEncoder(w).Encode([]dynv6api.Zone{{ID: 1, Name: "example.dynv6.net"}})
+		case r.URL.Path == "/zones/by-name/example.dynv6.net":
+			json.NewEncoder(w).Encode(dynv6api.Zone{ID: 1, Name: "example.dynv6.net"})
+		case r.URL.Path == "/zones/1/records":
+			json.NewEncoder(w).Encode([]dynv6api.Record{{ID: 1, ZoneID: 1, Name: "www", Type: "A", Data: "192.0.2.1"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	check := func(content string) error {
+		path := filepath.Join(dir, "records")
+		if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return runSync(context.Background(), []string{"-token", "test", "-base-url", srv.URL, "-journal", "", "-check", "example.dynv6.net", path})
+	}
+	if err := check("www A 192.0.2.1\n"); err != nil {
+		t.Fatalf("no drift: got %v", err)
+	}
+	if err := check("www A 192.0.2.2\n"); exitCode(err) != exitDrift {
+		t.Fatalf("drift: got %v with code %d, want %d", err, exitCode(err), exitDrift)
+	}
+
+	// a failed zone of a manifest isn't a partial failure, nothing was
+	// applied; a zone missing from the account is reported as such
+	path := filepath.Join(dir, "dynv6.json")
+	manifest := `{"zones": [{"zone": "example.dynv6.net", "records": [{"name": "www", "type": "A", "data": "192.0.2.2"}]}, {"zone": "missing.dynv6.net", "records": []}]}`
+	if err := ioutil.WriteFile(path, []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, flag := range []string{"-check", "-dry-run"} {
+		err := runSync(context.Background(), []string{"-token", "test", "-base-url", srv.URL, "-journal", "", flag, "-manifest", path})
+		if exitCode(err) != exitZoneNotFound {
+			t.Fatalf("%s with a missing zone: got %v with code %d, want %d", flag, err, exitCode(err), exitZoneNotFound)
+		}
+	}
+}
+
+func TestPartialError(t *testing.T) {
+	if err := partialError(2, nil); err != nil {
+		t.Fatalf("got %v for a successful write", err)
+	}
+	if err := partialError(2, errors.New("boom")); exitCode(err) != exitPartial {
+		t.Fatalf("got code %d, want %d", exitCode(err), exitPartial)
+	}
+}
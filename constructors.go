@@ -0,0 +1,164 @@
+package dynv6
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// DefaultTTL is the TTL set by the New* constructors. dynv6 doesn't store
+// TTLs, so it only matters when the records are passed to other providers.
+const DefaultTTL = time.Hour
+
+// relativeRecordName checks that name is relative to the zone and returns it,
+// using "@" for the zone apex.
+func relativeRecordName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "@" {
+		return "@", nil
+	}
+	if strings.HasSuffix(name, ".") {
+		return "", fmt.Errorf("Name must be relative to the zone: %q", name)
+	}
+	if strings.Contains(name, "..") || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("Invalid name: %q", name)
+	}
+	return name, nil
+}
+
+// hostName checks that target is a non-empty host name.
+func hostName(target string) (string, error) {
+	target = strings.TrimSpace(target)
+	if target == "" || strings.ContainsAny(target, " \t") {
+		return "", fmt.Errorf("Invalid host name: %q", target)
+	}
+	return target, nil
+}
+
+func newAddress(name, ip string, v4 bool) (libdns.Address, error) {
+	name, err := relativeRecordName(name)
+	if err != nil {
+		return libdns.Address{}, err
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Zone() != "" || addr.Is4() != v4 || addr.Is4In6() {
+		kind := "IPv6"
+		if v4 {
+			kind = "IPv4"
+		}
+		return libdns.Address{}, fmt.Errorf("Invalid %s address: %q", kind, ip)
+	}
+	return libdns.Address{Name: name, TTL: DefaultTTL, IP: addr}, nil
+}
+
+// NewA returns an A record for the IPv4 address ip.
+func NewA(name, ip string) (libdns.Address, error) {
+	return newAddress(name, ip, true)
+}
+
+// NewAAAA returns an AAAA record for the IPv6 address ip.
+func NewAAAA(name, ip string) (libdns.Address, error) {
+	return newAddress(name, ip, false)
+}
+
+// NewTXT returns a TXT record with the given text.
+func NewTXT(name, text string) (libdns.TXT, error) {
+	name, err := relativeRecordName(name)
+	if err != nil {
+		return libdns.TXT{}, err
+	}
+	if text == "" {
+		return libdns.TXT{}, fmt.Errorf("Empty TXT record: %q", name)
+	}
+	return libdns.TXT{Name: name, TTL: DefaultTTL, Text: text}, nil
+}
+
+// NewCNAME returns a CNAME record pointing to target. The zone apex can't
+// have a CNAME record.
+func NewCNAME(name, target string) (libdns.CNAME, error) {
+	name, err := relativeRecordName(name)
+	if err != nil {
+		return libdns.CNAME{}, err
+	}
+	if name == "@" {
+		return libdns.CNAME{}, fmt.Errorf("CNAME records are not allowed at the zone apex")
+	}
+	target, err = hostName(target)
+	if err != nil {
+		return libdns.CNAME{}, err
+	}
+	return libdns.CNAME{Name: name, TTL: DefaultTTL, Target: target}, nil
+}
+
+// NewMX returns an MX record for the mail server target.
+func NewMX(name string, preference uint16, target string) (libdns.MX, error) {
+	name, err := relativeRecordName(name)
+	if err != nil {
+		return libdns.MX{}, err
+	}
+	target, err = hostName(target)
+	if err != nil {
+		return libdns.MX{}, err
+	}
+	return libdns.MX{Name: name, TTL: DefaultTTL, Preference: preference, Target: target}, nil
+}
+
+// NewSRV returns an SRV record for the service, e.g. ("sip", "tcp", "@", ...).
+// Service and proto may be given with or without the leading underscore.
+func NewSRV(service, proto, name string, priority, weight, port uint16, target string) (libdns.SRV, error) {
+	name, err := relativeRecordName(name)
+	if err != nil {
+		return libdns.SRV{}, err
+	}
+	service = strings.TrimPrefix(service, "_")
+	proto = strings.ToLower(strings.TrimPrefix(proto, "_"))
+	if service == "" {
+		return libdns.SRV{}, fmt.Errorf("Missing SRV service")
+	}
+	if proto != "tcp" && proto != "udp" && proto != "tls" {
+		return libdns.SRV{}, fmt.Errorf("Invalid SRV protocol: %q", proto)
+	}
+	if target != "." {
+		target, err = hostName(target)
+		if err != nil {
+			return libdns.SRV{}, err
+		}
+	}
+	return libdns.SRV{
+		Service:   service,
+		Transport: proto,
+		Name:      name,
+		TTL:       DefaultTTL,
+		Priority:  priority,
+		Weight:    weight,
+		Port:      port,
+		Target:    target,
+	}, nil
+}
+
+// NewCAA returns a CAA record. Tag must be one of issue, issuewild or iodef.
+func NewCAA(name string, flags uint8, tag, value string) (libdns.CAA, error) {
+	name, err := relativeRecordName(name)
+	if err != nil {
+		return libdns.CAA{}, err
+	}
+	if err := validateCAA(flags, tag); err != nil {
+		return libdns.CAA{}, err
+	}
+	return libdns.CAA{Name: name, TTL: DefaultTTL, Flags: flags, Tag: tag, Value: value}, nil
+}
+
+// validateCAA checks the flags and tag of a CAA record.
+func validateCAA(flags uint8, tag string) error {
+	if flags != 0 && flags != 128 {
+		return fmt.Errorf("Invalid CAA flags: %d", flags)
+	}
+	switch tag {
+	case "issue", "issuewild", "iodef":
+		return nil
+	}
+	return fmt.Errorf("Invalid CAA tag %q, must be issue, issuewild or iodef", tag)
+}
@@ -0,0 +1,157 @@
+package dynv6
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// CSVColumns maps record fields to the columns of a CSV file, each given by
+// its header, matched case-insensitively, or by its number, starting at 1.
+// Empty fields select the columns WriteCSV writes: "name", "type", "data"
+// and, if there is one, "ttl". Priority is optional and prepended to the
+// data of MX and SRV records, for spreadsheets keeping it apart.
+type CSVColumns struct {
+	Name, Type, Data, TTL, Priority string
+}
+
+// ParseCSVColumns parses a column mapping like
+// "name=Host,type=Record Type,data=Value,priority=4".
+func ParseCSVColumns(s string) (CSVColumns, error) {
+	var c CSVColumns
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		i := strings.Index(part, "=")
+		if i < 0 {
+			return c, fmt.Errorf("Invalid column mapping %q, expected field=column", part)
+		}
+		field, column := strings.ToLower(strings.TrimSpace(part[:i])), strings.TrimSpace(part[i+1:])
+		switch field {
+		case "name":
+			c.Name = column
+		case "type":
+			c.Type = column
+		case "data":
+			c.Data = column
+		case "ttl":
+			c.TTL = column
+		case "priority":
+			c.Priority = column
+		default:
+			return c, fmt.Errorf("Unknown record field %q, expected name, type, data, ttl or priority", field)
+		}
+	}
+	return c, nil
+}
+
+// WriteCSV writes the exported records as CSV with a header, for editing
+// in a spreadsheet. ReadCSV reads them back.
+func (e *Export) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "type", "data", "id", "expandedData"})
+	for _, r := range e.Records {
+		cw.Write([]string{r.Name, r.Type, r.Data, strconv.FormatInt(r.ID, 10), r.ExpandedData})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV parses the records of a CSV file whose first row is a header,
+// e.g. to apply them with Sync. Empty rows and rows starting with # are
+// skipped; other columns are ignored.
+func ReadCSV(r io.Reader, columns CSVColumns) ([]libdns.Record, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("Missing CSV header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	find := func(field, column string, required bool) (int, error) {
+		explicit := column != ""
+		if !explicit {
+			column = field
+		}
+		if n, err := strconv.Atoi(column); err == nil {
+			if n < 1 || n > len(header) {
+				return 0, fmt.Errorf("Column %d of %s is out of range, the file has %d columns", n, field, len(header))
+			}
+			return n - 1, nil
+		}
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), column) {
+				return i, nil
+			}
+		}
+		if required || explicit {
+			return 0, fmt.Errorf("No column %q for the %s of records", column, field)
+		}
+		return -1, nil
+	}
+	var idx [5]int
+	for i, c := range []struct {
+		field, column string
+		required      bool
+	}{
+		{"name", columns.Name, true},
+		{"type", columns.Type, true},
+		{"data", columns.Data, true},
+		{"ttl", columns.TTL, false},
+		{"priority", columns.Priority, false},
+	} {
+		if idx[i], err = find(c.field, c.column, c.required); err != nil {
+			return nil, err
+		}
+	}
+	var recs []libdns.Record
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		cell := func(i int) string {
+			if i < 0 || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		if strings.Join(row, "") == "" {
+			continue
+		}
+		rr := libdns.RR{Name: cell(idx[0]), Type: strings.ToUpper(cell(idx[1])), Data: cell(idx[2])}
+		if rr.Name == "" {
+			rr.Name = "@"
+		}
+		if ttl := cell(idx[3]); ttl != "" {
+			secs, err := strconv.Atoi(ttl)
+			if err != nil || secs < 0 {
+				return nil, fmt.Errorf("Line %d: invalid TTL %q", line, ttl)
+			}
+			rr.TTL = time.Duration(secs) * time.Second
+		}
+		if prio := cell(idx[4]); prio != "" && (rr.Type == "MX" || rr.Type == "SRV") {
+			rr.Data = prio + " " + rr.Data
+		}
+		rec, err := rr.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %v", line, err)
+		}
+		recs = append(recs, rec)
+	}
+}
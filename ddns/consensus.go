@@ -0,0 +1,98 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PublicDetectors returns detectors for independent public services, to be
+// combined with Consensus.
+func PublicDetectors() []Detector {
+	return []Detector{
+		HTTPDetector{},
+		HTTPDetector{URL4: "https://ipv4.icanhazip.com", URL6: "https://ipv6.icanhazip.com"},
+		HTTPDetector{URL4: "https://v4.ident.me", URL6: "https://v6.ident.me"},
+	}
+}
+
+// Consensus asks several detectors at once and only returns an address
+// reported by a quorum of them, so a single broken or hijacked service can't
+// push a wrong address into DNS. Detectors which fail don't vote, so the
+// others are a fallback as long as they reach the quorum. IPv4 and IPv6 are
+// decided independently.
+type Consensus struct {
+	// Detectors are asked in parallel. Defaults to PublicDetectors.
+	Detectors []Detector
+
+	// Quorum is how many detectors must report the same address. Defaults
+	// to a majority of the detectors.
+	Quorum int
+
+	// Timeout limits each detector. Defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// Detect implements Detector.
+func (c Consensus) Detect(ctx context.Context, network string) (netip.Addr, error) {
+	detectors := c.Detectors
+	if len(detectors) == 0 {
+		detectors = PublicDetectors()
+	}
+	quorum := c.Quorum
+	if quorum <= 0 || quorum > len(detectors) {
+		quorum = len(detectors)/2 + 1
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	addrs := make([]netip.Addr, len(detectors))
+	errs := make([]error, len(detectors))
+	var wg sync.WaitGroup
+	for i, d := range detectors {
+		wg.Add(1)
+		go func(i int, d Detector) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			addrs[i], errs[i] = d.Detect(ctx, network)
+		}(i, d)
+	}
+	wg.Wait()
+
+	votes := map[netip.Addr]int{}
+	var failed []string
+	for i, addr := range addrs {
+		if errs[i] != nil {
+			failed = append(failed, errs[i].Error())
+			continue
+		}
+		if addr = addr.Unmap(); addr.Is4() != (network != "ip6") {
+			failed = append(failed, fmt.Sprintf("got %s for %s", addr, network))
+			continue
+		}
+		votes[addr]++
+	}
+	var results []string
+	for addr, n := range votes {
+		if n >= quorum {
+			return addr, nil
+		}
+		results = append(results, fmt.Sprintf("%s (%d)", addr, n))
+	}
+	sort.Strings(results)
+	msg := fmt.Sprintf("no %s address reported by %d of %d detectors", network, quorum, len(detectors))
+	if len(results) > 0 {
+		msg += "; got " + strings.Join(results, ", ")
+	}
+	if len(failed) > 0 {
+		msg += "; failed: " + strings.Join(failed, "; ")
+	}
+	return netip.Addr{}, errors.New(msg)
+}
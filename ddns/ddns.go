@@ -0,0 +1,367 @@
+// Package ddns keeps address records of dynv6 zones pointed at the public
+// addresses of the host, like a classic dynamic DNS client. Updates that
+// can't be applied, e.g. because a router booted without WAN connectivity,
+// are queued, optionally on disk, and replayed once the API is reachable.
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/internal/drain"
+	"github.com/libdns/dynv6/notify"
+	"github.com/libdns/libdns"
+)
+
+// Detector finds the public address of the host for a network, "ip4" or
+// "ip6".
+type Detector interface {
+	Detect(ctx context.Context, network string) (netip.Addr, error)
+}
+
+// DetectorFunc adapts a function to a Detector.
+type DetectorFunc func(ctx context.Context, network string) (netip.Addr, error)
+
+// Detect implements Detector.
+func (f DetectorFunc) Detect(ctx context.Context, network string) (netip.Addr, error) {
+	return f(ctx, network)
+}
+
+// HTTPDetector asks a web service which answers with the address of the
+// client in plain text.
+type HTTPDetector struct {
+	// URL4 and URL6 are the services used for IPv4 and IPv6. They default
+	// to https://api.ipify.org and https://api6.ipify.org.
+	URL4, URL6 string
+
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Detect implements Detector.
+func (d HTTPDetector) Detect(ctx context.Context, network string) (netip.Addr, error) {
+	url := d.URL4
+	if network == "ip6" {
+		url = d.URL6
+		if url == "" {
+			url = "https://api6.ipify.org"
+		}
+	} else if url == "" {
+		url = "https://api.ipify.org"
+	}
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return netip.Addr{}, fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	b, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, 256))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(string(b)))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%s: %v", url, err)
+	}
+	if addr = addr.Unmap(); addr.Is4() != (network != "ip6") {
+		return netip.Addr{}, fmt.Errorf("%s: got %s for %s", url, addr, network)
+	}
+	return addr, nil
+}
+
+// Updater points the address records of a set of names at the addresses
+// found by its Detector.
+type Updater struct {
+	// Provider writes the records. It is required.
+	Provider libdns.RecordSetter
+
+	// Zone the names belong to, e.g. "example.dynv6.net". It is required.
+	Zone string
+
+	// Names are the record names relative to the zone; "@" is the apex,
+	// whose addresses are written with UpsertAddress if the Provider is an
+	// AddressUpserter. Defaults to the apex only.
+	Names []string
+
+	// Networks are the address families kept up to date, "ip4" and "ip6".
+	// Defaults to both.
+	Networks []string
+
+	// Detector finds the public addresses. Defaults to HTTPDetector{}.
+	Detector Detector
+
+	// Interval between updates in Run. Defaults to 5 minutes.
+	Interval time.Duration
+
+	// MaxInterval caps the interval while updates keep failing, e.g. while
+	// the API is down or the token was revoked: it doubles with every failed
+	// update up to MaxInterval and is reset by a successful one. Defaults to
+	// an hour.
+	MaxInterval time.Duration
+
+	// TTL of the written records. If zero, the provider's default is used.
+	TTL time.Duration
+
+	// AdjustTTL lowers a TTL above dynv6.MaxDynamicTTL to
+	// dynv6.SuggestedDynamicTTL instead of only warning about it.
+	AdjustTTL bool
+
+	// OnWarning, if set, is called once per record with a TTL long enough
+	// to keep clients on an old address, see dynv6.CheckTTL. Warnings are
+	// also written to ErrorLog.
+	OnWarning func(dynv6.Warning)
+
+	// Queue holds the updates that couldn't be written yet. If nil, an
+	// in-memory queue is used, which is lost on restart; use OpenQueue to
+	// keep it on disk.
+	Queue *Queue
+
+	// State holds the last published addresses, whose updates are skipped.
+	// If nil, an in-memory state is used, so every address is written again
+	// after a restart; use OpenState to keep it on disk.
+	State *State
+
+	// StateMaxAge is how long State is trusted: once an update in it is
+	// older, the state is forgotten and all records are written again, so
+	// records changed or deleted outside of the updater are repaired.
+	// Defaults to a day; a negative value keeps the state forever.
+	StateMaxAge time.Duration
+
+	// ErrorLog receives errors of single networks and of updates in Run. If
+	// nil, the standard logger is used.
+	ErrorLog *log.Logger
+
+	// Notifier, if set, is sent the events of the updater, see
+	// EventAddressChanged and the other Event constants, so silently broken
+	// updates get noticed.
+	Notifier notify.EventNotifier
+
+	// FailureThreshold is how many consecutive updates of Run must fail
+	// before EventUpdateFailing is sent. Defaults to 3.
+	FailureThreshold int
+
+	// OnUpdate, if set, is called with the result of every update in Run.
+	OnUpdate func(err error)
+
+	// DrainTimeout is how long an update in progress may continue once the
+	// context of Run is done. Queued updates are replayed a last time
+	// within it.
+	DrainTimeout time.Duration
+
+	warned map[string]bool
+}
+
+func (u *Updater) logf(format string, args ...interface{}) {
+	if u.ErrorLog != nil {
+		u.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+func (u *Updater) names() []string {
+	if len(u.Names) == 0 {
+		return []string{"@"}
+	}
+	return u.Names
+}
+
+func (u *Updater) networks() []string {
+	if len(u.Networks) == 0 {
+		return []string{"ip4", "ip6"}
+	}
+	return u.Networks
+}
+
+func (u *Updater) stateMaxAge() time.Duration {
+	if u.StateMaxAge == 0 {
+		return 24 * time.Hour
+	}
+	return u.StateMaxAge
+}
+
+func (u *Updater) detector() Detector {
+	if u.Detector == nil {
+		return HTTPDetector{}
+	}
+	return u.Detector
+}
+
+// Update detects the current addresses, queues the records that changed
+// and replays the queue. It fails if no address could be detected or the
+// queue couldn't be written.
+func (u *Updater) Update(ctx context.Context) error {
+	if u.Provider == nil || u.Zone == "" {
+		return errors.New("ddns: provider and zone are required")
+	}
+	if u.Queue == nil {
+		u.Queue = new(Queue)
+	}
+	if u.State == nil {
+		u.State = new(State)
+	}
+	if maxAge := u.stateMaxAge(); maxAge > 0 && u.State.publishedBefore(time.Now().Add(-maxAge)) {
+		if err := u.State.Forget(); err != nil {
+			return err
+		}
+	}
+	var detected int
+	var detectErr error
+	for _, network := range u.networks() {
+		addr, err := u.detector().Detect(ctx, network)
+		if err != nil {
+			u.logf("ddns: detecting %s address: %v", network, err)
+			detectErr = err
+			continue
+		}
+		detected++
+		typ := "A"
+		if addr.Is6() {
+			typ = "AAAA"
+		}
+		for _, name := range u.names() {
+			up := Update{Zone: u.Zone, Name: name, Type: typ, Data: addr.String(), TTL: u.TTL, Queued: time.Now()}
+			up.TTL = u.checkTTL(up)
+			if u.State.Published(up) {
+				// a queued change back from this address is stale
+				if err := u.Queue.discard(up); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := u.Queue.Add(up); err != nil {
+				return err
+			}
+		}
+	}
+	if detected == 0 {
+		return fmt.Errorf("ddns: no address detected: %v", detectErr)
+	}
+	applied, err := u.Queue.Replay(ctx, u.Provider)
+	u.notifyApplied(ctx, applied)
+	if stateErr := u.State.Record(applied...); stateErr != nil && err == nil {
+		err = stateErr
+	}
+	return err
+}
+
+// backoff returns the interval after the given number of consecutive
+// failures, doubling interval per failure up to max.
+func backoff(interval, max time.Duration, failures int) time.Duration {
+	if max < interval {
+		return interval
+	}
+	d := interval
+	for i := 0; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// checkTTL warns about a TTL unsuited for dynamic addresses and returns the
+// TTL to write.
+func (u *Updater) checkTTL(up Update) time.Duration {
+	w := dynv6.CheckTTL(dynv6.PurposeDynamic, up.Zone, libdns.RR{Name: up.Name, Type: up.Type, TTL: up.TTL})
+	if w == nil {
+		return up.TTL
+	}
+	if u.warned == nil {
+		u.warned = map[string]bool{}
+	}
+	if !u.warned[up.key()] {
+		u.warned[up.key()] = true
+		if u.AdjustTTL {
+			w.Message += fmt.Sprintf(", writing %v instead", w.SuggestedTTL)
+		}
+		u.logf("%s", w.Message)
+		if u.OnWarning != nil {
+			u.OnWarning(*w)
+		}
+	}
+	if u.AdjustTTL {
+		return w.SuggestedTTL
+	}
+	return up.TTL
+}
+
+// Run updates the records every Interval until ctx is canceled, backing
+// off up to MaxInterval while updates fail. Failures are logged when they
+// start and whenever the count doubles, not every time. An update in
+// progress continues for up to DrainTimeout once ctx is canceled; if it
+// doesn't finish in time, it is canceled and Run returns an error wrapping
+// context.DeadlineExceeded.
+func (u *Updater) Run(ctx context.Context) error {
+	interval := u.Interval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	maxInterval := u.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = time.Hour
+	}
+	work, finish := drain.Context(ctx, u.DrainTimeout)
+	var failures int
+	var notice failureNotice
+	for ctx.Err() == nil {
+		err := u.Update(work)
+		delay := interval
+		if work.Err() == nil {
+			streak := failures
+			if err != nil {
+				streak++
+			}
+			notice.observe(work, u, streak, err)
+		}
+		switch {
+		case err != nil && work.Err() == nil:
+			failures++
+			delay = backoff(interval, maxInterval, failures)
+			// 1, 2, 4, 8, ... failures
+			if failures&(failures-1) == 0 {
+				u.logf("ddns: %v (%d failed update(s), next in %s)", err, failures, delay)
+			}
+		case err == nil && failures > 0:
+			u.logf("ddns: updated again after %d failed update(s)", failures)
+			failures = 0
+		}
+		if u.OnUpdate != nil {
+			u.OnUpdate(err)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	if u.Queue != nil && u.Queue.Len() > 0 && work.Err() == nil {
+		if _, err := u.Queue.Replay(work, u.Provider); err != nil {
+			u.logf("ddns: replaying the queue on shutdown: %v", err)
+		}
+	}
+	if err := finish(); err != nil {
+		return fmt.Errorf("ddns: %w", err)
+	}
+	return ctx.Err()
+}
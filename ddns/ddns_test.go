@@ -0,0 +1,552 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/dynv6/notify"
+	"github.com/libdns/libdns"
+)
+
+// fakeSetter records the written records and fails while offline is set.
+type fakeSetter struct {
+	mu      sync.Mutex
+	offline bool
+	records map[string]string
+	writes  int
+}
+
+func (f *fakeSetter) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.offline {
+		return nil, errors.New("network is unreachable")
+	}
+	if f.records == nil {
+		f.records = map[string]string{}
+	}
+	for _, r := range recs {
+		rr := r.RR()
+		f.records[zone+" "+rr.Name+" "+rr.Type] = rr.Data
+		f.writes++
+	}
+	return recs, nil
+}
+
+func staticDetector(addrs ...string) Detector {
+	return DetectorFunc(func(ctx context.Context, network string) (netip.Addr, error) {
+		for _, a := range addrs {
+			addr := netip.MustParseAddr(a)
+			if addr.Is4() == (network == "ip4") {
+				return addr, nil
+			}
+		}
+		return netip.Addr{}, errors.New("no address")
+	})
+}
+
+func TestOfflineReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	q, err := OpenQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setter := &fakeSetter{offline: true}
+	u := &Updater{
+		Provider: setter,
+		Zone:     "example.dynv6.net",
+		Names:    []string{"@", "home"},
+		Detector: staticDetector("192.0.2.1", "2001:db8::1"),
+		Queue:    q,
+	}
+	if err := u.Update(context.Background()); err == nil {
+		t.Fatal("expected an error while offline")
+	}
+	u.Detector = staticDetector("192.0.2.2", "2001:db8::1")
+	u.Update(context.Background())
+	if n := q.Len(); n != 4 {
+		t.Fatalf("got %d queued updates, want 4", n)
+	}
+
+	// after a restart the queue is replayed from disk, with the latest
+	// address of each record
+	q, err = OpenQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := q.Len(); n != 4 {
+		t.Fatalf("got %d updates after reopening, want 4", n)
+	}
+	setter.offline = false
+	if _, err := q.Replay(context.Background(), setter); err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 0 || setter.writes != 4 {
+		t.Fatalf("%d updates left, %d writes", q.Len(), setter.writes)
+	}
+	if got := setter.records["example.dynv6.net home A"]; got != "192.0.2.2" {
+		t.Fatalf("got %s, want the latest address", got)
+	}
+	if q, _ := OpenQueue(path); q.Len() != 0 {
+		t.Fatal("replayed updates still stored")
+	}
+}
+
+// fakeUpserter is a fakeSetter writing the apex addresses of the zone.
+type fakeUpserter struct {
+	fakeSetter
+	apex []string
+}
+
+func (f *fakeUpserter) UpsertAddress(ctx context.Context, fqdn string, addrs []netip.Addr) ([]libdns.Record, error) {
+	for _, a := range addrs {
+		f.apex = append(f.apex, fqdn+" "+a.String())
+	}
+	return nil, nil
+}
+
+func TestApexAddresses(t *testing.T) {
+	setter := &fakeUpserter{}
+	u := &Updater{
+		Provider: setter,
+		Zone:     "example.dynv6.net",
+		Names:    []string{"@", "home"},
+		Detector: staticDetector("192.0.2.1", "2001:db8::1"),
+	}
+	if err := u.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(setter.apex) != "[example.dynv6.net. 192.0.2.1 example.dynv6.net. 2001:db8::1]" {
+		t.Fatalf("apex addresses %v", setter.apex)
+	}
+	if setter.writes != 2 || setter.records["example.dynv6.net @ A"] != "" {
+		t.Fatalf("records written %v", setter.records)
+	}
+}
+
+func TestUpdateSkipsUnchanged(t *testing.T) {
+	setter := &fakeSetter{}
+	u := &Updater{
+		Provider: setter,
+		Zone:     "example.dynv6.net",
+		Networks: []string{"ip4"},
+		Detector: staticDetector("192.0.2.1"),
+	}
+	for i := 0; i < 3; i++ {
+		if err := u.Update(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if setter.writes != 1 {
+		t.Fatalf("got %d writes, want 1", setter.writes)
+	}
+}
+
+func TestUpdateDiscardsStaleQueued(t *testing.T) {
+	setter := &fakeSetter{}
+	u := &Updater{
+		Provider: setter,
+		Zone:     "example.dynv6.net",
+		Networks: []string{"ip4"},
+		Detector: staticDetector("192.0.2.1"),
+	}
+	if err := u.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	setter.offline = true
+	u.Detector = staticDetector("192.0.2.2")
+	if err := u.Update(context.Background()); err == nil {
+		t.Fatal("expected an error while offline")
+	}
+	// the address returns to the published one before the queue is replayed
+	setter.offline = false
+	u.Detector = staticDetector("192.0.2.1")
+	if err := u.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if u.Queue.Len() != 0 || setter.writes != 1 {
+		t.Fatalf("%d updates left, %d writes", u.Queue.Len(), setter.writes)
+	}
+	if got := setter.records["example.dynv6.net @ A"]; got != "192.0.2.1" {
+		t.Fatalf("got %s, want 192.0.2.1", got)
+	}
+}
+
+func TestStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	setter := &fakeSetter{}
+	for boot := 0; boot < 3; boot++ {
+		state, err := OpenState(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := &Updater{
+			Provider: setter,
+			Zone:     "example.dynv6.net",
+			Networks: []string{"ip4"},
+			Detector: staticDetector("192.0.2.1"),
+			State:    state,
+		}
+		if err := u.Update(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if setter.writes != 1 {
+		t.Fatalf("got %d writes across restarts, want 1", setter.writes)
+	}
+	state, err := OpenState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &Updater{Provider: setter, Zone: "example.dynv6.net", Networks: []string{"ip4"}, Detector: staticDetector("192.0.2.2"), State: state}
+	if err := u.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if setter.writes != 2 || setter.records["example.dynv6.net @ A"] != "192.0.2.2" {
+		t.Fatalf("changed address not written: %v", setter.records)
+	}
+}
+
+func TestStateMaxAge(t *testing.T) {
+	setter := &fakeSetter{}
+	u := &Updater{
+		Provider:    setter,
+		Zone:        "example.dynv6.net",
+		Networks:    []string{"ip4"},
+		Detector:    staticDetector("192.0.2.1"),
+		StateMaxAge: time.Hour,
+	}
+	if err := u.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the record was deleted in the web interface meanwhile
+	setter.records = nil
+	for k, up := range u.State.published {
+		up.Queued = up.Queued.Add(-2 * time.Hour)
+		u.State.published[k] = up
+	}
+	if err := u.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if setter.writes != 2 || setter.records["example.dynv6.net @ A"] != "192.0.2.1" {
+		t.Fatalf("expired state not forgotten: %d writes, %v", setter.writes, setter.records)
+	}
+	if err := u.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if setter.writes != 2 {
+		t.Fatalf("got %d writes, want 2 with a fresh state", setter.writes)
+	}
+}
+
+func TestAdjustTTL(t *testing.T) {
+	var written []libdns.Record
+	var warnings []dynv6.Warning
+	u := &Updater{
+		Provider: setterFunc(func(recs []libdns.Record) { written = append(written, recs...) }),
+		Zone:     "example.dynv6.net",
+		Networks: []string{"ip4"},
+		Detector: staticDetector("192.0.2.1"),
+		TTL:      time.Hour,
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+	u.OnWarning = func(w dynv6.Warning) { warnings = append(warnings, w) }
+	if err := u.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || warnings[0].Code != dynv6.WarnDynamicTTL || written[0].RR().TTL != time.Hour {
+		t.Fatalf("got warnings %+v, records %+v", warnings, written)
+	}
+
+	u.AdjustTTL = true
+	u.Detector = staticDetector("192.0.2.2")
+	if err := u.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("warned %d times about the same record", len(warnings))
+	}
+	if ttl := written[1].RR().TTL; ttl != dynv6.SuggestedDynamicTTL {
+		t.Fatalf("wrote TTL %v, want %v", ttl, dynv6.SuggestedDynamicTTL)
+	}
+}
+
+type setterFunc func(recs []libdns.Record)
+
+func (f setterFunc) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	f(recs)
+	return recs, nil
+}
+
+func TestHTTPDetector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.7\n"))
+	}))
+	defer srv.Close()
+	d := HTTPDetector{URL4: srv.URL, URL6: srv.URL}
+	addr, err := d.Detect(context.Background(), "ip4")
+	if err != nil || addr != netip.MustParseAddr("192.0.2.7") {
+		t.Fatalf("got %v, %v", addr, err)
+	}
+	if _, err := d.Detect(context.Background(), "ip6"); err == nil {
+		t.Fatal("accepted an IPv4 address for ip6")
+	}
+}
+
+func TestConsensus(t *testing.T) {
+	failing := DetectorFunc(func(ctx context.Context, network string) (netip.Addr, error) {
+		return netip.Addr{}, errors.New("service down")
+	})
+	good := staticDetector("192.0.2.7", "2001:db8::7")
+	wrong := staticDetector("198.51.100.1", "2001:db8::7")
+	c := Consensus{Detectors: []Detector{good, wrong, good}}
+	if addr, err := c.Detect(context.Background(), "ip4"); err != nil || addr != netip.MustParseAddr("192.0.2.7") {
+		t.Fatalf("got %v, %v, want the majority", addr, err)
+	}
+	// the families are decided separately
+	if addr, err := c.Detect(context.Background(), "ip6"); err != nil || addr != netip.MustParseAddr("2001:db8::7") {
+		t.Fatalf("got %v, %v", addr, err)
+	}
+	c = Consensus{Detectors: []Detector{good, wrong, failing}}
+	if _, err := c.Detect(context.Background(), "ip4"); err == nil {
+		t.Fatal("no majority was accepted")
+	}
+	// a failing detector doesn't count against a lower quorum
+	c = Consensus{Detectors: []Detector{good, failing, good}, Quorum: 2}
+	if _, err := c.Detect(context.Background(), "ip4"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSTUNDetector(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		req := make([]byte, 1500)
+		n, from, err := conn.ReadFrom(req)
+		if err != nil || n < 20 {
+			return
+		}
+		// a binding response with XOR-MAPPED-ADDRESS 192.0.2.7:4242
+		resp := make([]byte, 32)
+		binary.BigEndian.PutUint16(resp[0:], stunBindingResponse)
+		binary.BigEndian.PutUint16(resp[2:], 12)
+		copy(resp[4:20], req[4:20])
+		binary.BigEndian.PutUint16(resp[20:], stunXORMappedAddress)
+		binary.BigEndian.PutUint16(resp[22:], 8)
+		resp[25] = 0x01
+		binary.BigEndian.PutUint16(resp[26:], 4242^stunMagicCookie>>16)
+		for i, b := range []byte{192, 0, 2, 7} {
+			resp[28+i] = b ^ req[4+i]
+		}
+		conn.WriteTo(resp, from)
+	}()
+	addr, err := STUNDetector{Server: conn.LocalAddr().String()}.Detect(context.Background(), "ip4")
+	if err != nil || addr != netip.MustParseAddr("192.0.2.7") {
+		t.Fatalf("got %v, %v", addr, err)
+	}
+}
+
+func TestInterfaceDetector(t *testing.T) {
+	flags := parseIfInet6([]byte(`20010db8000000000000000000000001 02 40 00 80     eth0
+20010db8000000001c2d3e4f5a6b7c8d 02 40 00 01     eth0
+20010db8000000000000000000000002 02 40 00 a0     eth0
+fe800000000000000000000000000001 02 40 20 80     eth0
+20010db8000000000000000000000003 03 40 00 80     wlan0
+`), "eth0")
+	if len(flags) != 4 || flags[netip.MustParseAddr("2001:db8::1c2d:3e4f:5a6b:7c8d")] != ifaFlagTemporary {
+		t.Fatalf("got %v", flags)
+	}
+	var addrs []ifaceAddr
+	for _, a := range []string{"fe80::1", "fd00::1", "2001:db8::1c2d:3e4f:5a6b:7c8d", "2001:db8::2", "2001:db8::1", "192.168.1.2", "203.0.113.7"} {
+		addr := netip.MustParseAddr(a)
+		addrs = append(addrs, ifaceAddr{addr: addr, flags: flags[addr]})
+	}
+	for _, tc := range []struct {
+		d       InterfaceDetector
+		network string
+		want    string
+	}{
+		{InterfaceDetector{}, "ip6", "2001:db8::1"},
+		{InterfaceDetector{}, "ip4", "203.0.113.7"},
+		{InterfaceDetector{IncludePrivate: true}, "ip6", "fd00::1"},
+		{InterfaceDetector{IncludePrivate: true}, "ip4", "192.168.1.2"},
+		{InterfaceDetector{IncludeTemporary: true}, "ip6", "2001:db8::1c2d:3e4f:5a6b:7c8d"},
+		{InterfaceDetector{IncludeDeprecated: true}, "ip6", "2001:db8::2"},
+	} {
+		got, ok := tc.d.selectAddr(addrs, tc.network)
+		if !ok || got != netip.MustParseAddr(tc.want) {
+			t.Errorf("%+v %s: got %v, want %s", tc.d, tc.network, got, tc.want)
+		}
+	}
+	if got, ok := (InterfaceDetector{}).selectAddr(addrs[:3], "ip6"); ok {
+		t.Errorf("got %v from link-local, private and temporary addresses", got)
+	}
+}
+
+func TestInterfaceID(t *testing.T) {
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	id, err := EUI64(mac)
+	if err != nil || id.String() != "::211:22ff:fe33:4455" {
+		t.Fatalf("got %v, %v", id, err)
+	}
+	if parsed, err := ParseInterfaceID(id.String()); err != nil || parsed != id {
+		t.Fatalf("got %v, %v", parsed, err)
+	}
+	if _, err := ParseInterfaceID("2001:db8::1"); err == nil {
+		t.Fatal("accepted an address as interface ID")
+	}
+	addr, err := id.In(netip.MustParsePrefix("2001:db8:1:2::/64"))
+	if err != nil || addr != netip.MustParseAddr("2001:db8:1:2:211:22ff:fe33:4455") {
+		t.Fatalf("got %v, %v", addr, err)
+	}
+	if _, err := id.In(netip.MustParsePrefix("2001:db8::/96")); err == nil {
+		t.Fatal("accepted a /96")
+	}
+
+	secret := []byte("secret")
+	a := StablePrivacyID(netip.MustParsePrefix("2001:db8:1:2::/64"), "eth0", nil, 0, secret)
+	if b := StablePrivacyID(netip.MustParsePrefix("2001:db8:1:2::1/64"), "eth0", nil, 0, secret); a != b {
+		t.Fatal("stable ID changed within the prefix")
+	}
+	if b := StablePrivacyID(netip.MustParsePrefix("2001:db8:1:3::/64"), "eth0", nil, 0, secret); a == b {
+		t.Fatal("stable ID didn't change with the prefix")
+	}
+
+	d := PrefixDetector{Detector: staticDetector("192.0.2.7", "2001:db8:1:2::99"), ID: id}
+	if addr, err := d.Detect(context.Background(), "ip6"); err != nil || addr != netip.MustParseAddr("2001:db8:1:2:211:22ff:fe33:4455") {
+		t.Fatalf("got %v, %v", addr, err)
+	}
+	if addr, err := d.Detect(context.Background(), "ip4"); err != nil || addr != netip.MustParseAddr("192.0.2.7") {
+		t.Fatalf("got %v, %v", addr, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for failures, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute} {
+		if got := backoff(time.Minute, 10*time.Minute, failures); got != want {
+			t.Errorf("%d failures: got %s, want %s", failures, got, want)
+		}
+	}
+	if got := backoff(time.Hour, time.Minute, 3); got != time.Hour {
+		t.Errorf("got %s, want the interval if it exceeds the maximum", got)
+	}
+}
+
+func TestRunLogsEscalating(t *testing.T) {
+	var logs lockedBuffer
+	var mu sync.Mutex
+	var failures int
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	u := &Updater{
+		Provider:    &fakeSetter{offline: true},
+		Zone:        "example.dynv6.net",
+		Networks:    []string{"ip4"},
+		Detector:    staticDetector("192.0.2.1"),
+		Interval:    time.Millisecond,
+		MaxInterval: 2 * time.Millisecond,
+		ErrorLog:    log.New(&logs, "", 0),
+		OnUpdate: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if failures++; failures == 10 {
+				cancel()
+			}
+		},
+	}
+	u.Run(ctx)
+	// failures 1, 2, 4 and 8 are logged
+	if n := strings.Count(logs.String(), "failed update(s)"); n != 4 {
+		t.Fatalf("logged %d times in 10 failures, want 4:\n%s", n, logs.String())
+	}
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var kinds []string
+	var runs int
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rejected := &dynv6api.AuthError{Reason: dynv6api.AuthInvalidToken, Err: &dynv6api.Error{StatusCode: http.StatusUnauthorized}}
+	u := &Updater{
+		Provider: libdnsSetterFunc(func(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if runs < 4 {
+				return nil, rejected
+			}
+			return recs, nil
+		}),
+		Zone:        "example.dynv6.net",
+		Names:       []string{"home"},
+		Networks:    []string{"ip4"},
+		Detector:    staticDetector("192.0.2.1"),
+		Interval:    time.Millisecond,
+		MaxInterval: time.Millisecond,
+		ErrorLog:    log.New(ioutil.Discard, "", 0),
+		Notifier: notify.EventNotifierFunc(func(ctx context.Context, e notify.Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			kinds = append(kinds, e.Kind)
+			if e.Kind == EventAddressChanged && e.Fields["address"] != "192.0.2.1" {
+				t.Errorf("unexpected fields %v", e.Fields)
+			}
+			return nil
+		}),
+		OnUpdate: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if runs++; runs == 6 {
+				cancel()
+			}
+		},
+	}
+	u.Run(ctx)
+	want := []string{EventTokenInvalid, EventUpdateFailing, EventAddressChanged, EventRecovered}
+	if strings.Join(kinds, " ") != strings.Join(want, " ") {
+		t.Fatalf("got events %v, want %v", kinds, want)
+	}
+}
+
+type libdnsSetterFunc func(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error)
+
+func (f libdnsSetterFunc) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return f(ctx, zone, recs)
+}
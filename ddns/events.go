@@ -0,0 +1,92 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/dynv6/notify"
+)
+
+// Kinds of the events sent to Updater.Notifier.
+const (
+	// EventAddressChanged is sent for every record pointed at a new
+	// address.
+	EventAddressChanged = "address-changed"
+	// EventUpdateFailing is sent once when FailureThreshold consecutive
+	// updates of Run failed.
+	EventUpdateFailing = "update-failing"
+	// EventTokenInvalid is sent once when dynv6 rejects the token, which
+	// won't fix itself.
+	EventTokenInvalid = "token-invalid"
+	// EventRecovered is sent when an update succeeds after
+	// EventUpdateFailing or EventTokenInvalid.
+	EventRecovered = "recovered"
+)
+
+// defaultFailureThreshold is used when Updater.FailureThreshold is zero.
+const defaultFailureThreshold = 3
+
+// notify sends an event to the notifier, if any, logging failures.
+func (u *Updater) notify(ctx context.Context, kind, title string, fields map[string]string) {
+	if u.Notifier == nil {
+		return
+	}
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	fields["zone"] = strings.TrimSuffix(u.Zone, ".")
+	e := notify.Event{Kind: kind, Title: title, Time: time.Now(), Fields: fields}
+	if err := u.Notifier.NotifyEvent(ctx, e); err != nil {
+		u.logf("ddns: notifying %s: %v", kind, err)
+	}
+}
+
+func (u *Updater) notifyApplied(ctx context.Context, applied []Update) {
+	for _, up := range applied {
+		fqdn := up.Name + "." + strings.TrimSuffix(u.Zone, ".")
+		if up.Name == "@" {
+			fqdn = strings.TrimSuffix(u.Zone, ".")
+		}
+		u.notify(ctx, EventAddressChanged, fmt.Sprintf("%s now points at %s", fqdn, up.Data), map[string]string{
+			"name":    up.Name,
+			"type":    up.Type,
+			"address": up.Data,
+		})
+	}
+}
+
+// failureNotice tracks the failure events sent during a failure streak.
+type failureNotice struct {
+	failing, tokenInvalid bool
+}
+
+// observe sends the events due after an update of Run.
+func (n *failureNotice) observe(ctx context.Context, u *Updater, failures int, err error) {
+	if err == nil {
+		if n.failing || n.tokenInvalid {
+			u.notify(ctx, EventRecovered, fmt.Sprintf("DDNS updates of %s work again after %d failure(s)", strings.TrimSuffix(u.Zone, "."), failures), nil)
+		}
+		*n = failureNotice{}
+		return
+	}
+	var authErr *dynv6api.AuthError
+	if errors.As(err, &authErr) && !n.tokenInvalid {
+		n.tokenInvalid = true
+		u.notify(ctx, EventTokenInvalid, "The dynv6 token of the DDNS updater was rejected", map[string]string{"error": err.Error()})
+	}
+	threshold := u.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+	if failures >= threshold && !n.failing {
+		n.failing = true
+		u.notify(ctx, EventUpdateFailing, fmt.Sprintf("DDNS updates of %s failed %d times", strings.TrimSuffix(u.Zone, "."), failures), map[string]string{
+			"failures": fmt.Sprint(failures),
+			"error":    err.Error(),
+		})
+	}
+}
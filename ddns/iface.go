@@ -0,0 +1,150 @@
+package ddns
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Flags of IPv6 addresses in /proc/net/if_inet6, from linux/if_addr.h.
+const (
+	ifaFlagTemporary  = 0x01
+	ifaFlagDADFailed  = 0x08
+	ifaFlagDeprecated = 0x20
+	ifaFlagTentative  = 0x40
+)
+
+// InterfaceDetector takes the address from a network interface of the host
+// instead of asking a service, the source of truth on networks where the
+// host has a public IPv6 address. Loopback, link-local and, on Linux,
+// tentative addresses are never used; by default private addresses,
+// temporary IPv6 privacy addresses and deprecated addresses aren't either.
+// If several addresses are left, the first one of the interface is used.
+type InterfaceDetector struct {
+	// Interface is the name of the interface, e.g. "eth0". It is required.
+	Interface string
+
+	// IncludePrivate allows unique local IPv6 addresses (fc00::/7) and
+	// private IPv4 addresses (RFC 1918).
+	IncludePrivate bool
+
+	// IncludeTemporary allows temporary IPv6 addresses (RFC 8981), which
+	// change daily and are meant for outgoing connections. They are only
+	// recognized on Linux.
+	IncludeTemporary bool
+
+	// IncludeDeprecated allows addresses whose preferred lifetime expired,
+	// e.g. of a prefix the router no longer announces. They are only
+	// recognized on Linux.
+	IncludeDeprecated bool
+}
+
+// ifaceAddr is an address of an interface with its flags, if known.
+type ifaceAddr struct {
+	addr  netip.Addr
+	flags uint32
+}
+
+// Detect implements Detector.
+func (d InterfaceDetector) Detect(ctx context.Context, network string) (netip.Addr, error) {
+	iface, err := net.InterfaceByName(d.Interface)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	netAddrs, err := iface.Addrs()
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%s: %v", d.Interface, err)
+	}
+	flags := ipv6Flags(d.Interface)
+	var addrs []ifaceAddr
+	for _, a := range netAddrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ipnet.IP)
+		if !ok {
+			continue
+		}
+		addr = addr.Unmap()
+		addrs = append(addrs, ifaceAddr{addr: addr, flags: flags[addr]})
+	}
+	addr, ok := d.selectAddr(addrs, network)
+	if !ok {
+		return netip.Addr{}, fmt.Errorf("%s: no usable %s address", d.Interface, network)
+	}
+	return addr, nil
+}
+
+// selectAddr returns the first address of the network passing the filters.
+func (d InterfaceDetector) selectAddr(addrs []ifaceAddr, network string) (netip.Addr, bool) {
+	for _, a := range addrs {
+		switch {
+		case a.addr.Is4() != (network != "ip6"),
+			a.addr.IsLoopback(), a.addr.IsLinkLocalUnicast(), a.addr.IsMulticast(), a.addr.IsUnspecified(),
+			a.flags&(ifaFlagTentative|ifaFlagDADFailed) != 0,
+			a.addr.IsPrivate() && !d.IncludePrivate,
+			a.flags&ifaFlagTemporary != 0 && !d.IncludeTemporary,
+			a.flags&ifaFlagDeprecated != 0 && !d.IncludeDeprecated:
+			continue
+		}
+		return a.addr, true
+	}
+	return netip.Addr{}, false
+}
+
+// parseIfInet6 returns the flags of the IPv6 addresses of an interface from
+// the contents of /proc/net/if_inet6, which has a line per address:
+//
+//	20010db8000000000000000000000001 02 40 00 80 eth0
+//
+// These are the address, interface index, prefix length, scope, flags and
+// interface name, in hex where numeric.
+func parseIfInet6(data []byte, name string) map[netip.Addr]uint32 {
+	flags := map[netip.Addr]uint32{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 6 || fields[5] != name {
+			continue
+		}
+		b, err := hex.DecodeString(fields[0])
+		if err != nil || len(b) != 16 {
+			continue
+		}
+		f, err := strconv.ParseUint(fields[4], 16, 32)
+		if err != nil {
+			continue
+		}
+		addr, _ := netip.AddrFromSlice(b)
+		flags[addr] = uint32(f)
+	}
+	return flags
+}
+
+// ByNetwork uses a different detector per network, e.g. an
+// InterfaceDetector for IPv6 and a Consensus of services for IPv4 behind
+// NAT.
+type ByNetwork struct {
+	// IP4 and IP6 are the detectors of the networks. Nil ones default to
+	// an HTTPDetector.
+	IP4, IP6 Detector
+}
+
+// Detect implements Detector.
+func (d ByNetwork) Detect(ctx context.Context, network string) (netip.Addr, error) {
+	detector := d.IP4
+	if network == "ip6" {
+		detector = d.IP6
+	}
+	if detector == nil {
+		detector = HTTPDetector{}
+	}
+	return detector.Detect(ctx, network)
+}
@@ -0,0 +1,16 @@
+package ddns
+
+import (
+	"io/ioutil"
+	"net/netip"
+)
+
+// ipv6Flags returns the flags of the IPv6 addresses of an interface, or nil
+// if they aren't available.
+func ipv6Flags(name string) map[netip.Addr]uint32 {
+	data, err := ioutil.ReadFile("/proc/net/if_inet6")
+	if err != nil {
+		return nil
+	}
+	return parseIfInet6(data, name)
+}
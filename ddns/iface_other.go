@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package ddns
+
+import "net/netip"
+
+// ipv6Flags returns nil, the flags of addresses are only read on Linux.
+func ipv6Flags(name string) map[netip.Addr]uint32 {
+	return nil
+}
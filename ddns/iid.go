@@ -0,0 +1,133 @@
+package ddns
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// InterfaceID is the lower 64 bits of an IPv6 address, which identify a
+// host within a /64 prefix.
+type InterfaceID [8]byte
+
+// EUI64 returns the modified EUI-64 interface ID of a MAC address (RFC 4291,
+// appendix A), which SLAAC uses unless privacy or stable-privacy addresses
+// are configured: ff:fe is inserted in the middle of a 48-bit MAC and the
+// universal/local bit is flipped.
+func EUI64(mac net.HardwareAddr) (InterfaceID, error) {
+	var id InterfaceID
+	switch len(mac) {
+	case 6:
+		copy(id[:3], mac[:3])
+		id[3], id[4] = 0xff, 0xfe
+		copy(id[5:], mac[3:])
+	case 8:
+		copy(id[:], mac)
+	default:
+		return id, fmt.Errorf("ddns: %s is not a 48 or 64 bit MAC address", mac)
+	}
+	id[0] ^= 0x02
+	return id, nil
+}
+
+// StablePrivacyID returns a stable, semantically opaque interface ID for the
+// prefix as described in RFC 7217, using SHA-256 as the pseudorandom
+// function over the prefix, the interface name, the optional network ID
+// (e.g. the SSID), the DAD counter and the secret key. The ID stays the same
+// while the host stays in the network and changes with the prefix, unlike
+// EUI64 without revealing the MAC. Operating systems use their own secret
+// keys, so this computes the addresses of hosts configured with the same
+// inputs, not those of arbitrary hosts.
+func StablePrivacyID(prefix netip.Prefix, iface string, networkID []byte, dadCounter uint8, secret []byte) InterfaceID {
+	h := sha256.New()
+	p := prefix.Masked().Addr().As16()
+	h.Write(p[:8])
+	h.Write([]byte(iface))
+	h.Write(networkID)
+	h.Write([]byte{dadCounter})
+	h.Write(secret)
+	var id InterfaceID
+	copy(id[:], h.Sum(nil))
+	return id
+}
+
+// ParseInterfaceID parses an interface ID written as an IPv6 address whose
+// upper 64 bits are zero, e.g. "::1" or "::211:22ff:fe33:4455".
+func ParseInterfaceID(s string) (InterfaceID, error) {
+	var id InterfaceID
+	addr, err := netip.ParseAddr(s)
+	if err != nil || !addr.Is6() || addr.Is4In6() {
+		return id, fmt.Errorf("ddns: invalid interface ID %q", s)
+	}
+	b := addr.As16()
+	for _, v := range b[:8] {
+		if v != 0 {
+			return id, fmt.Errorf("ddns: interface ID %q has more than 64 bits", s)
+		}
+	}
+	copy(id[:], b[8:])
+	return id, nil
+}
+
+// String returns the ID in the form ParseInterfaceID accepts.
+func (id InterfaceID) String() string {
+	var b [16]byte
+	copy(b[8:], id[:])
+	return netip.AddrFrom16(b).String()
+}
+
+// In returns the address of the ID in prefix, which must be an IPv6 prefix
+// of at most 64 bits.
+func (id InterfaceID) In(prefix netip.Prefix) (netip.Addr, error) {
+	if !prefix.Addr().Is6() || prefix.Addr().Is4In6() || prefix.Bits() < 0 || prefix.Bits() > 64 {
+		return netip.Addr{}, fmt.Errorf("ddns: %s is not an IPv6 prefix of at most 64 bits", prefix)
+	}
+	b := prefix.Masked().Addr().As16()
+	copy(b[8:], id[:])
+	return netip.AddrFrom16(b), nil
+}
+
+// PrefixDetector derives the IPv6 address of another host of the LAN from
+// the prefix the host running the updater is in, e.g. to keep the AAAA
+// records of a NAS behind a delegated prefix current, which changes with
+// every reconnect. IPv4 addresses are detected unchanged.
+type PrefixDetector struct {
+	// Detector finds the address of the host running the updater. It
+	// defaults to an HTTPDetector.
+	Detector Detector
+
+	// Bits is the length of the prefix shared with the other host. Defaults
+	// to 64.
+	Bits int
+
+	// ID is the interface ID of the other host, e.g. from EUI64 or
+	// StablePrivacyID.
+	ID InterfaceID
+}
+
+// Detect implements Detector.
+func (d PrefixDetector) Detect(ctx context.Context, network string) (netip.Addr, error) {
+	detector := d.Detector
+	if detector == nil {
+		detector = HTTPDetector{}
+	}
+	addr, err := detector.Detect(ctx, network)
+	if err != nil || network != "ip6" {
+		return addr, err
+	}
+	bits := d.Bits
+	if bits == 0 {
+		bits = 64
+	}
+	if !addr.Is6() {
+		return netip.Addr{}, errors.New("ddns: detected address isn't IPv6")
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("ddns: %v", err)
+	}
+	return d.ID.In(prefix)
+}
@@ -0,0 +1,188 @@
+package ddns
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// Update is a queued change of an address record.
+type Update struct {
+	Zone string        `json:"zone"`
+	Name string        `json:"name"`
+	Type string        `json:"type"`
+	Data string        `json:"data"`
+	TTL  time.Duration `json:"ttl,omitempty"`
+	// Queued is when the update was queued.
+	Queued time.Time `json:"queued"`
+}
+
+func (up Update) key() string {
+	return strings.ToLower(strings.TrimSuffix(up.Zone, ".")+" "+up.Name) + " " + strings.ToUpper(up.Type)
+}
+
+func (up Update) record() libdns.Record {
+	return libdns.RR{Name: up.Name, Type: up.Type, Data: up.Data, TTL: up.TTL}
+}
+
+// Queue holds updates which haven't been written yet. Only the latest
+// update of each record is kept. The zero value is an in-memory queue; a
+// queue returned by OpenQueue is persisted to a file after every change.
+// It is safe for concurrent use.
+type Queue struct {
+	path string
+
+	mu      sync.Mutex
+	updates []Update
+}
+
+// OpenQueue loads the queue stored at path. The file is created on the
+// first change if it doesn't exist.
+func OpenQueue(path string) (*Queue, error) {
+	q := &Queue{path: path}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &q.updates); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Len returns the number of queued updates.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.updates)
+}
+
+// Updates returns the queued updates, oldest first.
+func (q *Queue) Updates() []Update {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Update(nil), q.updates...)
+}
+
+// Add queues an update, replacing a queued update of the same record.
+func (q *Queue) Add(up Update) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, v := range q.updates {
+		if v.key() == up.key() {
+			q.updates = append(q.updates[:i], q.updates[i+1:]...)
+			break
+		}
+	}
+	q.updates = append(q.updates, up)
+	return q.save()
+}
+
+// discard drops a queued update of the same record as up, which is stale
+// once the record holds up again.
+func (q *Queue) discard(up Update) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, v := range q.updates {
+		if v.key() == up.key() {
+			q.updates = append(q.updates[:i], q.updates[i+1:]...)
+			return q.save()
+		}
+	}
+	return nil
+}
+
+// AddressUpserter is implemented by providers which point names at
+// addresses themselves, like *dynv6.Provider: dynv6 serves the addresses of
+// the apex from the zone rather than from A and AAAA records.
+type AddressUpserter interface {
+	UpsertAddress(ctx context.Context, fqdn string, addrs []netip.Addr) ([]libdns.Record, error)
+}
+
+// write applies up. Updates of the apex go through UpsertAddress if the
+// setter implements AddressUpserter.
+func (up Update) write(ctx context.Context, setter libdns.RecordSetter) error {
+	if u, ok := setter.(AddressUpserter); ok && (up.Name == "@" || up.Name == "") {
+		addr, err := netip.ParseAddr(up.Data)
+		if err != nil {
+			return err
+		}
+		_, err = u.UpsertAddress(ctx, strings.TrimSuffix(up.Zone, ".")+".", []netip.Addr{addr})
+		return err
+	}
+	_, err := setter.SetRecords(ctx, up.Zone, []libdns.Record{up.record()})
+	return err
+}
+
+// Replay writes the queued updates with the setter and removes the ones
+// which succeeded. It returns the applied updates and the first error;
+// failed updates stay queued for the next replay.
+func (q *Queue) Replay(ctx context.Context, setter libdns.RecordSetter) ([]Update, error) {
+	var applied []Update
+	var firstErr error
+	for _, up := range q.Updates() {
+		if err := up.write(ctx, setter); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		applied = append(applied, up)
+		q.remove(up)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.save(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return applied, firstErr
+}
+
+// remove drops up unless it was replaced by a newer update in the meantime.
+func (q *Queue) remove(up Update) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, v := range q.updates {
+		if v == up {
+			q.updates = append(q.updates[:i], q.updates[i+1:]...)
+			return
+		}
+	}
+}
+
+// save writes the queue to its file. The caller must hold q.mu.
+func (q *Queue) save() error {
+	if q.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(q.updates, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(q.path, b, 0o600)
+}
+
+// writeFileAtomic writes b to the file at path, creating its directory.
+// It writes a temporary file first and renames it, so a crash can't leave
+// a truncated file.
+func writeFileAtomic(path string, b []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,112 @@
+package ddns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State remembers the last published address of each record, so updates of
+// unchanged addresses are skipped without asking the API. The zero value is
+// kept in memory; a state returned by OpenState is persisted to a file, so
+// devices which reboot often don't repeat the updates of every boot. It is
+// safe for concurrent use. The state can't see records changed or deleted
+// outside of the updater, so Updater.StateMaxAge forgets it from time to
+// time.
+type State struct {
+	path string
+
+	mu        sync.Mutex
+	published map[string]Update
+}
+
+// OpenState loads the state stored at path. The file is created on the
+// first change if it doesn't exist.
+func OpenState(path string) (*State, error) {
+	s := &State{path: path}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ups []Update
+	if err := json.Unmarshal(b, &ups); err != nil {
+		return nil, err
+	}
+	for _, up := range ups {
+		s.set(up)
+	}
+	return s, nil
+}
+
+func (s *State) set(up Update) {
+	if s.published == nil {
+		s.published = map[string]Update{}
+	}
+	s.published[up.key()] = up
+}
+
+// Published reports whether up is the last published update of its record,
+// ignoring when it was queued.
+func (s *State) Published(up Update) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.published[up.key()]
+	return ok && last.Data == up.Data && last.TTL == up.TTL
+}
+
+// Record stores updates as published.
+func (s *State) Record(ups ...Update) error {
+	if len(ups) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, up := range ups {
+		s.set(up)
+	}
+	return s.save()
+}
+
+// Forget drops the published updates, so the next update writes all
+// records again.
+func (s *State) Forget() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published = nil
+	return s.save()
+}
+
+// publishedBefore reports whether an update was queued before t.
+func (s *State) publishedBefore(t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, up := range s.published {
+		if up.Queued.Before(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// save writes the state to its file. The caller must hold s.mu.
+func (s *State) save() error {
+	if s.path == "" {
+		return nil
+	}
+	ups := []Update{}
+	for _, up := range s.published {
+		ups = append(ups, up)
+	}
+	sort.Slice(ups, func(i, j int) bool { return ups[i].key() < ups[j].key() })
+	b, err := json.MarshalIndent(ups, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, b, 0o600)
+}
@@ -0,0 +1,142 @@
+package ddns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+	stunMagicCookie     = 0x2112A442
+
+	stunMappedAddress    = 0x0001
+	stunXORMappedAddress = 0x0020
+)
+
+// STUNDetector asks a STUN server (RFC 5389) for the address it sees the
+// host's UDP packets from. It needs no HTTP service and works where only UDP
+// leaves the network.
+type STUNDetector struct {
+	// Server is the host:port of the STUN server. Defaults to
+	// stun.l.google.com:19302.
+	Server string
+}
+
+// Detect implements Detector.
+func (d STUNDetector) Detect(ctx context.Context, network string) (netip.Addr, error) {
+	server := d.Server
+	if server == "" {
+		server = "stun.l.google.com:19302"
+	}
+	udp := "udp4"
+	if network == "ip6" {
+		udp = "udp6"
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, udp, server)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	req := make([]byte, 20)
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	if _, err := rand.Read(req[8:20]); err != nil {
+		return netip.Addr{}, err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return netip.Addr{}, err
+	}
+	resp := make([]byte, 1500)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("%s: %v", server, err)
+		}
+		// ignore stray packets of other transactions
+		if n < 20 || string(resp[8:20]) != string(req[8:20]) {
+			continue
+		}
+		addr, err := parseSTUNResponse(resp[:n])
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("%s: %v", server, err)
+		}
+		return addr, nil
+	}
+}
+
+// parseSTUNResponse returns the mapped address of a binding response,
+// preferring XOR-MAPPED-ADDRESS.
+func parseSTUNResponse(b []byte) (netip.Addr, error) {
+	if binary.BigEndian.Uint16(b[0:]) != stunBindingResponse {
+		return netip.Addr{}, fmt.Errorf("unexpected message type %#04x", binary.BigEndian.Uint16(b[0:]))
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if 20+length > len(b) {
+		return netip.Addr{}, errors.New("truncated response")
+	}
+	var mapped netip.Addr
+	for attrs := b[20 : 20+length]; len(attrs) >= 4; {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		n := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+n > len(attrs) {
+			return netip.Addr{}, errors.New("truncated attribute")
+		}
+		value := attrs[4 : 4+n]
+		switch typ {
+		case stunXORMappedAddress:
+			addr, ok := stunAddress(value, b[4:20])
+			if ok {
+				return addr, nil
+			}
+		case stunMappedAddress:
+			if addr, ok := stunAddress(value, nil); ok {
+				mapped = addr
+			}
+		}
+		// attributes are padded to 4 bytes
+		n = (n + 3) &^ 3
+		if 4+n > len(attrs) {
+			break
+		}
+		attrs = attrs[4+n:]
+	}
+	if !mapped.IsValid() {
+		return netip.Addr{}, errors.New("no mapped address in response")
+	}
+	return mapped, nil
+}
+
+// stunAddress decodes an address attribute, XORed with the magic cookie and
+// transaction ID in key if key isn't nil.
+func stunAddress(value, key []byte) (netip.Addr, bool) {
+	if len(value) < 4 {
+		return netip.Addr{}, false
+	}
+	ip := append([]byte(nil), value[4:]...)
+	switch {
+	case value[1] == 0x01 && len(ip) == 4, value[1] == 0x02 && len(ip) == 16:
+	default:
+		return netip.Addr{}, false
+	}
+	for i := range ip {
+		if key != nil {
+			ip[i] ^= key[i]
+		}
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr.Unmap(), true
+}
@@ -0,0 +1,173 @@
+package dynv6
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Delegation is the NS set a parent zone delegates a zone with, as reported
+// by CheckDelegation.
+type Delegation struct {
+	// Zone is the checked zone, e.g. "example.org.".
+	Zone string
+	// Parent is the zone delegating it, e.g. "org.".
+	Parent string
+	// Server is the nameserver of the parent zone which was asked.
+	Server string
+	// Nameservers are the nameservers the parent delegates the zone to. It
+	// is empty if the zone isn't delegated.
+	Nameservers []string
+	// Foreign are the Nameservers which aren't dynv6's.
+	Foreign []string
+}
+
+// OK reports whether the zone is delegated to dynv6 nameservers only.
+func (d *Delegation) OK() bool {
+	return len(d.Nameservers) > 0 && len(d.Foreign) == 0
+}
+
+// Problem describes what is wrong with the delegation, or returns "" if it
+// is OK.
+func (d *Delegation) Problem() string {
+	switch {
+	case len(d.Nameservers) == 0:
+		return fmt.Sprintf("%s is not delegated by %s", d.Zone, d.Parent)
+	case len(d.Foreign) == len(d.Nameservers):
+		return fmt.Sprintf("%s is delegated to %s, not to dynv6", d.Zone, strings.Join(d.Nameservers, ", "))
+	case len(d.Foreign) > 0:
+		return fmt.Sprintf("%s is also delegated to non-dynv6 nameservers %s", d.Zone, strings.Join(d.Foreign, ", "))
+	}
+	return ""
+}
+
+// DelegationChecker asks the nameservers of the parent of a zone which
+// nameservers it is delegated to. Unlike a lookup of the NS records through
+// a recursive resolver, this finds misdelegations hidden by the NS records
+// the dynv6 nameservers serve themselves. The zero value is ready to use.
+type DelegationChecker struct {
+	// Resolver is the recursive resolver finding the parent zone and its
+	// nameservers. Defaults to the first nameserver of /etc/resolv.conf.
+	Resolver Resolver
+	// Authority returns the resolver asking a nameserver of the parent
+	// zone, given as host:port. Defaults to DNSResolver.
+	Authority func(server string) Resolver
+}
+
+// CheckDelegation checks the delegation of zone with a zero
+// DelegationChecker.
+func CheckDelegation(ctx context.Context, zone string) (*Delegation, error) {
+	return DelegationChecker{}.Check(ctx, zone)
+}
+
+// Check returns the delegation of zone by its parent zone. Use OK or
+// Problem of the result to tell whether it points at dynv6.
+func (c DelegationChecker) Check(ctx context.Context, zone string) (*Delegation, error) {
+	zone = dns.CanonicalName(zone)
+	if zone == "." {
+		return nil, errors.New("The root zone has no parent")
+	}
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = systemResolver()
+	}
+	d := &Delegation{Zone: zone}
+
+	// the SOA record answering for the parent name is that of the parent zone
+	parentName := "."
+	if i, end := dns.NextLabel(zone, 0); !end {
+		parentName = zone[i:]
+	}
+	resp, err := exchange(ctx, resolver, parentName, dns.TypeSOA, true)
+	if err != nil {
+		return nil, fmt.Errorf("Finding the parent zone of %s: %v", zone, err)
+	}
+	for _, rr := range append(resp.Answer, resp.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			d.Parent = dns.CanonicalName(soa.Hdr.Name)
+			break
+		}
+	}
+	if d.Parent == "" {
+		return nil, fmt.Errorf("Finding the parent zone of %s: no SOA record for %s", zone, parentName)
+	}
+
+	resp, err = exchange(ctx, resolver, d.Parent, dns.TypeNS, true)
+	if err != nil {
+		return nil, fmt.Errorf("Looking up the nameservers of %s: %v", d.Parent, err)
+	}
+	servers := nsHosts(resp.Answer, d.Parent)
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("Looking up the nameservers of %s: no NS records", d.Parent)
+	}
+
+	authority := c.Authority
+	if authority == nil {
+		authority = func(server string) Resolver { return DNSResolver(server) }
+	}
+	for _, server := range servers {
+		resp, err = exchange(ctx, authority(net.JoinHostPort(server, "53")), zone, dns.TypeNS, false)
+		// NXDOMAIN means the zone isn't delegated
+		if err != nil && (resp == nil || resp.Rcode != dns.RcodeNameError) {
+			continue
+		}
+		d.Server = server
+		// a referral lists the NS set in the authority section, a parent
+		// which serves the zone itself answers with it
+		d.Nameservers = nsHosts(append(resp.Answer, resp.Ns...), zone)
+		for _, ns := range d.Nameservers {
+			if !isDynv6Nameserver(ns) {
+				d.Foreign = append(d.Foreign, ns)
+			}
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("Asking the nameservers of %s for the delegation of %s: %v", d.Parent, zone, err)
+}
+
+// exchange sends a query and fails unless it is answered with NOERROR. The
+// response is returned along with the error of another response code.
+func exchange(ctx context.Context, r Resolver, name string, qtype uint16, recursive bool) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = recursive
+	resp, err := r.Exchange(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return resp, fmt.Errorf("%s %s: %s", dns.TypeToString[qtype], name, dns.RcodeToString[resp.Rcode])
+	}
+	return resp, nil
+}
+
+// nsHosts returns the sorted, lower case targets of the NS records of name.
+func nsHosts(rrs []dns.RR, name string) []string {
+	var hosts []string
+	for _, rr := range rrs {
+		if ns, ok := rr.(*dns.NS); ok && dns.CanonicalName(ns.Hdr.Name) == name {
+			hosts = append(hosts, strings.TrimSuffix(dns.CanonicalName(ns.Ns), "."))
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func isDynv6Nameserver(host string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(strings.ToLower(host), "."), ".dynv6.com")
+}
+
+// systemResolver returns the first nameserver of /etc/resolv.conf, or a
+// public resolver if there is none, e.g. on Windows.
+func systemResolver() Resolver {
+	conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil || len(conf.Servers) == 0 {
+		return DNSResolver("1.1.1.1:53")
+	}
+	return DNSResolver(net.JoinHostPort(conf.Servers[0], conf.Port))
+}
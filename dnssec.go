@@ -0,0 +1,103 @@
+package dynv6
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// DS is a delegation signer record to enter at the registrar of a zone
+// signed by dynv6, as returned by LookupDS.
+type DS struct {
+	// Zone is the signed zone, e.g. "example.org.".
+	Zone       string
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	// Digest is the upper case hex digest of the key.
+	Digest string
+	// DNSKEY is the key the digest is computed of, in zone file format,
+	// for registrars which take the key instead of a digest.
+	DNSKEY string
+}
+
+// String returns the record in zone file format, e.g.
+// "example.org. IN DS 12345 13 2 3F1A...".
+func (d DS) String() string {
+	return fmt.Sprintf("%s IN DS %d %d %d %s", d.Zone, d.KeyTag, d.Algorithm, d.DigestType, d.Digest)
+}
+
+// AlgorithmName returns the name of the key algorithm, e.g. "ECDSAP256SHA256".
+func (d DS) AlgorithmName() string {
+	return dns.AlgorithmToString[d.Algorithm]
+}
+
+// DigestTypeName returns the name of the digest type, e.g. "SHA-256".
+func (d DS) DigestTypeName() string {
+	switch d.DigestType {
+	case dns.SHA256:
+		return "SHA-256"
+	case dns.SHA384:
+		return "SHA-384"
+	}
+	return dns.HashToString[d.DigestType]
+}
+
+// LookupDS queries the DNSKEY records of zone at resolver and returns the
+// SHA-256 and SHA-384 DS records of its key signing keys, or of all its
+// keys if none is marked as one. resolver defaults to the dynv6 nameserver,
+// so the keys are seen before the zone is delegated securely. It fails if
+// the zone has no keys, i.e. DNSSEC isn't enabled for it.
+func LookupDS(ctx context.Context, resolver Resolver, zone string) ([]DS, error) {
+	zone = dns.CanonicalName(zone)
+	if resolver == nil {
+		resolver = DNSResolver(propagationServer)
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(zone, dns.TypeDNSKEY)
+	m.SetEdns0(4096, true)
+	resp, err := resolver.Exchange(ctx, m)
+	if err != nil {
+		return nil, fmt.Errorf("Querying the DNSKEY records of %s: %v", zone, err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("Querying the DNSKEY records of %s: %s", zone, dns.RcodeToString[resp.Rcode])
+	}
+	var keys, ksks []*dns.DNSKEY
+	for _, rr := range resp.Answer {
+		key, ok := rr.(*dns.DNSKEY)
+		if !ok || dns.CanonicalName(key.Hdr.Name) != zone || key.Flags&dns.ZONE == 0 {
+			continue
+		}
+		keys = append(keys, key)
+		if key.Flags&dns.SEP != 0 {
+			ksks = append(ksks, key)
+		}
+	}
+	if len(ksks) > 0 {
+		keys = ksks
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s has no DNSKEY records, enable DNSSEC for it first", zone)
+	}
+	var dss []DS
+	for _, key := range keys {
+		for _, digest := range []uint8{dns.SHA256, dns.SHA384} {
+			ds := key.ToDS(digest)
+			if ds == nil {
+				return nil, fmt.Errorf("Computing the DS record of key %d of %s: unsupported key", key.KeyTag(), zone)
+			}
+			dss = append(dss, DS{
+				Zone:       zone,
+				KeyTag:     ds.KeyTag,
+				Algorithm:  ds.Algorithm,
+				DigestType: ds.DigestType,
+				Digest:     strings.ToUpper(ds.Digest),
+				DNSKEY:     key.String(),
+			})
+		}
+	}
+	return dss, nil
+}
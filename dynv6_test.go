@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/libdns/dynv6/dynv6api"
 	"github.com/libdns/libdns"
 )
 
@@ -21,7 +22,7 @@ func init() {
 }
 
 func TestErrorLog(t *testing.T) {
-	zone, err := p.addRecord(ctx, 0, &record{
+	zone, err := p.client().CreateRecord(ctx, 0, dynv6api.Record{
 		Name: "test",
 		Data: "test",
 		Type: "TXT",
@@ -35,12 +36,12 @@ func TestErrorLog(t *testing.T) {
 }
 
 func TestGetZoneByName(t *testing.T) {
-	zones, err := p.getZones(ctx)
+	zones, err := p.client().ListZones(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
 	for _, zoneItem := range zones {
-		z, err := p.getZoneByName(ctx, zoneItem.Name)
+		z, err := p.client().GetZoneByName(ctx, zoneItem.Name)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -49,12 +50,12 @@ func TestGetZoneByName(t *testing.T) {
 }
 
 func TestGetZoneByID(t *testing.T) {
-	zones, err := p.getZones(ctx)
+	zones, err := p.client().ListZones(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
 	for _, zoneItem := range zones {
-		z, err := p.getZoneByID(ctx, zoneItem.ID)
+		z, err := p.client().GetZone(ctx, zoneItem.ID)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -63,7 +64,7 @@ func TestGetZoneByID(t *testing.T) {
 }
 
 func TestListZones(t *testing.T) {
-	zones, err := p.getZones(ctx)
+	zones, err := p.client().ListZones(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -71,12 +72,12 @@ func TestListZones(t *testing.T) {
 }
 
 func TestGetRecords(t *testing.T) {
-	zones, err := p.getZones(ctx)
+	zones, err := p.client().ListZones(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
 	for _, zoneItem := range zones {
-		records, err := p.getRecords(ctx, zoneItem.ID)
+		records, err := p.client().ListRecords(ctx, zoneItem.ID)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -94,13 +95,13 @@ func generateRandInt(t *testing.T) uint16 {
 }
 
 func TestAddUpdateDeleteRecord(t *testing.T) {
-	zones, err := p.getZones(ctx)
+	zones, err := p.client().ListZones(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
 	for _, zoneItem := range zones {
 		data := generateRandInt(t)
-		r, err := p.addRecord(ctx, zoneItem.ID, &record{
+		r, err := p.client().CreateRecord(ctx, zoneItem.ID, dynv6api.Record{
 			Name: fmt.Sprintf("test%d", data),
 			Type: "TXT",
 			Data: fmt.Sprint(data),
@@ -113,8 +114,7 @@ func TestAddUpdateDeleteRecord(t *testing.T) {
 			t.Fatal("Data returned is not equal to data sent")
 		}
 		data = generateRandInt(t)
-		r, err = p.updateRecord(ctx, zoneItem.ID, &record{
-			ID:   r.ID,
+		r, err = p.client().UpdateRecord(ctx, zoneItem.ID, r.ID, dynv6api.Record{
 			Name: r.Name,
 			Type: r.Type,
 			Data: fmt.Sprint(data),
@@ -126,7 +126,7 @@ func TestAddUpdateDeleteRecord(t *testing.T) {
 		if r.Data != fmt.Sprint(data) {
 			t.Fatal("Data returned is not equal to data sent")
 		}
-		err = p.deleteRecord(ctx, zoneItem.ID, r.ID)
+		err = p.client().DeleteRecord(ctx, zoneItem.ID, r.ID)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -135,7 +135,7 @@ func TestAddUpdateDeleteRecord(t *testing.T) {
 }
 
 func TestLibdnsGetRecords(t *testing.T) {
-	zones, err := p.getZones(ctx)
+	zones, err := p.client().ListZones(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -149,7 +149,7 @@ func TestLibdnsGetRecords(t *testing.T) {
 }
 
 func TestLibdnsAppendSetDeleteRecords(t *testing.T) {
-	zones, err := p.getZones(ctx)
+	zones, err := p.client().ListZones(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -206,3 +206,25 @@ func TestLibdnsAppendSetDeleteRecords(t *testing.T) {
 		}
 	}
 }
+
+func TestLibdnsListZones(t *testing.T) {
+	zones, err := p.ListZones(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(zones)
+}
+
+func TestLibdnsGetZoneInfo(t *testing.T) {
+	zones, err := p.ListZones(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, zoneItem := range zones {
+		z, err := p.GetZoneInfo(ctx, zoneItem.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%+v", z)
+	}
+}
@@ -0,0 +1,102 @@
+package dynv6api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// KeysURL is the page of the dynv6 website where API tokens are managed.
+const KeysURL = "https://dynv6.com/keys"
+
+// Reasons of an AuthError.
+const (
+	// AuthMissingToken means the client has no token.
+	AuthMissingToken = "missing_token"
+	// AuthMalformedToken means the token contains characters no dynv6 token
+	// has, e.g. whitespace within it. Surrounding whitespace is removed by
+	// NormalizeToken.
+	AuthMalformedToken = "malformed_token"
+	// AuthInvalidToken means dynv6 rejected the token, e.g. because it was
+	// deleted.
+	AuthInvalidToken = "invalid_token"
+	// AuthForbidden means the token is valid but may not access the zone
+	// or perform the operation.
+	AuthForbidden = "insufficient_permissions"
+)
+
+// AuthError is returned when a request isn't authorized.
+type AuthError struct {
+	Reason string
+	// Err is the API error, if dynv6 refused the request.
+	Err *Error
+}
+
+func (e *AuthError) Error() string {
+	switch e.Reason {
+	case AuthMissingToken:
+		return "No dynv6 API token given, generate one at " + KeysURL
+	case AuthMalformedToken:
+		return "Malformed dynv6 API token, it must not contain whitespace or control characters; check the token at " + KeysURL
+	case AuthForbidden:
+		return "The dynv6 API token may not access this zone or perform this operation, check its permissions at " + KeysURL + ": " + e.Err.Error()
+	}
+	return "The dynv6 API token was rejected, check that it still exists at " + KeysURL + ": " + e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	if e.Err == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// NormalizeToken removes what is often copied along with a token:
+// surrounding whitespace and quotes, and a "Bearer " prefix taken from an
+// Authorization header. It reports whether the token was changed. The
+// client normalizes its token before every request.
+func NormalizeToken(token string) (string, bool) {
+	t := token
+	for {
+		prev := t
+		t = strings.TrimSpace(t)
+		if len(t) >= 2 && (t[0] == '"' || t[0] == '\'') && t[len(t)-1] == t[0] {
+			t = t[1 : len(t)-1]
+		}
+		if len(t) > 7 && strings.EqualFold(t[:7], "bearer ") {
+			t = t[7:]
+		}
+		if t == prev {
+			return t, t != token
+		}
+	}
+}
+
+// checkToken catches token problems before a request is sent.
+func checkToken(token string) error {
+	if token == "" {
+		return &AuthError{Reason: AuthMissingToken}
+	}
+	for _, r := range token {
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return &AuthError{Reason: AuthMalformedToken}
+		}
+	}
+	return nil
+}
+
+// authError converts 401 and 403 responses into an AuthError.
+func authError(err error) error {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized:
+		return &AuthError{Reason: AuthInvalidToken, Err: apiErr}
+	case http.StatusForbidden:
+		return &AuthError{Reason: AuthForbidden, Err: apiErr}
+	}
+	return err
+}
@@ -0,0 +1,332 @@
+// Package dynv6api is a low-level client for the dynv6 REST API
+// (https://dynv6.com/docs/apis#rest).
+//
+// Most users want the libdns provider in the parent package, which is built
+// on top of this client. Use this package directly to access zone settings
+// and record fields the libdns interfaces don't model.
+//
+// The models and operations in api_gen.go are generated from openapi.json,
+// a description of the dynv6 REST API; run go generate after changing it.
+package dynv6api
+
+//go:generate go run ./internal/gen -spec openapi.json -out api_gen.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the base URL of the DefaultAPIVersion of the dynv6
+// REST API.
+const DefaultBaseURL = defaultAPIURL + DefaultAPIVersion
+
+const defaultTimeout = time.Second * 60
+
+var defaultHTTPClient = NewHTTPClient(TransportOptions{})
+
+// Client for the dynv6 REST API. The zero value is not usable, a Token is
+// required. A Client is safe for concurrent use.
+type Client struct {
+	// Token is the API token used for authorization.
+	// You can generate one at: https://dynv6.com/keys
+	// Whitespace, quotes and a "Bearer " prefix pasted along with it are
+	// removed, see NormalizeToken.
+	Token string
+
+	// BaseURL of the API. Defaults to DefaultBaseURL.
+	BaseURL string
+
+	// Version is the API version path segment of the default base URL,
+	// e.g. "v3". Defaults to DefaultAPIVersion. It is ignored if BaseURL is
+	// set, which includes the version. Use Detect to check that the
+	// version responds as expected.
+	Version string
+
+	// HTTPClient used for requests. Defaults to a client with a 60 second
+	// timeout.
+	HTTPClient *http.Client
+
+	// Middleware intercepts every HTTP call made by the client, e.g. for
+	// logging or metrics. The first middleware is the outermost one. It must
+	// not be changed once the client is in use.
+	Middleware []Middleware
+
+	// RetryPolicy decides which failed requests are repeated. Defaults to
+	// DefaultRetryPolicy.
+	RetryPolicy RetryPolicy
+
+	// OnRateLimit, if set, is called with the quota reported by every API
+	// response carrying rate limit headers.
+	OnRateLimit func(RateLimit)
+
+	// RateLimitReserve is the number of remaining requests below which the
+	// client spaces out its requests until the quota is reset. Defaults to
+	// 5, negative disables the slowdown.
+	RateLimitReserve int
+
+	// StrictDecoding makes responses with fields the models don't have fail
+	// with a *SchemaError after decoding them, so changes of the API are
+	// noticed right away, e.g. in tests against the live API.
+	StrictDecoding bool
+
+	// OnUnknownFields, if set, is called with the fields of a response the
+	// models don't have, unless StrictDecoding is set.
+	OnUnknownFields func(path string, fields []string)
+
+	// Clock and Sleeper default to SystemClock.
+	Clock   Clock
+	Sleeper Sleeper
+
+	stats     statsCollector
+	rateLimit rateLimitState
+}
+
+// NewClient returns a client using the given token.
+func NewClient(token string) *Client {
+	return &Client{Token: token}
+}
+
+// Error is returned when the API responds with an unexpected status code.
+type Error struct {
+	StatusCode int
+	Status     string
+	Method     string
+	URL        string
+	// Path is the API path of the request, e.g. /zones/1/records/2.
+	Path string
+	// RequestBody is the decoded JSON body of the request, if any.
+	RequestBody interface{}
+	// ResponseBody is the raw body of the response.
+	ResponseBody string
+}
+
+func (e *Error) Error() string {
+	req := struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Body   interface{} `json:"body"`
+	}{
+		Method: e.Method,
+		URL:    e.URL,
+		Body:   e.RequestBody,
+	}
+	var reqJSONString string
+	if reqJSONBytes, err := json.Marshal(req); err == nil {
+		reqJSONString = string(reqJSONBytes)
+	} else {
+		reqJSONString = err.Error()
+	}
+	return fmt.Sprintf("Unexpected status code: %s, Request: %s, Response: %s", e.Status, reqJSONString, e.ResponseBody)
+}
+
+// Errors matched by errors.Is for 404 responses, depending on whether the
+// zone or a record of it wasn't found.
+var (
+	ErrZoneNotFound   = errors.New("Zone not found")
+	ErrRecordNotFound = errors.New("Record not found")
+)
+
+// Is reports whether a 404 error is ErrZoneNotFound or ErrRecordNotFound.
+func (e *Error) Is(target error) bool {
+	if e.StatusCode != http.StatusNotFound {
+		return false
+	}
+	switch target {
+	case ErrRecordNotFound:
+		return isRecordPath(e.Path)
+	case ErrZoneNotFound:
+		return strings.HasPrefix(e.Path, "/zones/") && !isRecordPath(e.Path)
+	}
+	return false
+}
+
+// isRecordPath reports whether path refers to a single record,
+// /zones/{id}/records/{rid}.
+func isRecordPath(path string) bool {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	return len(parts) == 4 && parts[0] == "zones" && parts[2] == "records"
+}
+
+func checkStatusCode(resp *http.Response, reqBody []byte) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.String(),
+	}
+	if reqBody != nil {
+		var reqBodyObject interface{}
+		if err := json.Unmarshal(reqBody, &reqBodyObject); err != nil {
+			reqBodyObject = err.Error()
+		}
+		e.RequestBody = reqBodyObject
+	}
+	if respBodyBytes, err := ioutil.ReadAll(resp.Body); err == nil {
+		e.ResponseBody = string(respBodyBytes)
+	} else {
+		e.ResponseBody = err.Error()
+	}
+	return e
+}
+
+func (c *Client) url(path string) string {
+	base := c.BaseURL
+	if base == "" {
+		base = defaultAPIURL + c.version()
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+// do sends a request to the API. If in is not nil, it is sent as the JSON
+// body of the request. If out is not nil, the JSON response is decoded into it.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	token, _ := NormalizeToken(c.Token)
+	err := checkToken(token)
+	if err == nil {
+		err = authError(c.send(ctx, method, path, in, out))
+	}
+	if err != nil {
+		c.stats.error(err)
+	}
+	return err
+}
+
+// Do sends a request to an endpoint the client doesn't model, e.g. a new
+// one, with the same authentication, retries, rate limiting, logging and
+// error types as the typed methods. path is relative to BaseURL and starts
+// with a slash, e.g. "/zones/1/settings". in and out are handled like
+// those of the typed methods: in is sent as JSON if not nil, and the JSON
+// response is decoded into out if not nil.
+func (c *Client) Do(ctx context.Context, method, path string, in, out interface{}) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("Path %q doesn't start with a slash", path)
+	}
+	return c.do(ctx, method, path, in, out)
+}
+
+func (c *Client) send(ctx context.Context, method, path string, in, out interface{}) error {
+	var reqBody []byte
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		reqBody = b
+	}
+	send := c.chain(func(call *Call) (*http.Response, error) {
+		c.stats.call(call.Method, call.Path, call.Attempt)
+		return c.httpClient().Do(call.Request)
+	})
+	policy := c.retryPolicy()
+	var (
+		resp *http.Response
+		err  error
+	)
+	for attempt := 1; ; attempt++ {
+		if err = c.throttle(ctx); err != nil {
+			return err
+		}
+		var req *http.Request
+		req, err = c.newRequest(ctx, method, path, reqBody)
+		if err != nil {
+			return err
+		}
+		resp, err = send(&Call{
+			Method:  method,
+			Path:    path,
+			Attempt: attempt,
+			Request: req,
+		})
+		c.observeRateLimit(resp)
+		delay, retry := policy.ShouldRetry(resp, err, attempt)
+		if method == http.MethodPost && !createRetryable(resp) {
+			// the record may have been created, don't create it twice
+			retry = false
+		}
+		if !retry || ctx.Err() != nil {
+			break
+		}
+		if b := RetryBudgetFrom(ctx); b != nil && !b.take() {
+			break
+		}
+		if resp != nil {
+			if resp.StatusCode == http.StatusTooManyRequests {
+				c.stats.rateLimitWait()
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := c.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err = checkStatusCode(resp, reqBody); err != nil {
+		apiErr := err.(*Error)
+		apiErr.Path = path
+		if unavailableStatus(resp.StatusCode) {
+			if u := unavailableError(resp, path, []byte(apiErr.ResponseBody)); u != nil {
+				u.Err = apiErr
+				return u
+			}
+		}
+		return err
+	}
+	// a captive portal answers requests without a response body, too
+	if out == nil && !isHTMLResponse(resp) {
+		return nil
+	}
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if u := unavailableError(resp, path, bodyBytes); u != nil {
+		return u
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(bodyBytes, out); err != nil {
+		return err
+	}
+	return c.checkSchema(path, bodyBytes, out)
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, reqBody []byte) (*http.Request, error) {
+	var body io.Reader
+	if reqBody != nil {
+		body = bytes.NewReader(reqBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path), body)
+	if err != nil {
+		return nil, err
+	}
+	token, _ := NormalizeToken(c.Token)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
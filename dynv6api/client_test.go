@@ -0,0 +1,712 @@
+package dynv6api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return &Client{Token: "secret", BaseURL: srv.URL}
+}
+
+func TestGetZoneByName(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/zones/by-name/example.dynv6.net" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"id":42,"name":"example.dynv6.net","ipv4address":"192.0.2.1","ipv6prefix":"2001:db8::/64","createdAt":"2020-01-02T03:04:05Z","updatedAt":"2020-01-02T03:04:05Z"}`))
+	})
+	z, err := c.GetZoneByName(context.Background(), "example.dynv6.net.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.ID != 42 || z.IPv4Address != "192.0.2.1" || z.IPv6Prefix != "2001:db8::/64" || z.CreatedAt.Year() != 2020 {
+		t.Fatalf("unexpected zone %+v", z)
+	}
+}
+
+func TestCreateRecord(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/zones/42/records" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var rec Record
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Type != "MX" || rec.Priority == nil || *rec.Priority != 10 {
+			t.Errorf("unexpected record %+v", rec)
+		}
+		rec.ID = 7
+		rec.ZoneID = 42
+		json.NewEncoder(w).Encode(rec)
+	})
+	prio := 10
+	rec, err := c.CreateRecord(context.Background(), 42, Record{Type: "MX", Name: "@", Data: "mail", Priority: &prio})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.ID != 7 || rec.ZoneID != 42 {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"error":"invalid"}`))
+	})
+	_, err := c.CreateRecord(context.Background(), 1, Record{Type: "TXT", Name: "test", Data: "test"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.ResponseBody != `{"error":"invalid"}` || apiErr.Method != "POST" {
+		t.Fatalf("unexpected error %+v", apiErr)
+	}
+	body, ok := apiErr.RequestBody.(map[string]interface{})
+	if !ok || body["data"] != "test" {
+		t.Fatalf("unexpected request body %#v", apiErr.RequestBody)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Test"); got != "mutated" {
+			t.Errorf("middleware did not mutate request, got X-Test %q", got)
+		}
+		w.Write([]byte(`[]`))
+	})
+	var order []string
+	var calls []Call
+	var statuses []int
+	c.Middleware = []Middleware{
+		func(next Handler) Handler {
+			return func(call *Call) (*http.Response, error) {
+				order = append(order, "outer")
+				resp, err := next(call)
+				if err == nil {
+					statuses = append(statuses, resp.StatusCode)
+				}
+				return resp, err
+			}
+		},
+		func(next Handler) Handler {
+			return func(call *Call) (*http.Response, error) {
+				order = append(order, "inner")
+				calls = append(calls, *call)
+				call.Request.Header.Set("X-Test", "mutated")
+				return next(call)
+			}
+		},
+	}
+	if _, err := c.ListRecords(context.Background(), 42); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 2 || order[0] != "outer" || order[1] != "inner" {
+		t.Fatalf("unexpected middleware order %v", order)
+	}
+	if len(calls) != 1 || calls[0].Method != "GET" || calls[0].Path != "/zones/42/records" || calls[0].Attempt != 1 {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+	if len(statuses) != 1 || statuses[0] != http.StatusOK {
+		t.Fatalf("unexpected statuses %v", statuses)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":1}`))
+	})
+	var buf bytes.Buffer
+	c.Middleware = []Middleware{Logging(log.New(&buf, "", 0), LogBodies)}
+	if _, err := c.CreateRecord(context.Background(), 42, Record{Type: "TXT", Name: "x", Data: "y"}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"POST /zones/42/records (attempt 1): 200 OK", `request body: {"type":"TXT","name":"x","data":"y"}`, `response body: {"id":1}`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log output %q does not contain %q", out, want)
+		}
+	}
+
+	buf.Reset()
+	c.Middleware = []Middleware{Logging(log.New(&buf, "", 0), LogErrors)}
+	if _, err := c.GetRecord(context.Background(), 42, 1); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("LogErrors logged a successful call: %q", buf.String())
+	}
+}
+
+func TestStats(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/zones/by-name/missing.dynv6.net" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[]`))
+	})
+	ctx := context.Background()
+	c.ListRecords(ctx, 1)
+	c.ListRecords(ctx, 2)
+	c.GetZoneByName(ctx, "missing.dynv6.net")
+	st := c.Stats()
+	if st.Calls["GET /zones/{id}/records"] != 2 || st.Calls["GET /zones/by-name/{name}"] != 1 {
+		t.Fatalf("unexpected calls %v", st.Calls)
+	}
+	if st.Errors["not_found"] != 1 || len(st.Errors) != 1 {
+		t.Fatalf("unexpected errors %v", st.Errors)
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&Error{StatusCode: 401}, "auth"},
+		{&Error{StatusCode: 429}, "rate_limit"},
+		{&Error{StatusCode: 422}, "client"},
+		{&Error{StatusCode: 503}, "server"},
+		{&UnavailableError{StatusCode: 503, Err: &Error{StatusCode: 503}}, "unavailable"},
+		{context.DeadlineExceeded, "timeout"},
+		{&json.SyntaxError{}, "decode"},
+		{errors.New("boom"), "other"},
+	}
+	for _, test := range tests {
+		if got := ErrorClass(test.err); got != test.want {
+			t.Errorf("ErrorClass(%v) = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+func TestFilterRecords(t *testing.T) {
+	recs := []Record{
+		{Name: "", Type: "A", Data: "192.0.2.1"},
+		{Name: "www", Type: "A", Data: "192.0.2.2"},
+		{Name: "www", Type: "TXT", Data: "x"},
+	}
+	tests := []struct {
+		f    RecordFilter
+		want int
+	}{
+		{RecordFilter{}, 3},
+		{RecordFilter{Name: "@"}, 1},
+		{RecordFilter{Name: "WWW"}, 2},
+		{RecordFilter{Type: "a"}, 2},
+		{RecordFilter{Name: "www", Type: "TXT"}, 1},
+	}
+	for _, test := range tests {
+		if got := len(FilterRecords(recs, test.f)); got != test.want {
+			t.Errorf("FilterRecords(%+v) returned %d records, want %d", test.f, got, test.want)
+		}
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	hc := NewHTTPClient(TransportOptions{MaxIdleConnsPerHost: 16, IdleConnTimeout: time.Minute, DisableKeepAlives: true})
+	tr := hc.Transport.(*transport).current()
+	if tr.MaxIdleConnsPerHost != 16 || tr.IdleConnTimeout != time.Minute || !tr.DisableKeepAlives {
+		t.Fatalf("options not applied: %+v", tr)
+	}
+	if timeout := hc.Transport.(*transport).opts.timeout(); timeout != 60*time.Second {
+		t.Fatalf("unexpected default timeout %s", timeout)
+	}
+	if tr.MaxIdleConns != http.DefaultTransport.(*http.Transport).MaxIdleConns {
+		t.Fatal("zero values must keep the defaults")
+	}
+}
+
+func TestTransportReset(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+	hc := NewHTTPClient(TransportOptions{Timeout: 20 * time.Millisecond})
+	tr := hc.Transport.(*transport)
+	first := tr.current()
+	if first.TLSNextProto != nil {
+		t.Fatal("HTTP/2 should be enabled by default")
+	}
+	for i := 0; i < resetAfterTimeouts; i++ {
+		if _, err := hc.Get(srv.URL); err == nil {
+			t.Fatal("expected a timeout")
+		}
+	}
+	if tr.current() == first {
+		t.Fatal("transport was not recreated after repeated timeouts")
+	}
+	if tr.current().TLSNextProto == nil {
+		t.Fatal("expected a fallback to HTTP/1.1")
+	}
+
+	if tr := NewHTTPClient(TransportOptions{HTTP2: HTTP2Disable}).Transport.(*transport).current(); tr.TLSNextProto == nil || tr.ForceAttemptHTTP2 {
+		t.Fatal("HTTP/2 not disabled")
+	}
+}
+
+func TestHedge(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+		if n == 1 {
+			// the first request stalls
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`[{"id":1,"name":"example.dynv6.net"}]`))
+	}))
+	defer srv.Close()
+	c := &Client{Token: "secret", BaseURL: srv.URL, Middleware: []Middleware{Hedge(10 * time.Millisecond)}}
+	zones, err := c.ListZones(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+	if n := count(); len(zones) != 1 || n != 2 {
+		t.Fatalf("got %d zones after %d requests", len(zones), n)
+	}
+
+	// writes are never hedged
+	mu.Lock()
+	requests = 0
+	mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.CreateRecord(ctx, 1, Record{Type: "A"}); err == nil {
+		t.Fatal("expected the stalled write to time out")
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("write sent %d times", n)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var mu sync.Mutex
+	failures := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	c := &Client{Token: "secret", BaseURL: srv.URL, RetryPolicy: ExponentialBackoff{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}}
+	if _, err := c.ListZones(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if st := c.Stats(); st.Retries != 2 {
+		t.Fatalf("got %d retries, want 2", st.Retries)
+	}
+
+	failures = 1
+	c.RetryPolicy = NoRetry
+	var apiErr *Error
+	if _, err := c.ListZones(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got error %v, want the 503", err)
+	}
+
+	// creates are not retried after network errors
+	var attempts int
+	c.RetryPolicy = RetryPolicyFunc(func(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+		attempts++
+		return 0, attempt < 3
+	})
+	c.BaseURL = "http://127.0.0.1:1"
+	if _, err := c.CreateRecord(context.Background(), 1, Record{Type: "A"}); err == nil {
+		t.Fatal("expected a network error")
+	}
+	if attempts != 1 {
+		t.Fatalf("create attempted %d times", attempts)
+	}
+
+	// nor after gateway errors, which may come after the record was
+	// created, but after 429
+	for _, test := range []struct {
+		status   int
+		attempts int
+	}{
+		{http.StatusBadGateway, 1},
+		{http.StatusServiceUnavailable, 1},
+		{http.StatusGatewayTimeout, 1},
+		{http.StatusTooManyRequests, 3},
+	} {
+		status := test.status
+		var posts int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			posts++
+			w.WriteHeader(status)
+		}))
+		c := &Client{Token: "secret", BaseURL: srv.URL, RetryPolicy: ExponentialBackoff{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}}
+		c.CreateRecord(context.Background(), 1, Record{Type: "A"})
+		srv.Close()
+		if posts != test.attempts {
+			t.Errorf("%d: create attempted %d times, want %d", status, posts, test.attempts)
+		}
+	}
+}
+
+func TestAuthError(t *testing.T) {
+	status := http.StatusUnauthorized
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	tests := []struct {
+		token  string
+		status int
+		reason string
+	}{
+		{"", 0, AuthMissingToken},
+		{"sec\nret", 0, AuthMalformedToken},
+		{"secret", http.StatusUnauthorized, AuthInvalidToken},
+		{"secret", http.StatusForbidden, AuthForbidden},
+	}
+	for _, test := range tests {
+		status = test.status
+		c := &Client{Token: test.token, BaseURL: srv.URL, RetryPolicy: NoRetry}
+		_, err := c.ListZones(context.Background())
+		var authErr *AuthError
+		if !errors.As(err, &authErr) || authErr.Reason != test.reason {
+			t.Errorf("token %q, status %d: got %v, want reason %s", test.token, test.status, err, test.reason)
+			continue
+		}
+		if !strings.Contains(err.Error(), KeysURL) || ErrorClass(err) != "auth" {
+			t.Errorf("unexpected error %q", err)
+		}
+		var apiErr *Error
+		if test.status != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != test.status) {
+			t.Errorf("API error not wrapped: %v", err)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "1")
+		w.Header().Set("X-RateLimit-Reset", "10")
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	var reported []RateLimit
+	c := &Client{Token: "secret", BaseURL: srv.URL, OnRateLimit: func(rl RateLimit) {
+		reported = append(reported, rl)
+	}}
+	if c.RateLimit() != nil {
+		t.Fatal("rate limit known before the first request")
+	}
+	if _, err := c.ListZones(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	rl := c.Stats().RateLimit
+	if rl == nil || rl.Remaining != 1 || rl.Reset.Sub(rl.Observed) != 10*time.Second {
+		t.Fatalf("unexpected rate limit %+v", rl)
+	}
+	if len(reported) != 1 || reported[0] != *rl {
+		t.Fatalf("callback got %+v", reported)
+	}
+	// the remaining request is spread over the time until the reset
+	if d := c.rateLimitDelay(rl.Observed); d != 5*time.Second {
+		t.Fatalf("got delay %v, want 5s", d)
+	}
+	if d := c.rateLimitDelay(rl.Reset); d != 0 {
+		t.Fatalf("got delay %v after the reset", d)
+	}
+	c.RateLimitReserve = -1
+	if d := c.rateLimitDelay(rl.Observed); d != 0 {
+		t.Fatalf("got delay %v with the slowdown disabled", d)
+	}
+
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("X-RateLimit-Remaining", "100")
+	resp.Header.Set("X-RateLimit-Reset", "1900000000")
+	if rl, ok := parseRateLimit(resp, time.Now()); !ok || !rl.Reset.Equal(time.Unix(1900000000, 0)) {
+		t.Fatalf("unexpected rate limit %+v", rl)
+	}
+
+	// a negative remaining quota counts as exhausted
+	resp.Header.Set("X-RateLimit-Remaining", "-1")
+	resp.Header.Set("X-RateLimit-Reset", "10")
+	neg, ok := parseRateLimit(resp, rl.Observed)
+	if !ok || neg.Remaining != 0 {
+		t.Fatalf("unexpected rate limit %+v", neg)
+	}
+	c.RateLimitReserve = 0
+	c.rateLimit.set(neg)
+	if d := c.rateLimitDelay(neg.Observed); d != 10*time.Second {
+		t.Fatalf("got delay %v, want 10s", d)
+	}
+}
+
+// fakeClock records sleeps instead of waiting.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+func TestClock(t *testing.T) {
+	failures := 3
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "1")
+		w.Header().Set("X-RateLimit-Reset", "10")
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := &Client{Token: "secret", BaseURL: srv.URL, Clock: clock, Sleeper: clock,
+		RetryPolicy: RetryPolicyFunc(func(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+			return time.Duration(attempt) * time.Minute, err == nil && resp.StatusCode == http.StatusServiceUnavailable
+		})}
+	start := time.Now()
+	if _, err := c.ListZones(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("retries took %s of real time", elapsed)
+	}
+	want := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute}
+	if len(clock.sleeps) != len(want) || clock.sleeps[0] != want[0] || clock.sleeps[2] != want[2] {
+		t.Fatalf("slept %v, want %v", clock.sleeps, want)
+	}
+	// the quota is observed at the fake time and spaces out the next request
+	if rl := c.RateLimit(); !rl.Observed.Equal(clock.now) {
+		t.Fatalf("rate limit observed at %s, want %s", rl.Observed, clock.now)
+	}
+	clock.sleeps = nil
+	if _, err := c.ListZones(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 5*time.Second {
+		t.Fatalf("slept %v before the request, want 5s", clock.sleeps)
+	}
+}
+
+func TestDo(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var in map[string]string
+		json.NewDecoder(r.Body).Decode(&in)
+		json.NewEncoder(w).Encode(map[string]string{"path": r.Method + " " + r.URL.Path, "got": in["key"]})
+	}))
+	defer srv.Close()
+	clock := &fakeClock{}
+	c := &Client{Token: "secret", BaseURL: srv.URL, Clock: clock, Sleeper: clock}
+	var out map[string]string
+	if err := c.Do(context.Background(), "PUT", "/zones/1/settings", map[string]string{"key": "value"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["path"] != "PUT /zones/1/settings" || out["got"] != "value" || attempts != 2 {
+		t.Fatalf("got %v after %d attempts", out, attempts)
+	}
+	if err := c.Do(context.Background(), "GET", "zones", nil, nil); err == nil {
+		t.Fatal("accepted a relative path")
+	}
+	c.Token = "other"
+	var authErr *AuthError
+	if err := c.Do(context.Background(), "GET", "/zones", nil, nil); !errors.As(err, &authErr) {
+		t.Fatalf("got %v, want an AuthError", err)
+	}
+}
+
+func TestNormalizeToken(t *testing.T) {
+	for in, want := range map[string]string{
+		"secret":              "secret",
+		"  secret\n":          "secret",
+		`"secret"`:            "secret",
+		"'secret'":            "secret",
+		"Bearer secret":       "secret",
+		` "bearer secret" `:   "secret",
+		"Bearer 'secret'\r\n": "secret",
+		"sec ret":             "sec ret",
+		`"secret`:             `"secret`,
+	} {
+		got, changed := NormalizeToken(in)
+		if got != want || changed != (in != want) {
+			t.Errorf("%q: got %q, %t, want %q", in, got, changed, want)
+		}
+	}
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+	c := &Client{Token: " \"Bearer secret\"\n", BaseURL: srv.URL}
+	if _, err := c.ListZones(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer secret" {
+		t.Fatalf("sent %q", auth)
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id":1,"name":"example.dynv6.net","Ipv4Address":"192.0.2.1","dnssec":true},{"id":2,"name":"b.dynv6.net","owner":{"id":3}}]`))
+	}))
+	defer srv.Close()
+	var unknown []string
+	c := &Client{Token: "secret", BaseURL: srv.URL, OnUnknownFields: func(path string, fields []string) {
+		unknown = append(unknown, path+" "+strings.Join(fields, ","))
+	}}
+	zones, err := c.ListZones(context.Background())
+	if err != nil || len(zones) != 2 || zones[0].IPv4Address != "192.0.2.1" {
+		t.Fatalf("got %v, %v", zones, err)
+	}
+	if len(unknown) != 1 || unknown[0] != "/zones [].dnssec,[].owner" {
+		t.Fatalf("got unknown fields %q", unknown)
+	}
+	c.StrictDecoding = true
+	_, err = c.ListZones(context.Background())
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || len(schemaErr.Fields) != 2 {
+		t.Fatalf("got %v, want a SchemaError", err)
+	}
+}
+
+func TestUpstreamUnavailable(t *testing.T) {
+	var calls int
+	status, ctype, body := http.StatusOK, "text/html; charset=utf-8", "<html>\n  <title>Welcome to Hotel Wi-Fi</title>\n</html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", ctype)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	c := &Client{Token: "secret", BaseURL: srv.URL, RetryPolicy: ExponentialBackoff{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}}
+
+	_, err := c.ListZones(context.Background())
+	var u *UnavailableError
+	if !errors.Is(err, ErrUpstreamUnavailable) || !errors.As(err, &u) || u.Snippet != "<html> <title>Welcome to Hotel Wi-Fi</title> </html>" {
+		t.Fatalf("portal: got %v, want ErrUpstreamUnavailable", err)
+	}
+	if calls != 2 {
+		t.Errorf("portal: got %d calls, want a retry", calls)
+	}
+	// requests without a response body must not succeed either
+	if err := c.DeleteZone(context.Background(), 1); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("portal delete: got %v, want ErrUpstreamUnavailable", err)
+	}
+
+	status, body = http.StatusServiceUnavailable, "<h1>"+strings.Repeat("Down for maintenance ", 20)+"</h1>"
+	_, err = c.ListZones(context.Background())
+	var apiErr *Error
+	if !errors.As(err, &u) || !errors.As(err, &apiErr) || apiErr.StatusCode != 503 || !strings.HasSuffix(u.Snippet, "…") {
+		t.Fatalf("maintenance: got %v, want an UnavailableError wrapping the 503", err)
+	}
+
+	ctype, body = "application/json", `{"error":"overloaded"}`
+	if _, err = c.ListZones(context.Background()); errors.Is(err, ErrUpstreamUnavailable) || !errors.As(err, &apiErr) {
+		t.Fatalf("json error: got %v, want a plain API error", err)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	if got := (&Client{Version: "v3"}).url("/zones"); got != "https://dynv6.com/api/v3/zones" {
+		t.Errorf("got URL %s for v3", got)
+	}
+	if got := (&Client{}).url("/zones"); got != DefaultBaseURL+"/zones" {
+		t.Errorf("got default URL %s", got)
+	}
+
+	var status int
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	c := &Client{Token: "secret", BaseURL: srv.URL, RetryPolicy: NoRetry}
+	tests := []struct {
+		status   int
+		body     string
+		mismatch bool
+	}{
+		{200, `[{"id":1,"name":"example.dynv6.net"}]`, false},
+		{200, `[]`, false},
+		{200, `{"zones":[]}`, true},
+		{200, `[{"zone_id":1,"zone":"example.dynv6.net"}]`, true},
+		{404, `{"error":"not found"}`, true},
+		{401, `{"error":"unauthorized"}`, false},
+	}
+	for _, test := range tests {
+		status, body = test.status, test.body
+		err := c.Detect(context.Background())
+		if errors.Is(err, ErrVersionMismatch) != test.mismatch {
+			t.Errorf("%d %s: got %v, want mismatch %v", test.status, test.body, err, test.mismatch)
+		}
+		if test.status == 401 && !errors.As(err, new(*AuthError)) {
+			t.Errorf("401: got %v, want an AuthError", err)
+		}
+		if test.status == 200 && !test.mismatch && err != nil {
+			t.Errorf("%s: got %v", test.body, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package dynv6api
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time, e.g. to interpret rate limit resets. Tests can set
+// a fake Clock and Sleeper to run retries and rate limiting instantly and
+// deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+// Sleeper waits between retries and when spacing out requests.
+type Sleeper interface {
+	// Sleep waits for d. It returns ctx.Err() as soon as ctx is done.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// SystemClock is the system's clock, the default Clock and Sleeper.
+var SystemClock interface {
+	Clock
+	Sleeper
+} = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Client) now() time.Time {
+	if c.Clock != nil {
+		return c.Clock.Now()
+	}
+	return time.Now()
+}
+
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	if c.Sleeper != nil {
+		return c.Sleeper.Sleep(ctx, d)
+	}
+	return SystemClock.Sleep(ctx, d)
+}
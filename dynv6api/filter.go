@@ -0,0 +1,53 @@
+package dynv6api
+
+import (
+	"context"
+	"strings"
+)
+
+// RecordFilter selects records by name and type. Empty fields match any
+// value. Name "@" matches the records at the zone apex.
+type RecordFilter struct {
+	Name string
+	Type string
+}
+
+// Match reports whether r is selected by the filter.
+func (f RecordFilter) Match(r Record) bool {
+	if f.Type != "" && !strings.EqualFold(f.Type, r.Type) {
+		return false
+	}
+	if f.Name != "" && !strings.EqualFold(apexName(f.Name), apexName(r.Name)) {
+		return false
+	}
+	return true
+}
+
+func apexName(name string) string {
+	name = strings.TrimSuffix(name, ".")
+	if name == "@" {
+		return ""
+	}
+	return name
+}
+
+// FilterRecords returns the records matching f.
+func FilterRecords(recs []Record, f RecordFilter) []Record {
+	var out []Record
+	for _, r := range recs {
+		if f.Match(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// ListRecordsFiltered returns the records of a zone matching f. The dynv6
+// API has no filtering parameters, so the records are filtered client-side.
+func (c *Client) ListRecordsFiltered(ctx context.Context, zoneID int64, f RecordFilter) ([]Record, error) {
+	recs, err := c.ListRecords(ctx, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	return FilterRecords(recs, f), nil
+}
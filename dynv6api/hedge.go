@@ -0,0 +1,90 @@
+package dynv6api
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Hedge returns a middleware that sends a second, identical GET request if
+// the first one hasn't been answered after delay, and uses whichever
+// response arrives first. It lowers the tail latency of reads when the API
+// is slow, at the cost of additional requests. Other methods are passed on
+// unchanged, as they are not idempotent.
+func Hedge(delay time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(call *Call) (*http.Response, error) {
+			if call.Method != http.MethodGet || delay <= 0 {
+				return next(call)
+			}
+			return hedge(call, next, delay)
+		}
+	}
+}
+
+type hedgeResult struct {
+	resp  *http.Response
+	err   error
+	index int
+}
+
+func hedge(call *Call, next Handler, delay time.Duration) (*http.Response, error) {
+	ctx := call.Request.Context()
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	launch := func() {
+		reqCtx, cancel := context.WithCancel(ctx)
+		c := *call
+		c.Request = call.Request.Clone(reqCtx)
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := next(&c)
+			results <- hedgeResult{resp, err, index}
+		}()
+	}
+	launch()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) == 1 {
+				pending++
+				launch()
+			}
+		case r := <-results:
+			pending--
+			if r.err != nil && pending > 0 {
+				// the other request may still succeed
+				cancels[r.index]()
+				continue
+			}
+			for i, cancel := range cancels {
+				if i != r.index {
+					cancel()
+				}
+			}
+			go discard(results, pending)
+			if r.err != nil {
+				cancels[r.index]()
+				return nil, r.err
+			}
+			r.resp.Body = &cancelBody{r.resp.Body, cancels[r.index]}
+			return r.resp, nil
+		}
+	}
+}
+
+// discard closes the responses of the requests which lost the race.
+func discard(results chan hedgeResult, pending int) {
+	for ; pending > 0; pending-- {
+		if r := <-results; r.err == nil {
+			io.Copy(ioutil.Discard, r.resp.Body)
+			r.resp.Body.Close()
+		}
+	}
+}
@@ -0,0 +1,439 @@
+// Command gen generates the models and operations of the dynv6api package
+// from the OpenAPI document of the dynv6 REST API.
+//
+// It only supports the subset of OpenAPI used by openapi.json: object
+// schemas with scalar properties, path parameters, JSON request bodies and
+// JSON responses that are either a schema reference or an array of them.
+//
+// The following vendor extensions are understood:
+//
+//	x-go-name      Go name of a property or request body parameter
+//	x-trim-suffix  suffix trimmed from a string path parameter before use
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// orderedMap is a JSON object that remembers the order of its keys, so the
+// generated code follows the order of the document.
+type orderedMap struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func (m *orderedMap) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	m.values = map[string]json.RawMessage{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		m.keys = append(m.keys, key)
+		m.values[key] = v
+	}
+	return nil
+}
+
+type document struct {
+	Paths      orderedMap `json:"paths"`
+	Components struct {
+		Parameters map[string]parameter `json:"parameters"`
+		Schemas    orderedMap           `json:"schemas"`
+	} `json:"components"`
+}
+
+type schema struct {
+	Ref         string     `json:"$ref"`
+	Type        string     `json:"type"`
+	Format      string     `json:"format"`
+	Nullable    bool       `json:"nullable"`
+	ReadOnly    bool       `json:"readOnly"`
+	Description string     `json:"description"`
+	GoName      string     `json:"x-go-name"`
+	Required    []string   `json:"required"`
+	Items       *schema    `json:"items"`
+	Properties  orderedMap `json:"properties"`
+}
+
+type parameter struct {
+	Ref        string `json:"$ref"`
+	Name       string `json:"name"`
+	In         string `json:"in"`
+	TrimSuffix string `json:"x-trim-suffix"`
+	Schema     schema `json:"schema"`
+}
+
+type mediaTypes struct {
+	JSON *struct {
+		Schema schema `json:"schema"`
+	} `json:"application/json"`
+}
+
+type operation struct {
+	OperationID string      `json:"operationId"`
+	Description string      `json:"description"`
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		GoName  string     `json:"x-go-name"`
+		Content mediaTypes `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content mediaTypes `json:"content"`
+	} `json:"responses"`
+}
+
+func main() {
+	spec := flag.String("spec", "openapi.json", "OpenAPI document")
+	out := flag.String("out", "api_gen.go", "output file")
+	pkg := flag.String("package", "dynv6api", "package name")
+	flag.Parse()
+
+	b, err := ioutil.ReadFile(*spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var doc document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		log.Fatal(err)
+	}
+	g := &generator{doc: &doc, schemas: map[string]*schema{}}
+	src, err := g.generate(*pkg, *spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	formatted, err := format.Source(src)
+	if err != nil {
+		os.Stderr.Write(src)
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*out, formatted, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type generator struct {
+	doc     *document
+	schemas map[string]*schema
+	buf     bytes.Buffer
+	imports map[string]bool
+	methods []string // signatures of the operations, for the API interface
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generate(pkg, spec string) ([]byte, error) {
+	g.imports = map[string]bool{"context": true}
+	for _, name := range g.doc.Components.Schemas.keys {
+		var s schema
+		if err := json.Unmarshal(g.doc.Components.Schemas.values[name], &s); err != nil {
+			return nil, fmt.Errorf("schema %s: %v", name, err)
+		}
+		g.schemas[name] = &s
+	}
+	for _, name := range g.doc.Components.Schemas.keys {
+		if err := g.genSchema(name, g.schemas[name]); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range g.doc.Paths.keys {
+		var ops orderedMap
+		if err := json.Unmarshal(g.doc.Paths.values[path], &ops); err != nil {
+			return nil, fmt.Errorf("path %s: %v", path, err)
+		}
+		for _, method := range ops.keys {
+			var op operation
+			if err := json.Unmarshal(ops.values[method], &op); err != nil {
+				return nil, fmt.Errorf("%s %s: %v", method, path, err)
+			}
+			if err := g.genOperation(strings.ToUpper(method), path, &op); err != nil {
+				return nil, fmt.Errorf("%s %s: %v", method, path, err)
+			}
+		}
+	}
+
+	g.printf("\n// API is the set of operations of the dynv6 REST API, implemented by\n")
+	g.printf("// Client. Accept it instead of *Client to substitute mocks in tests.\n")
+	g.printf("type API interface {\n")
+	for _, m := range g.methods {
+		g.printf("\t%s\n", m)
+	}
+	g.printf("}\n\nvar _ API = (*Client)(nil)\n")
+
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "// Code generated by internal/gen from %s; DO NOT EDIT.\n\n", spec)
+	fmt.Fprintf(&head, "package %s\n\nimport (\n", pkg)
+	for _, imp := range []string{"context", "fmt", "net/url", "strings", "time"} {
+		if g.imports[imp] {
+			fmt.Fprintf(&head, "\t%q\n", imp)
+		}
+	}
+	head.WriteString(")\n")
+	return append(head.Bytes(), g.buf.Bytes()...), nil
+}
+
+func (g *generator) genSchema(name string, s *schema) error {
+	g.printf("\n")
+	g.comment(s.Description, "")
+	g.printf("type %s struct {\n", name)
+	required := map[string]bool{}
+	for _, r := range s.Required {
+		required[r] = true
+	}
+	for _, prop := range s.Properties.keys {
+		var ps schema
+		if err := json.Unmarshal(s.Properties.values[prop], &ps); err != nil {
+			return fmt.Errorf("schema %s property %s: %v", name, prop, err)
+		}
+		typ, err := g.goType(&ps)
+		if err != nil {
+			return fmt.Errorf("schema %s property %s: %v", name, prop, err)
+		}
+		g.comment(ps.Description, "\t")
+		tag := prop
+		if !required[prop] {
+			tag += ",omitempty"
+		}
+		g.printf("\t%s %s `json:%q`\n", fieldName(prop, &ps), typ, tag)
+	}
+	g.printf("}\n")
+	return nil
+}
+
+func (g *generator) goType(s *schema) (string, error) {
+	if s.Ref != "" {
+		return refName(s.Ref), nil
+	}
+	var typ string
+	switch s.Type {
+	case "string":
+		typ = "string"
+		if s.Format == "date-time" {
+			g.imports["time"] = true
+			typ = "time.Time"
+		}
+	case "integer":
+		typ = "int"
+		if s.Format == "int64" {
+			typ = "int64"
+		}
+	case "boolean":
+		typ = "bool"
+	case "array":
+		elem, err := g.goType(s.Items)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil
+	default:
+		return "", fmt.Errorf("unsupported type %q", s.Type)
+	}
+	if s.Nullable {
+		typ = "*" + typ
+	}
+	return typ, nil
+}
+
+func (g *generator) genOperation(method, path string, op *operation) error {
+	var (
+		params  []string // declarations of the method
+		fmtArgs []string // arguments formatting the path
+		pre     []string // statements before the request
+	)
+	pathFmt := path
+	for _, p := range op.Parameters {
+		if p.Ref != "" {
+			p = g.doc.Components.Parameters[refName(p.Ref)]
+		}
+		if p.In != "path" {
+			return fmt.Errorf("unsupported parameter location %q", p.In)
+		}
+		typ, err := g.goType(&p.Schema)
+		if err != nil {
+			return err
+		}
+		params = append(params, p.Name+" "+typ)
+		placeholder := "{" + p.Name + "}"
+		switch typ {
+		case "string":
+			g.imports["net/url"] = true
+			pathFmt = strings.Replace(pathFmt, placeholder, "%s", 1)
+			fmtArgs = append(fmtArgs, "url.PathEscape("+p.Name+")")
+			if p.TrimSuffix != "" {
+				g.imports["strings"] = true
+				pre = append(pre, fmt.Sprintf("%s = strings.TrimSuffix(%s, %q)", p.Name, p.Name, p.TrimSuffix))
+			}
+		default:
+			pathFmt = strings.Replace(pathFmt, placeholder, "%d", 1)
+			fmtArgs = append(fmtArgs, p.Name)
+		}
+	}
+	in := "nil"
+	if op.RequestBody != nil {
+		if op.RequestBody.Content.JSON == nil {
+			return fmt.Errorf("request body is not JSON")
+		}
+		bs := &op.RequestBody.Content.JSON.Schema
+		typ, err := g.goType(bs)
+		if err != nil {
+			return err
+		}
+		in = op.RequestBody.GoName
+		if in == "" {
+			in = "body"
+		}
+		params = append(params, in+" "+typ)
+		if s, ok := g.schemas[typ]; ok {
+			readOnly, err := g.readOnlyFields(s)
+			if err != nil {
+				return err
+			}
+			for _, f := range readOnly {
+				pre = append(pre, fmt.Sprintf("%s.%s", in, f))
+			}
+		}
+	}
+
+	var result string
+	if resp, ok := op.Responses["200"]; ok && resp.Content.JSON != nil {
+		rs := &resp.Content.JSON.Schema
+		typ, err := g.goType(rs)
+		if err != nil {
+			return err
+		}
+		result = typ
+		if rs.Ref != "" {
+			result = "*" + typ
+		}
+	}
+
+	pathExpr := fmt.Sprintf("%q", pathFmt)
+	if len(fmtArgs) > 0 {
+		g.imports["fmt"] = true
+		pathExpr = fmt.Sprintf("fmt.Sprintf(%q, %s)", pathFmt, strings.Join(fmtArgs, ", "))
+	}
+
+	g.printf("\n")
+	g.comment(op.Description, "")
+	sig := strings.Join(append([]string{"ctx context.Context"}, params...), ", ")
+	if result == "" {
+		g.methods = append(g.methods, fmt.Sprintf("%s(%s) error", op.OperationID, sig))
+		g.printf("func (c *Client) %s(%s) error {\n", op.OperationID, sig)
+		for _, s := range pre {
+			g.printf("\t%s\n", s)
+		}
+		g.printf("\treturn c.do(ctx, %q, %s, %s, nil)\n}\n", method, pathExpr, in)
+		return nil
+	}
+	g.methods = append(g.methods, fmt.Sprintf("%s(%s) (%s, error)", op.OperationID, sig, result))
+	g.printf("func (c *Client) %s(%s) (%s, error) {\n", op.OperationID, sig, result)
+	for _, s := range pre {
+		g.printf("\t%s\n", s)
+	}
+	if strings.HasPrefix(result, "*") {
+		g.printf("\tvar out %s\n", result[1:])
+		g.printf("\tif err := c.do(ctx, %q, %s, %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n", method, pathExpr, in)
+		g.printf("\treturn &out, nil\n}\n")
+	} else {
+		g.printf("\tvar out %s\n", result)
+		g.printf("\tif err := c.do(ctx, %q, %s, %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n", method, pathExpr, in)
+		g.printf("\treturn out, nil\n}\n")
+	}
+	return nil
+}
+
+// readOnlyFields returns assignments clearing the read-only fields of s,
+// which the API ignores on writes.
+func (g *generator) readOnlyFields(s *schema) ([]string, error) {
+	var out []string
+	for _, prop := range s.Properties.keys {
+		var ps schema
+		if err := json.Unmarshal(s.Properties.values[prop], &ps); err != nil {
+			return nil, err
+		}
+		if !ps.ReadOnly {
+			continue
+		}
+		typ, err := g.goType(&ps)
+		if err != nil {
+			return nil, err
+		}
+		zero := `""`
+		switch {
+		case strings.HasPrefix(typ, "*"), strings.HasPrefix(typ, "[]"):
+			zero = "nil"
+		case typ == "int", typ == "int64":
+			zero = "0"
+		case typ == "bool":
+			zero = "false"
+		case typ == "time.Time":
+			zero = "time.Time{}"
+		}
+		out = append(out, fmt.Sprintf("%s = %s", fieldName(prop, &ps), zero))
+	}
+	return out, nil
+}
+
+func (g *generator) comment(text, indent string) {
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" {
+			g.printf("%s//\n", indent)
+			continue
+		}
+		for _, l := range wrap(line, 76-len(indent)) {
+			g.printf("%s// %s\n", indent, l)
+		}
+	}
+}
+
+func wrap(s string, width int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(s) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	return append(lines, line)
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func fieldName(prop string, s *schema) string {
+	if s.GoName != "" {
+		return s.GoName
+	}
+	r := []rune(prop)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
@@ -0,0 +1,94 @@
+package dynv6api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Call describes a single HTTP request attempt made by the client.
+type Call struct {
+	// Method is the HTTP method, e.g. "GET".
+	Method string
+	// Path is the API path relative to the base URL, e.g. "/zones/42/records".
+	Path string
+	// Attempt is 1 for the first attempt of a request.
+	Attempt int
+	// Request is the HTTP request. Middleware may modify it before passing
+	// the call on.
+	Request *http.Request
+}
+
+// Handler performs a call and returns the response.
+type Handler func(call *Call) (*http.Response, error)
+
+// Middleware wraps a Handler. It may inspect or modify the call before
+// invoking next and the response or error after next returns.
+type Middleware func(next Handler) Handler
+
+// chain wraps h with the middleware of the client. The first middleware is
+// the outermost one.
+func (c *Client) chain(h Handler) Handler {
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		h = c.Middleware[i](h)
+	}
+	return h
+}
+
+// LogLevel controls the verbosity of the Logging middleware.
+type LogLevel int
+
+const (
+	// LogErrors logs calls that failed or returned an unexpected status code.
+	LogErrors LogLevel = iota
+	// LogCalls logs every call with its status and duration.
+	LogCalls
+	// LogBodies logs every call including the request and response bodies.
+	LogBodies
+)
+
+// Logging returns a middleware that logs calls to logger with the given
+// verbosity. If logger is nil, the standard logger is used.
+func Logging(logger *log.Logger, level LogLevel) Middleware {
+	logf := log.Printf
+	if logger != nil {
+		logf = logger.Printf
+	}
+	return func(next Handler) Handler {
+		return func(call *Call) (*http.Response, error) {
+			var reqBody []byte
+			if level >= LogBodies && call.Request.GetBody != nil {
+				if body, err := call.Request.GetBody(); err == nil {
+					reqBody, _ = ioutil.ReadAll(body)
+					body.Close()
+				}
+			}
+			start := time.Now()
+			resp, err := next(call)
+			elapsed := time.Since(start).Round(time.Millisecond)
+			switch {
+			case err != nil:
+				logf("dynv6: %s %s (attempt %d): %v after %s", call.Method, call.Path, call.Attempt, err, elapsed)
+				return resp, err
+			case level == LogErrors && resp.StatusCode >= 200 && resp.StatusCode < 300:
+				return resp, err
+			}
+			logf("dynv6: %s %s (attempt %d): %s in %s", call.Method, call.Path, call.Attempt, resp.Status, elapsed)
+			if level >= LogBodies {
+				respBody, readErr := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+				if readErr != nil {
+					return resp, readErr
+				}
+				if len(reqBody) > 0 {
+					logf("dynv6: request body: %s", reqBody)
+				}
+				logf("dynv6: response body: %s", respBody)
+			}
+			return resp, err
+		}
+	}
+}
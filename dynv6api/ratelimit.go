@@ -0,0 +1,121 @@
+package dynv6api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRateLimitReserve is used when Client.RateLimitReserve is zero.
+const defaultRateLimitReserve = 5
+
+// maxRateLimitDelay caps the delay added before a request when the quota
+// is low, so a bogus reset time can't stall the client.
+const maxRateLimitDelay = 30 * time.Second
+
+// RateLimit is the request quota reported by the X-RateLimit-Remaining and
+// X-RateLimit-Reset headers of an API response.
+type RateLimit struct {
+	// Remaining is the number of requests left until Reset.
+	Remaining int `json:"remaining"`
+	// Reset is when the quota is replenished. It is zero if the response
+	// didn't include it.
+	Reset time.Time `json:"reset,omitempty"`
+	// Observed is when the response was received.
+	Observed time.Time `json:"observed"`
+}
+
+// parseRateLimit returns the rate limit reported by resp, if any. The reset
+// header may hold either the seconds until the reset or a Unix timestamp.
+func parseRateLimit(resp *http.Response, now time.Time) (RateLimit, bool) {
+	remaining, err := strconv.Atoi(strings.TrimSpace(resp.Header.Get("X-RateLimit-Remaining")))
+	if err != nil {
+		return RateLimit{}, false
+	}
+	if remaining < 0 {
+		// a broken header, which would make the delay negative or divide
+		// by zero
+		remaining = 0
+	}
+	rl := RateLimit{Remaining: remaining, Observed: now}
+	if reset, err := strconv.ParseInt(strings.TrimSpace(resp.Header.Get("X-RateLimit-Reset")), 10, 64); err == nil && reset >= 0 {
+		if reset > 1e9 {
+			rl.Reset = time.Unix(reset, 0)
+		} else {
+			rl.Reset = now.Add(time.Duration(reset) * time.Second)
+		}
+	}
+	return rl, true
+}
+
+type rateLimitState struct {
+	mu   sync.Mutex
+	last *RateLimit
+}
+
+func (s *rateLimitState) get() *RateLimit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil {
+		return nil
+	}
+	rl := *s.last
+	return &rl
+}
+
+func (s *rateLimitState) set(rl RateLimit) {
+	s.mu.Lock()
+	s.last = &rl
+	s.mu.Unlock()
+}
+
+// RateLimit returns the quota reported by the most recent API response, or
+// nil if the API hasn't reported one.
+func (c *Client) RateLimit() *RateLimit {
+	return c.rateLimit.get()
+}
+
+func (c *Client) observeRateLimit(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	rl, ok := parseRateLimit(resp, c.now())
+	if !ok {
+		return
+	}
+	c.rateLimit.set(rl)
+	if c.OnRateLimit != nil {
+		c.OnRateLimit(rl)
+	}
+}
+
+// rateLimitDelay returns how long to wait before the next request, spreading
+// the remaining requests until the reset once the quota gets low.
+func (c *Client) rateLimitDelay(now time.Time) time.Duration {
+	reserve := c.RateLimitReserve
+	if reserve == 0 {
+		reserve = defaultRateLimitReserve
+	}
+	rl := c.rateLimit.get()
+	if reserve < 0 || rl == nil || rl.Remaining > reserve || rl.Reset.IsZero() || !now.Before(rl.Reset) {
+		return 0
+	}
+	delay := rl.Reset.Sub(now) / time.Duration(rl.Remaining+1)
+	if delay > maxRateLimitDelay {
+		delay = maxRateLimitDelay
+	}
+	return delay
+}
+
+// throttle waits before a request if the quota is low.
+func (c *Client) throttle(ctx context.Context) error {
+	delay := c.rateLimitDelay(c.now())
+	if delay <= 0 {
+		return nil
+	}
+	c.stats.rateLimitWait()
+	return c.sleep(ctx, delay)
+}
@@ -0,0 +1,143 @@
+package dynv6api
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy decides whether a failed request is repeated.
+//
+// ShouldRetry is called after every attempt with its response or error and
+// the number of the attempt, starting at 1. It returns whether to retry and
+// how long to wait before. Requests creating records are only retried if
+// they were rejected with 429 or answered by something in front of the API,
+// e.g. a captive portal, so a record is never created twice; after network
+// errors and 502, 503 or 504 responses the record may exist already.
+type RetryPolicy interface {
+	ShouldRetry(resp *http.Response, err error, attempt int) (delay time.Duration, retry bool)
+}
+
+// RetryPolicyFunc adapts a function to the RetryPolicy interface.
+type RetryPolicyFunc func(resp *http.Response, err error, attempt int) (time.Duration, bool)
+
+// ShouldRetry calls f(resp, err, attempt).
+func (f RetryPolicyFunc) ShouldRetry(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	return f(resp, err, attempt)
+}
+
+// ExponentialBackoff retries network errors, the status codes 429, 502,
+// 503 and 504, and HTML pages in place of successful responses, e.g. of a
+// captive portal, with exponentially growing delays and jitter.
+type ExponentialBackoff struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every
+	// further retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy makes up to 4 attempts, waiting between 0.5 and 10
+// seconds.
+var DefaultRetryPolicy RetryPolicy = ExponentialBackoff{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// NoRetry never retries.
+var NoRetry RetryPolicy = RetryPolicyFunc(func(*http.Response, error, int) (time.Duration, bool) {
+	return 0, false
+})
+
+// ShouldRetry implements RetryPolicy.
+func (b ExponentialBackoff) ShouldRetry(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= b.MaxAttempts || !retryable(resp, err) {
+		return 0, false
+	}
+	delay := b.BaseDelay << uint(attempt-1)
+	if delay > b.MaxDelay || delay <= 0 {
+		delay = b.MaxDelay
+	}
+	// wait between half and the whole delay, so clients don't retry in sync
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	return delay, true
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	if resp.StatusCode < 300 && isHTMLResponse(resp) {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// createRetryable reports whether a failed request creating a record surely
+// didn't create it. A gateway may answer 502, 503 or 504 after dynv6
+// processed the request.
+func createRetryable(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode < 300 && isHTMLResponse(resp)
+}
+
+func (c *Client) retryPolicy() RetryPolicy {
+	if c.RetryPolicy != nil {
+		return c.RetryPolicy
+	}
+	return DefaultRetryPolicy
+}
+
+// RetryBudget caps the retries of all requests made with a context, so a
+// batch of calls against a flaky API can't multiply into many more
+// requests. It is safe for concurrent use.
+type RetryBudget struct {
+	remaining int64
+}
+
+// NewRetryBudget returns a budget allowing n retries in total.
+func NewRetryBudget(n int) *RetryBudget {
+	return &RetryBudget{remaining: int64(n)}
+}
+
+// Remaining returns the number of retries left.
+func (b *RetryBudget) Remaining() int {
+	return int(atomic.LoadInt64(&b.remaining))
+}
+
+func (b *RetryBudget) take() bool {
+	for {
+		n := atomic.LoadInt64(&b.remaining)
+		if n <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.remaining, n, n-1) {
+			return true
+		}
+	}
+}
+
+type retryBudgetKey struct{}
+
+// WithRetryBudget returns a copy of ctx whose requests share the budget b.
+func WithRetryBudget(ctx context.Context, b *RetryBudget) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, b)
+}
+
+// RetryBudgetFrom returns the budget of ctx, or nil if it has none.
+func RetryBudgetFrom(ctx context.Context) *RetryBudget {
+	b, _ := ctx.Value(retryBudgetKey{}).(*RetryBudget)
+	return b
+}
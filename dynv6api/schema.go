@@ -0,0 +1,102 @@
+package dynv6api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SchemaError is returned with StrictDecoding when a response has fields
+// the models don't have, i.e. dynv6 changed its API.
+type SchemaError struct {
+	// Path is the API path of the request, e.g. /zones/1/records.
+	Path string
+	// Fields are the unknown fields, e.g. "[].ttl" for a field of the
+	// records of a listing.
+	Fields []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("Unknown fields in the response of %s: %s", e.Path, strings.Join(e.Fields, ", "))
+}
+
+// checkSchema reports the fields of the JSON data which out has no field
+// for, if StrictDecoding or OnUnknownFields ask for them.
+func (c *Client) checkSchema(path string, data []byte, out interface{}) error {
+	if !c.StrictDecoding && c.OnUnknownFields == nil {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		// the error was reported by decoding into out
+		return nil
+	}
+	seen := map[string]bool{}
+	unknownFields(v, reflect.TypeOf(out), "", seen)
+	if len(seen) == 0 {
+		return nil
+	}
+	fields := make([]string, 0, len(seen))
+	for f := range seen {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	if c.StrictDecoding {
+		return &SchemaError{Path: path, Fields: fields}
+	}
+	c.OnUnknownFields(path, fields)
+	return nil
+}
+
+// unknownFields adds the fields of the decoded JSON value v which t has no
+// field for to seen, prefixed with their path.
+func unknownFields(v interface{}, t reflect.Type, prefix string, seen map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return
+		}
+		for _, e := range v {
+			unknownFields(e, t.Elem(), prefix+"[]", seen)
+		}
+	case map[string]interface{}:
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		for name, e := range v {
+			f, ok := jsonField(t, name)
+			if !ok {
+				seen[strings.TrimPrefix(prefix+"."+name, ".")] = true
+				continue
+			}
+			unknownFields(e, f.Type, prefix+"."+name, seen)
+		}
+	}
+}
+
+// jsonField returns the field of the struct type t which encoding/json
+// decodes the JSON field name into, matching case-insensitively like it.
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if strings.EqualFold(tag, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
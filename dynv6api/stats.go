@@ -0,0 +1,144 @@
+package dynv6api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Stats is a snapshot of the counters of a client.
+type Stats struct {
+	// Calls counts the HTTP calls made per endpoint, e.g.
+	// "GET /zones/{id}/records". Every attempt is counted.
+	Calls map[string]int64 `json:"calls"`
+	// Retries counts the attempts that repeated an earlier failed attempt.
+	Retries int64 `json:"retries"`
+	// RateLimitWaits counts the times a request was delayed because of
+	// rate limiting.
+	RateLimitWaits int64 `json:"rate_limit_waits"`
+	// RateLimit is the quota reported by the most recent response, if any.
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+	// Errors counts failed requests per error class, see ErrorClass.
+	Errors map[string]int64 `json:"errors"`
+}
+
+type statsCollector struct {
+	mu             sync.Mutex
+	calls          map[string]int64
+	retries        int64
+	rateLimitWaits int64
+	errors         map[string]int64
+}
+
+func (s *statsCollector) call(method, path string, attempt int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.calls == nil {
+		s.calls = map[string]int64{}
+	}
+	s.calls[endpoint(method, path)]++
+	if attempt > 1 {
+		s.retries++
+	}
+}
+
+func (s *statsCollector) rateLimitWait() {
+	s.mu.Lock()
+	s.rateLimitWaits++
+	s.mu.Unlock()
+}
+
+func (s *statsCollector) error(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.errors == nil {
+		s.errors = map[string]int64{}
+	}
+	s.errors[ErrorClass(err)]++
+}
+
+func (s *statsCollector) snapshot() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Stats{
+		Calls:          make(map[string]int64, len(s.calls)),
+		Retries:        s.retries,
+		RateLimitWaits: s.rateLimitWaits,
+		Errors:         make(map[string]int64, len(s.errors)),
+	}
+	for k, v := range s.calls {
+		st.Calls[k] = v
+	}
+	for k, v := range s.errors {
+		st.Errors[k] = v
+	}
+	return st
+}
+
+// Stats returns a snapshot of the client's counters.
+func (c *Client) Stats() Stats {
+	st := c.stats.snapshot()
+	st.RateLimit = c.RateLimit()
+	return st
+}
+
+// endpoint returns the method and path with IDs and names replaced by
+// placeholders, so calls can be grouped per endpoint.
+func endpoint(method, path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		switch {
+		case i > 0 && segs[i-1] == "by-name":
+			segs[i] = "{name}"
+		case seg != "" && strings.Trim(seg, "0123456789") == "":
+			segs[i] = "{id}"
+		}
+	}
+	return method + " " + strings.Join(segs, "/")
+}
+
+// ErrorClass classifies an error returned by the client as one of "auth",
+// "not_found", "rate_limit", "client", "server", "unavailable", "timeout",
+// "canceled", "network", "decode" or "other".
+func ErrorClass(err error) string {
+	var apiErr *Error
+	var authErr *AuthError
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &authErr):
+		return "auth"
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return "unavailable"
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.StatusCode == 401 || apiErr.StatusCode == 403:
+			return "auth"
+		case apiErr.StatusCode == 404:
+			return "not_found"
+		case apiErr.StatusCode == 429:
+			return "rate_limit"
+		case apiErr.StatusCode >= 500:
+			return "server"
+		default:
+			return "client"
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return "decode"
+	default:
+		return "other"
+	}
+}
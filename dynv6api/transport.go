@@ -0,0 +1,178 @@
+package dynv6api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTP/2 modes of TransportOptions.
+const (
+	// HTTP2Auto uses HTTP/2 if the server supports it and falls back to
+	// HTTP/1.1 if HTTP/2 connections keep timing out.
+	HTTP2Auto = ""
+	// HTTP2Force always attempts HTTP/2.
+	HTTP2Force = "force"
+	// HTTP2Disable only uses HTTP/1.1.
+	HTTP2Disable = "disable"
+)
+
+// resetAfterTimeouts is the number of consecutive timeouts after which the
+// connections are dropped and the transport is recreated.
+const resetAfterTimeouts = 3
+
+// TransportOptions tune the connection handling of the HTTP client returned
+// by NewHTTPClient. Zero values keep the defaults of http.DefaultTransport.
+type TransportOptions struct {
+	// MaxIdleConns limits the number of idle connections kept open.
+	MaxIdleConns int `json:"max_idle_conns,omitempty"`
+
+	// MaxIdleConnsPerHost limits the number of idle connections kept open
+	// to the API. Raise it for many concurrent requests, the Go default is 2.
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host,omitempty"`
+
+	// MaxConnsPerHost limits the number of connections to the API,
+	// including connections in use.
+	MaxConnsPerHost int `json:"max_conns_per_host,omitempty"`
+
+	// IdleConnTimeout is how long idle connections are kept open.
+	IdleConnTimeout time.Duration `json:"idle_conn_timeout,omitempty"`
+
+	// DisableKeepAlives closes every connection after a single request,
+	// for constrained devices which make few calls.
+	DisableKeepAlives bool `json:"disable_keep_alives,omitempty"`
+
+	// HTTP2 is one of HTTP2Auto (the default), HTTP2Force or HTTP2Disable.
+	HTTP2 string `json:"http2,omitempty"`
+
+	// Timeout of a single request. Defaults to 60 seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// NewHTTPClient returns an HTTP client with the given connection settings,
+// to be used as Client.HTTPClient.
+//
+// A connection can get stuck, e.g. an HTTP/2 connection after the network
+// changed, so that every request on it times out. After repeated timeouts
+// the client drops its connections; in HTTP2Auto mode it also switches to
+// HTTP/1.1.
+func NewHTTPClient(opts TransportOptions) *http.Client {
+	// the transport applies the timeout itself to tell timeouts apart from
+	// canceled requests
+	return &http.Client{
+		Transport: &transport{opts: opts, rt: newTransport(opts, opts.HTTP2 == HTTP2Disable)},
+	}
+}
+
+func (opts TransportOptions) timeout() time.Duration {
+	if opts.Timeout > 0 {
+		return opts.Timeout
+	}
+	return defaultTimeout
+}
+
+func newTransport(opts TransportOptions, http1 bool) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.MaxIdleConns > 0 {
+		t.MaxIdleConns = opts.MaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	if opts.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+	if opts.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	t.DisableKeepAlives = opts.DisableKeepAlives
+	if http1 {
+		// a non-nil, empty map disables HTTP/2
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+// transport recreates the underlying transport after repeated timeouts.
+type transport struct {
+	opts TransportOptions
+
+	mu       sync.Mutex
+	rt       *http.Transport
+	timeouts int
+	http1    bool
+}
+
+func (t *transport) current() *http.Transport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rt
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt := t.current()
+	ctx, cancel := context.WithTimeout(req.Context(), t.opts.timeout())
+	resp, err := rt.RoundTrip(req.WithContext(ctx))
+	if err == nil {
+		resp.Body = &cancelBody{resp.Body, cancel}
+	} else {
+		if ctx.Err() == context.DeadlineExceeded && req.Context().Err() == nil {
+			err = &timeoutError{err}
+		}
+		cancel()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err == nil || req.Context().Err() != nil || !isTimeout(err) {
+		// the deadline of the caller doesn't say anything about the connection
+		t.timeouts = 0
+		return resp, err
+	}
+	t.timeouts++
+	if t.timeouts >= resetAfterTimeouts && t.rt == rt {
+		rt.CloseIdleConnections()
+		if t.opts.HTTP2 == HTTP2Auto {
+			t.http1 = true
+		}
+		t.rt = newTransport(t.opts, t.http1 || t.opts.HTTP2 == HTTP2Disable)
+		t.timeouts = 0
+	}
+	return resp, err
+}
+
+// CloseIdleConnections is called by http.Client.CloseIdleConnections.
+func (t *transport) CloseIdleConnections() {
+	t.current().CloseIdleConnections()
+}
+
+// cancelBody releases the timeout of a request once its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type timeoutError struct {
+	err error
+}
+
+func (e *timeoutError) Error() string   { return e.err.Error() + " (timeout exceeded)" }
+func (e *timeoutError) Unwrap() error   { return e.err }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,103 @@
+package dynv6api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUpstreamUnavailable is matched by errors.Is when the API answered with
+// something other than JSON, e.g. the HTML page of a maintenance or of the
+// captive portal of a hotel Wi-Fi. Retrying later usually helps.
+var ErrUpstreamUnavailable = errors.New("The dynv6 API is unavailable")
+
+// UnavailableError is returned when the API responds with a non-JSON body in
+// place of a JSON one or of an error, see ErrUpstreamUnavailable.
+type UnavailableError struct {
+	StatusCode int
+	// Path is the API path of the request, e.g. /zones.
+	Path string
+	// ContentType is the Content-Type header of the response.
+	ContentType string
+	// Snippet is the start of the body with its whitespace collapsed.
+	Snippet string
+	// Err is the API error, if the status code wasn't successful.
+	Err *Error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("The dynv6 API is unavailable, %s responded with status %d and %s instead of JSON: %q", e.Path, e.StatusCode, e.ContentType, e.Snippet)
+}
+
+// Is reports whether target is ErrUpstreamUnavailable.
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUpstreamUnavailable
+}
+
+func (e *UnavailableError) Unwrap() error {
+	if e.Err == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// snippetLength is the maximum length of UnavailableError.Snippet in bytes.
+const snippetLength = 200
+
+// unavailableError returns an UnavailableError if body of a response isn't
+// JSON, or nil.
+func unavailableError(resp *http.Response, path string, body []byte) *UnavailableError {
+	ctype := resp.Header.Get("Content-Type")
+	if isJSONType(ctype) || json.Valid(body) {
+		return nil
+	}
+	if ctype == "" {
+		ctype = "no content type"
+	}
+	return &UnavailableError{
+		StatusCode:  resp.StatusCode,
+		Path:        path,
+		ContentType: ctype,
+		Snippet:     snippet(body),
+	}
+}
+
+// unavailableStatus reports whether a response with the status code and a
+// non-JSON body means that the API is unavailable rather than that it
+// refused the request.
+func unavailableStatus(code int) bool {
+	switch code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return code >= 200 && code < 300
+}
+
+// isHTMLResponse reports whether a response is an HTML page, which the API
+// never sends.
+func isHTMLResponse(resp *http.Response) bool {
+	t, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return t == "text/html"
+}
+
+func isJSONType(ctype string) bool {
+	t, _, _ := mime.ParseMediaType(ctype)
+	return t == "application/json" || strings.HasSuffix(t, "+json")
+}
+
+// snippet collapses the whitespace of body and cuts it to snippetLength.
+func snippet(body []byte) string {
+	s := strings.Join(strings.Fields(string(body)), " ")
+	if len(s) <= snippetLength {
+		return s
+	}
+	s = s[:snippetLength]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s + "…"
+}
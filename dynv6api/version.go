@@ -0,0 +1,57 @@
+package dynv6api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultAPIVersion is the version of the dynv6 REST API the models and
+// operations of this package were written for.
+const DefaultAPIVersion = "v2"
+
+// defaultAPIURL is DefaultBaseURL without the version.
+const defaultAPIURL = "https://dynv6.com/api/"
+
+// ErrVersionMismatch is matched by errors.Is when Detect finds that the API
+// doesn't respond like the version the client expects.
+var ErrVersionMismatch = errors.New("The dynv6 API doesn't respond like the expected version")
+
+// Detect confirms with a single request listing the zones that the API
+// version the client talks to is served and responds like the client
+// expects. Errors of a mismatching version match ErrVersionMismatch; other
+// errors, e.g. an AuthError, are returned unchanged.
+func (c *Client) Detect(ctx context.Context) error {
+	var zones json.RawMessage
+	err := c.do(ctx, http.MethodGet, "/zones", nil, &zones)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusGone) {
+		return fmt.Errorf("%w: %s is not served: %s", ErrVersionMismatch, c.url(""), apiErr.Status)
+	}
+	if err != nil {
+		return err
+	}
+	var list []struct {
+		ID   *int64  `json:"id"`
+		Name *string `json:"name"`
+	}
+	if err := json.Unmarshal(zones, &list); err != nil {
+		return fmt.Errorf("%w: the zones of %s are not a list of zones: %v", ErrVersionMismatch, c.url(""), err)
+	}
+	for _, z := range list {
+		if z.ID == nil || z.Name == nil {
+			return fmt.Errorf("%w: the zones of %s have no id or name", ErrVersionMismatch, c.url(""))
+		}
+	}
+	return nil
+}
+
+func (c *Client) version() string {
+	if c.Version != "" {
+		return strings.Trim(c.Version, "/")
+	}
+	return DefaultAPIVersion
+}
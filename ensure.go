@@ -0,0 +1,43 @@
+package dynv6
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/libdns/libdns"
+)
+
+// Ensure makes rec the only record of its name and type in the zone: it
+// creates rec if the RRset doesn't exist, replaces the RRset if it differs
+// and does nothing if it already consists of rec. It reports whether the
+// zone was changed, so provisioning scripts can be run repeatedly.
+func (p *Provider) Ensure(ctx context.Context, zone string, rec libdns.Record) (bool, error) {
+	rr := rec.RR()
+	existing, err := p.GetRecordsByNameAndType(ctx, zone, rr.Name, rr.Type)
+	if err != nil {
+		return false, err
+	}
+	if len(existing) == 1 && CompareRecords(existing[0], rec) == 0 {
+		return false, nil
+	}
+	if _, err := p.SetRecords(ctx, zone, []libdns.Record{rec}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// EnsureTXT makes text the only TXT record of name, see Ensure.
+func (p *Provider) EnsureTXT(ctx context.Context, zone, name, text string) (bool, error) {
+	return p.Ensure(ctx, zone, libdns.TXT{Name: name, TTL: p.TTL, Text: text})
+}
+
+// EnsureA makes ip the only A or, for an IPv6 address, AAAA record of name,
+// see Ensure.
+func (p *Provider) EnsureA(ctx context.Context, zone, name string, ip netip.Addr) (bool, error) {
+	return p.Ensure(ctx, zone, libdns.Address{Name: name, TTL: p.TTL, IP: ip.Unmap()})
+}
+
+// EnsureCNAME makes name an alias of target, see Ensure.
+func (p *Provider) EnsureCNAME(ctx context.Context, zone, name, target string) (bool, error) {
+	return p.Ensure(ctx, zone, libdns.CNAME{Name: name, TTL: p.TTL, Target: target})
+}
@@ -0,0 +1,185 @@
+package dynv6
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+// LoadEnv configures the provider from environment variables, so it can be
+// deployed, e.g. in a container, without a configuration file. Only the
+// variables which are set are applied:
+//
+//	DYNV6_TOKEN                  Token
+//	DYNV6_TOKEN_FILE             file containing the Token, e.g. a Docker secret
+//	DYNV6_BASE_URL               BaseURL
+//	DYNV6_API_VERSION            APIVersion
+//	DYNV6_TTL                    TTL
+//	DYNV6_OPERATION_TIMEOUT      OperationTimeout
+//	DYNV6_RETRY_MAX_ATTEMPTS     MaxAttempts of an ExponentialBackoff RetryPolicy
+//	DYNV6_RETRY_BASE_DELAY       BaseDelay of an ExponentialBackoff RetryPolicy
+//	DYNV6_RETRY_MAX_DELAY        MaxDelay of an ExponentialBackoff RetryPolicy
+//	DYNV6_RETRY_BUDGET           RetryBudget
+//	DYNV6_RATE_LIMIT_RESERVE     RateLimitReserve
+//	DYNV6_SPF_MODE               SPFMode
+//	DYNV6_ZONE_CACHE_TTL         ZoneCacheTTL
+//	DYNV6_RECORD_CACHE_TTL       RecordCacheTTL
+//	DYNV6_PROPAGATION_RESOLVERS  PropagationResolvers, separated by commas
+//	DYNV6_PROPAGATION_QUORUM     PropagationQuorum
+//	DYNV6_LOG_LEVEL              "errors", "calls" or "bodies", adds a
+//	                             dynv6api.Logging middleware writing to Logger
+//
+// Durations are written like "30s" or "5m". It must be called before the
+// provider is first used.
+func (p *Provider) LoadEnv() error {
+	if path, ok := lookupEnv("DYNV6_TOKEN_FILE"); ok {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("DYNV6_TOKEN_FILE: %v", err)
+		}
+		p.Token = strings.TrimSpace(string(b))
+	}
+	if v, ok := lookupEnv("DYNV6_TOKEN"); ok {
+		p.Token = v
+	}
+	if v, ok := lookupEnv("DYNV6_BASE_URL"); ok {
+		p.BaseURL = v
+	}
+	if v, ok := lookupEnv("DYNV6_API_VERSION"); ok {
+		p.APIVersion = v
+	}
+	if v, ok := lookupEnv("DYNV6_SPF_MODE"); ok {
+		p.SPFMode = v
+	}
+	if v, ok := lookupEnv("DYNV6_PROPAGATION_RESOLVERS"); ok {
+		p.PropagationResolvers = nil
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				p.PropagationResolvers = append(p.PropagationResolvers, s)
+			}
+		}
+	}
+	durations := []struct {
+		name  string
+		field *time.Duration
+	}{
+		{"DYNV6_TTL", &p.TTL},
+		{"DYNV6_OPERATION_TIMEOUT", &p.OperationTimeout},
+		{"DYNV6_ZONE_CACHE_TTL", &p.ZoneCacheTTL},
+		{"DYNV6_RECORD_CACHE_TTL", &p.RecordCacheTTL},
+	}
+	for _, d := range durations {
+		if err := envDuration(d.name, d.field); err != nil {
+			return err
+		}
+	}
+	ints := []struct {
+		name  string
+		field *int
+	}{
+		{"DYNV6_RETRY_BUDGET", &p.RetryBudget},
+		{"DYNV6_RATE_LIMIT_RESERVE", &p.RateLimitReserve},
+		{"DYNV6_PROPAGATION_QUORUM", &p.PropagationQuorum},
+	}
+	for _, i := range ints {
+		if err := envInt(i.name, i.field); err != nil {
+			return err
+		}
+	}
+	if err := p.loadRetryEnv(); err != nil {
+		return err
+	}
+	if v, ok := lookupEnv("DYNV6_LOG_LEVEL"); ok {
+		level, err := ParseLogLevel(v)
+		if err != nil {
+			return fmt.Errorf("DYNV6_LOG_LEVEL: %v", err)
+		}
+		p.Middleware = append(p.Middleware, dynv6api.Logging(p.Logger, level))
+	}
+	return nil
+}
+
+// loadRetryEnv applies the DYNV6_RETRY_* variables to the RetryPolicy, which
+// must be unset or an ExponentialBackoff.
+func (p *Provider) loadRetryEnv() error {
+	var backoff dynv6api.ExponentialBackoff
+	switch policy := p.RetryPolicy.(type) {
+	case nil:
+		backoff = dynv6api.DefaultRetryPolicy.(dynv6api.ExponentialBackoff)
+	case dynv6api.ExponentialBackoff:
+		backoff = policy
+	default:
+		return nil
+	}
+	changed := false
+	for _, name := range []string{"DYNV6_RETRY_MAX_ATTEMPTS", "DYNV6_RETRY_BASE_DELAY", "DYNV6_RETRY_MAX_DELAY"} {
+		if _, ok := lookupEnv(name); ok {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := envInt("DYNV6_RETRY_MAX_ATTEMPTS", &backoff.MaxAttempts); err != nil {
+		return err
+	}
+	if err := envDuration("DYNV6_RETRY_BASE_DELAY", &backoff.BaseDelay); err != nil {
+		return err
+	}
+	if err := envDuration("DYNV6_RETRY_MAX_DELAY", &backoff.MaxDelay); err != nil {
+		return err
+	}
+	p.RetryPolicy = backoff
+	return nil
+}
+
+// ParseLogLevel parses "errors", "calls" or "bodies" into a log level of
+// dynv6api.Logging.
+func ParseLogLevel(s string) (dynv6api.LogLevel, error) {
+	switch strings.ToLower(s) {
+	case "errors":
+		return dynv6api.LogErrors, nil
+	case "calls":
+		return dynv6api.LogCalls, nil
+	case "bodies":
+		return dynv6api.LogBodies, nil
+	}
+	return 0, fmt.Errorf("Unknown log level %q, expected errors, calls or bodies", s)
+}
+
+// lookupEnv returns the value of a variable which is set and not empty.
+func lookupEnv(name string) (string, bool) {
+	v := os.Getenv(name)
+	return v, v != ""
+}
+
+func envDuration(name string, field *time.Duration) error {
+	v, ok := lookupEnv(name)
+	if !ok {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	*field = d
+	return nil
+}
+
+func envInt(name string, field *int) error {
+	v, ok := lookupEnv(name)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	*field = n
+	return nil
+}
@@ -0,0 +1,144 @@
+package dynv6
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+)
+
+// ExportVersion is the version of the Export format written by this package.
+// It changes only when a change would break readers of older exports.
+const ExportVersion = 1
+
+// Export is a backup of a zone in a stable JSON format: the records are in
+// the order of CompareRecords and the fields don't depend on the version of
+// the dynv6 API, so exports of an unchanged zone are identical and diff well
+// in version control. Sync restores one from the records of Parse.
+type Export struct {
+	Version int            `json:"version"`
+	Zone    ExportZone     `json:"zone"`
+	Records []ExportRecord `json:"records"`
+}
+
+// ExportZone is the metadata of an exported zone.
+type ExportZone struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	IPv4Address string    `json:"ipv4address,omitempty"`
+	IPv6Prefix  string    `json:"ipv6prefix,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// ExportRecord is an exported record in presentation format, e.g. MX data
+// includes the preference. Name is "@" for the apex.
+type ExportRecord struct {
+	ID           int64  `json:"id,omitempty"`
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Data         string `json:"data"`
+	ExpandedData string `json:"expandedData,omitempty"`
+}
+
+// NewExport returns the export of a zone and its records as returned by
+// the API.
+func NewExport(zone dynv6api.Zone, recs []dynv6api.Record) *Export {
+	e := &Export{
+		Version: ExportVersion,
+		Zone: ExportZone{
+			ID:          zone.ID,
+			Name:        zone.Name,
+			IPv4Address: zone.IPv4Address,
+			IPv6Prefix:  zone.IPv6Prefix,
+			CreatedAt:   zone.CreatedAt.UTC(),
+			UpdatedAt:   zone.UpdatedAt.UTC(),
+		},
+		Records: []ExportRecord{},
+	}
+	for i := range recs {
+		rr := toLibdnsRecord(&recs[i]).RR()
+		name := rr.Name
+		if name == "" {
+			name = "@"
+		}
+		e.Records = append(e.Records, ExportRecord{
+			ID:           recs[i].ID,
+			Name:         name,
+			Type:         rr.Type,
+			Data:         rr.Data,
+			ExpandedData: recs[i].ExpandedData,
+		})
+	}
+	sort.SliceStable(e.Records, func(i, j int) bool {
+		a, b := e.Records[i], e.Records[j]
+		if c := CompareRecords(a.rr(), b.rr()); c != 0 {
+			return c < 0
+		}
+		return a.ID < b.ID
+	})
+	return e
+}
+
+func (r ExportRecord) rr() libdns.RR {
+	return libdns.RR{Name: r.Name, Type: r.Type, Data: r.Data}
+}
+
+// Export returns the export of the zone. It always asks the API.
+func (p *Provider) Export(ctx context.Context, zone string) (*Export, error) {
+	z, err := p.GetZoneInfo(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	recs, err := p.client().ListRecords(ctx, z.ID)
+	if err != nil {
+		return nil, err
+	}
+	return NewExport(*z, recs), nil
+}
+
+// WriteTo writes the export as indented JSON.
+func (e *Export) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// ReadExport decodes an export. Exports of a newer version than
+// ExportVersion are rejected, as fields might be misread.
+func ReadExport(r io.Reader) (*Export, error) {
+	var e Export
+	if err := json.NewDecoder(r).Decode(&e); err != nil {
+		return nil, err
+	}
+	switch {
+	case e.Version == 0:
+		return nil, fmt.Errorf("Missing export version")
+	case e.Version > ExportVersion:
+		return nil, fmt.Errorf("Export version %d is newer than the supported version %d", e.Version, ExportVersion)
+	}
+	return &e, nil
+}
+
+// Parse returns the exported records, e.g. to restore them with Sync.
+func (e *Export) Parse() ([]libdns.Record, error) {
+	recs := make([]libdns.Record, 0, len(e.Records))
+	for _, r := range e.Records {
+		rec, err := r.rr().Parse()
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", r.Name, r.Type, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
@@ -0,0 +1,90 @@
+package dynv6
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// flightGroup coalesces concurrent identical reads, so a burst of calls for
+// the same zone results in a single API request.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+
+	// waiters counts the callers waiting for the call; the last one to
+	// give up cancels it. Guarded by flightGroup.mu.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do calls fn, unless a call with the same key is in flight, in which case
+// it waits for that call and returns its result. shared reports whether the
+// result came from another call.
+//
+// fn runs with the values of ctx but not its deadline or cancellation, so a
+// caller giving up doesn't fail the others; each caller returns the error
+// of its own ctx when it is done first. fn must apply a timeout itself. It
+// is canceled once all callers gave up.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (val interface{}, err error, shared bool) {
+	g.mu.Lock()
+	f, shared := g.calls[key]
+	if !shared {
+		if g.calls == nil {
+			g.calls = map[string]*flight{}
+		}
+		fctx, cancel := context.WithCancel(detached{ctx})
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = f
+		go func() {
+			defer cancel()
+			f.val, f.err = fn(fctx)
+			g.mu.Lock()
+			if g.calls[key] == f {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.val, f.err, shared
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			if g.calls[key] == f {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err(), shared
+	}
+}
+
+// forget makes later calls with the key start a new call instead of joining
+// the one in flight, e.g. because its result is outdated by a write.
+func (g *flightGroup) forget(key string) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+}
+
+// detached is a context with the values of its parent but without its
+// deadline and cancellation.
+type detached struct{ context.Context }
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
@@ -1,5 +1,13 @@
 module github.com/libdns/dynv6
 
-go 1.15
+go 1.18
 
-require github.com/libdns/libdns v1.1.1
+require (
+	github.com/libdns/libdns v1.1.1
+	github.com/miekg/dns v1.1.62
+)
+
+require (
+	golang.org/x/net v0.27.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+)
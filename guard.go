@@ -0,0 +1,48 @@
+package dynv6
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// DangerousDeleteError is returned by DeleteRecords for the NS and SOA
+// records at the apex, which delegate the zone, unless AllowDangerous is
+// set.
+type DangerousDeleteError struct {
+	Record libdns.RR
+}
+
+func (e *DangerousDeleteError) Error() string {
+	return fmt.Sprintf("Refusing to delete %s record %q: without it the zone may stop resolving; set AllowDangerous to delete it anyway", e.Record.Type, e.Record.Name)
+}
+
+// isDangerous reports whether deleting r can break the delegation of the
+// zone. The NS and DS records of subdomains are managed like any other, so
+// removing a delegation doesn't need AllowDangerous.
+func isDangerous(r libdns.Record) bool {
+	rr := r.RR()
+	if keyName(rr.Name) != "@" {
+		return false
+	}
+	switch strings.ToUpper(rr.Type) {
+	case "NS", "SOA":
+		return true
+	}
+	return false
+}
+
+// checkDeletes returns an error for the first dangerous record in recs,
+// unless the provider allows deleting them.
+func (p *Provider) checkDeletes(recs []libdns.Record) error {
+	if p.AllowDangerous {
+		return nil
+	}
+	for _, r := range recs {
+		if isDangerous(r) {
+			return &DangerousDeleteError{Record: r.RR()}
+		}
+	}
+	return nil
+}
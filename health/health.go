@@ -0,0 +1,157 @@
+// Package health serves the /healthz and /readyz endpoints of the daemons,
+// so orchestrators like Kubernetes can restart them when they wedge and
+// route traffic only to instances which can reach dynv6.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+)
+
+// Checker tracks the runs of a daemon and checks the dynv6 API.
+//
+// /healthz fails if no run completed within MaxAge, i.e. the daemon loop is
+// stuck. /readyz also fails if no run succeeded within MaxAge, if the token
+// is rejected or if the API is unreachable.
+type Checker struct {
+	// API is listed to check the token and the reachability of dynv6,
+	// usually the Provider. If nil, the API isn't checked.
+	API libdns.ZoneLister
+
+	// MaxAge is the time within which a run must complete. Zero disables
+	// the checks of runs, e.g. for servers without a loop.
+	MaxAge time.Duration
+
+	// CacheTTL is how long the result of an API check is reused, so probes
+	// don't use up the rate limit. Defaults to one minute.
+	CacheTTL time.Duration
+
+	mu          sync.Mutex
+	started     time.Time
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastErr     error
+	apiChecked  time.Time
+	apiErr      error
+}
+
+// Observe records the outcome of a run.
+func (c *Checker) Observe(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastRun = time.Now()
+	c.lastErr = err
+	if err == nil {
+		c.lastSuccess = c.lastRun
+	}
+}
+
+// Register adds the endpoints to mux. The first run is expected within
+// MaxAge of registering.
+func (c *Checker) Register(mux *http.ServeMux) {
+	c.mu.Lock()
+	c.started = time.Now()
+	c.mu.Unlock()
+	mux.HandleFunc("/healthz", c.Healthz)
+	mux.HandleFunc("/readyz", c.Readyz)
+}
+
+type check struct {
+	name string
+	err  error
+}
+
+// Healthz serves the liveness check.
+func (c *Checker) Healthz(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	checks := []check{{"loop", c.checkAge(c.lastRun, "run")}}
+	c.mu.Unlock()
+	write(w, checks)
+}
+
+// Readyz serves the readiness check.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	checks := []check{{"loop", c.checkAge(c.lastRun, "run")}}
+	err := c.checkAge(c.lastSuccess, "successful run")
+	if err != nil && c.lastErr != nil {
+		err = fmt.Errorf("%v, last error: %v", err, c.lastErr)
+	}
+	checks = append(checks, check{"success", err})
+	c.mu.Unlock()
+	if c.API != nil {
+		err := c.checkAPI(r.Context())
+		tokenErr, apiErr := err, err
+		if dynv6api.ErrorClass(err) == "auth" {
+			apiErr = nil
+		} else {
+			tokenErr = nil
+		}
+		checks = append(checks, check{"token", tokenErr}, check{"api", apiErr})
+	}
+	write(w, checks)
+}
+
+// checkAge checks that t is within MaxAge, counting from the start if
+// there was no run yet. c.mu must be held.
+func (c *Checker) checkAge(t time.Time, what string) error {
+	if c.MaxAge <= 0 {
+		return nil
+	}
+	since := t
+	if since.IsZero() {
+		since = c.started
+	}
+	if age := time.Since(since); age > c.MaxAge {
+		if t.IsZero() {
+			return fmt.Errorf("no %s within %v", what, c.MaxAge)
+		}
+		return fmt.Errorf("last %s %v ago", what, age.Round(time.Second))
+	}
+	return nil
+}
+
+func (c *Checker) checkAPI(ctx context.Context) error {
+	ttl := c.CacheTTL
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	c.mu.Lock()
+	checked, apiErr := c.apiChecked, c.apiErr
+	c.mu.Unlock()
+	if !checked.IsZero() && time.Since(checked) < ttl {
+		return apiErr
+	}
+	// not holding c.mu, so a slow API doesn't block Observe and /healthz
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	_, err := c.API.ListZones(ctx)
+	c.mu.Lock()
+	c.apiChecked, c.apiErr = time.Now(), err
+	c.mu.Unlock()
+	return err
+}
+
+// write reports the checks, one per line, with status 503 if one failed.
+func write(w http.ResponseWriter, checks []check) {
+	var b strings.Builder
+	status := http.StatusOK
+	for _, ch := range checks {
+		if ch.err != nil {
+			status = http.StatusServiceUnavailable
+			fmt.Fprintf(&b, "[-]%s failed: %v\n", ch.name, ch.err)
+		} else {
+			fmt.Fprintf(&b, "[+]%s ok\n", ch.name)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprint(w, b.String())
+}
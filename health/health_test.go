@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+)
+
+type fakeAPI struct {
+	err   error
+	calls int
+}
+
+func (f *fakeAPI) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func get(t *testing.T, mux *http.ServeMux, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestChecker(t *testing.T) {
+	api := &fakeAPI{}
+	c := &Checker{API: api, MaxAge: time.Hour}
+	mux := http.NewServeMux()
+	c.Register(mux)
+
+	// within MaxAge of the start, no run is needed yet
+	if code, body := get(t, mux, "/readyz"); code != http.StatusOK {
+		t.Fatalf("expected ready, got %d:\n%s", code, body)
+	}
+	c.Observe(errors.New("boom"))
+	c.lastSuccess = time.Now().Add(-2 * time.Hour)
+	code, body := get(t, mux, "/readyz")
+	if code != http.StatusServiceUnavailable || !strings.Contains(body, "[-]success failed: last successful run 2h0m0s ago, last error: boom") {
+		t.Fatalf("unexpected readiness %d:\n%s", code, body)
+	}
+	if code, _ := get(t, mux, "/healthz"); code != http.StatusOK {
+		t.Fatalf("expected live, got %d", code)
+	}
+	c.lastRun = time.Now().Add(-2 * time.Hour)
+	if code, _ := get(t, mux, "/healthz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a stuck loop to fail, got %d", code)
+	}
+	if api.calls != 1 {
+		t.Fatalf("expected the API check to be cached, got %d calls", api.calls)
+	}
+}
+
+func TestCheckerAPI(t *testing.T) {
+	api := &fakeAPI{err: &dynv6api.Error{StatusCode: 401, Status: "401 Unauthorized"}}
+	c := &Checker{API: api, CacheTTL: time.Nanosecond}
+	mux := http.NewServeMux()
+	c.Register(mux)
+	code, body := get(t, mux, "/readyz")
+	if code != http.StatusServiceUnavailable || !strings.Contains(body, "[-]token failed") || !strings.Contains(body, "[+]api ok") {
+		t.Fatalf("unexpected readiness %d:\n%s", code, body)
+	}
+	api.err = errors.New("connection refused")
+	time.Sleep(time.Millisecond)
+	code, body = get(t, mux, "/readyz")
+	if code != http.StatusServiceUnavailable || !strings.Contains(body, "[+]token ok") || !strings.Contains(body, "[-]api failed: connection refused") {
+		t.Fatalf("unexpected readiness %d:\n%s", code, body)
+	}
+}
+
+// blockingAPI blocks ListZones until release is closed.
+type blockingAPI struct {
+	started, release chan struct{}
+}
+
+func (b *blockingAPI) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	close(b.started)
+	<-b.release
+	return nil, nil
+}
+
+func TestCheckerSlowAPI(t *testing.T) {
+	api := &blockingAPI{started: make(chan struct{}), release: make(chan struct{})}
+	c := &Checker{API: api, MaxAge: time.Hour}
+	mux := http.NewServeMux()
+	c.Register(mux)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		get(t, mux, "/readyz")
+	}()
+	<-api.started
+	// a hanging API check doesn't block the liveness check and the loop
+	c.Observe(nil)
+	if code, body := get(t, mux, "/healthz"); code != http.StatusOK {
+		t.Fatalf("expected live, got %d:\n%s", code, body)
+	}
+	close(api.release)
+	<-done
+}
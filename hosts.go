@@ -0,0 +1,76 @@
+package dynv6
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"path"
+	"strings"
+)
+
+// HostsOptions select what WriteHosts writes.
+type HostsOptions struct {
+	// Pattern selects records by a shell pattern matching their name,
+	// relative to the zone or fully qualified, e.g. "nas" or "*.home". An
+	// empty pattern selects all records.
+	Pattern string
+	// Replace maps addresses to the ones written instead, e.g. the public
+	// address to the LAN address of a host behind NAT.
+	Replace map[netip.Addr]netip.Addr
+}
+
+// WriteHosts writes the A and AAAA records of the export in /etc/hosts
+// format, one line per record with the fully qualified name, for resolving
+// the names of a zone on a LAN without asking dynv6. The IPv4 address of
+// the zone counts as an apex A record if there is none.
+func (e *Export) WriteHosts(w io.Writer, opts HostsOptions) error {
+	zone := strings.TrimSuffix(e.Zone.Name, ".")
+	type entry struct {
+		name string
+		addr netip.Addr
+	}
+	var entries []entry
+	apexA := false
+	for _, r := range e.Records {
+		if r.Type != "A" && r.Type != "AAAA" {
+			continue
+		}
+		addr, err := netip.ParseAddr(r.Data)
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", r.Name, r.Type, err)
+		}
+		if r.Name == "@" && r.Type == "A" {
+			apexA = true
+		}
+		entries = append(entries, entry{r.Name, addr})
+	}
+	if addr, err := netip.ParseAddr(e.Zone.IPv4Address); err == nil && !apexA {
+		entries = append([]entry{{"@", addr}}, entries...)
+	}
+	for _, en := range entries {
+		fqdn := zone
+		if en.name != "@" {
+			fqdn = en.name + "." + zone
+		}
+		if opts.Pattern != "" && !hostsMatch(opts.Pattern, en.name, fqdn) {
+			continue
+		}
+		addr := en.addr
+		if to, ok := opts.Replace[addr]; ok {
+			addr = to
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", addr, fqdn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hostsMatch(pattern, name, fqdn string) bool {
+	for _, s := range []string{name, fqdn} {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
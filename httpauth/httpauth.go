@@ -0,0 +1,262 @@
+// Package httpauth authenticates the requests to the HTTP servers of the
+// module, e.g. acme-dns and the -listen endpoints of the daemons, so they
+// can be exposed on a LAN. Clients send a static bearer token or sign their
+// requests with a shared secret, and are identified by name in logs.
+//
+// A bearer token is sent as
+//
+//	Authorization: Bearer <token>
+//
+// A signed request carries
+//
+//	Authorization: HMAC-SHA256 Client=<id>,Timestamp=<unix seconds>,Signature=<hex>
+//
+// where the signature is the HMAC-SHA256 with the secret of the client of
+// the timestamp, the method, the path with the query and the hex SHA-256 of
+// the body, each followed by a newline. Sign computes it. Signatures are
+// valid for MaxSkew around the timestamp, which limits replays.
+package httpauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client is a client allowed to call a server.
+type Client struct {
+	// ID names the client in logs, e.g. "traefik".
+	ID string
+	// Token is the bearer token of the client. Empty disables bearer
+	// authentication of the client.
+	Token string
+	// Secret is the HMAC secret the client signs requests with. Empty
+	// disables signed requests of the client.
+	Secret string
+}
+
+// Authenticator checks the requests to a handler.
+type Authenticator struct {
+	Clients []Client
+
+	// Exempt are paths served without authentication, e.g. the health
+	// checks of an orchestrator.
+	Exempt []string
+
+	// MaxSkew is how far the timestamp of a signed request may be from the
+	// time it is received. Defaults to 5 minutes.
+	MaxSkew time.Duration
+
+	// MaxBodySize is the largest body Handler reads to check a signature,
+	// so a client can't exhaust the memory. Defaults to 1 MiB.
+	MaxBodySize int64
+
+	// ErrorLog receives the rejected requests. If nil, the standard logger
+	// is used.
+	ErrorLog *log.Logger
+
+	now func() time.Time
+}
+
+// ErrUnauthorized is returned by Authenticate for requests without valid
+// credentials.
+var ErrUnauthorized = errors.New("httpauth: missing or invalid credentials")
+
+type clientKey struct{}
+
+// ClientID returns the ID of the client which sent the request ctx belongs
+// to, or "" if the request wasn't authenticated.
+func ClientID(ctx context.Context) string {
+	id, _ := ctx.Value(clientKey{}).(string)
+	return id
+}
+
+// Handler returns h, rejecting requests which aren't authenticated with 401
+// Unauthorized. The ID of the client is available to h through ClientID.
+// A nil Authenticator returns h unchanged.
+func (a *Authenticator) Handler(h http.Handler) http.Handler {
+	if a == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range a.Exempt {
+			if r.URL.Path == p {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, a.maxBodySize())
+		id, err := a.Authenticate(r)
+		if err != nil {
+			a.logf("httpauth: rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			if !errors.Is(err, ErrUnauthorized) {
+				// the body of a signed request couldn't be read
+				http.Error(w, "reading body failed", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dynv6"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, id)))
+	})
+}
+
+// Authenticate returns the ID of the client which sent r. The body of a
+// signed request is read and replaced, so handlers can still read it.
+func (a *Authenticator) Authenticate(r *http.Request) (string, error) {
+	auth := r.Header.Get("Authorization")
+	scheme, params := auth, ""
+	if i := strings.IndexByte(auth, ' '); i >= 0 {
+		scheme, params = auth[:i], strings.TrimSpace(auth[i+1:])
+	}
+	switch {
+	case strings.EqualFold(scheme, "Bearer") && params != "":
+		return a.checkToken(params)
+	case strings.EqualFold(scheme, "HMAC-SHA256"):
+		return a.checkSignature(r, params)
+	}
+	return "", ErrUnauthorized
+}
+
+// checkToken compares token with the tokens of all clients in constant
+// time, so the time taken tells nothing about them.
+func (a *Authenticator) checkToken(token string) (string, error) {
+	sum := sha256.Sum256([]byte(token))
+	var id string
+	found := 0
+	for _, c := range a.Clients {
+		if c.Token == "" {
+			continue
+		}
+		want := sha256.Sum256([]byte(c.Token))
+		if subtle.ConstantTimeCompare(sum[:], want[:]) == 1 && found == 0 {
+			id, found = c.ID, 1
+		}
+	}
+	if found == 0 {
+		return "", ErrUnauthorized
+	}
+	return id, nil
+}
+
+func (a *Authenticator) checkSignature(r *http.Request, params string) (string, error) {
+	var id, ts, sig string
+	for _, p := range strings.Split(params, ",") {
+		k, v := p, ""
+		if i := strings.IndexByte(p, '='); i >= 0 {
+			k, v = p[:i], p[i+1:]
+		}
+		switch strings.TrimSpace(k) {
+		case "Client":
+			id = v
+		case "Timestamp":
+			ts = v
+		case "Signature":
+			sig = v
+		}
+	}
+	var secret string
+	for _, c := range a.Clients {
+		if c.ID == id && c.Secret != "" {
+			secret = c.Secret
+		}
+	}
+	if secret == "" {
+		return "", ErrUnauthorized
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", ErrUnauthorized
+	}
+	skew := a.MaxSkew
+	if skew <= 0 {
+		skew = 5 * time.Minute
+	}
+	if d := a.clock().Sub(time.Unix(unix, 0)); d > skew || d < -skew {
+		return "", fmt.Errorf("%w: timestamp too far from the current time", ErrUnauthorized)
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return "", ErrUnauthorized
+	}
+	want, err := signature(r, secret, ts)
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal(got, want) {
+		return "", ErrUnauthorized
+	}
+	return id, nil
+}
+
+// Sign signs r for the server as the client id with secret, setting its
+// Authorization header. The body is read and replaced.
+func Sign(r *http.Request, id, secret string) error {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig, err := signature(r, secret, ts)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 Client=%s,Timestamp=%s,Signature=%x", id, ts, sig))
+	return nil
+}
+
+func signature(r *http.Request, secret, ts string) ([]byte, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%x\n", ts, r.Method, r.URL.RequestURI(), sum)
+	return mac.Sum(nil), nil
+}
+
+// ParseClient parses a client given as "id=credential", e.g. on the
+// command line.
+func ParseClient(s string) (id, credential string, err error) {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 || i == len(s)-1 {
+		return "", "", fmt.Errorf("httpauth: invalid client %q, expected id=credential", s)
+	}
+	return s[:i], s[i+1:], nil
+}
+
+func (a *Authenticator) maxBodySize() int64 {
+	if a.MaxBodySize <= 0 {
+		return 1 << 20
+	}
+	return a.MaxBodySize
+}
+
+func (a *Authenticator) clock() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+	return time.Now()
+}
+
+func (a *Authenticator) logf(format string, args ...interface{}) {
+	if a.ErrorLog != nil {
+		a.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
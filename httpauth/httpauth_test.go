@@ -0,0 +1,88 @@
+package httpauth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	a := &Authenticator{
+		Clients: []Client{
+			{ID: "traefik", Token: "s3cret"},
+			{ID: "certbot", Secret: "shared"},
+		},
+		Exempt:   []string{"/healthz"},
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+	h := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(ClientID(r.Context()) + " " + string(body)))
+	}))
+	do := func(r *http.Request) (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code, rec.Body.String()
+	}
+
+	r := httptest.NewRequest("POST", "/update", strings.NewReader("data"))
+	if code, _ := do(r); code != http.StatusUnauthorized {
+		t.Fatalf("no credentials: got %d", code)
+	}
+	r = httptest.NewRequest("GET", "/healthz", nil)
+	if code, _ := do(r); code != http.StatusOK {
+		t.Fatalf("exempt path: got %d", code)
+	}
+
+	r = httptest.NewRequest("POST", "/update", strings.NewReader("data"))
+	r.Header.Set("Authorization", "Bearer s3cret")
+	if code, body := do(r); code != http.StatusOK || body != "traefik data" {
+		t.Fatalf("bearer token: got %d %q", code, body)
+	}
+	r.Header.Set("Authorization", "Bearer wrong")
+	if code, _ := do(r); code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: got %d", code)
+	}
+	// the secret of a client isn't a bearer token
+	r.Header.Set("Authorization", "Bearer shared")
+	if code, _ := do(r); code != http.StatusUnauthorized {
+		t.Fatalf("secret as token: got %d", code)
+	}
+
+	signed := func(id, secret, body string) *http.Request {
+		r := httptest.NewRequest("POST", "/update?x=1", bytes.NewReader([]byte(body)))
+		if err := Sign(r, id, secret); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	if code, body := do(signed("certbot", "shared", "data")); code != http.StatusOK || body != "certbot data" {
+		t.Fatalf("signed request: got %d %q", code, body)
+	}
+	if code, _ := do(signed("certbot", "wrong", "data")); code != http.StatusUnauthorized {
+		t.Fatalf("wrong secret: got %d", code)
+	}
+	if code, _ := do(signed("traefik", "s3cret", "data")); code != http.StatusUnauthorized {
+		t.Fatalf("token as secret: got %d", code)
+	}
+	r = signed("certbot", "shared", "data")
+	r.Body = ioutil.NopCloser(strings.NewReader("tampered"))
+	if code, _ := do(r); code != http.StatusUnauthorized {
+		t.Fatalf("tampered body: got %d", code)
+	}
+	a.MaxBodySize = 4
+	if code, _ := do(signed("certbot", "shared", "too long")); code != http.StatusBadRequest {
+		t.Fatalf("body over MaxBodySize: got %d", code)
+	}
+	a.MaxBodySize = 0
+	r = signed("certbot", "shared", "data")
+	a.now = func() time.Time { return time.Now().Add(10 * time.Minute) }
+	if code, _ := do(r); code != http.StatusUnauthorized {
+		t.Fatalf("stale signature: got %d", code)
+	}
+}
@@ -0,0 +1,75 @@
+// Package drain lets daemons finish in-flight work after they were asked to
+// stop, instead of canceling it halfway, e.g. between deleting and creating
+// the records of an RRset.
+package drain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Context returns a context for work started before ctx is done. It has the
+// values of ctx, but is only canceled timeout after ctx is done; with a
+// timeout of zero, at once. finish releases the context and reports whether
+// the work completed in time: it returns an error wrapping
+// context.DeadlineExceeded if the context had to be canceled.
+func Context(ctx context.Context, timeout time.Duration) (work context.Context, finish func() error) {
+	d := &drainCtx{Context: ctx, done: make(chan struct{})}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+			return
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			d.cancel(true)
+		case <-stop:
+		}
+	}()
+	var once sync.Once
+	return d, func() error {
+		once.Do(func() { close(stop) })
+		d.cancel(false)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.expired {
+			return fmt.Errorf("drain timeout of %v exceeded, in-flight operations were canceled: %w", timeout, context.DeadlineExceeded)
+		}
+		return nil
+	}
+}
+
+type drainCtx struct {
+	context.Context
+	mu      sync.Mutex
+	done    chan struct{}
+	err     error
+	expired bool
+}
+
+func (d *drainCtx) cancel(expired bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return
+	}
+	d.expired = expired
+	d.err = context.Canceled
+	close(d.done)
+}
+
+func (d *drainCtx) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (d *drainCtx) Done() <-chan struct{} { return d.done }
+
+func (d *drainCtx) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
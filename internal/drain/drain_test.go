@@ -0,0 +1,38 @@
+package drain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type key struct{}
+
+func TestContext(t *testing.T) {
+	ctx, stop := context.WithCancel(context.WithValue(context.Background(), key{}, "v"))
+	work, finish := Context(ctx, 50*time.Millisecond)
+	if work.Value(key{}) != "v" {
+		t.Fatal("expected the values of the parent")
+	}
+	stop()
+	select {
+	case <-work.Done():
+		t.Fatal("canceled before the drain timeout")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if err := finish(); err != nil {
+		t.Fatalf("expected the drain to complete, got %v", err)
+	}
+	if work.Err() == nil {
+		t.Fatal("expected finish to cancel the context")
+	}
+
+	ctx, stop = context.WithCancel(context.Background())
+	work, finish = Context(ctx, 10*time.Millisecond)
+	stop()
+	<-work.Done()
+	if err := finish(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the drain timeout, got %v", err)
+	}
+}
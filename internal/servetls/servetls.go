@@ -0,0 +1,208 @@
+// Package servetls configures TLS for the HTTP servers of the CLI, from
+// certificate files or a generated self-signed certificate, so tokens
+// aren't sent in the clear over untrusted networks.
+package servetls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options select the certificate of a server.
+type Options struct {
+	// CertFile and KeyFile are PEM files of the certificate chain and its
+	// key. They are read again when they change, so renewed certificates
+	// are picked up without a restart.
+	CertFile, KeyFile string
+
+	// SelfSigned generates a self-signed certificate for Hosts. With
+	// CertFile and KeyFile set, it is only generated if they don't exist
+	// and then written there, so the certificate, and its fingerprint
+	// clients may pin, stays the same across restarts.
+	SelfSigned bool
+
+	// Hosts are the names and addresses the self-signed certificate is
+	// valid for. Defaults to localhost, the loopback addresses and the
+	// host name.
+	Hosts []string
+}
+
+// Config returns the TLS configuration for o, or nil if o selects no
+// certificate.
+func Config(o Options) (*tls.Config, error) {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return nil, errors.New("servetls: both a certificate and a key file are required")
+	}
+	if o.SelfSigned {
+		if o.CertFile == "" {
+			cert, err := SelfSigned(o.Hosts)
+			if err != nil {
+				return nil, err
+			}
+			return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+		}
+		if _, err := os.Stat(o.CertFile); os.IsNotExist(err) {
+			if err := writeSelfSigned(o.CertFile, o.KeyFile, o.Hosts); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if o.CertFile == "" {
+		return nil, nil
+	}
+	l := &loader{certFile: o.CertFile, keyFile: o.KeyFile}
+	if _, err := l.certificate(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return l.certificate() },
+		MinVersion:     tls.VersionTLS12,
+	}, nil
+}
+
+// loader reloads a certificate when its files change.
+type loader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	modTime time.Time
+	cert    *tls.Certificate
+}
+
+func (l *loader) certificate() (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var modTime time.Time
+	for _, f := range []string{l.certFile, l.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			if l.cert != nil {
+				return l.cert, nil
+			}
+			return nil, fmt.Errorf("servetls: %v", err)
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+	if l.cert != nil && modTime.Equal(l.modTime) {
+		return l.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		if l.cert != nil {
+			// keep serving the old certificate while the files are
+			// being replaced
+			return l.cert, nil
+		}
+		return nil, fmt.Errorf("servetls: %v", err)
+	}
+	l.cert, l.modTime = &cert, modTime
+	return l.cert, nil
+}
+
+// SelfSigned generates a self-signed ECDSA certificate valid for a year
+// for hosts, see Options.Hosts.
+func SelfSigned(hosts []string) (tls.Certificate, error) {
+	certPEM, keyPEM, err := generate(hosts)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+func writeSelfSigned(certFile, keyFile string, hosts []string) error {
+	certPEM, keyPEM, err := generate(hosts)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return fmt.Errorf("servetls: %v", err)
+	}
+	if err := ioutil.WriteFile(certFile, certPEM, 0644); err != nil {
+		return fmt.Errorf("servetls: %v", err)
+	}
+	return nil
+}
+
+func generate(hosts []string) (certPEM, keyPEM []byte, err error) {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+		if name, err := os.Hostname(); err == nil && name != "" {
+			hosts = append(hosts, name)
+		}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("servetls: generating a key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("servetls: %v", err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"dynv6 self-signed"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("servetls: creating the certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("servetls: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the certificate cfg
+// serves, in the colon separated hex form browsers and curl show, or "" if
+// there is none.
+func Fingerprint(cfg *tls.Config) string {
+	var cert *tls.Certificate
+	switch {
+	case cfg == nil:
+	case len(cfg.Certificates) > 0:
+		cert = &cfg.Certificates[0]
+	case cfg.GetCertificate != nil:
+		cert, _ = cfg.GetCertificate(nil)
+	}
+	if cert == nil || len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, ":")
+}
@@ -0,0 +1,75 @@
+package servetls
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	if cfg, err := Config(Options{}); cfg != nil || err != nil {
+		t.Fatalf("no options: got %v, %v", cfg, err)
+	}
+	if _, err := Config(Options{CertFile: "cert.pem"}); err == nil {
+		t.Fatal("expected an error for a certificate without a key")
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	opts := Options{CertFile: certFile, KeyFile: keyFile, SelfSigned: true, Hosts: []string{"127.0.0.1"}}
+	cfg, err := Config(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := Fingerprint(cfg)
+	if fp == "" {
+		t.Fatal("no fingerprint")
+	}
+	if fi, err := os.Stat(keyFile); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("key file: %v, %v", fi, err)
+	}
+	// the stored certificate is reused
+	again, err := Config(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Fingerprint(again) != fp {
+		t.Fatal("the self-signed certificate changed across restarts")
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, DisableKeepAlives: true}}
+	served := func() string {
+		resp, err := client.Get("https://" + ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return Fingerprint(&tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{resp.TLS.PeerCertificates[0].Raw}}}})
+	}
+	if got := served(); got != fp {
+		t.Fatalf("served %s, want %s", got, fp)
+	}
+
+	// renewed files are picked up
+	cert, key, err := generate([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(certFile, cert, 0644)
+	ioutil.WriteFile(keyFile, key, 0600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	if got := served(); got == fp {
+		t.Fatal("the renewed certificate wasn't served")
+	}
+}
@@ -0,0 +1,340 @@
+// Package journal keeps a local log of the changes made to dynv6 zones,
+// with the records before and after every change, so the history of a zone
+// can be inspected and earlier states restored.
+//
+// The journal is a file of JSON lines, one Entry per line. Entries are only
+// ever appended, so the file can be shipped or backed up like any log.
+//
+// A file of JSON lines was chosen over an embedded database like SQLite or
+// bbolt on purpose. SQLite needs cgo or a large pure Go port, and bbolt
+// holds an exclusive lock on its file, so a daemon recording changes would
+// block every CLI invocation recording or reading history. An append of a
+// single line needs no lock across processes, the file stays readable with
+// grep and jq, and nothing is lost when a write is interrupted except that
+// line, which Entries skips and reports. Queries scan the whole file, which is fast
+// for the thousands of changes a DNS zone sees over years.
+package journal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/libdns"
+)
+
+// Record is a record as stored in the journal.
+type Record struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+// FromLibdns converts records for storing them in an entry.
+func FromLibdns(recs []libdns.Record) []Record {
+	var out []Record
+	for _, r := range recs {
+		rr := r.RR()
+		out = append(out, Record{Name: rr.Name, Type: rr.Type, Data: rr.Data})
+	}
+	return out
+}
+
+// RR returns the record as a libdns.RR.
+func (r Record) RR() libdns.RR {
+	return libdns.RR{Name: r.Name, Type: r.Type, Data: r.Data}
+}
+
+// Entry is a change of a zone.
+type Entry struct {
+	// ID identifies the entry, e.g. to restore the state before it.
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// User is the user and host which made the change, e.g. "alice@laptop".
+	User string `json:"user"`
+	// Command is the command which made the change, e.g. "set" or "sync".
+	Command string `json:"command"`
+	Zone    string `json:"zone"`
+	// Before are the records the change removed or replaced, After the
+	// records it created or kept.
+	Before []Record `json:"before,omitempty"`
+	After  []Record `json:"after,omitempty"`
+	// Error is set if the change failed, possibly after applying parts of
+	// it, in which case Before and After are the intended change.
+	Error string `json:"error,omitempty"`
+}
+
+// Plan returns the change as a plan, without the records that are both
+// before and after it.
+func (e Entry) Plan() dynv6.Plan {
+	plan := dynv6.Plan{Zone: e.Zone}
+	before, after := map[Record]bool{}, map[Record]bool{}
+	for _, r := range e.Before {
+		before[r] = true
+	}
+	for _, r := range e.After {
+		after[r] = true
+	}
+	for _, r := range e.Before {
+		if !after[r] {
+			plan.Delete = append(plan.Delete, r.RR())
+		}
+	}
+	for _, r := range e.After {
+		if !before[r] {
+			plan.Create = append(plan.Create, r.RR())
+		}
+	}
+	return plan
+}
+
+// Journal is a journal file. It is safe for concurrent use, and several
+// processes may append to the same file.
+type Journal struct {
+	Path string
+
+	// ErrorLog receives the lines Entries skips because they can't be
+	// read, e.g. the partial line of an interrupted write. If nil, the
+	// standard logger is used.
+	ErrorLog *log.Logger
+
+	mu sync.Mutex
+}
+
+// Record appends an entry to the journal, filling in its ID, Time and User
+// if they are empty, and returns it.
+func (j *Journal) Record(e Entry) (Entry, error) {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.User == "" {
+		e.User = CurrentUser()
+	}
+	e.Zone = normalize(e.Zone)
+	b, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(j.Path), 0700); err != nil {
+		return e, err
+	}
+	f, err := os.OpenFile(j.Path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return e, err
+	}
+	line := append(b, '\n')
+	// end the partial line of an interrupted write, so it doesn't swallow
+	// this entry
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err != nil && err != io.EOF {
+			f.Close()
+			return e, err
+		}
+		if last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	// a single write, so lines of concurrent processes don't interleave
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return e, err
+	}
+	return e, f.Close()
+}
+
+// Entries returns the entries of a zone, oldest first. If zone is empty,
+// the entries of all zones are returned. A missing journal has no entries.
+// Lines which can't be read are skipped and reported to ErrorLog.
+func (j *Journal) Entries(zone string) ([]Entry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.Open(j.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zone = normalize(zone)
+	var entries []Entry
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 16<<20)
+	for line := 1; s.Scan(); line++ {
+		if len(strings.TrimSpace(s.Text())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			j.logf("journal: %s:%d: skipping unreadable line: %v", j.Path, line, err)
+			continue
+		}
+		if zone == "" || e.Zone == zone {
+			entries = append(entries, e)
+		}
+	}
+	return entries, s.Err()
+}
+
+func (j *Journal) logf(format string, args ...interface{}) {
+	if j.ErrorLog != nil {
+		j.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// Written returns a function for dynv6.PruneOnly which reports whether the
+// journal recorded that a command created an RRset, so prune only deletes
+// RRsets the tool created and never records made by hand. An RRset counts
+// as created by an entry with records of it after and none before, so
+// taking over an RRset made by hand, e.g. with set, doesn't count. The
+// journal is read again when it changed; if it can't be read, nothing is
+// pruned.
+func (j *Journal) Written() func(zone string, s dynv6.RRSet) bool {
+	var (
+		mu      sync.Mutex
+		modTime time.Time
+		written map[string]map[Record]bool
+	)
+	return func(zone string, s dynv6.RRSet) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		fi, err := os.Stat(j.Path)
+		if err != nil {
+			return false
+		}
+		if written == nil || !fi.ModTime().Equal(modTime) {
+			entries, err := j.Entries("")
+			if err != nil {
+				return false
+			}
+			modTime, written = fi.ModTime(), map[string]map[Record]bool{}
+			for _, e := range entries {
+				if written[e.Zone] == nil {
+					written[e.Zone] = map[Record]bool{}
+				}
+				existed := map[Record]bool{}
+				for _, r := range e.Before {
+					k := r.key()
+					existed[Record{Name: k.Name, Type: k.Type}] = true
+				}
+				for _, r := range e.After {
+					k := r.key()
+					if set := (Record{Name: k.Name, Type: k.Type}); !existed[set] {
+						written[e.Zone][set] = true
+					}
+				}
+			}
+		}
+		return written[normalize(zone)][Record{Name: strings.ToLower(s.Name), Type: strings.ToUpper(s.Type)}]
+	}
+}
+
+// CurrentUser returns the name of the current user and host, as recorded
+// in entries.
+func CurrentUser() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		return name + "@" + host
+	}
+	return name
+}
+
+func newID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func normalize(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, "."))
+}
+
+// Since returns the entries made after to, which is the ID of an entry or
+// a time in RFC 3339 format or as "2006-01-02 15:04:05" in local time.
+func Since(entries []Entry, to string) ([]Entry, error) {
+	for i, e := range entries {
+		if e.ID == to {
+			return entries[i+1:], nil
+		}
+	}
+	t, err := time.Parse(time.RFC3339, to)
+	if err != nil {
+		t, err = time.ParseInLocation("2006-01-02 15:04:05", to, time.Local)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("journal: %q is neither the ID of a change nor a time", to)
+	}
+	for i, e := range entries {
+		if e.Time.After(t) {
+			return entries[i:], nil
+		}
+	}
+	return nil, nil
+}
+
+// Undo returns the records of a zone before the entries, given its
+// current records: starting with the newest entry, the records created by
+// an entry are removed and the records it removed are restored. Records
+// changed outside the journal, e.g. in the web interface, are kept.
+func Undo(current []libdns.Record, entries []Entry) []libdns.Record {
+	var state []Record
+	index := map[Record]bool{}
+	add := func(r Record) {
+		if k := r.key(); !index[k] {
+			index[k] = true
+			state = append(state, r)
+		}
+	}
+	for _, r := range FromLibdns(current) {
+		add(r)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		removed := map[Record]bool{}
+		for _, r := range entries[i].After {
+			removed[r.key()] = true
+			delete(index, r.key())
+		}
+		kept := state[:0]
+		for _, r := range state {
+			if !removed[r.key()] {
+				kept = append(kept, r)
+			}
+		}
+		state = kept
+		for _, r := range entries[i].Before {
+			add(r)
+		}
+	}
+	out := make([]libdns.Record, len(state))
+	for i, r := range state {
+		out[i] = r.RR()
+	}
+	return out
+}
+
+// key identifies a record regardless of the case of its name and type.
+func (r Record) key() Record {
+	return Record{Name: strings.ToLower(r.Name), Type: strings.ToUpper(r.Type), Data: r.Data}
+}
@@ -0,0 +1,172 @@
+package journal
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/libdns"
+)
+
+func TestJournal(t *testing.T) {
+	j := &Journal{Path: filepath.Join(t.TempDir(), "dynv6", "journal.jsonl")}
+	if entries, err := j.Entries(""); err != nil || entries != nil {
+		t.Fatalf("missing journal: got %v, %v", entries, err)
+	}
+	www := libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := j.Record(Entry{Command: "append", Zone: "Example.dynv6.net.", After: FromLibdns([]libdns.Record{www})}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	e, err := j.Record(Entry{Command: "delete", Zone: "other.dynv6.net", Before: FromLibdns([]libdns.Record{www})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ID == "" || e.Time.IsZero() || e.User == "" {
+		t.Fatalf("entry not filled in: %+v", e)
+	}
+
+	entries, err := j.Entries("example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 10 || entries[0].Zone != "example.dynv6.net" || entries[0].After[0] != (Record{"www", "A", "192.0.2.1"}) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	all, _ := j.Entries("")
+	if len(all) != 11 || all[10].ID != e.ID {
+		t.Fatalf("got %d entries, want 11 ending with %s", len(all), e.ID)
+	}
+}
+
+func TestPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	var logs strings.Builder
+	j := &Journal{Path: path, ErrorLog: log.New(&logs, "", 0)}
+	if _, err := j.Record(Entry{Command: "set", Zone: "example.dynv6.net"}); err != nil {
+		t.Fatal(err)
+	}
+	// an interrupted write leaves a partial line
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"abc","zone":"exa`)
+	f.Close()
+	if _, err := j.Record(Entry{Command: "delete", Zone: "example.dynv6.net"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := j.Entries("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Command != "set" || entries[1].Command != "delete" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if !strings.Contains(logs.String(), "journal.jsonl:2") {
+		t.Fatalf("partial line not reported: %q", logs.String())
+	}
+}
+
+func TestEntryPlan(t *testing.T) {
+	kept := Record{"www", "A", "192.0.2.1"}
+	e := Entry{
+		Zone:   "example.dynv6.net",
+		Before: []Record{kept, {"www", "A", "192.0.2.2"}},
+		After:  []Record{kept, {"www", "A", "192.0.2.3"}},
+	}
+	plan := e.Plan()
+	if len(plan.Delete) != 1 || plan.Delete[0].RR().Data != "192.0.2.2" || len(plan.Create) != 1 || plan.Create[0].RR().Data != "192.0.2.3" {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	entries := []Entry{
+		{ID: "1", Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), After: []Record{{"www", "A", "192.0.2.1"}}},
+		{ID: "2", Time: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), Before: []Record{{"www", "A", "192.0.2.1"}}, After: []Record{{"www", "A", "192.0.2.2"}}},
+		{ID: "3", Time: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC), Before: []Record{{"mail", "MX", "10 mx"}}},
+	}
+	current := []libdns.Record{
+		libdns.RR{Name: "WWW", Type: "A", Data: "192.0.2.2"},
+		libdns.RR{Name: "manual", Type: "TXT", Data: "kept"},
+	}
+	for _, test := range []struct {
+		to   string
+		want []string
+	}{
+		{"3", []string{"WWW A 192.0.2.2", "manual TXT kept"}},
+		{"1", []string{"manual TXT kept", "mail MX 10 mx", "www A 192.0.2.1"}},
+		{"2026-01-01T12:00:00Z", []string{"manual TXT kept", "mail MX 10 mx", "www A 192.0.2.1"}},
+		{"2025-12-31T00:00:00Z", []string{"manual TXT kept", "mail MX 10 mx"}},
+	} {
+		since, err := Since(entries, test.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range Undo(current, since) {
+			rr := r.RR()
+			got = append(got, rr.Name+" "+rr.Type+" "+rr.Data)
+		}
+		if strings.Join(got, ", ") != strings.Join(test.want, ", ") {
+			t.Errorf("to %s: got %v, want %v", test.to, got, test.want)
+		}
+	}
+	if _, err := Since(entries, "unknown"); err == nil {
+		t.Error("expected an error for an unknown ID")
+	}
+}
+
+func TestWritten(t *testing.T) {
+	j := &Journal{Path: filepath.Join(t.TempDir(), "journal.jsonl")}
+	written := j.Written()
+	www := dynv6.RRSet{Name: "WWW", Type: "a"}
+	if written("example.dynv6.net", www) {
+		t.Fatal("missing journal: got written")
+	}
+	if _, err := j.Record(Entry{Command: "sync", Zone: "example.dynv6.net", After: FromLibdns([]libdns.Record{libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"}})}); err != nil {
+		t.Fatal(err)
+	}
+	// make sure the modification time changes on coarse file systems
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(j.Path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !written("example.dynv6.net.", www) {
+		t.Error("recorded RRset: got not written")
+	}
+	if written("other.dynv6.net", www) || written("example.dynv6.net", dynv6.RRSet{Name: "www", Type: "AAAA"}) {
+		t.Error("other RRsets: got written")
+	}
+
+	// replacing an RRset made by hand doesn't make it the tool's
+	mail := dynv6.RRSet{Name: "mail", Type: "A"}
+	if _, err := j.Record(Entry{Command: "set", Zone: "example.dynv6.net",
+		Before: FromLibdns([]libdns.Record{libdns.RR{Name: "mail", Type: "A", Data: "192.0.2.1"}}),
+		After:  FromLibdns([]libdns.Record{libdns.RR{Name: "mail", Type: "A", Data: "192.0.2.2"}})}); err != nil {
+		t.Fatal(err)
+	}
+	later = later.Add(time.Second)
+	if err := os.Chtimes(j.Path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if written("example.dynv6.net", mail) {
+		t.Error("replaced RRset: got written")
+	}
+	if !written("example.dynv6.net", www) {
+		t.Error("recorded RRset: got not written after another entry")
+	}
+}
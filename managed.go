@@ -0,0 +1,48 @@
+package dynv6
+
+import (
+	"fmt"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+)
+
+// Nameservers are the authoritative nameservers of all dynv6 zones.
+var Nameservers = []string{"ns1.dynv6.com.", "ns2.dynv6.com.", "ns3.dynv6.com."}
+
+// Managed is the ProviderData of the NS and SOA records GetRecords includes
+// with IncludeManaged. dynv6 manages these records itself, they can't be
+// changed through the API.
+type Managed struct{}
+
+// IsReadOnly reports whether r is one of the records managed by dynv6.
+func IsReadOnly(r libdns.Record) bool {
+	switch r := r.(type) {
+	case libdns.NS:
+		_, ok := r.ProviderData.(Managed)
+		return ok
+	case RawRecord:
+		_, ok := r.ProviderData.(Managed)
+		return ok
+	}
+	return false
+}
+
+// managedRecords returns the apex NS and SOA records of the zone.
+func managedRecords(z *dynv6api.Zone) []libdns.Record {
+	var recs []libdns.Record
+	for _, ns := range Nameservers {
+		recs = append(recs, libdns.NS{Name: "@", Target: ns, ProviderData: Managed{}})
+	}
+	var serial int64
+	if !z.UpdatedAt.IsZero() {
+		serial = z.UpdatedAt.Unix()
+	}
+	recs = append(recs, RawRecord{
+		Name:         "@",
+		Type:         "SOA",
+		Data:         fmt.Sprintf("%s hostmaster.dynv6.net. %d 16384 2048 1048576 2560", Nameservers[0], serial),
+		ProviderData: Managed{},
+	})
+	return recs
+}
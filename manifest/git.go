@@ -0,0 +1,120 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// GitSource keeps a clone of a Git repository holding a manifest, so zones
+// can be managed by pushing commits. It runs the git command, which must be
+// installed; credentials are whatever git is configured with, e.g. an SSH
+// key or a token in the URL.
+type GitSource struct {
+	// URL of the repository. It is required.
+	URL string
+
+	// Branch to follow. Defaults to the default branch of the repository.
+	Branch string
+
+	// Dir is the local clone. It is created by the first Pull.
+	Dir string
+
+	// Path is the path of the manifest within the repository, "dynv6.json"
+	// by default.
+	Path string
+
+	// Git is the git command, "git" by default.
+	Git string
+
+	mu       sync.Mutex
+	revision string
+}
+
+// Pull clones the repository or fetches the branch, checks out its latest
+// commit, discarding local changes, and returns the commit. changed reports
+// whether it differs from the commit before.
+func (g *GitSource) Pull(ctx context.Context) (revision string, changed bool, err error) {
+	if g.URL == "" || g.Dir == "" {
+		return "", false, fmt.Errorf("manifest: git source needs a URL and a directory")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, err := os.Stat(filepath.Join(g.Dir, ".git")); os.IsNotExist(err) {
+		args := []string{"clone", "--quiet", "--depth", "1"}
+		if g.Branch != "" {
+			args = append(args, "--branch", g.Branch)
+		}
+		if _, err := g.git(ctx, "", append(args, "--", g.URL, g.Dir)...); err != nil {
+			return "", false, err
+		}
+	} else {
+		ref := g.Branch
+		if ref == "" {
+			ref = "HEAD"
+		}
+		if _, err := g.git(ctx, g.Dir, "fetch", "--quiet", "--depth", "1", g.URL, ref); err != nil {
+			return "", false, err
+		}
+		if _, err := g.git(ctx, g.Dir, "reset", "--quiet", "--hard", "FETCH_HEAD"); err != nil {
+			return "", false, err
+		}
+	}
+	revision, err = g.git(ctx, g.Dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", false, err
+	}
+	changed = revision != g.revision
+	g.revision = revision
+	return revision, changed, nil
+}
+
+// Revision returns the commit checked out by the last Pull.
+func (g *GitSource) Revision() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.revision
+}
+
+// ReadFile returns the manifest of the commit checked out by the last Pull
+// and the commit.
+func (g *GitSource) ReadFile() ([]byte, string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.revision == "" {
+		return nil, "", fmt.Errorf("manifest: %s not pulled yet", g.URL)
+	}
+	path := g.Path
+	if path == "" {
+		path = "dynv6.json"
+	}
+	data, err := ioutil.ReadFile(filepath.Join(g.Dir, filepath.FromSlash(path)))
+	return data, g.revision, err
+}
+
+func (g *GitSource) git(ctx context.Context, dir string, args ...string) (string, error) {
+	name := g.Git
+	if name == "" {
+		name = "git"
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	// never wait for a password prompt in a daemon
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("manifest: git %s: %s", args[0], msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
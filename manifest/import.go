@@ -0,0 +1,194 @@
+package manifest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Import is a zone converted from the export format of another provider.
+type Import struct {
+	Zone Zone
+	// Skipped describes the records which were not imported, e.g. the apex
+	// SOA and NS records, which dynv6 manages, or records of types dynv6
+	// doesn't support.
+	Skipped []string
+}
+
+func (imp *Import) add(name, typ, data string) {
+	typ = strings.ToUpper(typ)
+	switch {
+	case name == "@" && (typ == "SOA" || typ == "NS"):
+		imp.Skipped = append(imp.Skipped, fmt.Sprintf("%s %s %s: managed by dynv6", name, typ, data))
+	case !isSupported(typ):
+		imp.Skipped = append(imp.Skipped, fmt.Sprintf("%s %s %s: unsupported record type", name, typ, data))
+	default:
+		// a $ would start a variable in a manifest
+		data = strings.ReplaceAll(data, "$", "$$")
+		imp.Zone.Records = append(imp.Zone.Records, Record{Name: name, Type: typ, Data: data})
+	}
+}
+
+// ImportBIND converts a zone file in the BIND format, as exported by
+// Cloudflare and most other providers, to the zone origin. TTLs and
+// classes are dropped, as dynv6 doesn't store them.
+func ImportBIND(r io.Reader, origin string) (*Import, error) {
+	origin = dns.Fqdn(origin)
+	imp := &Import{Zone: Zone{Zone: strings.TrimSuffix(origin, "."), Records: []Record{}}}
+	zp := dns.NewZoneParser(r, origin, "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		h := rr.Header()
+		name, ok := relativeName(h.Name, origin)
+		if !ok {
+			imp.Skipped = append(imp.Skipped, fmt.Sprintf("%s: outside of zone %s", h.Name, origin))
+			continue
+		}
+		var data string
+		switch rr := rr.(type) {
+		case *dns.TXT:
+			data = strings.Join(rr.Txt, "")
+		case *dns.SPF:
+			data = strings.Join(rr.Txt, "")
+		default:
+			data = strings.TrimSpace(strings.TrimPrefix(rr.String(), h.String()))
+		}
+		imp.add(name, dns.TypeToString[h.Rrtype], data)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, fmt.Errorf("manifest: %v", err)
+	}
+	return imp, nil
+}
+
+func relativeName(name, origin string) (string, bool) {
+	name = strings.ToLower(name)
+	origin = strings.ToLower(origin)
+	if name == origin {
+		return "@", true
+	}
+	if !strings.HasSuffix(name, "."+origin) {
+		return "", false
+	}
+	return strings.TrimSuffix(name, "."+origin), true
+}
+
+// ImportOctoDNS converts an octoDNS zone file in YAML to the zone origin:
+//
+//	'':
+//	  - type: A
+//	    values: [203.0.113.7, 203.0.113.8]
+//	  - type: MX
+//	    value: {exchange: mail.example.com., preference: 10}
+//	www:
+//	  type: CNAME
+//	  value: example.com.
+//
+// Only the subset of YAML octoDNS writes is understood, without anchors or
+// block scalars. Keys other than type, value and values, e.g. ttl and
+// octodns, are ignored.
+func ImportOctoDNS(data []byte, origin string) (*Import, error) {
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("manifest: %v", err)
+	}
+	names, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("manifest: expected a mapping of record names")
+	}
+	imp := &Import{Zone: Zone{Zone: strings.TrimSuffix(origin, "."), Records: []Record{}}}
+	keys := make([]string, 0, len(names))
+	for name := range names {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := key
+		if name == "" {
+			name = "@"
+		}
+		var defs []interface{}
+		switch v := names[key].(type) {
+		case []interface{}:
+			defs = v
+		default:
+			defs = []interface{}{v}
+		}
+		for _, def := range defs {
+			rec, ok := def.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("manifest: %s: expected a record", name)
+			}
+			typ, _ := rec["type"].(string)
+			if typ == "" {
+				return nil, fmt.Errorf("manifest: %s: missing type", name)
+			}
+			values, ok := rec["values"].([]interface{})
+			if !ok {
+				if v, present := rec["value"]; present {
+					values = []interface{}{v}
+				}
+			}
+			for _, v := range values {
+				data, err := octoDNSData(strings.ToUpper(typ), v)
+				if err != nil {
+					return nil, fmt.Errorf("manifest: %s %s: %v", name, typ, err)
+				}
+				imp.add(name, typ, data)
+			}
+		}
+	}
+	return imp, nil
+}
+
+// octoDNSData returns the record data of an octoDNS value in presentation
+// format.
+func octoDNSData(typ string, v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		if typ == "TXT" || typ == "SPF" {
+			// octoDNS escapes semicolons
+			return strings.ReplaceAll(s, `\;`, ";"), nil
+		}
+		return s, nil
+	}
+	fields, ok := v.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("unexpected value %v", v)
+	}
+	get := func(keys ...string) (string, error) {
+		for _, k := range keys {
+			if s, ok := fields[k].(string); ok {
+				return s, nil
+			}
+		}
+		return "", fmt.Errorf("missing %s", keys[0])
+	}
+	var parts []string
+	var keys [][]string
+	switch typ {
+	case "MX":
+		keys = [][]string{{"preference", "priority"}, {"exchange", "value"}}
+	case "SRV":
+		keys = [][]string{{"priority"}, {"weight"}, {"port"}, {"target"}}
+	case "CAA":
+		keys = [][]string{{"flags"}, {"tag"}, {"value"}}
+		if _, ok := fields["flags"]; !ok {
+			fields["flags"] = "0"
+		}
+	default:
+		return "", fmt.Errorf("unexpected structured value for %s", typ)
+	}
+	for _, k := range keys {
+		s, err := get(k...)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, s)
+	}
+	if typ == "CAA" {
+		parts[2] = fmt.Sprintf("%q", parts[2])
+	}
+	return strings.Join(parts, " "), nil
+}
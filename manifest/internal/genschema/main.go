@@ -0,0 +1,19 @@
+// Command genschema writes the JSON Schema of manifests, manifest.Schema,
+// to the file published next to the package.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+
+	"github.com/libdns/dynv6/manifest"
+)
+
+func main() {
+	out := flag.String("out", "manifest.schema.json", "output file")
+	flag.Parse()
+	if err := ioutil.WriteFile(*out, manifest.Schema(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,254 @@
+// Package manifest describes the desired records of several dynv6 zones in
+// a single JSON document and syncs an account to it:
+//
+//	{
+//	  "zones": [
+//	    {
+//	      "zone": "example.dynv6.net",
+//	      "prune": true,
+//	      "records": [
+//	        {"name": "www", "type": "A", "data": "203.0.113.7"},
+//	        {"name": "@", "type": "TXT", "data": "v=spf1 -all"}
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// Record data may refer to variables as ${NAME}, see Manifest.Expand.
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+)
+
+// Manifest lists the desired records of zones.
+type Manifest struct {
+	// Values are the defaults of the variables used in record data.
+	Values map[string]string `json:"values,omitempty"`
+	Zones  []Zone            `json:"zones"`
+
+	// Revision identifies the version of the manifest for logs and
+	// metrics, e.g. the commit it was loaded from. It is set by the loader.
+	Revision string `json:"-"`
+
+	// lines are the lines of the fields, if it was read by Validate.
+	lines map[string]int
+}
+
+// Zone is the desired state of a single zone.
+type Zone struct {
+	Zone string `json:"zone"`
+	// Prune deletes the RRsets of the zone which are not listed.
+	Prune   bool     `json:"prune,omitempty"`
+	Records []Record `json:"records"`
+}
+
+// Record is a record of a zone in presentation format.
+type Record struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+// Parse decodes a manifest.
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Load reads a manifest from a file.
+func Load(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// Expand substitutes the variables in the record data of all zones. A
+// ${NAME} is looked up in values, then in the Values of the manifest and
+// then in the environment; "$$" is a literal "$". Using an undefined
+// variable is an error, so a typo doesn't end up in a record.
+func (m *Manifest) Expand(values map[string]string) error {
+	lookup := m.lookup(values)
+	for i := range m.Zones {
+		z := &m.Zones[i]
+		for j := range z.Records {
+			data, err := expand(z.Records[j].Data, lookup)
+			if err != nil {
+				return fmt.Errorf("zone %s, record %d: %v", z.Zone, j, err)
+			}
+			z.Records[j].Data = data
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) lookup(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		if v, ok := values[name]; ok {
+			return v, true
+		}
+		if v, ok := m.Values[name]; ok {
+			return v, true
+		}
+		return os.LookupEnv(name)
+	}
+}
+
+func expand(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 || i == len(s)-1 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			s = s[i+2:]
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("Unterminated variable in %q", s[i:])
+			}
+			name := s[i+2 : i+end]
+			v, ok := lookup(name)
+			if !ok {
+				return "", fmt.Errorf("Undefined variable %s", name)
+			}
+			b.WriteString(v)
+			s = s[i+end+1:]
+		default:
+			b.WriteByte('$')
+			s = s[i+1:]
+		}
+	}
+}
+
+// ParseRecords parses the records of the zone.
+func (z Zone) ParseRecords() ([]libdns.Record, error) {
+	recs := make([]libdns.Record, 0, len(z.Records))
+	for i, r := range z.Records {
+		rec, err := libdns.RR{Name: r.Name, Type: strings.ToUpper(r.Type), Data: r.Data}.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("zone %s, record %d: %v", z.Zone, i, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// Result is the outcome of syncing a zone.
+type Result struct {
+	Zone string
+	// Records is the number of records declared for the zone.
+	Records int
+	Plan    dynv6.Plan
+	Err     error
+}
+
+// Results are the outcomes of syncing the zones of a manifest.
+type Results []Result
+
+// Created returns the number of records created in all zones.
+func (rs Results) Created() int {
+	n := 0
+	for _, r := range rs {
+		if r.Err == nil {
+			n += len(r.Plan.Create)
+		}
+	}
+	return n
+}
+
+// Deleted returns the number of records deleted in all zones.
+func (rs Results) Deleted() int {
+	n := 0
+	for _, r := range rs {
+		if r.Err == nil {
+			n += len(r.Plan.Delete)
+		}
+	}
+	return n
+}
+
+// Failed returns the results of the zones which failed.
+func (rs Results) Failed() Results {
+	var failed Results
+	for _, r := range rs {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// Sync makes every zone of the manifest match its records with
+// Provider.Sync. The zones are looked up in the account first; a zone which
+// doesn't exist or fails to sync doesn't stop the others. The returned error
+// summarizes the failed zones, the results hold the details.
+func Sync(ctx context.Context, p *dynv6.Provider, m *Manifest) (Results, error) {
+	return syncZones(ctx, p, m, nil)
+}
+
+// syncZones is Sync, holding the lock of each zone while it is synced if
+// lock is set.
+func syncZones(ctx context.Context, p *dynv6.Provider, m *Manifest, lock func(context.Context, string) (func(), error)) (Results, error) {
+	zones, err := p.ListZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exists := map[string]bool{}
+	for _, z := range zones {
+		exists[normalize(z.Name)] = true
+	}
+	var results Results
+	for _, z := range m.Zones {
+		r := Result{Zone: z.Zone, Records: len(z.Records)}
+		recs, err := z.ParseRecords()
+		switch {
+		case err != nil:
+			r.Err = err
+		case !exists[normalize(z.Zone)]:
+			r.Err = fmt.Errorf("%w in the account: %s", dynv6api.ErrZoneNotFound, z.Zone)
+		case lock == nil:
+			r.Plan, r.Err = p.Sync(ctx, z.Zone, recs, z.Prune)
+		default:
+			unlock, err := lock(ctx, z.Zone)
+			if err != nil {
+				r.Err = err
+				break
+			}
+			r.Plan, r.Err = p.Sync(ctx, z.Zone, recs, z.Prune)
+			unlock()
+		}
+		results = append(results, r)
+	}
+	if failed := results.Failed(); len(failed) > 0 {
+		return results, fmt.Errorf("%d of %d zone(s) failed, %s: %w", len(failed), len(results), failed[0].Zone, failed[0].Err)
+	}
+	return results, nil
+}
+
+func normalize(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, "."))
+}
@@ -0,0 +1,459 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/metrics"
+	"github.com/libdns/dynv6/notify"
+	"github.com/libdns/dynv6/testutil"
+	"github.com/libdns/libdns"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(`{"zones":[{"zone":"a.dynv6.net","prune":true,"records":[{"name":"www","type":"a","data":"203.0.113.7"}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Zones) != 1 || !m.Zones[0].Prune {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	recs, err := m.Zones[0].ParseRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := recs[0].RR(); rr.Type != "A" || rr.Data != "203.0.113.7" {
+		t.Fatalf("unexpected record: %+v", rr)
+	}
+	if _, err := (Zone{Zone: "a.dynv6.net", Records: []Record{{Name: "www", Type: "A", Data: "x"}}}).ParseRecords(); err == nil {
+		t.Fatal("expected an error for invalid record data")
+	}
+}
+
+func TestSync(t *testing.T) {
+	api, url := testutil.NewServer(t)
+	api.AddZone(1, "a.dynv6.net")
+	api.Seed(testutil.NewZoneFixture("b.dynv6.net").WithA("old", "203.0.113.1"))
+	p := &dynv6.Provider{Token: "test", BaseURL: url}
+
+	m := &Manifest{Zones: []Zone{
+		{Zone: "a.dynv6.net", Records: []Record{{Name: "www", Type: "A", Data: "203.0.113.7"}}},
+		{Zone: "missing.dynv6.net", Records: []Record{{Name: "www", Type: "A", Data: "203.0.113.7"}}},
+		{Zone: "b.dynv6.net", Prune: true, Records: []Record{{Name: "@", Type: "TXT", Data: "hello"}}},
+	}}
+	results, err := Sync(context.Background(), p, m)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 zone(s) failed") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	if failed := results.Failed(); len(failed) != 1 || failed[0].Zone != "missing.dynv6.net" {
+		t.Fatalf("unexpected failures: %+v", failed)
+	}
+	if results.Created() != 2 || results.Deleted() != 1 {
+		t.Fatalf("expected 2 creates and 1 delete, got %d and %d", results.Created(), results.Deleted())
+	}
+	if len(api.Records[1]) != 1 || len(api.Records[2]) != 1 || api.Records[2][0].Type != "TXT" {
+		t.Fatalf("unexpected records: %+v", api.Records)
+	}
+
+	problems, err := m.CheckZones(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Field != "zones[1].zone" {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	t.Setenv("DYNV6_TEST_TARGET", "env.example.org.")
+	m := &Manifest{
+		Values: map[string]string{"IP": "203.0.113.1", "HOST": "default"},
+		Zones: []Zone{{Zone: "a.dynv6.net", Records: []Record{
+			{Name: "www", Type: "A", Data: "${IP}"},
+			{Name: "@", Type: "TXT", Data: "host=${HOST} cost=$$5 $HOME"},
+			{Name: "alias", Type: "CNAME", Data: "${DYNV6_TEST_TARGET}"},
+		}}},
+	}
+	if err := m.Expand(map[string]string{"HOST": "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"203.0.113.1", "host=prod cost=$5 $HOME", "env.example.org."}
+	for i, r := range m.Zones[0].Records {
+		if r.Data != want[i] {
+			t.Errorf("record %d: expected %q, got %q", i, want[i], r.Data)
+		}
+	}
+
+	for _, data := range []string{"${DYNV6_TEST_UNDEFINED}", "${IP"} {
+		m := &Manifest{Zones: []Zone{{Zone: "a.dynv6.net", Records: []Record{{Name: "www", Type: "A", Data: data}}}}}
+		if err := m.Expand(nil); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	data := `{
+  "values": {"IP": "203.0.113.7"},
+  "zones": [
+    {
+      "zone": "a.dynv6.net",
+      "records": [
+        {"name": "www", "type": "A", "data": "${IP}"},
+        {"name": "mail", "type": "A", "data": "not an address"},
+        {"name": "x", "type": "NS", "data": "ns1.example.org."},
+        {"name": "y", "type": "TXT", "data": "${MISSING_DYNV6_VAR}"}
+      ]
+    },
+    {"zone": "A.dynv6.net.", "prune": "yes", "extra": 1}
+  ]
+}`
+	_, problems := Validate([]byte(data), nil)
+	want := []string{
+		"8: zones[0].records[1].data",
+		"9: zones[0].records[2].type",
+		"10: zones[0].records[3].data",
+		"13: zones[1].extra",
+		"13: zones[1].prune",
+		"13: zones[1].zone",
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %v", len(want), problems)
+	}
+	for i, p := range problems {
+		if !strings.HasPrefix(p.String(), want[i]+": ") {
+			t.Errorf("problem %d: expected %s, got %s", i, want[i], p)
+		}
+	}
+
+	if _, problems := Validate([]byte("{\n  \"zones\": [\n}"), nil); len(problems) != 1 || problems[0].Line != 3 {
+		t.Fatalf("expected a syntax error in line 3, got %v", problems)
+	}
+	m, problems := Validate([]byte(`{"zones": [{"zone": "a.dynv6.net", "records": []}]}`), nil)
+	if len(problems) != 0 || len(m.Zones) != 1 {
+		t.Fatalf("unexpected result: %v, %v", m, problems)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	published, err := ioutil.ReadFile("manifest.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(published, Schema()) {
+		t.Fatal("manifest.schema.json is outdated, run go generate")
+	}
+
+	data := `{
+  "$schema": "manifest.schema.json",
+  "zones": [
+    {"zone": "a.dynv6.net", "records": [
+      {"name": "www", "type": "a", "data": "not parsed"},
+      {"name": "", "type": "NS", "data": "ns1.example.org."}
+    ]},
+    {"prune": "yes", "extra": 1}
+  ]
+}`
+	want := []string{
+		"6: zones[0].records[1].name: Must not be empty",
+		"6: zones[0].records[1].type: Must be one of A, AAAA, CAA, CNAME, MX, SPF, SRV, TXT",
+		"8: zones[1].extra: Unknown field",
+		"8: zones[1].prune: Expected a bool, got a string",
+		"8: zones[1].zone: Missing field",
+	}
+	problems := ValidateSchema([]byte(data))
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %v", len(want), problems)
+	}
+	for i, p := range problems {
+		if p.String() != want[i] {
+			t.Errorf("problem %d: expected %s, got %s", i, want[i], p)
+		}
+	}
+	// Validate accepts the same fields
+	if _, problems := Validate([]byte(`{"$schema": "manifest.schema.json", "zones": []}`), nil); len(problems) != 0 {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+}
+
+func TestImportBIND(t *testing.T) {
+	zone := `;; Exported by Cloudflare
+$ORIGIN example.com.
+$TTL 3600
+@	3600	IN	SOA	ns1.example.net. admin.example.com. 1 7200 3600 86400 3600
+@	86400	IN	NS	ns1.example.net.
+@	1	IN	A	203.0.113.7
+www.example.com.	1	IN	CNAME	example.com.
+@	1	IN	MX	10 mail.example.com.
+@	1	IN	TXT	"v=spf1 -all"
+_sip._tcp	1	IN	SRV	10 5 5060 sip.example.com.
+@	1	IN	CAA	0 issue "letsencrypt.org"
+price	1	IN	TXT	"costs $5"
+@	1	IN	HTTPS	1 . alpn="h2"
+sub	1	IN	NS	ns1.example.org.
+other.example.org.	1	IN	A	203.0.113.8
+`
+	imp, err := ImportBIND(strings.NewReader(zone), "Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{"@", "A", "203.0.113.7"},
+		{"www", "CNAME", "example.com."},
+		{"@", "MX", "10 mail.example.com."},
+		{"@", "TXT", "v=spf1 -all"},
+		{"_sip._tcp", "SRV", "10 5 5060 sip.example.com."},
+		{"@", "CAA", `0 issue "letsencrypt.org"`},
+		{"price", "TXT", "costs $$5"},
+	}
+	if imp.Zone.Zone != "Example.com" || !equalRecords(imp.Zone.Records, want) {
+		t.Fatalf("unexpected zone %+v", imp.Zone)
+	}
+	if len(imp.Skipped) != 5 {
+		t.Fatalf("expected SOA, NS, HTTPS, delegation and foreign record to be skipped, got %q", imp.Skipped)
+	}
+	// the records parse as a manifest
+	b, err := json.Marshal(Manifest{Zones: []Zone{imp.Zone}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, problems := Validate(b, nil); len(problems) != 0 {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+
+	if _, err := ImportBIND(strings.NewReader("@ IN A not-an-address\n"), "example.com"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestImportOctoDNS(t *testing.T) {
+	data := `---
+'':
+  - type: A
+    ttl: 300
+    values: [203.0.113.7, 203.0.113.8]
+  - type: MX
+    values:
+    - exchange: mail.example.com.
+      preference: 10
+  - type: TXT
+    value: 'v=spf1 include:_spf.example.com -all\;' # escaped
+  - type: CAA
+    value: {flags: 0, tag: issue, value: letsencrypt.org}
+_sip._tcp:
+  type: SRV
+  value:
+    port: 5060
+    priority: 10
+    target: sip.example.com.
+    weight: 5
+www:
+  octodns:
+    cloudflare:
+      proxied: true
+  type: CNAME
+  value: example.com.
+alias:
+  type: ALIAS
+  value: example.org.
+`
+	imp, err := ImportOctoDNS([]byte(data), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{"@", "A", "203.0.113.7"},
+		{"@", "A", "203.0.113.8"},
+		{"@", "MX", "10 mail.example.com."},
+		{"@", "TXT", "v=spf1 include:_spf.example.com -all;"},
+		{"@", "CAA", `0 issue "letsencrypt.org"`},
+		{"_sip._tcp", "SRV", "10 5 5060 sip.example.com."},
+		{"www", "CNAME", "example.com."},
+	}
+	if imp.Zone.Zone != "example.com" || !equalRecords(imp.Zone.Records, want) {
+		t.Fatalf("unexpected zone %+v", imp.Zone)
+	}
+	if len(imp.Skipped) != 1 || !strings.Contains(imp.Skipped[0], "ALIAS") {
+		t.Fatalf("expected ALIAS to be skipped, got %q", imp.Skipped)
+	}
+
+	for _, data := range []string{
+		"www:\n  type: TXT\n  value: |\n    text\n",
+		"www:\n  type: A\nwww:\n  type: A\n",
+		"www:\n\ttype: A\n",
+		"www:\n  value: 203.0.113.7\n",
+	} {
+		if _, err := ImportOctoDNS([]byte(data), "example.com"); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func equalRecords(got, want []Record) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReconciler(t *testing.T) {
+	api, url := testutil.NewServer(t)
+	api.AddZone(1, "a.dynv6.net")
+	var logs bytes.Buffer
+	var drifts []notify.Drift
+	var reports []Report
+	var locks []string
+	r := &Reconciler{
+		Provider: &dynv6.Provider{Token: "test", BaseURL: url},
+		Load: func() (*Manifest, error) {
+			return &Manifest{Revision: "c0ffee", Zones: []Zone{{Zone: "a.dynv6.net", Records: []Record{{Name: "www", Type: "A", Data: "203.0.113.7"}}}}}, nil
+		},
+		Notifier: notify.NotifierFunc(func(ctx context.Context, d notify.Drift) error {
+			drifts = append(drifts, d)
+			return nil
+		}),
+		Log:      log.New(&logs, "", 0),
+		OnReport: func(rep Report) { reports = append(reports, rep) },
+		Lock: func(ctx context.Context, zone string) (func(), error) {
+			locks = append(locks, "lock "+zone)
+			return func() { locks = append(locks, "unlock "+zone) }, nil
+		},
+	}
+	r.Reconcile(context.Background())
+	r.Reconcile(context.Background())
+	if want := "[lock a.dynv6.net unlock a.dynv6.net lock a.dynv6.net unlock a.dynv6.net]"; fmt.Sprint(locks) != want {
+		t.Fatalf("got locks %v, want %v", locks, want)
+	}
+	if len(reports) != 2 || len(reports[0].Drifted()) != 1 || len(reports[1].Drifted()) != 0 {
+		t.Fatalf("expected drift in the first run only, got %+v", reports)
+	}
+	if len(drifts) != 1 || drifts[0].Zone != "a.dynv6.net" {
+		t.Fatalf("unexpected notifications: %+v", drifts)
+	}
+	if !strings.Contains(logs.String(), `level=info msg="zone reconciled" zone=a.dynv6.net created=1 deleted=0`) || !strings.Contains(logs.String(), "revision=c0ffee") {
+		t.Fatalf("unexpected log:\n%s", logs.String())
+	}
+
+	for i := 0; i < 100; i++ {
+		if d := (&Reconciler{Interval: time.Minute}).wait(); d < 54*time.Second || d > 66*time.Second {
+			t.Fatalf("wait %v out of bounds", d)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := &Metrics{}
+	started := time.Unix(1700000000, 0)
+	m.Observe(Report{Started: started, Duration: 2 * time.Second, Results: Results{
+		{Zone: "a.dynv6.net", Records: 3, Plan: dynv6.Plan{Create: []libdns.Record{libdns.RR{Name: "www", Type: "A", Data: "203.0.113.7"}}}},
+		{Zone: "b.dynv6.net", Err: errors.New("failed")},
+	}, Revision: "c0ffee", Err: errors.New("1 of 2 zone(s) failed")})
+	var b bytes.Buffer
+	w := metrics.NewWriter(&b)
+	m.Collect(w)
+	w.Flush()
+	for _, line := range []string{
+		`dynv6_reconcile_runs_total{result="failure"} 1`,
+		`dynv6_reconcile_duration_seconds_sum 2`,
+		`dynv6_reconcile_last_success_timestamp_seconds 0`,
+		`dynv6_reconcile_revision_info{revision="c0ffee"} 1`,
+		`dynv6_zone_records{zone="a.dynv6.net"} 3`,
+		`dynv6_zone_drift_total{zone="a.dynv6.net"} 1`,
+		`dynv6_zone_failures_total{zone="b.dynv6.net"} 1`,
+		`dynv6_zone_last_success_timestamp_seconds{zone="a.dynv6.net"} 1.700000002e+09`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, b.String())
+		}
+	}
+}
+
+func TestReconcilerDrain(t *testing.T) {
+	for _, tc := range []struct {
+		drain   time.Duration
+		wantErr error
+	}{
+		{time.Second, context.Canceled},
+		{time.Millisecond, context.DeadlineExceeded},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &Reconciler{
+			Load: func() (*Manifest, error) {
+				// the run is in progress when the daemon is stopped
+				cancel()
+				time.Sleep(20 * time.Millisecond)
+				return nil, errors.New("no manifest")
+			},
+			Log:          log.New(ioutil.Discard, "", 0),
+			DrainTimeout: tc.drain,
+		}
+		if err := r.Run(ctx); !errors.Is(err, tc.wantErr) {
+			t.Errorf("drain timeout %v: expected %v, got %v", tc.drain, tc.wantErr, err)
+		}
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	commit := func(data string) {
+		if err := ioutil.WriteFile(filepath.Join(repo, "zones.json"), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		run("add", "zones.json")
+		run("commit", "--quiet", "-m", "update")
+	}
+	run("init", "--quiet")
+	commit(`{"zones": []}`)
+
+	g := &GitSource{URL: repo, Dir: filepath.Join(t.TempDir(), "clone"), Path: "zones.json"}
+	if _, _, err := g.ReadFile(); err == nil {
+		t.Fatal("expected an error before the first pull")
+	}
+	first, changed, err := g.Pull(context.Background())
+	if err != nil || !changed || len(first) != 40 {
+		t.Fatalf("clone: got %q, %v, %v", first, changed, err)
+	}
+	if _, changed, _ := g.Pull(context.Background()); changed {
+		t.Fatal("pull without new commits reported a change")
+	}
+	commit(`{"zones": [{"zone": "a.dynv6.net", "records": []}]}`)
+	second, changed, err := g.Pull(context.Background())
+	if err != nil || !changed || second == first {
+		t.Fatalf("pull: got %q, %v, %v", second, changed, err)
+	}
+	data, revision, err := g.ReadFile()
+	if err != nil || revision != second || !strings.Contains(string(data), "a.dynv6.net") {
+		t.Fatalf("got %q at %s, %v", data, revision, err)
+	}
+}
@@ -0,0 +1,145 @@
+package manifest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/metrics"
+)
+
+// Metrics collects the reports of a Reconciler and writes them as
+// Prometheus metrics. Set the OnReport of the Reconciler to Observe.
+type Metrics struct {
+	// Provider, if set, adds its API call and error counters.
+	Provider *dynv6.Provider
+
+	mu          sync.Mutex
+	runs        map[string]int64
+	durationSum time.Duration
+	lastSuccess time.Time
+	revision    string
+	zones       map[string]*zoneMetrics
+}
+
+type zoneMetrics struct {
+	records     int
+	drifts      int64
+	created     int64
+	deleted     int64
+	failures    int64
+	lastSuccess time.Time
+}
+
+// Observe records a report.
+func (m *Metrics) Observe(r Report) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.runs == nil {
+		m.runs = map[string]int64{}
+		m.zones = map[string]*zoneMetrics{}
+	}
+	end := r.Started.Add(r.Duration)
+	m.durationSum += r.Duration
+	if r.Err != nil {
+		m.runs["failure"]++
+	} else {
+		m.runs["success"]++
+		m.lastSuccess = end
+	}
+	if r.Revision != "" {
+		m.revision = r.Revision
+	}
+	for _, res := range r.Results {
+		z := m.zones[res.Zone]
+		if z == nil {
+			z = &zoneMetrics{}
+			m.zones[res.Zone] = z
+		}
+		if res.Err != nil {
+			z.failures++
+			continue
+		}
+		z.records = res.Records
+		z.lastSuccess = end
+		if !res.Plan.Empty() {
+			z.drifts++
+			z.created += int64(len(res.Plan.Create))
+			z.deleted += int64(len(res.Plan.Delete))
+		}
+	}
+}
+
+// Collect writes the metrics.
+func (m *Metrics) Collect(w *metrics.Writer) {
+	m.mu.Lock()
+	w.Family("dynv6_reconcile_runs_total", metrics.Counter, "Reconcile runs by result.")
+	for _, result := range []string{"success", "failure"} {
+		w.Sample("dynv6_reconcile_runs_total", float64(m.runs[result]), "result", result)
+	}
+	w.Family("dynv6_reconcile_duration_seconds", metrics.Summary, "Duration of reconcile runs.")
+	w.Sample("dynv6_reconcile_duration_seconds_sum", m.durationSum.Seconds())
+	w.Sample("dynv6_reconcile_duration_seconds_count", float64(m.runs["success"]+m.runs["failure"]))
+	w.Family("dynv6_reconcile_last_success_timestamp_seconds", metrics.Gauge, "Time of the last successful reconcile run.")
+	w.Sample("dynv6_reconcile_last_success_timestamp_seconds", unixSeconds(m.lastSuccess))
+	if m.revision != "" {
+		w.Family("dynv6_reconcile_revision_info", metrics.Gauge, "Revision of the manifest reconciled by the last run, e.g. a Git commit.")
+		w.Sample("dynv6_reconcile_revision_info", 1, "revision", m.revision)
+	}
+
+	names := make([]string, 0, len(m.zones))
+	for name := range m.zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	zoneFamilies := []struct {
+		name, typ, help string
+		value           func(z *zoneMetrics) float64
+	}{
+		{"dynv6_zone_records", metrics.Gauge, "Records declared for the zone.", func(z *zoneMetrics) float64 { return float64(z.records) }},
+		{"dynv6_zone_drift_total", metrics.Counter, "Runs which found the zone differing from the manifest.", func(z *zoneMetrics) float64 { return float64(z.drifts) }},
+		{"dynv6_zone_records_created_total", metrics.Counter, "Records created to reconcile the zone.", func(z *zoneMetrics) float64 { return float64(z.created) }},
+		{"dynv6_zone_records_deleted_total", metrics.Counter, "Records deleted to reconcile the zone.", func(z *zoneMetrics) float64 { return float64(z.deleted) }},
+		{"dynv6_zone_failures_total", metrics.Counter, "Runs which failed to reconcile the zone.", func(z *zoneMetrics) float64 { return float64(z.failures) }},
+		{"dynv6_zone_last_success_timestamp_seconds", metrics.Gauge, "Time the zone was last reconciled successfully.", func(z *zoneMetrics) float64 { return unixSeconds(z.lastSuccess) }},
+	}
+	for _, f := range zoneFamilies {
+		w.Family(f.name, f.typ, f.help)
+		for _, name := range names {
+			w.Sample(f.name, f.value(m.zones[name]), "zone", name)
+		}
+	}
+	m.mu.Unlock()
+
+	if m.Provider == nil {
+		return
+	}
+	st := m.Provider.Stats()
+	w.Family("dynv6_api_calls_total", metrics.Counter, "HTTP calls to the dynv6 API by endpoint, including retries.")
+	for _, endpoint := range sortedKeys(st.Calls) {
+		w.Sample("dynv6_api_calls_total", float64(st.Calls[endpoint]), "endpoint", endpoint)
+	}
+	w.Family("dynv6_api_errors_total", metrics.Counter, "Failed dynv6 API requests by error class.")
+	for _, class := range sortedKeys(st.Errors) {
+		w.Sample("dynv6_api_errors_total", float64(st.Errors[class]), "class", class)
+	}
+	w.Family("dynv6_api_retries_total", metrics.Counter, "Retried dynv6 API requests.")
+	w.Sample("dynv6_api_retries_total", float64(st.Retries))
+}
+
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,166 @@
+package manifest
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/accesslog"
+	"github.com/libdns/dynv6/internal/drain"
+	"github.com/libdns/dynv6/notify"
+)
+
+// Reconciler periodically syncs an account to a manifest, like a minimal
+// GitOps controller for DNS.
+type Reconciler struct {
+	Provider *dynv6.Provider
+
+	// Load returns the manifest for a run. It is called for every run, so
+	// the manifest may change while the reconciler is running, e.g. by a
+	// git pull.
+	Load func() (*Manifest, error)
+
+	// Interval is the time between runs, 5 minutes by default.
+	Interval time.Duration
+
+	// Jitter is the fraction of Interval by which the time between runs
+	// varies randomly, so several reconcilers don't call the API at the
+	// same moment. It defaults to 0.1; a negative value disables it.
+	Jitter float64
+
+	// Notifier, if set, is notified about every zone which had to be
+	// changed.
+	Notifier notify.Notifier
+
+	// Log receives a line of key=value pairs per zone and run. If nil, the
+	// standard logger is used.
+	Log *log.Logger
+
+	// OnReport, if set, is called after every run.
+	OnReport func(Report)
+
+	// DrainTimeout is how long a run in progress may continue once the
+	// context of Run is done, so its changes aren't canceled halfway.
+	DrainTimeout time.Duration
+
+	// Trigger, if set, starts a run before the interval passed whenever it
+	// receives, e.g. when a GitSource pulled a new commit.
+	Trigger <-chan struct{}
+
+	// Lock, if set, is called before a zone is synced and the function it
+	// returns after, e.g. to serialize with other processes changing the
+	// zone. An error fails the zone.
+	Lock func(ctx context.Context, zone string) (unlock func(), err error)
+}
+
+// Report is the outcome of a run of a Reconciler.
+type Report struct {
+	Started  time.Time
+	Duration time.Duration
+	Results  Results
+	// Revision is the Revision of the manifest.
+	Revision string
+	// Err is the error of loading the manifest or of listing the zones,
+	// or the summary of the failed zones.
+	Err error
+}
+
+// Drifted returns the results of the zones which had to be changed.
+func (r Report) Drifted() Results {
+	var drifted Results
+	for _, res := range r.Results {
+		if res.Err == nil && !res.Plan.Empty() {
+			drifted = append(drifted, res)
+		}
+	}
+	return drifted
+}
+
+// Reconcile loads the manifest and syncs the account to it once.
+func (r *Reconciler) Reconcile(ctx context.Context) Report {
+	report := Report{Started: time.Now()}
+	m, err := r.Load()
+	if err == nil {
+		report.Revision = m.Revision
+		report.Results, err = syncZones(ctx, r.Provider, m, r.Lock)
+	}
+	report.Duration = time.Since(report.Started)
+	report.Err = err
+	for _, res := range report.Results {
+		switch {
+		case res.Err != nil:
+			r.logf("level", "error", "msg", "zone failed", "zone", res.Zone, "err", res.Err)
+		case res.Plan.Empty():
+			r.logf("level", "debug", "msg", "zone in sync", "zone", res.Zone)
+		default:
+			r.logf("level", "info", "msg", "zone reconciled", "zone", res.Zone, "created", len(res.Plan.Create), "deleted", len(res.Plan.Delete))
+			if r.Notifier != nil {
+				if err := r.Notifier.Notify(ctx, notify.NewDrift(res.Plan)); err != nil {
+					r.logf("level", "error", "msg", "notify failed", "zone", res.Zone, "err", err)
+				}
+			}
+		}
+	}
+	if report.Results == nil && err != nil {
+		r.logf("level", "error", "msg", "reconcile failed", "err", err)
+	}
+	kv := []interface{}{"level", "info", "msg", "reconcile finished", "zones", len(report.Results), "drifted", len(report.Drifted()), "failed", len(report.Results.Failed()), "duration", report.Duration.Round(time.Millisecond)}
+	if report.Revision != "" {
+		kv = append(kv, "revision", report.Revision)
+	}
+	r.logf(kv...)
+	if r.OnReport != nil {
+		r.OnReport(report)
+	}
+	return report
+}
+
+// Run reconciles until the context is done. Failed runs are logged and
+// retried at the next interval. Once the context is done, no run is
+// started; a run in progress may finish within DrainTimeout. If it
+// doesn't, it is canceled and Run returns an error wrapping
+// context.DeadlineExceeded, otherwise the error of the context.
+func (r *Reconciler) Run(ctx context.Context) error {
+	work, finish := drain.Context(ctx, r.DrainTimeout)
+	for ctx.Err() == nil {
+		r.Reconcile(work)
+		timer := time.NewTimer(r.wait())
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		case <-r.Trigger:
+		}
+		timer.Stop()
+	}
+	if err := finish(); err != nil {
+		r.logf("level", "error", "msg", "drain failed", "err", err)
+		return err
+	}
+	return ctx.Err()
+}
+
+func (r *Reconciler) wait() time.Duration {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	jitter := r.Jitter
+	if jitter == 0 {
+		jitter = 0.1
+	}
+	if jitter < 0 {
+		return interval
+	}
+	return interval + time.Duration((rand.Float64()*2-1)*jitter*float64(interval))
+}
+
+// logf writes the key value pairs in logfmt.
+func (r *Reconciler) logf(kv ...interface{}) {
+	l := r.Log
+	if l == nil {
+		l = log.Default()
+	}
+	accesslog.Print(l, kv...)
+}
@@ -0,0 +1,173 @@
+package manifest
+
+//go:generate go run ./internal/genschema -out manifest.schema.json
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/libdns/dynv6"
+)
+
+// Schema returns the JSON Schema (draft 7) of manifests, for editors to
+// offer completion and validation. The repository publishes it as
+// manifest/manifest.schema.json; declare it in a manifest with a "$schema"
+// field. Its record types are the ones of dynv6.SupportedTypes.
+func Schema() []byte {
+	types := append([]string{}, dynv6.SupportedTypes...)
+	for _, t := range dynv6.SupportedTypes {
+		types = append(types, strings.ToLower(t))
+	}
+	nonEmpty := func(description string) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "minLength": 1, "description": description}
+	}
+	recordType := nonEmpty("Record type, in upper or lower case.")
+	recordType["enum"] = types
+	record := map[string]interface{}{
+		"type":                 "object",
+		"description":          "A record in presentation format.",
+		"required":             []string{"name", "type", "data"},
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"name": nonEmpty(`Name relative to the zone, "@" for the apex.`),
+			"type": recordType,
+			"data": nonEmpty(`Record data, e.g. "203.0.113.7" or "10 mail.example.com.". May use ${NAME} variables; $$ is a literal $.`),
+		},
+	}
+	zone := map[string]interface{}{
+		"type":                 "object",
+		"description":          "The desired state of a zone.",
+		"required":             []string{"zone"},
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"zone":    nonEmpty("Name of the dynv6 zone, e.g. example.dynv6.net."),
+			"prune":   map[string]interface{}{"type": "boolean", "description": "Delete the RRsets of the zone which are not listed."},
+			"records": map[string]interface{}{"type": "array", "items": record},
+		},
+	}
+	schema := map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "dynv6 manifest",
+		"description":          "The desired records of dynv6 zones, synced by dynv6 sync -manifest.",
+		"type":                 "object",
+		"required":             []string{"zones"},
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"$schema": map[string]interface{}{"type": "string", "description": "The JSON Schema of the manifest, for editors."},
+			"values": map[string]interface{}{
+				"type":                 "object",
+				"description":          "Defaults of the variables used in record data.",
+				"additionalProperties": map[string]interface{}{"type": "string"},
+			},
+			"zones": map[string]interface{}{"type": "array", "items": zone},
+		},
+	}
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return append(b, '\n')
+}
+
+// ValidateSchema checks a JSON document against Schema only, without
+// parsing record data or expanding variables like Validate does. It is for
+// tools which need to agree with editors on what is a valid manifest.
+func ValidateSchema(data []byte) Problems {
+	lines, err := fieldLines(data)
+	if err != nil {
+		return Problems{{Line: lines[""], Message: err.Error()}}
+	}
+	var doc, schema interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Problems{{Message: err.Error()}}
+	}
+	if err := json.Unmarshal(Schema(), &schema); err != nil {
+		panic(err)
+	}
+	v := &validator{lines: lines}
+	v.schema(schema.(map[string]interface{}), doc, "")
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		a, b := v.problems[i], v.problems[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Field < b.Field
+	})
+	return v.problems
+}
+
+// schemaKinds maps the JSON Schema types to the kinds of kindOf.
+var schemaKinds = map[string]string{"boolean": "bool"}
+
+// schema checks val against the subset of JSON Schema used by Schema.
+func (v *validator) schema(schema map[string]interface{}, val interface{}, field string) {
+	if typ, ok := schema["type"].(string); ok {
+		want := typ
+		if k, ok := schemaKinds[typ]; ok {
+			want = k
+		}
+		if got := kindOf(val); got != want {
+			v.report(field, "Expected a %s, got a %s", want, got)
+			return
+		}
+	}
+	switch val := val.(type) {
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+		for _, name := range sortedFields(val) {
+			if prop, ok := props[name].(map[string]interface{}); ok {
+				v.schema(prop, val[name], join(field, name))
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					v.report(join(field, name), "Unknown field")
+				}
+			case map[string]interface{}:
+				v.schema(extra, val[name], join(field, name))
+			}
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := val[name.(string)]; !ok {
+				// reported at the line of the object
+				v.problems = append(v.problems, Problem{Line: v.lines[field], Field: join(field, name.(string)), Message: "Missing field"})
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range val {
+				v.schema(items, item, fmt.Sprintf("%s[%d]", field, i))
+			}
+		}
+	case string:
+		if min, ok := schema["minLength"].(float64); ok && len(val) < int(min) {
+			v.report(field, "Must not be empty")
+			return
+		}
+		if enum, ok := schema["enum"].([]interface{}); ok {
+			var values []string
+			seen := map[string]bool{}
+			for _, e := range enum {
+				if e == val {
+					return
+				}
+				// the values are listed in upper and lower case
+				if s := strings.ToUpper(e.(string)); !seen[s] {
+					seen[s] = true
+					values = append(values, s)
+				}
+			}
+			v.report(field, "Must be one of %s", strings.Join(values, ", "))
+		}
+	}
+}
+
+func sortedFields(obj map[string]interface{}) []string {
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,305 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/libdns"
+)
+
+// Problem is an issue found in a manifest.
+type Problem struct {
+	// Line is the line of the field in the manifest, 0 if unknown.
+	Line int
+	// Field is the path of the field, e.g. "zones[0].records[1].data".
+	Field   string
+	Message string
+}
+
+func (p Problem) String() string {
+	s := p.Message
+	if p.Field != "" {
+		s = p.Field + ": " + s
+	}
+	if p.Line > 0 {
+		s = fmt.Sprintf("%d: %s", p.Line, s)
+	}
+	return s
+}
+
+// Problems are the issues found in a manifest.
+type Problems []Problem
+
+func (ps Problems) Error() string {
+	if len(ps) == 1 {
+		return ps[0].String()
+	}
+	return fmt.Sprintf("%d problems, the first is %s", len(ps), ps[0])
+}
+
+// The fields of the manifest objects and their JSON kinds.
+var (
+	manifestFields = map[string]string{"$schema": "string", "values": "object", "zones": "array"}
+	zoneFields     = map[string]string{"zone": "string", "prune": "bool", "records": "array"}
+	recordFields   = map[string]string{"name": "string", "type": "string", "data": "string"}
+)
+
+// Validate checks a manifest without touching the API: its structure, that
+// the records are of types dynv6 supports and that their data, with the
+// variables expanded as by Expand, parses. It reports all problems at once,
+// with the line and field of each. The returned manifest is nil if there
+// are problems.
+func Validate(data []byte, values map[string]string) (*Manifest, Problems) {
+	lines, err := fieldLines(data)
+	if err != nil {
+		return nil, Problems{{Line: lines[""], Message: err.Error()}}
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, Problems{{Message: err.Error()}}
+	}
+	v := &validator{lines: lines}
+	v.manifest(raw, values)
+	if len(v.problems) > 0 {
+		sort.SliceStable(v.problems, func(i, j int) bool {
+			a, b := v.problems[i], v.problems[j]
+			return a.Line < b.Line || a.Line == b.Line && a.Field < b.Field
+		})
+		return nil, v.problems
+	}
+	m, err := Parse(data)
+	if err != nil {
+		return nil, Problems{{Message: err.Error()}}
+	}
+	m.lines = lines
+	return m, nil
+}
+
+type validator struct {
+	lines    map[string]int
+	problems Problems
+}
+
+func (v *validator) report(field, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Line: v.lines[field], Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// object checks that val is an object with only the given fields, of the
+// given kinds.
+func (v *validator) object(val interface{}, field string, fields map[string]string) map[string]interface{} {
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		v.report(field, "Expected an object")
+		return nil
+	}
+	for key, fv := range obj {
+		name := join(field, key)
+		kind, ok := fields[key]
+		if !ok {
+			v.report(name, "Unknown field")
+			continue
+		}
+		if got := kindOf(fv); got != kind {
+			v.report(name, "Expected a %s, got a %s", kind, got)
+		}
+	}
+	return obj
+}
+
+func (v *validator) manifest(raw interface{}, values map[string]string) {
+	obj := v.object(raw, "", manifestFields)
+	if obj == nil {
+		return
+	}
+	m := &Manifest{Values: map[string]string{}}
+	if vals, ok := obj["values"].(map[string]interface{}); ok {
+		for name, val := range vals {
+			s, ok := val.(string)
+			if !ok {
+				v.report(join("values", name), "Expected a string, got a %s", kindOf(val))
+				continue
+			}
+			m.Values[name] = s
+		}
+	}
+	if _, ok := obj["zones"]; !ok {
+		v.report("zones", "Missing field")
+	}
+	zones, _ := obj["zones"].([]interface{})
+	seen := map[string]string{}
+	for i, z := range zones {
+		field := fmt.Sprintf("zones[%d]", i)
+		zone := v.object(z, field, zoneFields)
+		if zone == nil {
+			continue
+		}
+		if name, ok := v.str(zone, field, "zone"); ok {
+			if other := seen[normalize(name)]; other != "" {
+				v.report(join(field, "zone"), "Zone %s is also listed in %s", name, other)
+			}
+			seen[normalize(name)] = field
+		}
+		recs, _ := zone["records"].([]interface{})
+		for j, r := range recs {
+			v.record(r, fmt.Sprintf("%s.records[%d]", field, j), m.lookup(values))
+		}
+	}
+}
+
+func (v *validator) record(raw interface{}, field string, lookup func(string) (string, bool)) {
+	rec := v.object(raw, field, recordFields)
+	if rec == nil {
+		return
+	}
+	fields := map[string]string{}
+	for _, key := range []string{"name", "type", "data"} {
+		fields[key], _ = v.str(rec, field, key)
+	}
+	if fields["name"] == "" || fields["type"] == "" || fields["data"] == "" {
+		return
+	}
+	typ := strings.ToUpper(fields["type"])
+	if !isSupported(typ) {
+		v.report(join(field, "type"), "Unsupported record type %s, dynv6 supports %s", fields["type"], strings.Join(dynv6.SupportedTypes, ", "))
+		return
+	}
+	data, err := expand(fields["data"], lookup)
+	if err != nil {
+		v.report(join(field, "data"), "%v", err)
+		return
+	}
+	if _, err := (libdns.RR{Name: fields["name"], Type: typ, Data: data}).Parse(); err != nil {
+		v.report(join(field, "data"), "%v", err)
+	}
+}
+
+// str returns a required, non-empty string field of obj. Fields of the
+// wrong kind were already reported by object.
+func (v *validator) str(obj map[string]interface{}, field, key string) (string, bool) {
+	val, present := obj[key]
+	if !present {
+		v.report(join(field, key), "Missing field")
+		return "", false
+	}
+	s, ok := val.(string)
+	if ok && s == "" {
+		v.report(join(field, key), "Must not be empty")
+	}
+	return s, ok && s != ""
+}
+
+// CheckZones reports the zones of the manifest which don't exist in the
+// account of p.
+func (m *Manifest) CheckZones(ctx context.Context, p *dynv6.Provider) (Problems, error) {
+	zones, err := p.ListZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exists := map[string]bool{}
+	for _, z := range zones {
+		exists[normalize(z.Name)] = true
+	}
+	var problems Problems
+	for i, z := range m.Zones {
+		if !exists[normalize(z.Zone)] {
+			field := fmt.Sprintf("zones[%d].zone", i)
+			problems = append(problems, Problem{Line: m.lines[field], Field: field, Message: fmt.Sprintf("Zone %s not found in the account", z.Zone)})
+		}
+	}
+	return problems, nil
+}
+
+func isSupported(typ string) bool {
+	for _, t := range dynv6.SupportedTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func kindOf(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return "null"
+}
+
+func join(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
+
+// fieldLines maps the path of every field of a JSON document to its line.
+// On a syntax error, the line of the error is stored for the empty path.
+func fieldLines(data []byte) (map[string]int, error) {
+	lines := map[string]int{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	lineAt := func(offset int64) int {
+		return 1 + bytes.Count(data[:offset], []byte("\n"))
+	}
+	var walk func(field string) error
+	walk = func(field string) error {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := lines[field]; !ok {
+			lines[field] = lineAt(dec.InputOffset())
+		}
+		switch t {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				name := join(field, fmt.Sprint(key))
+				lines[name] = lineAt(dec.InputOffset())
+				if err := walk(name); err != nil {
+					return err
+				}
+			}
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if err := walk(fmt.Sprintf("%s[%d]", field, i)); err != nil {
+					return err
+				}
+			}
+		default:
+			return nil
+		}
+		// the closing delimiter
+		_, err = dec.Token()
+		return err
+	}
+	err := walk("")
+	if err != nil {
+		if serr, ok := err.(*json.SyntaxError); ok {
+			lines[""] = lineAt(serr.Offset)
+		} else {
+			lines[""] = lineAt(int64(len(data)))
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+	}
+	return lines, err
+}
@@ -0,0 +1,289 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a non-empty line of a YAML document without its comment.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// parseYAML decodes the subset of YAML used by octoDNS zone files: block
+// mappings and sequences, plain and quoted scalars and single-line flow
+// sequences and mappings. Scalars are returned as strings, mappings as
+// map[string]interface{} and sequences as []interface{}.
+func parseYAML(data string) (interface{}, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" || trimmed == "..." {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	p := &yamlParser{lines: lines}
+	v, err := p.block(lines[0].indent)
+	if err == nil && p.i < len(p.lines) {
+		err = fmt.Errorf("line %d: unexpected indentation", p.lines[p.i].num)
+	}
+	return v, err
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if isSeqItem(p.lines[p.i].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) ([]interface{}, error) {
+	seq := []interface{}{}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && isSeqItem(p.lines[p.i].text) {
+		line := p.lines[p.i]
+		rest := strings.TrimLeft(line.text[1:], " ")
+		switch {
+		case rest == "":
+			p.i++
+			v, err := p.nested(indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		case isSeqItem(rest) || isMappingLine(rest):
+			// the item starts on the line of the dash, at the column of rest
+			p.lines[p.i] = yamlLine{num: line.num, indent: indent + len(line.text) - len(rest), text: rest}
+			v, err := p.block(p.lines[p.i].indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		default:
+			v, err := yamlScalar(rest, line.num)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			p.i++
+		}
+	}
+	return seq, nil
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && !isSeqItem(p.lines[p.i].text) {
+		line := p.lines[p.i]
+		key, rest, ok := splitMappingLine(line.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected a key", line.num)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		p.i++
+		if rest != "" {
+			v, err := yamlScalar(rest, line.num)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			continue
+		}
+		// a sequence may be indented as much as its key
+		if p.i < len(p.lines) && p.lines[p.i].indent == indent && isSeqItem(p.lines[p.i].text) {
+			v, err := p.sequence(indent)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			continue
+		}
+		v, err := p.nested(indent)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// nested parses the block indented deeper than indent, or returns an empty
+// string if there is none.
+func (p *yamlParser) nested(indent int) (interface{}, error) {
+	if p.i >= len(p.lines) || p.lines[p.i].indent <= indent {
+		return "", nil
+	}
+	return p.block(p.lines[p.i].indent)
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func isMappingLine(text string) bool {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return false
+	}
+	_, _, ok := splitMappingLine(text)
+	return ok
+}
+
+// splitMappingLine splits "key: value" into the unquoted key and the rest.
+func splitMappingLine(text string) (key, rest string, ok bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 || !strings.HasPrefix(text[end+1:], ":") {
+			return "", "", false
+		}
+		key, err := unquoteYAML(text[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(text[end+2:]), true
+	}
+	if strings.HasSuffix(text, ":") {
+		return text[:len(text)-1], "", true
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		return "", "", false
+	}
+	return text[:i], strings.TrimSpace(text[i+2:]), true
+}
+
+// yamlScalar parses an inline value: a quoted or plain scalar or a flow
+// collection.
+func yamlScalar(s string, line int) (interface{}, error) {
+	switch {
+	case s[0] == '"' || s[0] == '\'':
+		if end := closingQuote(s); end != len(s)-1 {
+			return nil, fmt.Errorf("line %d: malformed quoted string %s", line, s)
+		}
+		v, err := unquoteYAML(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		return v, nil
+	case s[0] == '[' || s[0] == '{':
+		closing := map[byte]byte{'[': ']', '{': '}'}[s[0]]
+		if s[len(s)-1] != closing {
+			return nil, fmt.Errorf("line %d: flow collections must end on the same line", line)
+		}
+		items := splitFlow(s[1 : len(s)-1])
+		if s[0] == '[' {
+			seq := []interface{}{}
+			for _, item := range items {
+				v, err := yamlScalar(item, line)
+				if err != nil {
+					return nil, err
+				}
+				seq = append(seq, v)
+			}
+			return seq, nil
+		}
+		m := map[string]interface{}{}
+		for _, item := range items {
+			key, rest, ok := splitMappingLine(item)
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected key: value in %s", line, s)
+			}
+			v, err := yamlScalar(rest, line)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		}
+		return m, nil
+	case s == "|" || s == ">" || strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"):
+		return nil, fmt.Errorf("line %d: block scalars are not supported", line)
+	}
+	return s, nil
+}
+
+// splitFlow splits the items of a flow collection at commas outside quotes.
+func splitFlow(s string) []string {
+	var items []string
+	start := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+// closingQuote returns the index of the quote closing the string starting
+// at s[0], or -1.
+func closingQuote(s string) int {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] == q && q == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquoteYAML(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return strconv.Unquote(s)
+}
+
+// stripYAMLComment removes a comment, i.e. a # at the start of the line or
+// after a space, outside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune(" -:[{,", rune(line[i-1]))):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
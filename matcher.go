@@ -0,0 +1,79 @@
+package dynv6
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// Matcher decides which existing record of a zone a record passed to
+// SetRecords or DeleteRecords refers to.
+type Matcher interface {
+	// Match reports whether the existing record is the record r.
+	Match(existing, r libdns.RR) bool
+}
+
+// MatcherFunc adapts a function to the Matcher interface.
+type MatcherFunc func(existing, r libdns.RR) bool
+
+// Match calls f(existing, r).
+func (f MatcherFunc) Match(existing, r libdns.RR) bool {
+	return f(existing, r)
+}
+
+var (
+	// MatchExact matches records with the same name, type and data. Names
+	// and types are compared case-insensitively. It is the default.
+	MatchExact Matcher = MatcherFunc(func(existing, r libdns.RR) bool {
+		return sameNameType(existing, r) && existing.Data == r.Data
+	})
+
+	// MatchNormalized is like MatchExact, but compares the data in a
+	// normalized form: IP addresses in canonical notation, host names
+	// case-insensitively and without the trailing dot and TXT data
+	// without surrounding quotes.
+	MatchNormalized Matcher = MatcherFunc(func(existing, r libdns.RR) bool {
+		return sameNameType(existing, r) && normalizeData(existing.Type, existing.Data) == normalizeData(r.Type, r.Data)
+	})
+
+	// MatchNameType matches records with the same name and type regardless
+	// of their data, so SetRecords changes existing records in place.
+	MatchNameType Matcher = MatcherFunc(sameNameType)
+)
+
+func sameNameType(a, b libdns.RR) bool {
+	return keyOf(a) == keyOf(b)
+}
+
+func normalizeData(typ, data string) string {
+	data = strings.TrimSpace(data)
+	switch strings.ToUpper(typ) {
+	case "A", "AAAA":
+		if ip, err := netip.ParseAddr(data); err == nil {
+			return ip.Unmap().String()
+		}
+	case "CNAME", "NS", "MX", "SRV":
+		fields := strings.Fields(data)
+		if n := len(fields); n > 0 {
+			fields[n-1] = strings.ToLower(strings.TrimSuffix(fields[n-1], "."))
+		}
+		return strings.Join(fields, " ")
+	case "TXT", "SPF":
+		if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+			return data[1 : len(data)-1]
+		}
+	}
+	return data
+}
+
+func (p *Provider) matcher(ctx context.Context) Matcher {
+	if m := optionsFrom(ctx).matcher; m != nil {
+		return m
+	}
+	if p.Matcher != nil {
+		return p.Matcher
+	}
+	return MatchExact
+}
@@ -0,0 +1,97 @@
+// Package metrics exposes metrics of the daemons in the Prometheus text
+// format, without depending on the Prometheus client library. Metrics are
+// written from the current state of a daemon on every scrape.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Metric types.
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+	Summary = "summary"
+)
+
+// Writer writes metrics in the Prometheus text exposition format.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter returns a writer to w. Flush must be called when done.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Family starts a metric family. Its samples must follow.
+func (w *Writer) Family(name, typ, help string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+}
+
+// Sample writes a sample. labels are pairs of label names and values.
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.printf("%s", name)
+	if len(labels) > 0 {
+		w.printf("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.printf(",")
+			}
+			w.printf("%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		w.printf("}")
+	}
+	w.printf(" %s\n", formatValue(value))
+}
+
+// Flush writes buffered data and returns the first error.
+func (w *Writer) Flush() error {
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	return w.err
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.w, format, args...)
+	}
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// Handler serves the metrics written by collect.
+func Handler(collect func(w *Writer)) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w := NewWriter(rw)
+		collect(w)
+		w.Flush()
+	})
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	h := Handler(func(w *Writer) {
+		w.Family("test_total", Counter, "A test\ncounter.")
+		w.Sample("test_total", 3, "zone", `a"b\c`, "kind", "x")
+		w.Family("test_value", Gauge, "A gauge.")
+		w.Sample("test_value", 0.5)
+		w.Sample("test_value", math.Inf(1))
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	want := `# HELP test_total A test\ncounter.
+# TYPE test_total counter
+test_total{zone="a\"b\\c",kind="x"} 3
+# HELP test_value A gauge.
+# TYPE test_value gauge
+test_value 0.5
+test_value +Inf
+`
+	if string(body) != want {
+		t.Fatalf("unexpected output:\n%s", body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+}
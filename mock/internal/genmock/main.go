@@ -0,0 +1,165 @@
+// Command genmock generates the mocks of the mock package from the
+// interfaces they implement, using reflection. Parameter names aren't
+// available through reflection, so the parameters are numbered, except for
+// the context.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+// mocks are the generated mocks and the interfaces they implement.
+var mocks = []struct {
+	name  string
+	iface reflect.Type
+	expr  string
+}{
+	{"Provider", reflect.TypeOf((*dynv6.Interface)(nil)).Elem(), "dynv6.Interface"},
+	{"API", reflect.TypeOf((*dynv6api.API)(nil)).Elem(), "dynv6api.API"},
+}
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+func main() {
+	out := flag.String("out", "mock_gen.go", "output file")
+	flag.Parse()
+	g := &generator{imports: map[string]bool{}}
+	for _, m := range mocks {
+		if err := g.genMock(m.name, m.iface, m.expr); err != nil {
+			log.Fatalf("%s: %v", m.name, err)
+		}
+	}
+	var head bytes.Buffer
+	head.WriteString("// Code generated by internal/genmock; DO NOT EDIT.\n\npackage mock\n\nimport (\n")
+	var imports []string
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	// the standard library first, as goimports groups them
+	sort.Slice(imports, func(i, j int) bool {
+		a, b := isStd(imports[i]), isStd(imports[j])
+		return a && !b || a == b && imports[i] < imports[j]
+	})
+	for i, imp := range imports {
+		if i > 0 && isStd(imports[i-1]) && !isStd(imp) {
+			head.WriteString("\n")
+		}
+		fmt.Fprintf(&head, "\t%q\n", imp)
+	}
+	head.WriteString(")\n")
+	src := append(head.Bytes(), g.buf.Bytes()...)
+	formatted, err := format.Source(src)
+	if err != nil {
+		os.Stderr.Write(src)
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*out, formatted, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func isStd(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
+
+type generator struct {
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// typeName returns the name of t in Go syntax, adding the packages it
+// refers to to the imports.
+func (g *generator) typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + g.typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + g.typeName(t.Elem())
+	case reflect.Map:
+		return "map[" + g.typeName(t.Key()) + "]" + g.typeName(t.Elem())
+	}
+	if t.PkgPath() != "" {
+		g.imports[t.PkgPath()] = true
+	}
+	return t.String()
+}
+
+func (g *generator) genMock(name string, iface reflect.Type, expr string) error {
+	g.imports[iface.PkgPath()] = true
+	g.printf("\n// %s is a mock of %s. Its methods record calls\n", name, expr)
+	g.printf("// and call the matching Func field, or return zero values if it is nil.\n")
+	g.printf("type %s struct {\n\tRecorder\n\n", name)
+	type method struct {
+		name, params, args, results, zero string
+		recorded                          []string
+	}
+	var methods []method
+	for i := 0; i < iface.NumMethod(); i++ {
+		m := iface.Method(i)
+		if m.Type.IsVariadic() {
+			return fmt.Errorf("%s: variadic methods are not supported", m.Name)
+		}
+		var params, args, recorded []string
+		for j := 0; j < m.Type.NumIn(); j++ {
+			in := m.Type.In(j)
+			arg := fmt.Sprintf("p%d", j)
+			if in == contextType {
+				arg = "ctx"
+			} else {
+				recorded = append(recorded, arg)
+			}
+			params = append(params, arg+" "+g.typeName(in))
+			args = append(args, arg)
+		}
+		var results, zero []string
+		for j := 0; j < m.Type.NumOut(); j++ {
+			results = append(results, g.typeName(m.Type.Out(j)))
+			zero = append(zero, fmt.Sprintf("r%d", j))
+		}
+		res := strings.Join(results, ", ")
+		if len(results) > 1 {
+			res = "(" + res + ")"
+		}
+		methods = append(methods, method{
+			name:     m.Name,
+			params:   strings.Join(params, ", "),
+			args:     strings.Join(args, ", "),
+			results:  res,
+			zero:     strings.Join(zero, ", "),
+			recorded: recorded,
+		})
+		g.printf("\t%sFunc func(%s) %s\n", m.Name, strings.Join(params, ", "), res)
+	}
+	g.printf("}\n\nvar _ %s = (*%s)(nil)\n", expr, name)
+
+	for i, m := range methods {
+		out := iface.Method(i).Type
+		g.printf("\n// %s records the call and calls %sFunc.\n", m.name, m.name)
+		g.printf("func (m *%s) %s(%s) %s {\n", name, m.name, m.params, m.results)
+		g.printf("\tm.record(%s)\n", strings.Join(append([]string{fmt.Sprintf("%q", m.name)}, m.recorded...), ", "))
+		g.printf("\tif m.%sFunc == nil {\n", m.name)
+		for j := 0; j < out.NumOut(); j++ {
+			g.printf("\t\tvar r%d %s\n", j, g.typeName(out.Out(j)))
+		}
+		g.printf("\t\treturn %s\n\t}\n", m.zero)
+		g.printf("\treturn m.%sFunc(%s)\n}\n", m.name, m.args)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package mock provides mocks of dynv6.Interface and dynv6api.API, so tests
+// of code built on the provider or the low-level client can assert the
+// exact sequence of calls without hand-written stubs:
+//
+//	m := &mock.Provider{}
+//	m.GetRecordsFunc = func(ctx context.Context, zone string) ([]libdns.Record, error) {
+//		return nil, nil
+//	}
+//	code.Under(test, m)
+//	m.AssertMethods(t, "GetRecords", "SetRecords")
+//
+// The mocks are generated from the interfaces; run go generate after
+// changing them.
+package mock
+
+//go:generate go run ./internal/genmock -out mock_gen.go
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Call is a recorded call of a mock method.
+type Call struct {
+	Method string
+	// Args are the arguments of the call, except for the context.
+	Args []interface{}
+}
+
+func (c Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		args[i] = fmt.Sprintf("%#v", a)
+	}
+	return c.Method + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Recorder records the calls of a mock. It is safe for concurrent use.
+type Recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (r *Recorder) record(method string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns the recorded calls in order.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Methods returns the methods of the recorded calls in order.
+func (r *Recorder) Methods() []string {
+	var methods []string
+	for _, c := range r.Calls() {
+		methods = append(methods, c.Method)
+	}
+	return methods
+}
+
+// Reset forgets the recorded calls.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// TB is the part of testing.TB used by the assertions.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertMethods reports an error unless exactly the given methods were
+// called, in that order.
+func (r *Recorder) AssertMethods(t TB, methods ...string) {
+	t.Helper()
+	if got := r.Methods(); !reflect.DeepEqual(got, methods) && (len(got) != 0 || len(methods) != 0) {
+		t.Errorf("got calls %s, want %s", strings.Join(got, ", "), strings.Join(methods, ", "))
+	}
+}
+
+// AssertCalls reports an error unless exactly the given calls were made,
+// in that order, comparing the arguments with reflect.DeepEqual.
+func (r *Recorder) AssertCalls(t TB, calls ...Call) {
+	t.Helper()
+	got := r.Calls()
+	if len(got) != len(calls) {
+		t.Errorf("got %d calls %v, want %d calls %v", len(got), got, len(calls), calls)
+		return
+	}
+	for i := range got {
+		if got[i].Method != calls[i].Method || !reflect.DeepEqual(got[i].Args, calls[i].Args) {
+			t.Errorf("call %d: got %s, want %s", i, got[i], calls[i])
+		}
+	}
+}
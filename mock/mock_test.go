@@ -0,0 +1,80 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+)
+
+// replaceTXT is code under test, replacing a TXT record if it exists.
+func replaceTXT(ctx context.Context, p dynv6.Interface, zone, name, text string) error {
+	recs, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return err
+	}
+	for _, r := range recs {
+		if rr := r.RR(); rr.Name == name && rr.Type == "TXT" {
+			_, err := p.SetRecords(ctx, zone, []libdns.Record{libdns.TXT{Name: name, Text: text}})
+			return err
+		}
+	}
+	return nil
+}
+
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestProvider(t *testing.T) {
+	m := &Provider{}
+	m.GetRecordsFunc = func(ctx context.Context, zone string) ([]libdns.Record, error) {
+		return []libdns.Record{libdns.TXT{Name: "note", Text: "old"}}, nil
+	}
+	if err := replaceTXT(context.Background(), m, "example.dynv6.net", "note", "new"); err != nil {
+		t.Fatal(err)
+	}
+	m.AssertMethods(t, "GetRecords", "SetRecords")
+	m.AssertCalls(t,
+		Call{"GetRecords", []interface{}{"example.dynv6.net"}},
+		Call{"SetRecords", []interface{}{"example.dynv6.net", []libdns.Record{libdns.TXT{Name: "note", Text: "new"}}}},
+	)
+
+	var rt recordingT
+	m.AssertMethods(&rt, "GetRecords")
+	if len(rt.errors) != 1 {
+		t.Fatalf("expected a mismatch to be reported, got %q", rt.errors)
+	}
+	m.Reset()
+	m.AssertMethods(t)
+}
+
+func TestAPI(t *testing.T) {
+	m := &API{}
+	sentinel := errors.New("zone not found")
+	m.GetZoneByNameFunc = func(ctx context.Context, name string) (*dynv6api.Zone, error) {
+		return nil, sentinel
+	}
+	var api dynv6api.API = m
+	if _, err := api.GetZoneByName(context.Background(), "example.dynv6.net"); err != sentinel {
+		t.Fatalf("got %v, want the error of the func", err)
+	}
+	// unset funcs return zero values
+	if recs, err := api.ListRecords(context.Background(), 1); recs != nil || err != nil {
+		t.Fatalf("got %v, %v, want zero values", recs, err)
+	}
+	m.AssertCalls(t,
+		Call{"GetZoneByName", []interface{}{"example.dynv6.net"}},
+		Call{"ListRecords", []interface{}{int64(1)}},
+	)
+}
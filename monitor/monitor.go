@@ -0,0 +1,311 @@
+// Package monitor watches records which must exist and alerts when they
+// vanish from the dynv6 API or stop resolving, so accidental deletions are
+// caught quickly.
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/accesslog"
+	"github.com/libdns/dynv6/manifest"
+	"github.com/libdns/dynv6/notify"
+	"github.com/libdns/libdns"
+)
+
+// Kinds of the events sent to Monitor.Notifier.
+const (
+	// EventRecordMissing is sent when the API stops returning a record.
+	EventRecordMissing = "record-missing"
+	// EventRecordUnresolved is sent when a resolver stops answering with
+	// a record.
+	EventRecordUnresolved = "record-unresolved"
+	// EventRecordRestored is sent when a record is returned or answered
+	// again after EventRecordMissing or EventRecordUnresolved.
+	EventRecordRestored = "record-restored"
+)
+
+// Target is a record which must exist.
+type Target struct {
+	Zone   string
+	Record libdns.Record
+}
+
+// Targets returns the records of the zones of m.
+func Targets(m *manifest.Manifest) ([]Target, error) {
+	var targets []Target
+	for _, z := range m.Zones {
+		recs, err := z.ParseRecords()
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range recs {
+			targets = append(targets, Target{Zone: z.Zone, Record: r})
+		}
+	}
+	return targets, nil
+}
+
+// Problem is a target which failed a check.
+type Problem struct {
+	Target
+	// Kind is EventRecordMissing or EventRecordUnresolved.
+	Kind string
+	// Server is the resolver which didn't answer with the record.
+	Server string
+}
+
+func (p Problem) key() string {
+	rr := p.Record.RR()
+	return strings.Join([]string{p.Kind, strings.TrimSuffix(p.Zone, "."), rr.Name, rr.Type, rr.Data, p.Server}, "\x00")
+}
+
+func (p Problem) String() string {
+	rr := p.Record.RR()
+	what := fmt.Sprintf("%s %s %q", fqdn(rr.Name, p.Zone), rr.Type, rr.Data)
+	if p.Kind == EventRecordUnresolved {
+		return what + " doesn't resolve at " + p.Server
+	}
+	return what + " is missing from the API"
+}
+
+// Report is the outcome of a check of a Monitor.
+type Report struct {
+	Started  time.Time
+	Duration time.Duration
+	// Checked is the number of targets.
+	Checked  int
+	Problems []Problem
+	// Err is the error of loading the targets or of listing a zone. The
+	// targets of a zone which couldn't be listed are only resolved.
+	Err error
+}
+
+// Monitor periodically checks that records exist in the API and resolve.
+type Monitor struct {
+	Provider libdns.RecordGetter
+
+	// Load returns the targets of a check. It is called for every check,
+	// so the targets may change while the monitor is running.
+	Load func() ([]Target, error)
+
+	// Resolvers are asked for every target. If empty, the dynv6
+	// nameserver is asked.
+	Resolvers []dynv6.Resolver
+
+	// Interval is the time between checks, one minute by default.
+	Interval time.Duration
+
+	// Failures is the number of consecutive checks a target must fail
+	// before it is alerted about, 2 by default, so a lost UDP packet
+	// doesn't cause an alert.
+	Failures int
+
+	// Notifier, if set, is notified once when a target starts failing and
+	// once when it recovers.
+	Notifier notify.EventNotifier
+
+	// Log receives a line of key=value pairs per problem and check. If
+	// nil, the standard logger is used.
+	Log *log.Logger
+
+	// OnReport, if set, is called after every check.
+	OnReport func(Report)
+
+	// failing counts the consecutive failures of the problems of the
+	// last check.
+	failing map[string]int
+	// alerted are the problems notified about and not recovered yet.
+	alerted map[string]Problem
+}
+
+// Check checks all targets once and sends the events due.
+func (m *Monitor) Check(ctx context.Context) Report {
+	report := Report{Started: time.Now()}
+	targets, err := m.Load()
+	if err != nil {
+		report.Err = err
+		report.Duration = time.Since(report.Started)
+		m.logf("level", "error", "msg", "loading the targets failed", "err", err)
+		if m.OnReport != nil {
+			m.OnReport(report)
+		}
+		return report
+	}
+	report.Checked = len(targets)
+	unlisted := map[string]bool{}
+	var errs []string
+	for zone, ts := range byZone(targets) {
+		existing, err := m.Provider.GetRecords(ctx, zone)
+		if err != nil {
+			unlisted[zone] = true
+			errs = append(errs, fmt.Sprintf("%s: %v", zone, err))
+			m.logf("level", "error", "msg", "listing the zone failed", "zone", zone, "err", err)
+		}
+		for _, t := range ts {
+			if err == nil && !exists(existing, t.Record) {
+				report.Problems = append(report.Problems, Problem{Target: t, Kind: EventRecordMissing})
+			}
+			for _, r := range m.resolvers() {
+				if !dynv6.Served(ctx, r, zone, t.Record) {
+					report.Problems = append(report.Problems, Problem{Target: t, Kind: EventRecordUnresolved, Server: serverName(r)})
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		report.Err = fmt.Errorf("listing %d zone(s) failed: %s", len(errs), strings.Join(errs, "; "))
+	}
+	sort.Slice(report.Problems, func(i, j int) bool { return report.Problems[i].key() < report.Problems[j].key() })
+	m.observe(ctx, report.Problems, unlisted)
+	report.Duration = time.Since(report.Started)
+	m.logf("level", "info", "msg", "check finished", "targets", report.Checked, "problems", len(report.Problems), "duration", report.Duration.Round(time.Millisecond))
+	if m.OnReport != nil {
+		m.OnReport(report)
+	}
+	return report
+}
+
+// observe counts the failures of the problems and sends the events for
+// those reaching the threshold and those which recovered. Missing
+// records of the unlisted zones neither fail nor recover.
+func (m *Monitor) observe(ctx context.Context, problems []Problem, unlisted map[string]bool) {
+	threshold := m.Failures
+	if threshold <= 0 {
+		threshold = 2
+	}
+	if m.alerted == nil {
+		m.alerted = map[string]Problem{}
+	}
+	failing := map[string]int{}
+	for k, p := range m.alerted {
+		if p.Kind == EventRecordMissing && unlisted[p.Zone] {
+			failing[k] = m.failing[k]
+		}
+	}
+	for _, p := range problems {
+		k := p.key()
+		failing[k] = m.failing[k] + 1
+		m.logf("level", "warn", "msg", "check failed", "zone", p.Zone, "name", p.Record.RR().Name, "type", p.Record.RR().Type, "kind", p.Kind, "server", p.Server, "failures", failing[k])
+		if _, ok := m.alerted[k]; !ok && failing[k] >= threshold {
+			m.alerted[k] = p
+			m.notify(ctx, p.Kind, p.String(), p)
+		}
+	}
+	m.failing = failing
+	for k, p := range m.alerted {
+		if _, ok := failing[k]; !ok {
+			delete(m.alerted, k)
+			m.notify(ctx, EventRecordRestored, restored(p), p)
+		}
+	}
+}
+
+func restored(p Problem) string {
+	rr := p.Record.RR()
+	what := fmt.Sprintf("%s %s %q", fqdn(rr.Name, p.Zone), rr.Type, rr.Data)
+	if p.Kind == EventRecordUnresolved {
+		return what + " resolves at " + p.Server + " again"
+	}
+	return what + " is back in the API"
+}
+
+// notify sends an event about p to the notifier, if any, logging failures.
+func (m *Monitor) notify(ctx context.Context, kind, title string, p Problem) {
+	if m.Notifier == nil {
+		return
+	}
+	rr := p.Record.RR()
+	fields := map[string]string{
+		"zone": strings.TrimSuffix(p.Zone, "."),
+		"name": rr.Name,
+		"type": rr.Type,
+		"data": rr.Data,
+	}
+	if p.Server != "" {
+		fields["server"] = p.Server
+	}
+	e := notify.Event{Kind: kind, Title: title, Time: time.Now(), Fields: fields}
+	if err := m.Notifier.NotifyEvent(ctx, e); err != nil {
+		m.logf("level", "error", "msg", "notify failed", "kind", kind, "err", err)
+	}
+}
+
+// Run checks until the context is done and returns its error.
+func (m *Monitor) Run(ctx context.Context) error {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	for ctx.Err() == nil {
+		m.Check(ctx)
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	return ctx.Err()
+}
+
+func (m *Monitor) resolvers() []dynv6.Resolver {
+	if len(m.Resolvers) == 0 {
+		return []dynv6.Resolver{nil}
+	}
+	return m.Resolvers
+}
+
+func byZone(targets []Target) map[string][]Target {
+	zones := map[string][]Target{}
+	for _, t := range targets {
+		zone := strings.TrimSuffix(t.Zone, ".")
+		t.Zone = zone
+		zones[zone] = append(zones[zone], t)
+	}
+	return zones
+}
+
+func exists(existing []libdns.Record, r libdns.Record) bool {
+	for _, e := range existing {
+		if dynv6.MatchNormalized.Match(e.RR(), r.RR()) {
+			return true
+		}
+	}
+	return false
+}
+
+func serverName(r dynv6.Resolver) string {
+	switch r := r.(type) {
+	case nil:
+		return "the dynv6 nameserver"
+	case dynv6.DNSResolver:
+		return string(r)
+	case fmt.Stringer:
+		return r.String()
+	}
+	return fmt.Sprintf("%T", r)
+}
+
+func fqdn(name, zone string) string {
+	zone = strings.TrimSuffix(zone, ".")
+	if name == "@" || name == "" {
+		return zone
+	}
+	return name + "." + zone
+}
+
+// logf writes the key value pairs in logfmt.
+func (m *Monitor) logf(kv ...interface{}) {
+	l := m.Log
+	if l == nil {
+		l = log.Default()
+	}
+	accesslog.Print(l, kv...)
+}
@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/notify"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// fakeGetter returns records, or fails while offline is set.
+type fakeGetter struct {
+	offline bool
+	records []libdns.Record
+}
+
+func (f *fakeGetter) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	if f.offline {
+		return nil, errors.New("network is unreachable")
+	}
+	return f.records, nil
+}
+
+// fakeResolver answers A queries with the addresses in its map.
+type fakeResolver map[string]string
+
+func (f fakeResolver) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	resp := new(dns.Msg)
+	resp.SetReply(m)
+	q := m.Question[0]
+	if addr, ok := f[q.Name]; ok && q.Qtype == dns.TypeA {
+		resp.Answer = append(resp.Answer, &dns.A{Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.ParseIP(addr)})
+	}
+	return resp, nil
+}
+
+func TestMonitor(t *testing.T) {
+	www := libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"}
+	api := &fakeGetter{records: []libdns.Record{www}}
+	ns := fakeResolver{"www.example.dynv6.net.": "192.0.2.1"}
+	var events []string
+	m := &Monitor{
+		Provider:  api,
+		Load:      func() ([]Target, error) { return []Target{{Zone: "example.dynv6.net.", Record: www}}, nil },
+		Resolvers: []dynv6.Resolver{ns},
+		Notifier: notify.EventNotifierFunc(func(ctx context.Context, e notify.Event) error {
+			events = append(events, fmt.Sprintf("%s %s %s", e.Kind, e.Fields["zone"], e.Fields["name"]))
+			return nil
+		}),
+		Log: log.New(ioutil.Discard, "", 0),
+	}
+	check := func(problems int, want ...string) {
+		t.Helper()
+		events = nil
+		r := m.Check(context.Background())
+		if len(r.Problems) != problems {
+			t.Fatalf("got problems %v, want %d", r.Problems, problems)
+		}
+		if fmt.Sprint(events) != fmt.Sprint(want) {
+			t.Fatalf("got events %v, want %v", events, want)
+		}
+	}
+	check(0)
+
+	// a deleted record is alerted about after two failed checks, once
+	api.records = nil
+	delete(ns, "www.example.dynv6.net.")
+	check(2)
+	check(2, "record-missing example.dynv6.net www", "record-unresolved example.dynv6.net www")
+	check(2)
+
+	// an unreachable API doesn't recover missing records
+	api.offline = true
+	if r := m.Check(context.Background()); r.Err == nil || len(r.Problems) != 1 {
+		t.Fatalf("offline: got %v, %v", r.Problems, r.Err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("offline: got events %v", events)
+	}
+
+	api.offline = false
+	api.records = []libdns.Record{www}
+	check(1, "record-restored example.dynv6.net www")
+	ns["www.example.dynv6.net."] = "192.0.2.1"
+	check(0, "record-restored example.dynv6.net www")
+}
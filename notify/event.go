@@ -0,0 +1,186 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Event is an alert about something other than drift, e.g. the DDNS updater
+// changing an address or failing repeatedly.
+type Event struct {
+	// Kind identifies the event for filtering, e.g. "address-changed".
+	Kind string
+	// Title is a one line summary.
+	Title string
+	// Text describes the event in detail. It may be empty.
+	Text string
+	Time time.Time
+	// Fields are details for machine consumption, e.g. the record name.
+	Fields map[string]string
+}
+
+// EventNotifier sends alerts about events. Webhook, Ntfy, Email, Exec and
+// Multi implement it along with Notifier.
+type EventNotifier interface {
+	NotifyEvent(ctx context.Context, e Event) error
+}
+
+// EventNotifierFunc adapts a function to an EventNotifier.
+type EventNotifierFunc func(ctx context.Context, e Event) error
+
+// NotifyEvent implements EventNotifier.
+func (f EventNotifierFunc) NotifyEvent(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// NotifyEvent implements EventNotifier for the notifiers which implement it.
+// It returns the first error.
+func (m Multi) NotifyEvent(ctx context.Context, e Event) error {
+	var first error
+	for _, n := range m {
+		en, ok := n.(EventNotifier)
+		if !ok {
+			continue
+		}
+		if err := en.NotifyEvent(ctx, e); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// NotifyEvent posts the event as JSON:
+//
+//	{
+//	  "kind": "address-changed",
+//	  "time": "2024-05-01T12:00:00Z",
+//	  "title": "home.example.dynv6.net now points at 203.0.113.7",
+//	  "text": "",
+//	  "fields": {"zone": "example.dynv6.net", "name": "home", "type": "A", "address": "203.0.113.7"}
+//	}
+func (w Webhook) NotifyEvent(ctx context.Context, e Event) error {
+	body := struct {
+		Kind   string            `json:"kind"`
+		Time   time.Time         `json:"time"`
+		Title  string            `json:"title"`
+		Text   string            `json:"text"`
+		Fields map[string]string `json:"fields"`
+	}{e.Kind, e.Time, e.Title, e.Text, e.Fields}
+	if body.Fields == nil {
+		body.Fields = map[string]string{}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for name, values := range w.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return post(w.Client, req)
+}
+
+// NotifyEvent implements EventNotifier.
+func (n Ntfy) NotifyEvent(ctx context.Context, e Event) error {
+	text := e.Text
+	if text == "" {
+		text = e.Title
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, strings.NewReader(text))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", e.Title)
+	req.Header.Set("Tags", e.Kind)
+	if n.Priority > 0 {
+		req.Header.Set("Priority", fmt.Sprint(n.Priority))
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return post(n.Client, req)
+}
+
+// NotifyEvent implements EventNotifier. The context is not used, as
+// net/smtp doesn't support it.
+func (e Email) NotifyEvent(ctx context.Context, ev Event) error {
+	text := ev.Text
+	if text == "" {
+		text = ev.Title
+	}
+	return e.send(ev.Title, ev.Time, text)
+}
+
+// Exec runs a command for every alert, e.g. a script sending an SMS. The
+// alert is passed in the environment: DYNV6_EVENT is the kind of the event
+// or "drift", DYNV6_TITLE the title and DYNV6_<FIELD> the fields of an
+// event, e.g. DYNV6_ADDRESS. The text is written to the standard input.
+type Exec struct {
+	// Command is the program and its arguments.
+	Command []string
+	// Timeout limits the run of the command. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// Notify implements Notifier.
+func (x Exec) Notify(ctx context.Context, d Drift) error {
+	return x.run(ctx, Event{Kind: "drift", Title: d.Title(), Text: d.Text(), Time: d.Detected, Fields: map[string]string{"zone": d.Zone}})
+}
+
+// NotifyEvent implements EventNotifier.
+func (x Exec) NotifyEvent(ctx context.Context, e Event) error {
+	return x.run(ctx, e)
+}
+
+func (x Exec) run(ctx context.Context, e Event) error {
+	if len(x.Command) == 0 {
+		return errors.New("notify: no command")
+	}
+	timeout := x.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, x.Command[0], x.Command[1:]...)
+	cmd.Env = append(os.Environ(), "DYNV6_EVENT="+e.Kind, "DYNV6_TITLE="+e.Title)
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cmd.Env = append(cmd.Env, "DYNV6_"+envName(k)+"="+e.Fields[k])
+	}
+	cmd.Stdin = strings.NewReader(e.Text)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notify: %s: %v: %s", x.Command[0], err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// envName converts a field name to an environment variable name.
+func envName(field string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, field)
+}
@@ -0,0 +1,201 @@
+// Package notify alerts about drift, i.e. live records of a zone which
+// differ from its declared state, e.g. after a manual or malicious change
+// in the dynv6 web interface, and about events of the daemons, such as the
+// DDNS updater failing.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/render"
+)
+
+// Drift describes how the live records of a zone differ from its declared
+// state. The changes are the ones needed to restore the declared state.
+type Drift struct {
+	Zone     string
+	Changes  []render.Change
+	Detected time.Time
+}
+
+// NewDrift returns the drift shown by a plan, detected now.
+func NewDrift(plan dynv6.Plan) Drift {
+	return Drift{Zone: plan.Zone, Changes: render.Changes(plan), Detected: time.Now()}
+}
+
+// Title is a one line summary of the drift.
+func (d Drift) Title() string {
+	return fmt.Sprintf("DNS drift in %s: %d change(s)", strings.TrimSuffix(d.Zone, "."), len(d.Changes))
+}
+
+// Text lists the changes, one per line.
+func (d Drift) Text() string {
+	var b bytes.Buffer
+	render.Text(&b, d.Changes)
+	return b.String()
+}
+
+// Notifier sends an alert about drift.
+type Notifier interface {
+	Notify(ctx context.Context, d Drift) error
+}
+
+// NotifierFunc adapts a function to a Notifier.
+type NotifierFunc func(ctx context.Context, d Drift) error
+
+// Notify implements Notifier.
+func (f NotifierFunc) Notify(ctx context.Context, d Drift) error {
+	return f(ctx, d)
+}
+
+// Multi notifies all of its notifiers, even if some fail.
+type Multi []Notifier
+
+// Notify implements Notifier. It returns the first error.
+func (m Multi) Notify(ctx context.Context, d Drift) error {
+	var first error
+	for _, n := range m {
+		if err := n.Notify(ctx, d); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Webhook posts the drift as JSON to a URL:
+//
+//	{
+//	  "zone": "example.dynv6.net",
+//	  "detected": "2024-05-01T12:00:00Z",
+//	  "title": "DNS drift in example.dynv6.net: 1 change(s)",
+//	  "changes": [
+//	    {"kind": "update", "name": "www", "type": "A", "old": "203.0.113.9", "new": "203.0.113.7"}
+//	  ]
+//	}
+type Webhook struct {
+	URL string
+	// Header is added to the request, e.g. for authentication.
+	Header http.Header
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+type webhookChange struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+var kindNames = map[byte]string{
+	render.Create: "create",
+	render.Update: "update",
+	render.Delete: "delete",
+}
+
+// Notify implements Notifier.
+func (w Webhook) Notify(ctx context.Context, d Drift) error {
+	body := struct {
+		Zone     string          `json:"zone"`
+		Detected time.Time       `json:"detected"`
+		Title    string          `json:"title"`
+		Changes  []webhookChange `json:"changes"`
+	}{Zone: d.Zone, Detected: d.Detected, Title: d.Title(), Changes: []webhookChange{}}
+	for _, c := range d.Changes {
+		body.Changes = append(body.Changes, webhookChange{kindNames[c.Kind], c.Name, c.Type, c.Old, c.New})
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for name, values := range w.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return post(w.Client, req)
+}
+
+// Ntfy publishes the drift to a topic of an ntfy server (https://ntfy.sh).
+type Ntfy struct {
+	// URL is the URL of the topic, e.g. https://ntfy.sh/my-dns-alerts.
+	URL string
+	// Token is an optional access token of the server.
+	Token string
+	// Priority is the priority of the message, 1 to 5; 0 is the default.
+	Priority int
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Notify implements Notifier.
+func (n Ntfy) Notify(ctx context.Context, d Drift) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, strings.NewReader(d.Text()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", d.Title())
+	req.Header.Set("Tags", "warning")
+	if n.Priority > 0 {
+		req.Header.Set("Priority", fmt.Sprint(n.Priority))
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return post(n.Client, req)
+}
+
+func post(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notify: %s: unexpected status %s", req.URL.Redacted(), resp.Status)
+	}
+	return nil
+}
+
+// Email sends the drift as a plain text mail.
+type Email struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	// Auth is optional, e.g. smtp.PlainAuth.
+	Auth smtp.Auth
+	From string
+	To   []string
+}
+
+// Notify implements Notifier. The context is not used, as net/smtp doesn't
+// support it.
+func (e Email) Notify(ctx context.Context, d Drift) error {
+	return e.send(d.Title(), d.Detected, d.Text())
+}
+
+func (e Email) send(subject string, date time.Time, text string) error {
+	if len(e.To) == 0 {
+		return errors.New("notify: no recipients")
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", e.From, strings.Join(e.To, ", "), subject, date.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	return smtp.SendMail(e.Addr, e.Auth, e.From, e.To, msg.Bytes())
+}
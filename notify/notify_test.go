@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/libdns"
+)
+
+func testDrift() Drift {
+	return NewDrift(dynv6.Plan{
+		Zone:   "example.dynv6.net.",
+		Create: []libdns.Record{libdns.RR{Name: "www", Type: "A", Data: "203.0.113.7"}},
+		Delete: []libdns.Record{libdns.RR{Name: "www", Type: "A", Data: "203.0.113.9"}},
+	})
+}
+
+func TestWebhook(t *testing.T) {
+	var body struct {
+		Zone    string
+		Title   string
+		Changes []webhookChange
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Secret") != "s3cret" {
+			t.Errorf("missing header")
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+	w := Webhook{URL: srv.URL, Header: http.Header{"X-Secret": {"s3cret"}}}
+	if err := w.Notify(context.Background(), testDrift()); err != nil {
+		t.Fatal(err)
+	}
+	want := webhookChange{Kind: "update", Name: "www", Type: "A", Old: "203.0.113.9", New: "203.0.113.7"}
+	if body.Zone != "example.dynv6.net." || len(body.Changes) != 1 || body.Changes[0] != want {
+		t.Fatalf("unexpected body: %+v", body)
+	}
+	if body.Title != "DNS drift in example.dynv6.net: 1 change(s)" {
+		t.Fatalf("unexpected title: %q", body.Title)
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	var title, auth, text string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		title, auth = r.Header.Get("Title"), r.Header.Get("Authorization")
+		b, _ := ioutil.ReadAll(r.Body)
+		text = string(b)
+	}))
+	defer srv.Close()
+	n := Ntfy{URL: srv.URL + "/alerts", Token: "tk"}
+	if err := n.Notify(context.Background(), testDrift()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(title, "DNS drift") || auth != "Bearer tk" || !strings.Contains(text, "'203.0.113.9' -> '203.0.113.7'") {
+		t.Fatalf("unexpected message: %q %q %q", title, auth, text)
+	}
+
+	status = http.StatusForbidden
+	if err := n.Notify(context.Background(), testDrift()); err == nil {
+		t.Fatal("expected an error for status 403")
+	}
+}
+
+func TestMulti(t *testing.T) {
+	calls := 0
+	fail := NotifierFunc(func(ctx context.Context, d Drift) error {
+		calls++
+		return errors.New("failed")
+	})
+	if err := (Multi{fail, fail}).Notify(context.Background(), testDrift()); err == nil || calls != 2 {
+		t.Fatalf("expected both notifiers to be called and an error, got %d calls and %v", calls, err)
+	}
+}
+
+func testEvent() Event {
+	return Event{
+		Kind:   "address-changed",
+		Title:  "home.example.dynv6.net now points at 203.0.113.7",
+		Fields: map[string]string{"name": "home", "address": "203.0.113.7"},
+	}
+}
+
+func TestWebhookEvent(t *testing.T) {
+	var body struct {
+		Kind   string
+		Title  string
+		Fields map[string]string
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+	var n EventNotifier = Multi{Webhook{URL: srv.URL}, NotifierFunc(func(ctx context.Context, d Drift) error { return nil })}
+	if err := n.NotifyEvent(context.Background(), testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if body.Kind != "address-changed" || body.Fields["address"] != "203.0.113.7" {
+		t.Fatalf("unexpected body: %+v", body)
+	}
+}
+
+func TestExec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	x := Exec{Command: []string{"sh", "-c", `printf '%s %s ' "$DYNV6_EVENT" "$DYNV6_ADDRESS" > "$0"; cat >> "$0"`, out}}
+	e := testEvent()
+	e.Text = "details"
+	if err := x.NotifyEvent(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(out); string(b) != "address-changed 203.0.113.7 details" {
+		t.Fatalf("got %q", b)
+	}
+	if err := (Exec{Command: []string{"sh", "-c", "echo oops; exit 3"}}).Notify(context.Background(), testDrift()); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Fatalf("got %v, want the output of the failed command", err)
+	}
+}
@@ -0,0 +1,109 @@
+package dynv6
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Option overrides the provider settings for the calls made with a context,
+// see WithOptions.
+type Option func(*callOptions)
+
+type callOptions struct {
+	dryRun      bool
+	propagation time.Duration
+	concurrency int
+	matcher     Matcher
+	confirm     ConfirmFunc
+	owner       string
+	pruneOnly   func(zone string, s RRSet) bool
+	verify      bool
+}
+
+type optionsKey struct{}
+
+// WithOptions returns a copy of ctx which applies opts to the provider calls
+// made with it, e.g.
+//
+//	p.DeleteRecords(dynv6.WithOptions(ctx, dynv6.DryRun()), zone, recs)
+func WithOptions(ctx context.Context, opts ...Option) context.Context {
+	o := optionsFrom(ctx)
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return context.WithValue(ctx, optionsKey{}, o)
+}
+
+func optionsFrom(ctx context.Context) callOptions {
+	o, _ := ctx.Value(optionsKey{}).(callOptions)
+	return o
+}
+
+// DryRun makes AppendRecords, SetRecords and DeleteRecords return the
+// records they would change without changing them.
+func DryRun() Option {
+	return func(o *callOptions) { o.dryRun = true }
+}
+
+// PropagationTimeout makes AppendRecords and SetRecords wait up to timeout
+// until the dynv6 nameservers, or the PropagationResolvers of the provider,
+// serve the written records, see WaitForPropagation.
+func PropagationTimeout(timeout time.Duration) Option {
+	return func(o *callOptions) { o.propagation = timeout }
+}
+
+// Concurrency makes AppendRecords and DeleteRecords send up to n API
+// requests at the same time.
+func Concurrency(n int) Option {
+	return func(o *callOptions) { o.concurrency = n }
+}
+
+// UseMatcher overrides the provider's Matcher.
+func UseMatcher(m Matcher) Option {
+	return func(o *callOptions) { o.matcher = m }
+}
+
+// ConfirmFunc is shown the plan of a Sync before it is applied and returns
+// whether to proceed.
+type ConfirmFunc func(ctx context.Context, plan Plan) (bool, error)
+
+// Confirm makes Sync ask fn for approval before applying a plan with
+// changes. If fn declines, Sync returns ErrNotConfirmed without changing
+// anything.
+func Confirm(fn ConfirmFunc) Option {
+	return func(o *callOptions) { o.confirm = fn }
+}
+
+// each calls fn for 0 <= i < count, concurrently if requested, and returns
+// the error of the lowest index. Without concurrency it stops at the first
+// error.
+func (o callOptions) each(count int, fn func(i int) error) error {
+	if o.concurrency <= 1 {
+		for i := 0; i < count; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	errs := make([]error, count)
+	sem := make(chan struct{}, o.concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+			<-sem
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package dynv6
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// OwnershipPrefix is the label prepended to the name of an RRset for the
+// TXT records marking its owners, see OwnershipTXT.
+const OwnershipPrefix = "_dynv6-owner"
+
+// OwnershipTXT makes Sync mark the RRsets it writes as owned by owner, and
+// prune only RRsets marked as owned by owner, like the TXT registry of
+// external-dns. The marker of an RRset is a TXT record at its name prefixed
+// with OwnershipPrefix, e.g. "_dynv6-owner.www" with the text
+// "heritage=dynv6,owner=<owner>,type=A". Records created by hand or by
+// other owners are never pruned.
+func OwnershipTXT(owner string) Option {
+	return func(o *callOptions) { o.owner = owner }
+}
+
+// PruneOnly makes Sync prune only the RRsets of a zone owned reports true
+// for, e.g. the ones a journal recorded as created by the tool. Combined
+// with OwnershipTXT, an RRset must satisfy both to be pruned.
+func PruneOnly(owned func(zone string, s RRSet) bool) Option {
+	return func(o *callOptions) { o.pruneOnly = owned }
+}
+
+// ownershipName returns the name of the markers of the RRsets named name.
+func ownershipName(name string) string {
+	if name == "" || name == "@" {
+		return OwnershipPrefix
+	}
+	return OwnershipPrefix + "." + name
+}
+
+// ownedName returns the name of the RRsets marked by TXT records named
+// name, if it is an ownership name.
+func ownedName(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	switch {
+	case lower == OwnershipPrefix:
+		return "@", true
+	case strings.HasPrefix(lower, OwnershipPrefix+"."):
+		return name[len(OwnershipPrefix)+1:], true
+	}
+	return "", false
+}
+
+func ownershipText(owner, typ string) string {
+	return fmt.Sprintf("heritage=dynv6,owner=%s,type=%s", owner, strings.ToUpper(typ))
+}
+
+// parseOwnership returns the owner and type of the RRset a marker text is
+// about.
+func parseOwnership(text string) (owner, typ string, ok bool) {
+	var heritage bool
+	for _, field := range strings.Split(text, ",") {
+		i := strings.Index(field, "=")
+		if i < 0 {
+			continue
+		}
+		switch k, v := field[:i], field[i+1:]; k {
+		case "heritage":
+			heritage = v == "dynv6"
+		case "owner":
+			owner = v
+		case "type":
+			typ = strings.ToUpper(v)
+		}
+	}
+	return owner, typ, heritage && owner != "" && typ != ""
+}
+
+// marker describes an ownership TXT record of current.
+type marker struct {
+	rec    libdns.Record
+	owner  string
+	target rrsetKey
+}
+
+func markersOf(current []libdns.Record) []marker {
+	var markers []marker
+	for _, r := range current {
+		rr := r.RR()
+		if rr.Type != "TXT" {
+			continue
+		}
+		name, ok := ownedName(rr.Name)
+		if !ok {
+			continue
+		}
+		if owner, typ, ok := parseOwnership(rr.Data); ok {
+			markers = append(markers, marker{rec: r, owner: owner, target: rrsetKey{strings.ToLower(name), typ}})
+		}
+	}
+	return markers
+}
+
+// withOwnership adds the markers of owner for the desired RRsets to
+// desired. The markers of other owners are kept, and so are the markers
+// of owner for RRsets which aren't desired unless they are pruned.
+func withOwnership(current, desired []libdns.Record, owner string, prune bool) []libdns.Record {
+	want := map[rrsetKey]bool{}
+	out := append([]libdns.Record(nil), desired...)
+	names := map[string]bool{}
+	for _, s := range GroupRRSets(desired) {
+		if _, ok := ownedName(s.Name); ok {
+			continue
+		}
+		want[s.key()] = true
+		names[strings.ToLower(s.Name)] = true
+		out = append(out, libdns.TXT{Name: ownershipName(s.Name), Text: ownershipText(owner, s.Type)})
+	}
+	// the desired marker RRsets replace the current ones, keep what isn't
+	// ours to change
+	for _, r := range current {
+		rr := r.RR()
+		name, ok := ownedName(rr.Name)
+		if !ok || rr.Type != "TXT" || !names[strings.ToLower(name)] {
+			continue
+		}
+		if o, typ, ok := parseOwnership(rr.Data); ok && o == owner && (prune || want[rrsetKey{strings.ToLower(name), typ}]) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// prunable returns the function selecting the records of a pruned RRset
+// to delete, or nil if all of them are.
+func (o callOptions) prunable(zone string, current []libdns.Record) func(s RRSet) []libdns.Record {
+	if o.owner == "" && o.pruneOnly == nil {
+		return nil
+	}
+	owned := map[rrsetKey]bool{}
+	for _, m := range markersOf(current) {
+		if m.owner == o.owner {
+			owned[m.target] = true
+		}
+	}
+	return func(s RRSet) []libdns.Record {
+		if o.owner != "" {
+			if _, ok := ownedName(s.Name); ok && strings.EqualFold(s.Type, "TXT") {
+				// drop our markers of RRsets which no longer exist
+				var recs []libdns.Record
+				for _, m := range markersOf(s.Records) {
+					if m.owner == o.owner {
+						recs = append(recs, m.rec)
+					}
+				}
+				return recs
+			}
+			if !owned[s.key()] {
+				return nil
+			}
+		}
+		if o.pruneOnly != nil && !o.pruneOnly(zone, s) {
+			return nil
+		}
+		return s.Records
+	}
+}
@@ -0,0 +1,185 @@
+package dynv6
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/libdns/libdns"
+)
+
+// Policy restricts the records a provider may create, update or delete, so
+// a process holding a token for the whole account, e.g. an ACME client,
+// can only change the records it is meant to. Each record written or
+// deleted is checked against the rules in order and the first rule
+// matching it decides; records no rule matches are denied unless Default
+// is "allow". Reads aren't restricted.
+//
+// A policy allowing only ACME challenges looks like this in JSON:
+//
+//	{"rules": [{"action": "allow", "types": ["TXT"], "name": "_acme-challenge(\\..+)?"}]}
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+	// Default is the action for records no rule matches, "allow" or
+	// "deny". Empty means "deny".
+	Default string `json:"default,omitempty"`
+
+	once     sync.Once
+	compiled []compiledRule
+	err      error
+}
+
+// PolicyRule matches records by type and name.
+type PolicyRule struct {
+	// Action is "allow" or "deny".
+	Action string `json:"action"`
+	// Types are the record types the rule matches. Empty matches all types.
+	Types []string `json:"types,omitempty"`
+	// Name is a regular expression matching the whole name of a record
+	// relative to its zone, "@" for the apex, case-insensitively. Empty
+	// matches all names.
+	Name string `json:"name,omitempty"`
+	// Zone is a regular expression matching the whole name of the zone,
+	// without the trailing dot. Empty matches all zones.
+	Zone string `json:"zone,omitempty"`
+}
+
+type compiledRule struct {
+	allow      bool
+	types      map[string]bool
+	name, zone *regexp.Regexp
+}
+
+// PolicyError is returned for a record the Policy or the ManagedSuffix of
+// the provider doesn't allow to change. Nothing was changed when it is
+// returned.
+type PolicyError struct {
+	Zone string
+	// Op is "write" or "delete".
+	Op     string
+	Record libdns.RR
+	// Suffix is set if the record is outside the ManagedSuffix.
+	Suffix string
+}
+
+func (e *PolicyError) Error() string {
+	verb := "writing"
+	if e.Op == "delete" {
+		verb = "deleting"
+	}
+	if e.Suffix != "" {
+		return fmt.Sprintf("Refusing %s %s record %q in %s: it is outside the managed suffix %s", verb, e.Record.Type, e.Record.Name, e.Zone, e.Suffix)
+	}
+	return fmt.Sprintf("The policy doesn't allow %s %s record %q in %s", verb, e.Record.Type, e.Record.Name, e.Zone)
+}
+
+// Validate compiles the rules of the policy and returns the first error.
+func (pol *Policy) Validate() error {
+	pol.once.Do(func() {
+		pol.compiled, pol.err = pol.compile()
+	})
+	return pol.err
+}
+
+func (pol *Policy) compile() ([]compiledRule, error) {
+	switch pol.Default {
+	case "", "allow", "deny":
+	default:
+		return nil, fmt.Errorf("Invalid default policy action %q, expected allow or deny", pol.Default)
+	}
+	rules := make([]compiledRule, len(pol.Rules))
+	for i, r := range pol.Rules {
+		switch r.Action {
+		case "allow", "deny":
+		default:
+			return nil, fmt.Errorf("Policy rule %d: invalid action %q, expected allow or deny", i+1, r.Action)
+		}
+		c := compiledRule{allow: r.Action == "allow"}
+		if len(r.Types) > 0 {
+			c.types = map[string]bool{}
+			for _, t := range r.Types {
+				c.types[strings.ToUpper(t)] = true
+			}
+		}
+		var err error
+		if c.name, err = anchored(r.Name); err != nil {
+			return nil, fmt.Errorf("Policy rule %d: name: %v", i+1, err)
+		}
+		if c.zone, err = anchored(r.Zone); err != nil {
+			return nil, fmt.Errorf("Policy rule %d: zone: %v", i+1, err)
+		}
+		rules[i] = c
+	}
+	return rules, nil
+}
+
+// anchored compiles a regular expression matching whole strings
+// case-insensitively, or returns nil for an empty one.
+func anchored(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)^(?:" + expr + ")$")
+}
+
+// Allows reports whether the policy allows changing rr in zone.
+func (pol *Policy) Allows(zone string, rr libdns.RR) (bool, error) {
+	if err := pol.Validate(); err != nil {
+		return false, err
+	}
+	zone = strings.TrimSuffix(zone, ".")
+	name := rr.Name
+	if name == "" {
+		name = "@"
+	}
+	typ := strings.ToUpper(rr.Type)
+	for _, r := range pol.compiled {
+		if r.types != nil && !r.types[typ] {
+			continue
+		}
+		if r.name != nil && !r.name.MatchString(name) {
+			continue
+		}
+		if r.zone != nil && !r.zone.MatchString(zone) {
+			continue
+		}
+		return r.allow, nil
+	}
+	return pol.Default == "allow", nil
+}
+
+// checkPolicy returns an error for the first of recs the policy or the
+// managed suffix of the provider doesn't allow to write or delete.
+func (p *Provider) checkPolicy(zone, op string, recs []libdns.Record) error {
+	if p.Policy == nil && p.ManagedSuffix == "" {
+		return nil
+	}
+	zone = strings.TrimSuffix(zone, ".")
+	for _, r := range recs {
+		rr := r.RR()
+		if p.ManagedSuffix != "" && !inSubtree(rr.Name, zone, p.ManagedSuffix) {
+			return &PolicyError{Zone: zone, Op: op, Record: rr, Suffix: p.ManagedSuffix}
+		}
+		if p.Policy == nil {
+			continue
+		}
+		ok, err := p.Policy.Allows(zone, rr)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &PolicyError{Zone: zone, Op: op, Record: rr}
+		}
+	}
+	return nil
+}
+
+// inSubtree reports whether the record named name in zone is at or below
+// the domain suffix, e.g. ".k8s.example.dynv6.net".
+func inSubtree(name, zone, suffix string) bool {
+	fqdn := strings.ToLower(libdns.AbsoluteName(name, zone))
+	suffix = strings.ToLower(strings.Trim(suffix, "."))
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	return fqdn == suffix || strings.HasSuffix(fqdn, "."+suffix)
+}
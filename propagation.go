@@ -0,0 +1,232 @@
+package dynv6
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// propagationServer is the nameserver WaitForPropagation asks.
+var propagationServer = "ns1.dynv6.com:53"
+
+// Resolver answers the DNS queries of propagation checks.
+type Resolver interface {
+	Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+}
+
+// DNSResolver queries a nameserver, given as host:port, over UDP and
+// retries over TCP if the answer is truncated.
+type DNSResolver string
+
+// Exchange implements Resolver.
+func (r DNSResolver) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	c := &dns.Client{Timeout: 5 * time.Second}
+	resp, _, err := c.ExchangeContext(ctx, m, string(r))
+	if err == nil && resp.Truncated {
+		c.Net = "tcp"
+		resp, _, err = c.ExchangeContext(ctx, m, string(r))
+	}
+	return resp, err
+}
+
+// DoHResolver queries a DNS-over-HTTPS resolver (RFC 8484), for networks
+// which block outbound port 53.
+type DoHResolver struct {
+	// URL of the resolver, e.g. https://cloudflare-dns.com/dns-query.
+	URL string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (r DoHResolver) String() string { return r.URL }
+
+// Exchange implements Resolver.
+func (r DoHResolver) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	q := m.Copy()
+	// RFC 8484 recommends ID 0, which makes answers cacheable
+	q.Id = 0
+	b, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", r.URL, resp.Status)
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+	answer := new(dns.Msg)
+	if err := answer.Unpack(body); err != nil {
+		return nil, fmt.Errorf("%s: %v", r.URL, err)
+	}
+	answer.Id = m.Id
+	return answer, nil
+}
+
+// ParseResolver parses a resolver: an https:// URL is a DoHResolver,
+// anything else a nameserver for DNSResolver, with port 53 by default.
+func ParseResolver(s string) Resolver {
+	if strings.HasPrefix(s, "https://") {
+		return DoHResolver{URL: s}
+	}
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		s = net.JoinHostPort(strings.Trim(s, "[]"), "53")
+	}
+	return DNSResolver(s)
+}
+
+// WaitForPropagation polls the dynv6 nameserver until it serves all records
+// in the zone or the timeout expires.
+func WaitForPropagation(ctx context.Context, zone string, recs []libdns.Record, timeout time.Duration) error {
+	return WaitForPropagationWith(ctx, []Resolver{DNSResolver(propagationServer)}, zone, recs, timeout)
+}
+
+// WaitForPropagationWith is WaitForPropagation asking the given resolvers
+// instead of the dynv6 nameserver. Every resolver must serve all records.
+func WaitForPropagationWith(ctx context.Context, resolvers []Resolver, zone string, recs []libdns.Record, timeout time.Duration) error {
+	return WaitForQuorum(ctx, resolvers, len(resolvers), zone, recs, timeout)
+}
+
+// WaitForQuorum polls the resolvers until at least quorum of them serve all
+// records in the zone or the timeout expires. Mixing the authoritative
+// nameservers with public recursive resolvers and requiring several of them
+// to agree avoids declaring records propagated because of a single cache.
+// A quorum of zero or more than the resolvers means all of them.
+func WaitForQuorum(ctx context.Context, resolvers []Resolver, quorum int, zone string, recs []libdns.Record, timeout time.Duration) error {
+	return waitForQuorum(ctx, dynv6api.SystemClock, dynv6api.SystemClock, resolvers, quorum, zone, recs, timeout)
+}
+
+func waitForQuorum(ctx context.Context, clock dynv6api.Clock, sleeper dynv6api.Sleeper, resolvers []Resolver, quorum int, zone string, recs []libdns.Record, timeout time.Duration) error {
+	if quorum <= 0 || quorum > len(resolvers) {
+		quorum = len(resolvers)
+	}
+	deadline := clock.Now().Add(timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	pending := make([][]libdns.Record, len(resolvers))
+	for i := range resolvers {
+		pending[i] = append([]libdns.Record(nil), recs...)
+	}
+	for {
+		var wg sync.WaitGroup
+		for i, resolver := range resolvers {
+			if len(pending[i]) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func(i int, resolver Resolver) {
+				defer wg.Done()
+				var missing []libdns.Record
+				for _, r := range pending[i] {
+					if !served(ctx, resolver, zone, r) {
+						missing = append(missing, r)
+					}
+				}
+				pending[i] = missing
+			}(i, resolver)
+		}
+		wg.Wait()
+		var behind []string
+		var missing libdns.RR
+		for i, resolver := range resolvers {
+			if len(pending[i]) > 0 {
+				behind = append(behind, fmt.Sprint(resolver))
+				missing = pending[i][0].RR()
+			}
+		}
+		agreed := len(resolvers) - len(behind)
+		if agreed >= quorum {
+			return nil
+		}
+		if !clock.Now().Before(deadline) || sleeper.Sleep(ctx, 2*time.Second) != nil {
+			if len(resolvers) == 1 {
+				return fmt.Errorf("%s record %q not served by %s within %s", missing.Type, missing.Name, behind[0], timeout)
+			}
+			return fmt.Errorf("%s record %q served by %d of %d resolvers within %s, %d required; not by %s", missing.Type, missing.Name, agreed, len(resolvers), timeout, quorum, strings.Join(behind, ", "))
+		}
+	}
+}
+
+// waitForPropagation waits with the PropagationResolvers and
+// PropagationQuorum of the provider.
+func (p *Provider) waitForPropagation(ctx context.Context, zone string, recs []libdns.Record, timeout time.Duration) error {
+	resolvers := []Resolver{DNSResolver(propagationServer)}
+	if len(p.PropagationResolvers) > 0 {
+		resolvers = resolvers[:0]
+		for _, s := range p.PropagationResolvers {
+			resolvers = append(resolvers, ParseResolver(s))
+		}
+	}
+	return waitForQuorum(ctx, p.clock(), p.sleeper(), resolvers, p.PropagationQuorum, zone, recs, timeout)
+}
+
+// Served reports whether the resolver answers with the data of r in zone,
+// the check WaitForPropagation repeats until it succeeds. A nil resolver
+// asks the dynv6 nameserver.
+func Served(ctx context.Context, resolver Resolver, zone string, r libdns.Record) bool {
+	if resolver == nil {
+		resolver = DNSResolver(propagationServer)
+	}
+	return served(ctx, resolver, zone, r)
+}
+
+// served reports whether the resolver answers with the data of r.
+func served(ctx context.Context, resolver Resolver, zone string, r libdns.Record) bool {
+	rr := r.RR()
+	qtype, ok := dns.StringToType[strings.ToUpper(rr.Type)]
+	if !ok {
+		// nothing to compare with, assume it is served
+		return true
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(libdns.AbsoluteName(rr.Name, dns.Fqdn(zone)), qtype)
+	resp, err := resolver.Exchange(ctx, m)
+	if err != nil {
+		return false
+	}
+	want := normalizeData(rr.Type, rr.Data)
+	for _, ans := range resp.Answer {
+		if ans.Header().Rrtype != qtype {
+			continue
+		}
+		if normalizeData(rr.Type, answerData(ans)) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// answerData returns the data of a DNS answer in the presentation format
+// used by libdns.RR.
+func answerData(ans dns.RR) string {
+	if txt, ok := ans.(*dns.TXT); ok {
+		return strings.Join(txt.Txt, "")
+	}
+	return strings.TrimPrefix(ans.String(), ans.Header().String())
+}
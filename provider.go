@@ -2,9 +2,13 @@ package dynv6
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"sync"
 	"time"
 
+	"github.com/libdns/dynv6/dynv6api"
 	"github.com/libdns/libdns"
 )
 
@@ -13,147 +17,498 @@ type Provider struct {
 	// Token is required for authorization.
 	// You can generate one at: https://dynv6.com/keys
 	Token string `json:"token,omitempty"`
-}
 
-// interne dynv6-Record-Struktur (vereinfacht)
-type record struct {
-	ID   int64         `json:"id,omitempty"`
-	Name string        `json:"name,omitempty"`
-	Type string        `json:"type,omitempty"`
-	Data string        `json:"data,omitempty"`
-	TTL  time.Duration `json:"ttl,omitempty"`
+	// BaseURL of the dynv6 REST API. Defaults to dynv6api.DefaultBaseURL.
+	BaseURL string `json:"base_url,omitempty"`
+
+	// APIVersion is the version of the dynv6 REST API used with the default
+	// base URL, see dynv6api.Client.Version.
+	APIVersion string `json:"api_version,omitempty"`
+
+	// TTL is reported for the records read from dynv6, which doesn't store
+	// TTLs. If zero, the TTL of those records is left unset.
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// Middleware intercepts every HTTP call to the dynv6 API, e.g. for
+	// logging (see dynv6api.Logging) or metrics. It must be set before the
+	// provider is first used.
+	Middleware []dynv6api.Middleware `json:"-"`
+
+	// Transport tunes connection reuse and HTTP/2, e.g. a higher
+	// MaxIdleConnsPerHost for bulk changes or DisableKeepAlives for
+	// constrained devices. It must be set before the provider is first used.
+	Transport dynv6api.TransportOptions `json:"transport,omitempty"`
+
+	// RetryPolicy decides which failed API requests are repeated. Defaults
+	// to dynv6api.DefaultRetryPolicy.
+	RetryPolicy dynv6api.RetryPolicy `json:"-"`
+
+	// RetryBudget caps the retries of all API requests made by a single
+	// AppendRecords, SetRecords, DeleteRecords or Sync call. Defaults to 10;
+	// a negative value removes the cap.
+	RetryBudget int `json:"retry_budget,omitempty"`
+
+	// HedgeDelay enables hedged reads: if a zone lookup or record listing
+	// hasn't been answered after this delay, a second request is sent and
+	// the first answer is used. See dynv6api.Hedge.
+	HedgeDelay time.Duration `json:"hedge_delay,omitempty"`
+
+	// OnRateLimit, if set, is called with the request quota whenever the
+	// API reports it. See dynv6api.Client.OnRateLimit.
+	OnRateLimit func(dynv6api.RateLimit) `json:"-"`
+
+	// Clock and Sleeper are used for retries, rate limiting, cache expiry
+	// and propagation waits. They default to dynv6api.SystemClock; tests
+	// set fakes to run them instantly.
+	Clock   dynv6api.Clock   `json:"-"`
+	Sleeper dynv6api.Sleeper `json:"-"`
+
+	// RateLimitReserve is the remaining quota below which requests are
+	// spaced out until the quota resets. Defaults to 5, negative disables.
+	RateLimitReserve int `json:"rate_limit_reserve,omitempty"`
+
+	// Logger receives warnings, e.g. about records that were converted
+	// before writing them. If nil, warnings are discarded.
+	Logger *log.Logger `json:"-"`
+
+	// OnWarning, if set, is called with every warning, e.g. about challenge
+	// records with TTLs long enough to break ACME validation. Warnings are
+	// also written to Logger.
+	OnWarning func(Warning) `json:"-"`
+
+	// SPFMode controls how records with the legacy SPF type are written:
+	// SPFConvert (the default) writes them as TXT records, SPFKeep writes
+	// them as SPF records and SPFMirror writes both.
+	SPFMode string `json:"spf_mode,omitempty"`
+
+	// ZoneCacheTTL is how long zone lookups are cached. Defaults to one
+	// hour; a negative value disables the cache. A zone the API answers
+	// with 404 for is dropped from the cache, so a zone which was deleted
+	// and created again fails only one call.
+	ZoneCacheTTL time.Duration `json:"zone_cache_ttl,omitempty"`
+
+	// RecordCacheTTL is how long record listings are cached. Record caching
+	// is disabled by default. Changes made through the provider invalidate
+	// the cached records of the zone.
+	RecordCacheTTL time.Duration `json:"record_cache_ttl,omitempty"`
+
+	// SharedCache makes all providers in the process with the same token
+	// share their cached zones and records, e.g. when Caddy creates a
+	// provider per site. Cache lifetimes are those of the provider which
+	// stored an entry.
+	SharedCache bool `json:"shared_cache,omitempty"`
+
+	// Matcher decides which existing records SetRecords and DeleteRecords
+	// refer to. Defaults to MatchExact.
+	Matcher Matcher `json:"-"`
+
+	// IncludeManaged makes GetRecords include the apex NS and SOA records
+	// dynv6 manages for the zone. They are read-only, see IsReadOnly.
+	IncludeManaged bool `json:"include_managed,omitempty"`
+
+	// AllowDangerous allows DeleteRecords to delete the NS and SOA records
+	// at the apex, which can take the zone offline.
+	AllowDangerous bool `json:"allow_dangerous,omitempty"`
+
+	// Policy restricts the records the provider may write and delete by
+	// name and type, e.g. to ACME challenges. Nil allows all records.
+	Policy *Policy `json:"policy,omitempty"`
+
+	// ManagedSuffix confines writes and deletes to a subtree of the zone,
+	// e.g. ".k8s.example.dynv6.net" for a cluster controller sharing a
+	// personal zone. Changing records outside it fails with a PolicyError.
+	ManagedSuffix string `json:"managed_suffix,omitempty"`
+
+	// PropagationResolvers are asked by the PropagationTimeout option
+	// whether written records are served, instead of the dynv6 nameserver.
+	// Each is a nameserver as host[:port] or the https:// URL of a
+	// DNS-over-HTTPS resolver, see ParseResolver.
+	PropagationResolvers []string `json:"propagation_resolvers,omitempty"`
+
+	// PropagationQuorum is how many of the PropagationResolvers must serve
+	// the written records. Defaults to all of them.
+	PropagationQuorum int `json:"propagation_quorum,omitempty"`
+
+	// OperationTimeout limits how long a call may take if its context has
+	// no deadline. Defaults to 30 seconds; a negative value disables it.
+	OperationTimeout time.Duration `json:"operation_timeout,omitempty"`
+
+	// StrictDecoding makes API responses with fields the client doesn't
+	// know fail, see dynv6api.Client.StrictDecoding. Otherwise they are
+	// reported once by a WarnUnknownFields warning.
+	StrictDecoding bool `json:"strict_decoding,omitempty"`
+
+	mu    sync.Mutex
+	api   *dynv6api.Client
+	stats providerStats
+	cache cache
+
+	// shadow holds the records GetRecordChanges last returned
+	shadow shadowCopy
+
+	// unknownFields holds the unknown fields already warned about
+	unknownFields sync.Map
 }
 
-// Helpfunction: extracts .Data from the libdns.Record
-func getDataFromRecord(r libdns.Record) string {
-	if rr, ok := r.(libdns.RR); ok {
-		return rr.Data
+const defaultOperationTimeout = 30 * time.Second
+
+// withDeadline applies the OperationTimeout to ctx if it has no deadline.
+// Waiting for propagation extends the timeout.
+func (p *Provider) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := p.OperationTimeout
+	if timeout == 0 {
+		timeout = defaultOperationTimeout
+	}
+	if _, ok := ctx.Deadline(); ok || timeout < 0 {
+		return ctx, func() {}
 	}
-	return ""
+	return context.WithTimeout(ctx, timeout+optionsFrom(ctx).propagation)
 }
 
-// Converts a intern dynv6-Record to libdns.RR
-func (r *record) toLibdnsRecord() libdns.Record {
-	return libdns.RR{
-		Name: r.Name,
-		Type: r.Type,
-		Data: r.Data,
-		TTL:  r.TTL,
+const defaultRetryBudget = 10
+
+// withRetryBudget gives the requests made with ctx a shared retry budget,
+// unless it already has one.
+func (p *Provider) withRetryBudget(ctx context.Context) context.Context {
+	n := p.RetryBudget
+	if n == 0 {
+		n = defaultRetryBudget
+	}
+	if n < 0 || dynv6api.RetryBudgetFrom(ctx) != nil {
+		return ctx
 	}
+	return dynv6api.WithRetryBudget(ctx, dynv6api.NewRetryBudget(n))
 }
 
-// Creates a dynv6-Record from the libdns.Record
-func fromLibdnsRecord(zone string, r *libdns.Record) (*record, error) {
-	if rr, ok := (*r).(libdns.RR); ok {
-		return &record{
-			Name: rr.Name,
-			Type: rr.Type,
-			Data: rr.Data,
-			TTL:  rr.TTL,
-		}, nil
-	}
-	return nil, fmt.Errorf("unsupported record type: %T", *r)
+// GetRecords lists all the records in the zone, sorted by CompareRecords.
+func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	zoneDetails, err := p.zone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	dynv6Records, err := p.records(ctx, zoneDetails.ID)
+	if err != nil {
+		return nil, err
+	}
+	var managed []libdns.Record
+	if p.IncludeManaged {
+		managed = managedRecords(zoneDetails)
+	}
+	recs := make([]libdns.Record, 0, len(dynv6Records)+len(managed))
+	for i := range dynv6Records {
+		recs = append(recs, withTTL(toLibdnsRecord(&dynv6Records[i]), p.TTL))
+	}
+	recs = append(recs, managed...)
+	SortRecords(recs)
+	return recs, nil
 }
 
-// GetRecords lists all the records in the zone.
-func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
-	zoneDetails, err := p.getZoneByName(ctx, zone)
+// GetRecordsByNameAndType lists the records in the zone with the given name
+// and type, sorted by CompareRecords. An empty name or type matches any
+// value. dynv6 can't filter listings, so the zone is listed and filtered
+// client-side; combine it with RecordCacheTTL to avoid repeated listings.
+func (p *Provider) GetRecordsByNameAndType(ctx context.Context, zone, name, typ string) ([]libdns.Record, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	zoneDetails, err := p.zone(ctx, zone)
 	if err != nil {
 		return nil, err
 	}
-	dynv6Records, err := p.getRecords(ctx, zoneDetails.ID)
+	dynv6Records, err := p.records(ctx, zoneDetails.ID)
 	if err != nil {
 		return nil, err
 	}
 	var recs []libdns.Record
-	for _, r := range dynv6Records {
-		recs = append(recs, r.toLibdnsRecord())
+	f := dynv6api.RecordFilter{Name: name, Type: typ}
+	filtered := dynv6api.FilterRecords(dynv6Records, f)
+	for i := range filtered {
+		recs = append(recs, withTTL(toLibdnsRecord(&filtered[i]), p.TTL))
 	}
+	if p.IncludeManaged {
+		for _, r := range managedRecords(zoneDetails) {
+			rr := r.RR()
+			if f.Match(dynv6api.Record{Name: rr.Name, Type: rr.Type}) {
+				recs = append(recs, r)
+			}
+		}
+	}
+	SortRecords(recs)
 	return recs, nil
 }
 
 // AppendRecords adds records to the zone and returns the records that were created.
 func (p *Provider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
-	zoneDetails, err := p.getZoneByName(ctx, zone)
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	ctx = p.withRetryBudget(ctx)
+	opts := optionsFrom(ctx)
+	zoneDetails, err := p.zone(ctx, zone)
 	if err != nil {
 		return nil, err
 	}
-	results := []libdns.Record{}
-	for _, r := range recs {
-		dynv6Rec, err := fromLibdnsRecord(zone, &r)
+	defer p.invalidateRecords(zoneDetails.ID)
+	recs = p.mapSPF(zone, recs)
+	if err := p.checkPolicy(zone, "write", recs); err != nil {
+		return nil, err
+	}
+	p.checkTTLs(zone, recs)
+	dynv6Recs := make([]*dynv6api.Record, len(recs))
+	for i := range recs {
+		dynv6Recs[i], err = fromLibdnsRecord(zone, &recs[i])
 		if err != nil {
-			return results, err
+			return []libdns.Record{}, err
+		}
+	}
+	created := make([]*dynv6api.Record, len(recs))
+	err = opts.each(len(recs), func(i int) error {
+		if opts.dryRun {
+			created[i] = dynv6Recs[i]
+			return nil
 		}
-		result, err := p.addRecord(ctx, zoneDetails.ID, dynv6Rec)
+		result, err := p.client().CreateRecord(ctx, zoneDetails.ID, *dynv6Recs[i])
 		if err != nil {
-			return results, err
+			return writeError(dynv6Recs[i], err)
+		}
+		created[i] = result
+		return nil
+	})
+	results := []libdns.Record{}
+	for _, r := range created {
+		if r != nil {
+			results = append(results, toLibdnsRecord(r))
 		}
-		results = append(results, result.toLibdnsRecord())
 	}
-	return results, nil
+	if err == nil && opts.verify && !opts.dryRun {
+		err = p.verify(ctx, zone, zoneDetails.ID, recs, false)
+	}
+	if err == nil && opts.propagation > 0 && !opts.dryRun {
+		err = p.waitForPropagation(ctx, zone, results, opts.propagation)
+	}
+	return results, err
 }
 
-// SetRecords sets the records in the zone, either by updating existing records or creating new ones, and returns the records that were updated.
+// SetRecords sets the records in the zone and returns the records that were set.
+// Every RRset in recs replaces the existing RRset with the same name and type,
+// records of the existing RRset are updated in place where possible.
 func (p *Provider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
-	zoneDetails, err := p.getZoneByName(ctx, zone)
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	ctx = p.withRetryBudget(ctx)
+	opts := optionsFrom(ctx)
+	zoneDetails, err := p.zone(ctx, zone)
 	if err != nil {
 		return nil, err
 	}
-	existingRecords, err := p.getRecords(ctx, zoneDetails.ID)
+	defer p.invalidateRecords(zoneDetails.ID)
+	existingRecords, err := p.records(ctx, zoneDetails.ID)
 	if err != nil {
 		return nil, err
 	}
+	recs = p.mapSPF(zone, recs)
+	if err := p.checkPolicy(zone, "write", recs); err != nil {
+		return nil, err
+	}
+	p.checkTTLs(zone, recs)
+	m := p.matcher(ctx)
 	results := []libdns.Record{}
-	for _, r := range recs {
-		existingRecord := findRecord(existingRecords, &r)
-		var result *record
-		if existingRecord != nil {
-			// record found, update it
-			updateRecord := *existingRecord
-			updateRecord.Data = getDataFromRecord(r)
-			result, err = p.updateRecord(ctx, zoneDetails.ID, &updateRecord)
-			if err != nil {
-				return results, err
+	used := map[int64]bool{}
+	for _, set := range GroupRRSets(recs) {
+		var existing []dynv6api.Record
+		for _, e := range existingRecords {
+			if keyOf(toLibdnsRecord(&e).RR()) == set.key() {
+				existing = append(existing, e)
 			}
-		} else {
-			// no record found, add a new one
-			newRecord, err := fromLibdnsRecord(zone, &r)
+		}
+		// records which the matcher pairs with an existing record are
+		// updated in place, the others take over stale records of the set
+		var missing []libdns.Record
+		updates := map[int64]libdns.Record{}
+		for _, r := range set.Records {
+			existingRecord := findExisting(m, existing, r, used)
+			if existingRecord == nil {
+				missing = append(missing, r)
+				continue
+			}
+			used[existingRecord.ID] = true
+			if CompareRecords(toLibdnsRecord(existingRecord), r) == 0 {
+				results = append(results, toLibdnsRecord(existingRecord))
+				continue
+			}
+			updates[existingRecord.ID] = r
+		}
+		var stale []dynv6api.Record
+		for _, e := range existing {
+			if !used[e.ID] {
+				stale = append(stale, e)
+			}
+		}
+		for _, r := range missing {
+			if len(stale) == 0 {
+				newRecord, err := fromLibdnsRecord(zone, &r)
+				if err != nil {
+					return results, err
+				}
+				result := newRecord
+				if !opts.dryRun {
+					result, err = p.client().CreateRecord(ctx, zoneDetails.ID, *newRecord)
+					if err != nil {
+						return results, writeError(newRecord, err)
+					}
+				}
+				results = append(results, toLibdnsRecord(result))
+				continue
+			}
+			used[stale[0].ID] = true
+			updates[stale[0].ID] = r
+			stale = stale[1:]
+		}
+		for _, e := range existing {
+			r, ok := updates[e.ID]
+			if !ok {
+				continue
+			}
+			updateRecord, err := fromLibdnsRecord(zone, &r)
 			if err != nil {
 				return results, err
 			}
-			result, err = p.addRecord(ctx, zoneDetails.ID, newRecord)
-			if err != nil {
+			result := updateRecord
+			if !opts.dryRun {
+				result, err = p.client().UpdateRecord(ctx, zoneDetails.ID, e.ID, *updateRecord)
+				if errors.Is(err, dynv6api.ErrRecordNotFound) {
+					// the record was deleted in the meantime
+					result, err = p.client().CreateRecord(ctx, zoneDetails.ID, *updateRecord)
+				}
+				if err != nil {
+					return results, writeError(updateRecord, err)
+				}
+			}
+			results = append(results, toLibdnsRecord(result))
+		}
+		if opts.dryRun {
+			continue
+		}
+		for _, e := range stale {
+			err := p.client().DeleteRecord(ctx, zoneDetails.ID, e.ID)
+			if err != nil && !errors.Is(err, dynv6api.ErrRecordNotFound) {
 				return results, err
 			}
 		}
-		results = append(results, result.toLibdnsRecord())
 	}
-	return results, nil
+	if opts.verify && !opts.dryRun {
+		if err := p.verify(ctx, zone, zoneDetails.ID, recs, true); err != nil {
+			return results, err
+		}
+	}
+	if opts.propagation > 0 && !opts.dryRun {
+		err = p.waitForPropagation(ctx, zone, results, opts.propagation)
+	}
+	return results, err
 }
 
 // DeleteRecords deletes records from the zone and returns the records that were deleted.
 func (p *Provider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
-	zoneDetails, err := p.getZoneByName(ctx, zone)
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	ctx = p.withRetryBudget(ctx)
+	if err := p.checkDeletes(recs); err != nil {
+		return nil, err
+	}
+	opts := optionsFrom(ctx)
+	zoneDetails, err := p.zone(ctx, zone)
 	if err != nil {
 		return nil, err
 	}
-	existingRecords, err := p.getRecords(ctx, zoneDetails.ID)
+	defer p.invalidateRecords(zoneDetails.ID)
+	existingRecords, err := p.records(ctx, zoneDetails.ID)
 	if err != nil {
 		return nil, err
 	}
-	results := []libdns.Record{}
+	m := p.matcher(ctx)
+	used := map[int64]bool{}
+	var toDelete []*dynv6api.Record
+	var notFound error
 	for _, r := range recs {
-		existingRecord := findRecordWithValue(existingRecords, &r)
+		existingRecord := findExisting(m, existingRecords, r, used)
 		if existingRecord == nil {
-			return results, fmt.Errorf("Record not found: %+v", r)
+			notFound = fmt.Errorf("Record not found: %+v", r)
+			break
 		}
-		err = p.deleteRecord(ctx, zoneDetails.ID, existingRecord.ID)
-		if err != nil {
-			return results, err
+		used[existingRecord.ID] = true
+		toDelete = append(toDelete, existingRecord)
+	}
+	for _, r := range toDelete {
+		if err := p.checkPolicy(zone, "delete", []libdns.Record{toLibdnsRecord(r)}); err != nil {
+			return nil, err
+		}
+	}
+	deleted := make([]bool, len(toDelete))
+	err = opts.each(len(toDelete), func(i int) error {
+		if !opts.dryRun {
+			if err := p.client().DeleteRecord(ctx, zoneDetails.ID, toDelete[i].ID); err != nil {
+				return err
+			}
+		}
+		deleted[i] = true
+		return nil
+	})
+	results := []libdns.Record{}
+	for i, ok := range deleted {
+		if ok {
+			results = append(results, recs[i])
 		}
-		results = append(results, r)
 	}
-	return results, nil
+	if err == nil {
+		err = notFound
+	}
+	return results, err
+}
+
+// GetZoneInfo returns the dynv6 metadata of the zone, such as its ID, apex
+// addresses and timestamps. It always asks the API, so the result is current.
+func (p *Provider) GetZoneInfo(ctx context.Context, zone string) (*dynv6api.Zone, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	z, err := p.client().GetZoneByName(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	p.storeZones(*z)
+	return z, nil
+}
+
+// Detect confirms that the configured version of the dynv6 API responds
+// as expected, see dynv6api.Client.Detect.
+func (p *Provider) Detect(ctx context.Context) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	return p.client().Detect(ctx)
+}
+
+// ListZones lists all the zones of the account.
+func (p *Provider) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	dynv6Zones, err := p.client().ListZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zones := make([]libdns.Zone, 0, len(dynv6Zones))
+	for _, z := range dynv6Zones {
+		zones = append(zones, libdns.Zone{Name: z.Name + "."})
+	}
+	return zones, nil
+}
+
+// Interface is the set of libdns interfaces implemented by Provider.
+// Accept it instead of *Provider to be able to substitute fakes in tests.
+type Interface interface {
+	libdns.RecordGetter
+	libdns.RecordAppender
+	libdns.RecordSetter
+	libdns.RecordDeleter
+	libdns.ZoneLister
 }
 
 // Interface guards
@@ -162,4 +517,6 @@ var (
 	_ libdns.RecordAppender = (*Provider)(nil)
 	_ libdns.RecordSetter   = (*Provider)(nil)
 	_ libdns.RecordDeleter  = (*Provider)(nil)
+	_ libdns.ZoneLister     = (*Provider)(nil)
+	_ Interface             = (*Provider)(nil)
 )
@@ -0,0 +1,2087 @@
+package dynv6
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/dynv6/testutil"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// newFakeProvider returns a provider talking to a new fake API.
+func newFakeProvider(t testing.TB) (*Provider, *testutil.API) {
+	api, url := testutil.NewServer(t)
+	p := &Provider{Token: "test"}
+	p.api = &dynv6api.Client{Token: p.Token, BaseURL: url}
+	return p, api
+}
+
+func TestZoneCache(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	for i := 0; i < 3; i++ {
+		if _, err := p.GetRecords(ctx, "example.dynv6.net."); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := api.CallCount("GET /zones/by-name/example.dynv6.net"); n != 1 {
+		t.Fatalf("zone looked up %d times, want 1", n)
+	}
+	if st := p.Stats(); st.CacheHits != 2 || st.CacheMisses != 1 {
+		t.Fatalf("unexpected cache stats %+v", st)
+	}
+}
+
+func TestZoneCacheEviction(t *testing.T) {
+	api, url := testutil.NewServer(t)
+	api.Seed(testutil.NewZoneFixture("example.dynv6.net").WithID(1).WithA("www", "192.0.2.1"))
+	p := &Provider{Token: "test", BaseURL: url}
+	if _, err := p.GetRecords(ctx, "example.dynv6.net"); err != nil {
+		t.Fatal(err)
+	}
+	// the zone is deleted and created again with a new ID
+	api.Lock()
+	api.Zones[0].ID = 2
+	api.Records[2], api.Records[1] = api.Records[1], nil
+	api.Unlock()
+	if _, err := p.GetRecords(ctx, "example.dynv6.net"); !errors.Is(err, dynv6api.ErrZoneNotFound) {
+		t.Fatalf("got %v, want ErrZoneNotFound for the cached ID", err)
+	}
+	recs, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("got %v, %v after the eviction", recs, err)
+	}
+	if n := api.CallCount("GET /zones/by-name/example.dynv6.net"); n != 2 {
+		t.Fatalf("zone looked up %d times, want 2", n)
+	}
+}
+
+func TestPrewarmZones(t *testing.T) {
+	p, api := newFakeProvider(t)
+	p.RecordCacheTTL = time.Minute
+	api.AddZone(1, "example.dynv6.net")
+	api.AddZone(2, "other.dynv6.net")
+	if err := p.PrewarmZones(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GetRecords(ctx, "other.dynv6.net"); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.CallCount("GET /zones/by-name/other.dynv6.net"); n != 0 {
+		t.Fatalf("zone looked up %d times after prewarming", n)
+	}
+	if n := api.CallCount("GET /zones/2/records"); n != 1 {
+		t.Fatalf("records listed %d times, want 1", n)
+	}
+
+	// writes invalidate the cached records
+	if _, err := p.AppendRecords(ctx, "other.dynv6.net", []libdns.Record{libdns.TXT{Name: "test", Text: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := p.GetRecords(ctx, "other.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("got %d records after append, want 1", len(recs))
+	}
+}
+
+func TestSPFMode(t *testing.T) {
+	tests := []struct {
+		typ   string
+		mode  string
+		types []string
+	}{
+		{"SPF", "", []string{"TXT"}},
+		{"SPF", SPFKeep, []string{"SPF"}},
+		{"SPF", SPFMirror, []string{"SPF", "TXT"}},
+		{"spf", "", []string{"TXT"}},
+		{"spf", SPFMirror, []string{"spf", "TXT"}},
+	}
+	for _, test := range tests {
+		spf := libdns.RR{Name: "@", Type: test.typ, Data: "v=spf1 -all"}
+		p, api := newFakeProvider(t)
+		p.SPFMode = test.mode
+		api.AddZone(1, "example.dynv6.net")
+		results, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{spf})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var types []string
+		for _, r := range api.Records[1] {
+			types = append(types, r.Type)
+			if r.Data != spf.Data {
+				t.Errorf("%s, mode %q: unexpected data %q", test.typ, test.mode, r.Data)
+			}
+		}
+		if strings.Join(types, ",") != strings.Join(test.types, ",") || len(results) != len(test.types) {
+			t.Errorf("%s, mode %q: wrote %v, want %v", test.typ, test.mode, types, test.types)
+		}
+	}
+}
+
+func TestGetZoneInfo(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.Zones = append(api.Zones, dynv6api.Zone{ID: 7, Name: "example.dynv6.net", IPv4Address: "192.0.2.1"})
+	z, err := p.GetZoneInfo(ctx, "example.dynv6.net.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.ID != 7 || z.IPv4Address != "192.0.2.1" {
+		t.Fatalf("unexpected zone %+v", z)
+	}
+}
+
+func TestSortRecords(t *testing.T) {
+	recs := []libdns.Record{
+		libdns.TXT{Name: "www", Text: "b"},
+		libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"},
+		libdns.TXT{Name: "www", Text: "a"},
+		libdns.RR{Name: "api", Type: "AAAA", Data: "2001:db8::1"},
+	}
+	SortRecords(recs)
+	var got []string
+	for _, r := range recs {
+		rr := r.RR()
+		got = append(got, rr.Name+" "+rr.Type+" "+rr.Data)
+	}
+	want := "api AAAA 2001:db8::1,www A 192.0.2.1,www TXT a,www TXT b"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("got %v, want %s", got, want)
+	}
+}
+
+func TestToLibdnsRecord(t *testing.T) {
+	tests := []struct {
+		rec  dynv6api.Record
+		want libdns.Record
+	}{
+		{dynv6api.Record{Name: "www", Type: "A", Data: "192.0.2.1"}, libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")}},
+		{dynv6api.Record{Name: "txt", Type: "TXT", Data: "hello"}, libdns.TXT{Name: "txt", Text: "hello"}},
+		{dynv6api.Record{Name: "alias", Type: "CNAME", Data: "www"}, libdns.CNAME{Name: "alias", Target: "www"}},
+	}
+	for _, test := range tests {
+		got := toLibdnsRecord(&test.rec)
+		if got != test.want {
+			t.Errorf("toLibdnsRecord(%+v) = %#v, want %#v", test.rec, got, test.want)
+		}
+	}
+
+	// unknown types and unparsable data are passed through
+	for _, rec := range []dynv6api.Record{
+		{ID: 3, Name: "svc", Type: "FUTURE", Data: "opaque data"},
+		{ID: 4, Name: "bad", Type: "A", Data: "not an address"},
+	} {
+		raw, ok := toLibdnsRecord(&rec).(RawRecord)
+		if !ok {
+			t.Fatalf("%+v was not returned as RawRecord", rec)
+		}
+		if raw.Type != rec.Type || raw.Data != rec.Data || raw.ProviderData.(dynv6api.Record).ID != rec.ID {
+			t.Errorf("unexpected raw record %+v", raw)
+		}
+		back, err := fromLibdnsRecord("example.dynv6.net", &[]libdns.Record{raw}[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back.Type != rec.Type || back.Data != rec.Data || back.Name != rec.Name {
+			t.Errorf("raw record not written verbatim: %+v", back)
+		}
+	}
+}
+
+func TestUnsupportedType(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	for _, rec := range []libdns.Record{
+		libdns.RR{Name: "@", Type: "SOA", Data: "ns1.dynv6.com. hostmaster.dynv6.net. 1 3600 600 86400 60"},
+		libdns.NS{Name: "sub", Target: "ns.example.org."},
+		RawRecord{Name: "host", Type: "HINFO", Data: "PC Linux"},
+	} {
+		_, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{rec})
+		var typeErr *UnsupportedTypeError
+		if !errors.As(err, &typeErr) {
+			t.Fatalf("%+v: got error %v, want UnsupportedTypeError", rec, err)
+		}
+		if typeErr.Type != rec.RR().Type || len(typeErr.Supported) == 0 {
+			t.Errorf("unexpected error %+v", typeErr)
+		}
+	}
+	if n := api.CallCount("POST /zones/1/records"); n != 1 {
+		t.Fatalf("API called %d times, want 1 for the unknown type only", n)
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	a, err := NewA("", "192.0.2.1")
+	if err != nil || a.Name != "@" || a.TTL != DefaultTTL || a.RR().Data != "192.0.2.1" {
+		t.Fatalf("NewA: %+v, %v", a, err)
+	}
+	srv, err := NewSRV("_sip", "_TCP", "@", 10, 5, 5060, "sip.example.org.")
+	if err != nil || srv.RR().Name != "_sip._tcp" || srv.RR().Data != "10 5 5060 sip.example.org." {
+		t.Fatalf("NewSRV: %+v, %v", srv.RR(), err)
+	}
+	for name, err := range map[string]error{
+		"A with IPv6":     func() error { _, err := NewA("www", "2001:db8::1"); return err }(),
+		"AAAA with IPv4":  func() error { _, err := NewAAAA("www", "192.0.2.1"); return err }(),
+		"absolute name":   func() error { _, err := NewTXT("www.example.dynv6.net.", "x"); return err }(),
+		"empty TXT":       func() error { _, err := NewTXT("www", ""); return err }(),
+		"CNAME at apex":   func() error { _, err := NewCNAME("@", "www"); return err }(),
+		"MX no target":    func() error { _, err := NewMX("@", 10, ""); return err }(),
+		"SRV bad proto":   func() error { _, err := NewSRV("sip", "sctp", "@", 0, 0, 1, "x"); return err }(),
+		"CAA invalid tag": func() error { _, err := NewCAA("@", 0, "issuer", "letsencrypt.org"); return err }(),
+	} {
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRRSets(t *testing.T) {
+	sets := GroupRRSets([]libdns.Record{
+		libdns.TXT{Name: "www", Text: "b"},
+		libdns.RR{Name: "WWW", Type: "txt", Data: "a"},
+		libdns.TXT{Name: "www", Text: "a"},
+		libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"},
+	})
+	if len(sets) != 2 || sets[0].Type != "A" || len(sets[1].Records) != 2 {
+		t.Fatalf("unexpected sets %+v", sets)
+	}
+	other := RRSet{Name: "www", Type: "TXT", Records: []libdns.Record{libdns.TXT{Name: "www", Text: "b"}, libdns.TXT{Name: "www", Text: "a", TTL: time.Minute}}}
+	if !sets[1].Equal(other) {
+		t.Fatalf("%+v and %+v should be equal", sets[1], other)
+	}
+	other.Records = other.Records[:1]
+	if diff := sets[1].Difference(other); len(diff) != 1 || diff[0].RR().Data != "a" {
+		t.Fatalf("unexpected difference %+v", diff)
+	}
+	// the sets share one sorted copy, appending to one must not change the next
+	sets[0].Records = append(sets[0].Records, libdns.RR{Name: "www", Type: "A", Data: "192.0.2.2"})
+	if rr := sets[1].Records[0].RR(); !strings.EqualFold(rr.Type, "TXT") || rr.Data != "a" {
+		t.Fatalf("appending to a set changed the next one: %+v", sets[1])
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	current := []libdns.Record{
+		libdns.TXT{Name: "www", Text: "old"},
+		libdns.TXT{Name: "www", Text: "same"},
+		libdns.RR{Name: "manual", Type: "A", Data: "192.0.2.1"},
+	}
+	desired := []libdns.Record{
+		libdns.TXT{Name: "www", Text: "same"},
+		libdns.TXT{Name: "www", Text: "new"},
+	}
+	plan := PlanSync(current, desired, false)
+	if len(plan.Create) != 1 || plan.Create[0].RR().Data != "new" || len(plan.Delete) != 1 || plan.Delete[0].RR().Data != "old" {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	if plan := PlanSync(current, desired, true); len(plan.Delete) != 2 {
+		t.Fatalf("prune should delete the manual record, got %+v", plan)
+	}
+	if plan := PlanSync(desired, desired, true); !plan.Empty() {
+		t.Fatalf("expected an empty plan, got %+v", plan)
+	}
+}
+
+func TestSetRecordsReplacesRRSet(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	api.Records[1] = []dynv6api.Record{
+		{ID: 1, Name: "www", Type: "A", Data: "192.0.2.1"},
+		{ID: 2, Name: "www", Type: "A", Data: "192.0.2.2"},
+		{ID: 3, Name: "www", Type: "AAAA", Data: "2001:db8::1"},
+	}
+	api.NextID = 3
+	_, err := p.SetRecords(ctx, "example.dynv6.net", []libdns.Record{
+		libdns.RR{Name: "www", Type: "A", Data: "192.0.2.3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range api.Records[1] {
+		got = append(got, strconv.FormatInt(r.ID, 10)+" "+r.Type+" "+r.Data)
+	}
+	if want := "1 A 192.0.2.3,3 AAAA 2001:db8::1"; strings.Join(got, ",") != want {
+		t.Fatalf("got %v, want %s", got, want)
+	}
+}
+
+func TestSetRecordsVanishedRecord(t *testing.T) {
+	p, api := newFakeProvider(t)
+	p.RecordCacheTTL = time.Minute
+	api.AddZone(1, "example.dynv6.net")
+	api.Records[1] = []dynv6api.Record{
+		{ID: 1, Name: "www", Type: "A", Data: "192.0.2.1"},
+		{ID: 2, Name: "www", Type: "A", Data: "192.0.2.2"},
+	}
+	api.NextID = 2
+	if _, err := p.GetRecords(ctx, "example.dynv6.net"); err != nil {
+		t.Fatal(err)
+	}
+	// both records are deleted behind the back of the cached listing
+	api.Records[1] = nil
+	_, err := p.SetRecords(ctx, "example.dynv6.net", []libdns.Record{
+		libdns.RR{Name: "www", Type: "A", Data: "192.0.2.3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recs := api.Records[1]; len(recs) != 1 || recs[0].Data != "192.0.2.3" {
+		t.Fatalf("unexpected records %+v", recs)
+	}
+
+	_, err = p.client().GetRecord(ctx, 1, 42)
+	if !errors.Is(err, dynv6api.ErrRecordNotFound) || errors.Is(err, dynv6api.ErrZoneNotFound) {
+		t.Fatalf("got %v, want ErrRecordNotFound", err)
+	}
+	_, err = p.client().ListRecords(ctx, 2)
+	if !errors.Is(err, dynv6api.ErrZoneNotFound) || errors.Is(err, dynv6api.ErrRecordNotFound) {
+		t.Fatalf("got %v, want ErrZoneNotFound", err)
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	api.Records[1] = []dynv6api.Record{
+		{ID: 1, Name: "www", Type: "CNAME", Data: "Host.example.org."},
+		{ID: 2, Name: "txt", Type: "TXT", Data: "old"},
+	}
+	api.NextID = 2
+
+	www := libdns.CNAME{Name: "www", Target: "host.example.org"}
+	if _, err := p.DeleteRecords(ctx, "example.dynv6.net", []libdns.Record{www}); err == nil {
+		t.Fatal("MatchExact should not match the differently spelled target")
+	}
+	p.Matcher = MatchNormalized
+	if _, err := p.DeleteRecords(ctx, "example.dynv6.net", []libdns.Record{www}); err != nil {
+		t.Fatal(err)
+	}
+
+	p.Matcher = MatchNameType
+	if _, err := p.SetRecords(ctx, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: "txt", Text: "new"}}); err != nil {
+		t.Fatal(err)
+	}
+	if recs := api.Records[1]; len(recs) != 1 || recs[0].ID != 2 || recs[0].Data != "new" {
+		t.Fatalf("TXT record not updated in place: %+v", recs)
+	}
+}
+
+func TestSRVRecords(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	srv := libdns.SRV{Service: "sip", Transport: "tcp", Name: "voip", Priority: 10, Weight: 5, Port: 5060, Target: "sip.example.org."}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{srv}); err != nil {
+		t.Fatal(err)
+	}
+	rec := api.Records[1][0]
+	if rec.Name != "_sip._tcp.voip" || rec.Data != "sip.example.org." || intValue(rec.Priority) != 10 || intValue(rec.Weight) != 5 || intValue(rec.Port) != 5060 {
+		t.Fatalf("unexpected API record %+v", rec)
+	}
+
+	// records given as text are decomposed as well
+	rr := libdns.RR{Name: "_xmpp._tcp", Type: "SRV", Data: "0 1 5222 xmpp.example.org."}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{rr}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := api.Records[1][1]; rec.Data != "xmpp.example.org." || intValue(rec.Port) != 5222 {
+		t.Fatalf("unexpected API record %+v", rec)
+	}
+
+	recs, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := recs[0].(libdns.SRV)
+	if !ok || got != srv {
+		t.Fatalf("got %#v, want %#v", recs[0], srv)
+	}
+	if got, ok := recs[1].(libdns.SRV); !ok || got.Name != "@" || got.Service != "xmpp" || got.RR() != rr {
+		t.Fatalf("got %#v, want %#v", recs[1], rr)
+	}
+
+	// the type of a record given as text is case-insensitive
+	lower := libdns.RR{Name: "_ldap._tcp", Type: "srv", Data: "0 1 389 ldap.example.org."}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{lower}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := api.Records[1][2]; rec.Data != "ldap.example.org." || intValue(rec.Port) != 389 {
+		t.Fatalf("unexpected API record %+v", rec)
+	}
+}
+
+func TestCAARecords(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	recs := []libdns.Record{
+		libdns.CAA{Name: "@", Flags: 128, Tag: "issue", Value: "letsencrypt.org"},
+		libdns.RR{Name: "@", Type: "CAA", Data: `0 IODEF "mailto:security@example.org"`},
+	}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", recs); err != nil {
+		t.Fatal(err)
+	}
+	if rec := api.Records[1][0]; rec.Data != "letsencrypt.org" || rec.Tag != "issue" || intValue(rec.Flags) != 128 {
+		t.Fatalf("unexpected API record %+v", rec)
+	}
+	if rec := api.Records[1][1]; rec.Data != "mailto:security@example.org" || rec.Tag != "iodef" {
+		t.Fatalf("unexpected API record %+v", rec)
+	}
+	got, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caa, ok := got[1].(libdns.CAA); !ok || caa != recs[0] {
+		t.Fatalf("got %#v, want %#v", got[1], recs[0])
+	}
+
+	// the type of a record given as text is case-insensitive
+	lower := libdns.RR{Name: "@", Type: "caa", Data: `0 issuewild "letsencrypt.org"`}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{lower}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := api.Records[1][2]; rec.Data != "letsencrypt.org" || rec.Tag != "issuewild" {
+		t.Fatalf("unexpected API record %+v", rec)
+	}
+
+	bad := libdns.CAA{Name: "@", Tag: "issuer", Value: "letsencrypt.org"}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{bad}); err == nil {
+		t.Fatal("expected an error for an invalid tag")
+	}
+}
+
+func TestMXRecords(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	recs := []libdns.Record{
+		libdns.MX{Name: "@", Preference: 10, Target: "mail.example.org."},
+		libdns.RR{Name: "@", Type: "MX", Data: "20 backup.example.org."},
+	}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", recs); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{10, 20} {
+		if rec := api.Records[1][i]; intValue(rec.Priority) != want || strings.Contains(rec.Data, " ") {
+			t.Fatalf("unexpected API record %+v", rec)
+		}
+	}
+	got, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mx, ok := got[1].(libdns.MX); !ok || mx.Preference != 20 || mx.Target != "backup.example.org." {
+		t.Fatalf("unexpected record %#v", got[1])
+	}
+
+	// the type of a record given as text is case-insensitive
+	lower := libdns.RR{Name: "@", Type: "mx", Data: "30 spare.example.org."}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{lower}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := api.Records[1][2]; intValue(rec.Priority) != 30 || rec.Data != "spare.example.org." {
+		t.Fatalf("unexpected API record %+v", rec)
+	}
+}
+
+func TestIncludeManaged(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	p.IncludeManaged = true
+	recs, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, r := range recs {
+		if !IsReadOnly(r) {
+			t.Errorf("%+v should be read-only", r)
+		}
+		types = append(types, r.RR().Type)
+	}
+	if got := strings.Join(types, ","); got != "NS,NS,NS,SOA" {
+		t.Fatalf("got %s, want the apex NS and SOA records", got)
+	}
+	if plan := PlanSync(recs, nil, true); !plan.Empty() {
+		t.Fatalf("managed records must not be pruned: %+v", plan)
+	}
+}
+
+func TestDangerousDelete(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	api.Records[1] = []dynv6api.Record{
+		{ID: 1, Name: "", Type: "NS", Data: "ns.example.org."},
+		{ID: 2, Name: "sub", Type: "NS", Data: "ns.example.org."},
+	}
+	ns := libdns.NS{Name: "@", Target: "ns.example.org."}
+	_, err := p.DeleteRecords(ctx, "example.dynv6.net", []libdns.Record{ns})
+	var dangerErr *DangerousDeleteError
+	if !errors.As(err, &dangerErr) || len(api.Records[1]) != 2 {
+		t.Fatalf("got error %v, want DangerousDeleteError", err)
+	}
+	// the delegation of a subdomain is an ordinary record
+	if _, err := p.DeleteRecords(ctx, "example.dynv6.net", []libdns.Record{libdns.NS{Name: "sub", Target: "ns.example.org."}}); err != nil {
+		t.Fatal(err)
+	}
+	p.AllowDangerous = true
+	if _, err := p.DeleteRecords(ctx, "example.dynv6.net", []libdns.Record{ns}); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.Records[1]) != 0 {
+		t.Fatal("NS records were not deleted")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.Seed(testutil.NewZoneFixture("example.dynv6.net").WithID(1).
+		WithA("www", "192.0.2.1").
+		WithTXT("_acme-challenge.www", "old"))
+	p.Policy = &Policy{Rules: []PolicyRule{
+		{Action: "deny", Name: "_acme-challenge\\.admin"},
+		{Action: "allow", Types: []string{"txt"}, Name: "_acme-challenge(\\..+)?"},
+	}}
+
+	for _, c := range []struct {
+		name string
+		rec  libdns.Record
+		ok   bool
+	}{
+		{"challenge", libdns.TXT{Name: "_acme-challenge", Text: "token"}, true},
+		{"subdomain challenge", libdns.TXT{Name: "_ACME-challenge.api", Text: "token"}, true},
+		{"denied challenge", libdns.TXT{Name: "_acme-challenge.admin", Text: "token"}, false},
+		{"other name", libdns.TXT{Name: "www", Text: "token"}, false},
+		{"other type", libdns.CNAME{Name: "_acme-challenge", Target: "acme.example.org."}, false},
+	} {
+		_, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{c.rec})
+		var policyErr *PolicyError
+		if c.ok && err != nil || !c.ok && !errors.As(err, &policyErr) {
+			t.Errorf("%s: got error %v", c.name, err)
+		}
+	}
+
+	before := api.CallCount("DELETE /zones/1/records/1")
+	if _, err := p.DeleteRecords(ctx, "example.dynv6.net", []libdns.Record{libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"}}); !errors.As(err, new(*PolicyError)) {
+		t.Fatalf("delete: got error %v, want PolicyError", err)
+	}
+	if api.CallCount("DELETE /zones/1/records/1") != before {
+		t.Fatal("delete denied by the policy reached the API")
+	}
+	if _, err := p.SetRecords(ctx, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: "_acme-challenge.www", Text: "new"}}); err != nil {
+		t.Fatal(err)
+	}
+	ops := []Operation{
+		{Kind: OpSet, Zone: "example.dynv6.net", Records: []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "a"}}},
+		{Kind: OpSet, Zone: "example.dynv6.net", Records: []libdns.Record{libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2")}}},
+	}
+	if err := p.Apply(ctx, ops); !errors.As(err, new(*PolicyError)) {
+		t.Fatalf("apply: got error %v, want PolicyError", err)
+	}
+
+	p.Policy = &Policy{Rules: []PolicyRule{{Action: "permit"}}}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "token"}}); err == nil || errors.As(err, new(*PolicyError)) {
+		t.Fatalf("invalid policy: got error %v", err)
+	}
+}
+
+func TestManagedSuffix(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.Seed(testutil.NewZoneFixture("example.dynv6.net").WithID(1).WithA("www", "192.0.2.1"))
+	p.ManagedSuffix = ".k8s.example.dynv6.net"
+
+	for _, c := range []struct {
+		name string
+		ok   bool
+	}{
+		{"k8s", true},
+		{"app.K8S", true},
+		{"_acme-challenge.app.k8s", true},
+		{"@", false},
+		{"www", false},
+		{"notk8s", false},
+		{"k8s.www", false},
+	} {
+		_, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: c.name, Text: "x"}})
+		var policyErr *PolicyError
+		if c.ok && err != nil || !c.ok && (!errors.As(err, &policyErr) || policyErr.Suffix == "") {
+			t.Errorf("%s: got error %v", c.name, err)
+		}
+	}
+	if _, err := p.UpsertAddress(ctx, "example.dynv6.net", []netip.Addr{netip.MustParseAddr("192.0.2.2")}); !errors.As(err, new(*PolicyError)) {
+		t.Fatalf("apex upsert: got error %v, want PolicyError", err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.dynv6.net", []libdns.Record{libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"}}); !errors.As(err, new(*PolicyError)) {
+		t.Fatalf("delete: got error %v, want PolicyError", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.Seed(testutil.NewZoneFixture("example.dynv6.net").WithID(1).WithTXT("txt", "a").WithTXT("txt", "b"))
+	// with normalize set, dynv6 silently lower-cases the stored data
+	var normalize bool
+	p.api.Middleware = append(p.api.Middleware, func(next dynv6api.Handler) dynv6api.Handler {
+		return func(call *dynv6api.Call) (*http.Response, error) {
+			resp, err := next(call)
+			if normalize && call.Method == "POST" {
+				api.Lock()
+				for i := range api.Records[1] {
+					api.Records[1][i].Data = strings.ToLower(api.Records[1][i].Data)
+				}
+				api.Unlock()
+			}
+			return resp, err
+		}
+	})
+	verify := WithOptions(ctx, Verify())
+
+	if _, err := p.SetRecords(verify, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: "txt", Text: "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AppendRecords(verify, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: "txt", Text: "d"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	normalize = true
+	_, err := p.AppendRecords(verify, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: "txt", Text: "E"}})
+	var verr *VerificationError
+	if !errors.As(err, &verr) || fmt.Sprint(verr.Want) != fmt.Sprint([]libdns.RR{{Name: "txt", Type: "TXT", Data: "E"}}) || len(verr.Got) != 3 {
+		t.Fatalf("got error %v, want VerificationError", err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: "txt", Text: "F"}}); err != nil {
+		t.Fatalf("without Verify: %v", err)
+	}
+}
+
+func TestCallOptions(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	var recs []libdns.Record
+	for i := 0; i < 8; i++ {
+		recs = append(recs, libdns.TXT{Name: "txt", Text: strconv.Itoa(i)})
+	}
+
+	dry := WithOptions(ctx, DryRun())
+	results, err := p.AppendRecords(dry, "example.dynv6.net", recs)
+	if err != nil || len(results) != len(recs) || len(api.Records[1]) != 0 {
+		t.Fatalf("dry run: got %d results, %d records, error %v", len(results), len(api.Records[1]), err)
+	}
+
+	results, err = p.AppendRecords(WithOptions(ctx, Concurrency(4)), "example.dynv6.net", recs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range results {
+		if r.RR().Data != strconv.Itoa(i) {
+			t.Fatalf("results out of order: %+v", results)
+		}
+	}
+	if len(api.Records[1]) != len(recs) {
+		t.Fatalf("got %d records, want %d", len(api.Records[1]), len(recs))
+	}
+
+	if _, err := p.DeleteRecords(dry, "example.dynv6.net", recs[:2]); err != nil || len(api.Records[1]) != len(recs) {
+		t.Fatalf("dry run deleted records: %v", err)
+	}
+	p.Matcher = MatchNameType
+	exact := WithOptions(ctx, UseMatcher(MatchExact))
+	if _, err := p.DeleteRecords(exact, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: "txt", Text: "x"}}); err == nil {
+		t.Fatal("the matcher option was not used")
+	}
+}
+
+func TestWaitForPropagation(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		if req.Question[0].Qtype == dns.TypeTXT {
+			rr, _ := dns.NewRR(`_acme-challenge.example.dynv6.net. 60 IN TXT "token"`)
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})}
+	go srv.ActivateAndServe()
+	defer srv.Shutdown()
+	defer func(s string) { propagationServer = s }(propagationServer)
+	propagationServer = pc.LocalAddr().String()
+
+	txt := libdns.TXT{Name: "_acme-challenge", Text: "token"}
+	if err := WaitForPropagation(ctx, "example.dynv6.net.", []libdns.Record{txt}, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	a := libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"}
+	if err := WaitForPropagation(ctx, "example.dynv6.net.", []libdns.Record{a}, 100*time.Millisecond); err == nil {
+		t.Fatal("expected a timeout for a record that is not served")
+	}
+}
+
+// newDoHServer returns a DNS-over-HTTPS resolver which answers TXT queries
+// with the given value.
+func newDoHServer(t *testing.T, value string) DoHResolver {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if r.Header.Get("Content-Type") != "application/dns-message" || req.Unpack(body) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		m := new(dns.Msg)
+		m.SetReply(req)
+		rr, _ := dns.NewRR(`_acme-challenge.example.dynv6.net. 60 IN TXT "` + value + `"`)
+		m.Answer = append(m.Answer, rr)
+		b, _ := m.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+	return DoHResolver{URL: srv.URL}
+}
+
+func TestDoHResolver(t *testing.T) {
+	resolvers := []Resolver{newDoHServer(t, "token")}
+	txt := libdns.TXT{Name: "_acme-challenge", Text: "token"}
+	if err := WaitForPropagationWith(ctx, resolvers, "example.dynv6.net.", []libdns.Record{txt}, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	for in, want := range map[string]Resolver{
+		"https://dns.google/dns-query": DoHResolver{URL: "https://dns.google/dns-query"},
+		"1.1.1.1":                      DNSResolver("1.1.1.1:53"),
+		"ns1.dynv6.com:5353":           DNSResolver("ns1.dynv6.com:5353"),
+		"2001:db8::1":                  DNSResolver("[2001:db8::1]:53"),
+	} {
+		if got := ParseResolver(in); got != want {
+			t.Errorf("ParseResolver(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestWaitForQuorum(t *testing.T) {
+	stale := newDoHServer(t, "old")
+	resolvers := []Resolver{newDoHServer(t, "token"), stale, newDoHServer(t, "token")}
+	txt := libdns.TXT{Name: "_acme-challenge", Text: "token"}
+	if err := WaitForQuorum(ctx, resolvers, 2, "example.dynv6.net.", []libdns.Record{txt}, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	err := WaitForQuorum(ctx, resolvers, 0, "example.dynv6.net.", []libdns.Record{txt}, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "served by 2 of 3 resolvers") || !strings.Contains(err.Error(), stale.URL) {
+		t.Fatalf("expected the stale resolver to fail the quorum, got %v", err)
+	}
+}
+
+func TestOperationTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	p := &Provider{Token: "test", OperationTimeout: 50 * time.Millisecond}
+	p.api = &dynv6api.Client{Token: p.Token, BaseURL: srv.URL}
+	start := time.Now()
+	_, err := p.GetRecords(context.Background(), "example.dynv6.net")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("call took %s", elapsed)
+	}
+}
+
+func TestCoalesceReads(t *testing.T) {
+	api := &testutil.API{}
+	api.AddZone(1, "example.dynv6.net")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		api.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	p := &Provider{Token: "test"}
+	p.api = &dynv6api.Client{Token: p.Token, BaseURL: srv.URL}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.GetRecords(ctx, "example.dynv6.net"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := api.CallCount("GET /zones/by-name/example.dynv6.net"); n != 1 {
+		t.Errorf("zone looked up %d times, want 1", n)
+	}
+	if n := api.CallCount("GET /zones/1/records"); n != 1 {
+		t.Errorf("records listed %d times, want 1", n)
+	}
+	if st := p.Stats(); st.Coalesced == 0 {
+		t.Error("no lookups were counted as coalesced")
+	}
+}
+
+func TestRecordCacheInvalidatedInFlight(t *testing.T) {
+	api := &testutil.API{}
+	api.AddZone(1, "example.dynv6.net")
+	listed, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/zones/1/records" {
+			api.ServeHTTP(w, r)
+			return
+		}
+		held := false
+		once.Do(func() { held = true })
+		if !held {
+			api.ServeHTTP(w, r)
+			return
+		}
+		// list the records, then answer only after the write
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, r)
+		close(listed)
+		<-release
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+	p := &Provider{Token: "test", RecordCacheTTL: time.Hour}
+	p.api = &dynv6api.Client{Token: p.Token, BaseURL: srv.URL}
+	if _, err := p.zone(ctx, "example.dynv6.net"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.GetRecords(ctx, "example.dynv6.net")
+		done <- err
+	}()
+	<-listed
+	rec := libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{rec}); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	recs, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("got %v, want the appended record", recs)
+	}
+}
+
+func TestCoalesceCancel(t *testing.T) {
+	var g flightGroup
+	started, release := make(chan struct{}), make(chan struct{})
+	fnErr := make(chan error, 1)
+	fn := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		select {
+		case <-release:
+			return "zones", nil
+		case <-ctx.Done():
+			fnErr <- ctx.Err()
+			return nil, ctx.Err()
+		}
+	}
+	waiters := func() int {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if f, ok := g.calls["k"]; ok {
+			return f.waiters
+		}
+		return 0
+	}
+
+	// the caller starting the call gives up, the one which joined it gets
+	// the result
+	first, cancelFirst := context.WithCancel(ctx)
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err, _ := g.do(first, "k", fn)
+		firstErr <- err
+	}()
+	<-started
+	second := make(chan interface{}, 1)
+	go func() {
+		v, err, shared := g.do(ctx, "k", fn)
+		if err != nil || !shared {
+			t.Errorf("joined call: got %v, %v, shared %t", v, err, shared)
+		}
+		second <- v
+	}()
+	for waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancelFirst()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled caller: got %v, want context.Canceled", err)
+	}
+	close(release)
+	if v := <-second; v != "zones" {
+		t.Fatalf("joined call: got %v", v)
+	}
+
+	// once every caller gave up, the call is canceled
+	started, release = make(chan struct{}), make(chan struct{})
+	only, cancelOnly := context.WithCancel(ctx)
+	go func() {
+		<-started
+		cancelOnly()
+	}()
+	if _, err, _ := g.do(only, "k", fn); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if err := <-fnErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("abandoned call: got %v, want context.Canceled", err)
+	}
+}
+
+func TestSharedCache(t *testing.T) {
+	p, api := newFakeProvider(t)
+	p.Token = "shared-cache-test"
+	p.api.Token = p.Token
+	p.SharedCache = true
+	api.AddZone(1, "example.dynv6.net")
+	if _, err := p.GetRecords(ctx, "example.dynv6.net"); err != nil {
+		t.Fatal(err)
+	}
+	other := &Provider{Token: p.Token, SharedCache: true}
+	other.api = p.api
+	if _, err := other.GetRecords(ctx, "example.dynv6.net"); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.CallCount("GET /zones/by-name/example.dynv6.net"); n != 1 {
+		t.Fatalf("zone looked up %d times, want 1", n)
+	}
+	unshared := &Provider{Token: p.Token}
+	unshared.api = p.api
+	if _, err := unshared.GetRecords(ctx, "example.dynv6.net"); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.CallCount("GET /zones/by-name/example.dynv6.net"); n != 2 {
+		t.Fatalf("zone looked up %d times, want 2", n)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var mu sync.Mutex
+	posts := 0
+	api := &testutil.API{}
+	api.AddZone(1, "example.dynv6.net")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			mu.Lock()
+			posts++
+			mu.Unlock()
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	p := &Provider{Token: "test", RetryBudget: 3}
+	p.api = &dynv6api.Client{Token: p.Token, BaseURL: srv.URL, RetryPolicy: dynv6api.ExponentialBackoff{MaxAttempts: 10, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}}
+	recs := []libdns.Record{libdns.TXT{Name: "a", Text: "1"}, libdns.TXT{Name: "b", Text: "2"}}
+	if _, err := p.AppendRecords(WithOptions(ctx, Concurrency(2)), "example.dynv6.net", recs); err == nil {
+		t.Fatal("expected an error")
+	}
+	if posts != len(recs)+3 {
+		t.Fatalf("got %d requests, want %d", posts, len(recs)+3)
+	}
+}
+
+func TestWriteQueue(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	q := p.NewWriteQueue(time.Hour)
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		if err := q.Set("example.dynv6.net", []libdns.Record{libdns.RR{Name: "www", Type: "A", Data: ip}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Set("example.dynv6.net", []libdns.Record{libdns.TXT{Name: "www", Text: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := q.Pending(); n != 2 {
+		t.Fatalf("got %d pending updates, want 2", n)
+	}
+	if err := q.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.CallCount("POST /zones/1/records"); n != 2 {
+		t.Fatalf("got %d writes, want 2", n)
+	}
+	var got []string
+	for _, r := range api.Records[1] {
+		got = append(got, r.Type+" "+r.Data)
+	}
+	if want := "A 192.0.2.3,TXT x"; strings.Join(got, ",") != want {
+		t.Fatalf("got %v, want %s", got, want)
+	}
+	if err := q.Set("example.dynv6.net", nil); err != ErrQueueClosed {
+		t.Fatalf("got %v after Close, want ErrQueueClosed", err)
+	}
+
+	// the queue flushes by itself after the delay
+	q = p.NewWriteQueue(time.Millisecond)
+	errs := make(chan error, 1)
+	q.OnError = func(zone string, err error) { errs <- err }
+	q.Set("missing.dynv6.net", []libdns.Record{libdns.TXT{Name: "www", Text: "x"}})
+	select {
+	case err := <-errs:
+		if !errors.Is(err, dynv6api.ErrZoneNotFound) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queue wasn't flushed")
+	}
+
+	// the updates of a failed zone stay queued for the next flush
+	if n := q.Pending(); n != 1 {
+		t.Fatalf("got %d pending updates after the failure, want 1", n)
+	}
+	api.AddZone(2, "missing.dynv6.net")
+	if err := q.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	api.Lock()
+	n := len(api.Records[2])
+	api.Unlock()
+	if n != 1 || q.Pending() != 0 {
+		t.Fatalf("got %d records and %d pending updates after the retry", n, q.Pending())
+	}
+}
+
+func TestApply(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	api.Records[1] = []dynv6api.Record{{ID: 1, Name: "www", Type: "A", Data: "192.0.2.1"}}
+	api.NextID = 1
+
+	// nothing is written if any operation is invalid
+	ops := []Operation{
+		{Kind: OpAppend, Zone: "example.dynv6.net", Records: []libdns.Record{libdns.TXT{Name: "a", Text: "x"}}},
+		{Kind: OpDelete, Zone: "example.dynv6.net", Records: []libdns.Record{libdns.TXT{Name: "b", Text: "x"}}},
+	}
+	var applyErr *ApplyError
+	if err := p.Apply(ctx, ops); !errors.As(err, &applyErr) || !applyErr.Validation || applyErr.Index != 1 {
+		t.Fatalf("got %v, want a validation error of operation 1", err)
+	}
+	ops[1] = Operation{Kind: OpDelete, Zone: "example.dynv6.net", Records: []libdns.Record{libdns.NS{Name: "sub", Target: "ns.example.org."}}}
+	if err := p.Apply(ctx, ops); !errors.As(err, &applyErr) || !applyErr.Validation {
+		t.Fatalf("got %v, want a validation error", err)
+	}
+	ops[1] = Operation{Kind: OpAppend, Zone: "missing.dynv6.net", Records: []libdns.Record{libdns.TXT{Name: "b", Text: "x"}}}
+	if err := p.Apply(ctx, ops); !errors.As(err, &applyErr) || !errors.Is(err, dynv6api.ErrZoneNotFound) {
+		t.Fatalf("got %v, want ErrZoneNotFound", err)
+	}
+	if n := api.CallCount("POST /zones/1/records"); n != 0 {
+		t.Fatalf("%d records created by invalid batches", n)
+	}
+
+	// later operations see the effects of earlier ones
+	ops = []Operation{
+		{Kind: OpAppend, Zone: "example.dynv6.net", Records: []libdns.Record{libdns.TXT{Name: "a", Text: "x"}}},
+		{Kind: OpDelete, Zone: "example.dynv6.net", Records: []libdns.Record{libdns.TXT{Name: "a", Text: "x"}}},
+		{Kind: OpSet, Zone: "example.dynv6.net", Records: []libdns.Record{libdns.RR{Name: "www", Type: "A", Data: "192.0.2.2"}}},
+		{Kind: OpDelete, Zone: "example.dynv6.net", Records: []libdns.Record{libdns.RR{Name: "www", Type: "A", Data: "192.0.2.2"}}},
+	}
+	if err := p.Apply(ctx, ops); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(api.Records[1]); n != 0 {
+		t.Fatalf("%d records left", n)
+	}
+
+	// failures during execution report the committed operations
+	ops = []Operation{
+		{Kind: OpAppend, Zone: "example.dynv6.net", Records: []libdns.Record{libdns.TXT{Name: "a", Text: "x"}}},
+		{Kind: OpAppend, Zone: "example.dynv6.net", Records: []libdns.Record{RawRecord{Name: "b", Type: "FUTURE", Data: "x"}}},
+	}
+	if err := p.Apply(ctx, ops); !errors.As(err, &applyErr) || applyErr.Validation || applyErr.Index != 1 || len(applyErr.Committed) != 1 {
+		t.Fatalf("got %v, want operation 1 to fail after committing operation 0", err)
+	}
+}
+
+func TestSyncConfirm(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	desired := []libdns.Record{libdns.TXT{Name: "www", Text: "x"}}
+	var shown Plan
+	decline := WithOptions(ctx, Confirm(func(ctx context.Context, plan Plan) (bool, error) {
+		shown = plan
+		return false, nil
+	}))
+	if _, err := p.Sync(decline, "example.dynv6.net", desired, true); err != ErrNotConfirmed {
+		t.Fatalf("got %v, want ErrNotConfirmed", err)
+	}
+	if len(shown.Create) != 1 || len(api.Records[1]) != 0 {
+		t.Fatalf("declined plan %+v was applied", shown)
+	}
+	approve := WithOptions(ctx, Confirm(func(ctx context.Context, plan Plan) (bool, error) {
+		return true, nil
+	}))
+	if _, err := p.Sync(approve, "example.dynv6.net", desired, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.Records[1]) != 1 {
+		t.Fatal("approved plan wasn't applied")
+	}
+
+	// a slow answer at the prompt doesn't use up the operation timeout
+	p.OperationTimeout = 50 * time.Millisecond
+	slow := WithOptions(ctx, Confirm(func(ctx context.Context, plan Plan) (bool, error) {
+		time.Sleep(100 * time.Millisecond)
+		return true, nil
+	}))
+	desired = append(desired, libdns.TXT{Name: "www", Text: "y"})
+	if _, err := p.Sync(slow, "example.dynv6.net", desired, true); err != nil {
+		t.Fatalf("slow confirmation: %v", err)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	tokenFile := t.TempDir() + "/token"
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DYNV6_TOKEN", "")
+	t.Setenv("DYNV6_TOKEN_FILE", tokenFile)
+	t.Setenv("DYNV6_BASE_URL", "http://localhost:8080/api/v2")
+	t.Setenv("DYNV6_TTL", "5m")
+	t.Setenv("DYNV6_RETRY_MAX_ATTEMPTS", "2")
+	t.Setenv("DYNV6_RETRY_BUDGET", "-1")
+	t.Setenv("DYNV6_LOG_LEVEL", "calls")
+	var p Provider
+	if err := p.LoadEnv(); err != nil {
+		t.Fatal(err)
+	}
+	backoff, ok := p.RetryPolicy.(dynv6api.ExponentialBackoff)
+	if p.Token != "secret" || p.BaseURL != "http://localhost:8080/api/v2" || p.TTL != 5*time.Minute ||
+		!ok || backoff.MaxAttempts != 2 || backoff.BaseDelay == 0 || p.RetryBudget != -1 || len(p.Middleware) != 1 {
+		t.Fatalf("unexpected provider %+v", &p)
+	}
+
+	t.Setenv("DYNV6_TTL", "soon")
+	if err := new(Provider).LoadEnv(); err == nil || !strings.Contains(err.Error(), "DYNV6_TTL") {
+		t.Fatalf("got %v, want an error naming DYNV6_TTL", err)
+	}
+}
+
+func TestRecordTTL(t *testing.T) {
+	p, api := newFakeProvider(t)
+	p.TTL = time.Minute
+	api.AddZone(1, "example.dynv6.net")
+	api.Records[1] = []dynv6api.Record{
+		{ID: 1, Name: "www", Type: "A", Data: "192.0.2.1"},
+		{ID: 2, Name: "svc", Type: "FUTURE", Data: "opaque"},
+	}
+	recs, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range recs {
+		if r.RR().TTL != time.Minute {
+			t.Errorf("%T has TTL %v, want 1m", r, r.RR().TTL)
+		}
+	}
+}
+
+func TestChallengeTTLWarning(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	var warnings []Warning
+	p.OnWarning = func(w Warning) { warnings = append(warnings, w) }
+	recs := []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", TTL: time.Hour, Text: "token"},
+		libdns.TXT{Name: "_acme-challenge.www", TTL: time.Minute, Text: "token"},
+		libdns.TXT{Name: "note", TTL: time.Hour, Text: "not a challenge"},
+	}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", recs); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("got warnings %+v, want one", warnings)
+	}
+	w := warnings[0]
+	if w.Code != WarnChallengeTTL || w.Name != "_acme-challenge" || w.SuggestedTTL != SuggestedChallengeTTL {
+		t.Fatalf("unexpected warning %+v", w)
+	}
+
+	if w := CheckTTL(PurposeDynamic, "example.dynv6.net", libdns.Address{Name: "home", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")}); w == nil || w.Code != WarnDynamicTTL {
+		t.Fatalf("got %+v, want a dynamic TTL warning", w)
+	}
+	if w := CheckTTL(PurposeDynamic, "example.dynv6.net", libdns.RR{Name: "home", Type: "A"}); w != nil {
+		t.Fatalf("default TTL warned about: %+v", w)
+	}
+}
+
+func TestExport(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	recs := []libdns.Record{
+		libdns.TXT{Name: "www", Text: "hello"},
+		libdns.MX{Name: "@", Preference: 10, Target: "mail.example.org."},
+		libdns.RR{Name: "@", Type: "A", Data: "203.0.113.7"},
+	}
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", recs); err != nil {
+		t.Fatal(err)
+	}
+	e, err := p.Export(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Version != ExportVersion || e.Zone.ID != 1 || e.Zone.Name != "example.dynv6.net" {
+		t.Fatalf("unexpected export %+v", e)
+	}
+	want := []string{"@ A 203.0.113.7", "@ MX 10 mail.example.org.", "www TXT hello"}
+	if len(e.Records) != len(want) {
+		t.Fatalf("unexpected records %+v", e.Records)
+	}
+	for i, r := range e.Records {
+		if got := r.Name + " " + r.Type + " " + r.Data; got != want[i] || r.ID == 0 {
+			t.Errorf("record %d: got %q (ID %d), want %q", i, got, r.ID, want[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := e.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	again, err := p.Export(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf2 bytes.Buffer
+	again.WriteTo(&buf2)
+	if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+		t.Fatalf("exports of an unchanged zone differ:\n%s\n%s", buf.Bytes(), buf2.Bytes())
+	}
+	read, err := ReadExport(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := read.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := p.Sync(ctx, "example.dynv6.net", parsed, true)
+	if err != nil || !plan.Empty() {
+		t.Fatalf("restoring an unchanged zone planned %+v, %v", plan, err)
+	}
+
+	if _, err := ReadExport(strings.NewReader(`{"version": 99, "records": []}`)); err == nil {
+		t.Fatal("expected an error for a newer version")
+	}
+	if _, err := ReadExport(strings.NewReader(`{"records": []}`)); err == nil {
+		t.Fatal("expected an error for a missing version")
+	}
+}
+
+func TestVerifyCapabilities(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(2, "test.dynv6.net")
+	api.AddZone(1, "example.dynv6.net")
+	if _, err := p.VerifyCapabilities(ctx, ""); err == nil || api.CallCount("GET /zones") != 0 {
+		t.Fatalf("got %v, want an error without a test zone and no requests", err)
+	}
+	r, err := p.VerifyCapabilities(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.TestZone != "example.dynv6.net" || len(r.Zones) != 2 || !r.Has(CapabilityApexWrite) {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if n := api.CallCount("POST /zones/1/records"); n != 2 || len(api.Records[1]) != 0 {
+		t.Fatalf("%d probe records created, %d left over", n, len(api.Records[1]))
+	}
+
+	// a read-only token
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	p.api = &dynv6api.Client{Token: p.Token, BaseURL: srv.URL}
+	r, err = p.VerifyCapabilities(ctx, "test.dynv6.net")
+	if err == nil || !strings.Contains(err.Error(), "write: ") {
+		t.Fatalf("got %v, want missing write capability", err)
+	}
+	for _, c := range Capabilities {
+		if want := c == CapabilityRead; r.Has(c) != want {
+			t.Errorf("%s: got %v, want %v", c, r.Has(c), want)
+		}
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with the golden file, or rewrites it with -update.
+func golden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run the test with -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs, run the test with -update if the change is intended:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// TestWireFormat pins the JSON sent to dynv6 for every record type in
+// testdata/wire/<case>.request.json, and the records parsed from the
+// responses in <case>.response.json in <case>.parsed.json.
+func TestWireFormat(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		rec  libdns.Record
+	}{
+		{"a", libdns.Address{Name: "www", IP: netip.MustParseAddr("203.0.113.7")}},
+		{"a-ttl", libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("203.0.113.7")}},
+		{"aaaa", libdns.Address{Name: "www", IP: netip.MustParseAddr("2001:db8::7")}},
+		{"cname", libdns.CNAME{Name: "blog", Target: "www.example.dynv6.net."}},
+		{"txt", libdns.TXT{Name: "@", Text: `v=spf1 include:"quoted" -all`}},
+		{"spf", libdns.RR{Name: "@", Type: "SPF", Data: "v=spf1 -all"}},
+		{"mx", libdns.MX{Name: "@", Preference: 10, Target: "mail.example.org."}},
+		{"srv", libdns.SRV{Service: "sip", Transport: "tcp", Name: "@", Priority: 10, Weight: 5, Port: 5060, Target: "sip.example.org."}},
+		{"caa", libdns.CAA{Name: "@", Flags: 128, Tag: "issue", Value: "letsencrypt.org"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			base := filepath.Join("testdata", "wire", c.name)
+			response, err := ioutil.ReadFile(base + ".response.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sent []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.URL.Path == "/zones/by-name/example.dynv6.net":
+					w.Write([]byte(`{"id": 1, "name": "example.dynv6.net"}`))
+				case r.Method == "POST":
+					sent, _ = ioutil.ReadAll(r.Body)
+					w.Write(response)
+				case r.Method == "GET":
+					w.Write(append(append([]byte("["), response...), ']'))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+			p := &Provider{Token: "test", BaseURL: srv.URL}
+
+			if _, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{c.rec}); err != nil {
+				t.Fatal(err)
+			}
+			golden(t, base+".request.json", append(sent, '\n'))
+
+			recs, err := p.GetRecords(ctx, "example.dynv6.net")
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := json.MarshalIndent(struct {
+				Type   string
+				Record libdns.Record
+				RR     libdns.RR
+			}{fmt.Sprintf("%T", recs[0]), recs[0], recs[0].RR()}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, base+".parsed.json", append(parsed, '\n'))
+		})
+	}
+}
+
+// silentResolver never serves a record.
+type silentResolver struct{}
+
+func (silentResolver) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	return new(dns.Msg).SetReply(m), nil
+}
+
+func (silentResolver) String() string { return "silent" }
+
+func TestClock(t *testing.T) {
+	p, api := newFakeProvider(t)
+	clock := testutil.NewClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	p.Clock, p.Sleeper = clock, clock
+	p.RecordCacheTTL = time.Minute
+	api.AddZone(1, "example.dynv6.net")
+	get := func() {
+		t.Helper()
+		if _, err := p.GetRecords(ctx, "example.dynv6.net"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get()
+	clock.Advance(59 * time.Second)
+	get()
+	if n := api.CallCount("GET /zones/1/records"); n != 1 {
+		t.Fatalf("records fetched %d times before the cache expired, want 1", n)
+	}
+	clock.Advance(time.Second)
+	get()
+	if n := api.CallCount("GET /zones/1/records"); n != 2 {
+		t.Fatalf("records fetched %d times after the cache expired, want 2", n)
+	}
+	clock.Advance(time.Hour)
+	get()
+	if n := api.CallCount("GET /zones/by-name/example.dynv6.net"); n != 2 {
+		t.Fatalf("zone looked up %d times after the zone cache expired, want 2", n)
+	}
+
+	start := time.Now()
+	recs := []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "token"}}
+	err := waitForQuorum(ctx, clock, clock, []Resolver{silentResolver{}}, 0, "example.dynv6.net.", recs, 10*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "not served by silent within 10s") {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("propagation wait took %s of real time", elapsed)
+	}
+	if sleeps := clock.Sleeps(); len(sleeps) != 5 || sleeps[0] != 2*time.Second {
+		t.Fatalf("slept %v, want 5 times 2s", sleeps)
+	}
+}
+
+func TestResolveZoneID(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.AddZone(1, "example.dynv6.net")
+	api.AddZone(2, "sub.example.dynv6.net")
+	for name, want := range map[string]int64{
+		"example.dynv6.net.":                        1,
+		"www.example.dynv6.net":                     1,
+		"_acme-challenge.WWW.sub.example.dynv6.net": 2,
+		"sub.example.dynv6.net":                     2,
+	} {
+		id, zone, err := p.ResolveZoneID(ctx, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if id != want {
+			t.Errorf("%s: got zone %d (%s), want %d", name, id, zone, want)
+		}
+	}
+	if n := api.CallCount("GET /zones"); n != 1 {
+		t.Errorf("zones listed %d times, want 1", n)
+	}
+	if _, _, err := p.ResolveZoneID(ctx, "example.org"); !errors.Is(err, dynv6api.ErrZoneNotFound) {
+		t.Errorf("got %v, want ErrZoneNotFound", err)
+	}
+	// the libdns methods use the resolved zones
+	if _, err := p.GetRecords(ctx, "example.dynv6.net"); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.CallCount("GET /zones/by-name/example.dynv6.net"); n != 0 {
+		t.Errorf("zone looked up %d times, want 0", n)
+	}
+}
+
+func TestUpsertAddress(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.Seed(testutil.NewZoneFixture("example.dynv6.net").WithID(1).
+		WithA("home", "203.0.113.1").
+		WithA("home", "203.0.113.2").
+		WithAAAA("home", "2001:db8::1"))
+	addrs := []netip.Addr{netip.MustParseAddr("::ffff:203.0.113.7")}
+	if _, err := p.UpsertAddress(ctx, "home.example.dynv6.net.", addrs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].RR() != (libdns.RR{Name: "home", Type: "A", Data: "203.0.113.7"}) {
+		t.Fatalf("got %v, want only the new A record", got)
+	}
+
+	addrs = []netip.Addr{netip.MustParseAddr("203.0.113.9"), netip.MustParseAddr("2001:db8::9")}
+	recs, err := p.UpsertAddress(ctx, "Example.dynv6.net", addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].RR().Name != "@" {
+		t.Fatalf("got %v, want the apex addresses", recs)
+	}
+	api.Lock()
+	z := api.Zones[0]
+	api.Unlock()
+	if z.IPv4Address != "203.0.113.9" || z.IPv6Prefix != "2001:db8::9" {
+		t.Fatalf("zone addresses are %s and %s", z.IPv4Address, z.IPv6Prefix)
+	}
+	// unchanged apex addresses aren't written again
+	if _, err := p.UpsertAddress(ctx, "example.dynv6.net", addrs); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.CallCount("PATCH /zones/1"); n != 1 {
+		t.Fatalf("zone updated %d times, want 1", n)
+	}
+	// an address changed elsewhere is written back despite the cached zone
+	api.Lock()
+	api.Zones[0].IPv4Address = "198.51.100.1"
+	api.Unlock()
+	if _, err := p.UpsertAddress(ctx, "example.dynv6.net", addrs); err != nil {
+		t.Fatal(err)
+	}
+	api.Lock()
+	z = api.Zones[0]
+	api.Unlock()
+	if z.IPv4Address != "203.0.113.9" {
+		t.Fatalf("zone address is %s, want it written back", z.IPv4Address)
+	}
+	addrs = append(addrs, netip.MustParseAddr("203.0.113.10"))
+	if _, err := p.UpsertAddress(ctx, "example.dynv6.net", addrs); err == nil {
+		t.Fatal("two apex IPv4 addresses were accepted")
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.Seed(testutil.NewZoneFixture("example.dynv6.net").WithID(1).
+		WithTXT("_verify", "old").
+		WithTXT("_verify", "older"))
+	for i, step := range []struct {
+		ensure  func() (bool, error)
+		changed bool
+	}{
+		{func() (bool, error) { return p.EnsureTXT(ctx, "example.dynv6.net", "_verify", "new") }, true},
+		{func() (bool, error) { return p.EnsureTXT(ctx, "example.dynv6.net", "_verify", "new") }, false},
+		{func() (bool, error) {
+			return p.EnsureA(ctx, "example.dynv6.net", "www", netip.MustParseAddr("203.0.113.7"))
+		}, true},
+		{func() (bool, error) {
+			return p.EnsureA(ctx, "example.dynv6.net", "www", netip.MustParseAddr("203.0.113.7"))
+		}, false},
+		{func() (bool, error) { return p.EnsureCNAME(ctx, "example.dynv6.net", "docs", "www.example.dynv6.net.") }, true},
+		{func() (bool, error) { return p.EnsureCNAME(ctx, "example.dynv6.net", "docs", "www.example.dynv6.net.") }, false},
+	} {
+		changed, err := step.ensure()
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if changed != step.changed {
+			t.Fatalf("step %d: changed = %t, want %t", i, changed, step.changed)
+		}
+	}
+	got, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %v, want one record per name", got)
+	}
+}
+
+func TestTokenNormalized(t *testing.T) {
+	api, url := testutil.NewServer(t)
+	api.AddZone(1, "example.dynv6.net")
+	var warnings []Warning
+	p := &Provider{Token: "Bearer test\n", BaseURL: url, OnWarning: func(w Warning) { warnings = append(warnings, w) }}
+	for i := 0; i < 2; i++ {
+		if _, err := p.ListZones(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(warnings) != 1 || warnings[0].Code != WarnTokenNormalized {
+		t.Fatalf("got warnings %v, want one %s", warnings, WarnTokenNormalized)
+	}
+}
+
+func TestUnknownFieldsWarning(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id":1,"name":"example.dynv6.net","dnssec":true}]`))
+	}))
+	defer srv.Close()
+	var warnings []Warning
+	p := &Provider{Token: "test", BaseURL: srv.URL, OnWarning: func(w Warning) { warnings = append(warnings, w) }}
+	for i := 0; i < 2; i++ {
+		if _, err := p.ListZones(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(warnings) != 1 || warnings[0].Code != WarnUnknownFields || !strings.Contains(warnings[0].Message, "[].dnssec") {
+		t.Fatalf("got warnings %v, want one %s", warnings, WarnUnknownFields)
+	}
+
+	strict := &Provider{Token: "test", BaseURL: srv.URL, StrictDecoding: true}
+	var schemaErr *dynv6api.SchemaError
+	if _, err := strict.ListZones(ctx); !errors.As(err, &schemaErr) {
+		t.Fatalf("got %v, want a SchemaError", err)
+	}
+}
+
+// resolverFunc answers queries with a function.
+type resolverFunc func(q dns.Question) *dns.Msg
+
+func (f resolverFunc) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	resp := f(m.Question[0])
+	resp.SetReply(m)
+	return resp, nil
+}
+
+func TestAudit(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.Seed(testutil.NewZoneFixture("example.dynv6.net").WithID(1).
+		WithA("www", "192.0.2.1").
+		WithTXT("txt", "hello").
+		WithMX("@", 10, "mail.example.org."))
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	current := resolverFunc(func(q dns.Question) *dns.Msg {
+		m := new(dns.Msg)
+		switch q.Name + " " + dns.TypeToString[q.Qtype] {
+		case "www.example.dynv6.net. A":
+			m.Answer = []dns.RR{rr("www.example.dynv6.net. 60 IN A 192.0.2.1")}
+		case "txt.example.dynv6.net. TXT":
+			m.Answer = []dns.RR{rr(`txt.example.dynv6.net. 60 IN TXT "hello"`)}
+		case "example.dynv6.net. MX":
+			m.Answer = []dns.RR{rr("example.dynv6.net. 60 IN MX 10 Mail.Example.org.")}
+		}
+		return m
+	})
+	stale := resolverFunc(func(q dns.Question) *dns.Msg {
+		m := new(dns.Msg)
+		switch q.Name + " " + dns.TypeToString[q.Qtype] {
+		case "www.example.dynv6.net. A":
+			m.Answer = []dns.RR{rr("www.example.dynv6.net. 60 IN A 192.0.2.9")}
+		case "example.dynv6.net. MX":
+			m.Answer = []dns.RR{rr("example.dynv6.net. 60 IN MX 10 mail.example.org.")}
+		}
+		return m
+	})
+
+	report, err := p.Audit(ctx, "example.dynv6.net", []Resolver{current, stale})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Findings) != 6 || report.OK() {
+		t.Fatalf("got %d findings, OK %v", len(report.Findings), report.OK())
+	}
+	var got []string
+	for _, f := range report.Problems() {
+		got = append(got, fmt.Sprintf("%s %s %s %s %v %v", f.Server, f.Name, f.Type, f.Status, f.Want, f.Got))
+	}
+	want := []string{
+		"resolver 2 txt TXT missing [hello] []",
+		"resolver 2 www A mismatch [192.0.2.1] [192.0.2.9]",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got problems\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckDelegation(t *testing.T) {
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	recursive := resolverFunc(func(q dns.Question) *dns.Msg {
+		m := new(dns.Msg)
+		switch {
+		case q.Qtype == dns.TypeSOA && q.Name == "org.":
+			m.Answer = []dns.RR{rr("org. 3600 IN SOA a0.org-servers.net. noc.org. 1 7200 900 1209600 86400")}
+		case q.Qtype == dns.TypeNS && q.Name == "org.":
+			m.Answer = []dns.RR{rr("org. 3600 IN NS b0.org-servers.net."), rr("org. 3600 IN NS a0.org-servers.net.")}
+		}
+		return m
+	})
+	var asked []string
+	checker := DelegationChecker{
+		Resolver: recursive,
+		Authority: func(server string) Resolver {
+			asked = append(asked, server)
+			return resolverFunc(func(q dns.Question) *dns.Msg {
+				m := new(dns.Msg)
+				switch q.Name {
+				case "good.org.":
+					m.Ns = []dns.RR{rr("good.org. 3600 IN NS ns1.dynv6.com."), rr("good.org. 3600 IN NS NS2.dynv6.com.")}
+				case "mixed.org.":
+					m.Ns = []dns.RR{rr("mixed.org. 3600 IN NS ns1.dynv6.com."), rr("mixed.org. 3600 IN NS ns.example.net.")}
+				default:
+					m.Rcode = dns.RcodeNameError
+				}
+				return m
+			})
+		},
+	}
+	tests := []struct {
+		zone    string
+		ok      bool
+		foreign int
+	}{
+		{"good.org", true, 0},
+		{"mixed.org.", false, 1},
+		{"missing.org.", false, 0},
+	}
+	for _, test := range tests {
+		d, err := checker.Check(ctx, test.zone)
+		if err != nil {
+			t.Fatalf("%s: %v", test.zone, err)
+		}
+		if d.OK() != test.ok || len(d.Foreign) != test.foreign || d.Parent != "org." || (d.Problem() == "") != test.ok {
+			t.Errorf("%s: got %+v, problem %q", test.zone, d, d.Problem())
+		}
+	}
+	if asked[0] != "a0.org-servers.net:53" {
+		t.Errorf("asked %v, want the parent's nameservers", asked)
+	}
+	d, _ := checker.Check(ctx, "good.org.")
+	if strings.Join(d.Nameservers, " ") != "ns1.dynv6.com ns2.dynv6.com" {
+		t.Errorf("got nameservers %v", d.Nameservers)
+	}
+}
+
+func TestLookupDS(t *testing.T) {
+	newKey := func(flags uint16) *dns.DNSKEY {
+		key := &dns.DNSKEY{
+			Hdr:       dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+			Flags:     flags,
+			Protocol:  3,
+			Algorithm: dns.ECDSAP256SHA256,
+		}
+		if _, err := key.Generate(256); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	ksk, zsk := newKey(dns.ZONE|dns.SEP), newKey(dns.ZONE)
+	var answer []dns.RR
+	r := resolverFunc(func(q dns.Question) *dns.Msg {
+		m := new(dns.Msg)
+		if q.Name == "example.org." && q.Qtype == dns.TypeDNSKEY {
+			m.Answer = answer
+		}
+		return m
+	})
+
+	answer = []dns.RR{zsk, ksk}
+	dss, err := LookupDS(ctx, r, "Example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ksk.ToDS(dns.SHA256)
+	if len(dss) != 2 || dss[0].KeyTag != ksk.KeyTag() || dss[0].Digest != strings.ToUpper(want.Digest) || dss[1].DigestTypeName() != "SHA-384" {
+		t.Fatalf("got %+v, want the SHA-256 and SHA-384 digests of the KSK", dss)
+	}
+	if got := dss[0].String(); got != fmt.Sprintf("example.org. IN DS %d 13 2 %s", ksk.KeyTag(), dss[0].Digest) {
+		t.Errorf("got %s", got)
+	}
+
+	// without a KSK, the zone signing keys are used
+	answer = []dns.RR{zsk}
+	if dss, err = LookupDS(ctx, r, "example.org."); err != nil || len(dss) != 2 || dss[0].KeyTag != zsk.KeyTag() {
+		t.Fatalf("got %+v, %v, want the digests of the ZSK", dss, err)
+	}
+
+	answer = nil
+	if _, err = LookupDS(ctx, r, "example.org."); err == nil {
+		t.Fatal("got no error for a zone without keys")
+	}
+}
+
+func TestCSV(t *testing.T) {
+	zone := testutil.NewZoneFixture("example.dynv6.net").WithID(1).
+		WithA("www", "192.0.2.1").
+		WithMX("", 10, "mail.example.dynv6.net").
+		WithTXT("_dmarc", "v=DMARC1; p=none")
+	e := NewExport(dynv6api.Zone{ID: 1, Name: "example.dynv6.net"}, zone.APIRecords())
+	var buf bytes.Buffer
+	if err := e.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := ReadCSV(&buf, CSVColumns{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := e.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != len(want) {
+		t.Fatalf("round trip: got %v, want %v", recs, want)
+	}
+	for i := range recs {
+		if recs[i].RR() != want[i].RR() {
+			t.Errorf("round trip: got %v, want %v", recs[i].RR(), want[i].RR())
+		}
+	}
+
+	sheet := "Host,Kind,Prio,Value,Notes\n" +
+		"www,a,,192.0.2.1,web server\n" +
+		",,,,\n" +
+		"# a comment\n" +
+		"@,MX,10,mail.example.dynv6.net.,\n"
+	columns, err := ParseCSVColumns("name=host, type=Kind, data=4, priority=Prio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, err = ReadCSV(strings.NewReader(sheet), columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].RR().Data != "192.0.2.1" || recs[1].RR().Data != "10 mail.example.dynv6.net." {
+		t.Fatalf("mapped: got %v", recs)
+	}
+
+	if _, err := ReadCSV(strings.NewReader(sheet), CSVColumns{}); err == nil || !strings.Contains(err.Error(), `"name"`) {
+		t.Errorf("missing column: got %v", err)
+	}
+	if _, err := ReadCSV(strings.NewReader("name,type,data\nwww,A,not-an-ip\n"), CSVColumns{}); err == nil || !strings.Contains(err.Error(), "Line 2") {
+		t.Errorf("invalid record: got %v", err)
+	}
+	if _, err := ParseCSVColumns("host=Name"); err == nil {
+		t.Error("unknown field: got no error")
+	}
+}
+
+func TestWriteHosts(t *testing.T) {
+	zone := testutil.NewZoneFixture("example.dynv6.net").WithID(1).
+		WithA("nas", "203.0.113.7").
+		WithAAAA("nas", "2001:db8::7").
+		WithA("printer.home", "192.168.1.20").
+		WithTXT("nas", "not an address")
+	e := NewExport(dynv6api.Zone{ID: 1, Name: "example.dynv6.net", IPv4Address: "203.0.113.7"}, zone.APIRecords())
+	tests := []struct {
+		opts HostsOptions
+		want string
+	}{
+		{HostsOptions{}, "203.0.113.7\texample.dynv6.net\n203.0.113.7\tnas.example.dynv6.net\n2001:db8::7\tnas.example.dynv6.net\n192.168.1.20\tprinter.home.example.dynv6.net\n"},
+		{HostsOptions{Pattern: "*.home"}, "192.168.1.20\tprinter.home.example.dynv6.net\n"},
+		{HostsOptions{Pattern: "nas.example.dynv6.net", Replace: map[netip.Addr]netip.Addr{netip.MustParseAddr("203.0.113.7"): netip.MustParseAddr("192.168.1.10")}},
+			"192.168.1.10\tnas.example.dynv6.net\n2001:db8::7\tnas.example.dynv6.net\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := e.WriteHosts(&buf, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("%+v: got\n%s\nwant\n%s", test.opts, buf.String(), test.want)
+		}
+	}
+}
+
+func TestOwnershipTXT(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.Seed(testutil.NewZoneFixture("example.dynv6.net").WithID(1).
+		WithA("manual", "192.0.2.9").
+		WithTXT("_dynv6-owner.api", "heritage=dynv6,owner=them,type=TXT"))
+	owned := WithOptions(ctx, OwnershipTXT("me"))
+	rrs := func() map[string]bool {
+		api.Lock()
+		defer api.Unlock()
+		got := map[string]bool{}
+		for _, r := range api.Records[1] {
+			got[r.Name+" "+r.Type+" "+r.Data] = true
+		}
+		return got
+	}
+
+	if _, err := p.Sync(owned, "example.dynv6.net", []libdns.Record{libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1"}}, true); err != nil {
+		t.Fatal(err)
+	}
+	got := rrs()
+	if !got["manual A 192.0.2.9"] || !got["www A 192.0.2.1"] || !got["_dynv6-owner.www TXT heritage=dynv6,owner=me,type=A"] || len(got) != 4 {
+		t.Fatalf("first sync: got %v", got)
+	}
+
+	plan, err := p.Sync(owned, "example.dynv6.net", []libdns.Record{libdns.RR{Name: "api", Type: "A", Data: "192.0.2.2"}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = rrs()
+	want := map[string]bool{
+		"manual A 192.0.2.9": true,
+		"api A 192.0.2.2":    true,
+		"_dynv6-owner.api TXT heritage=dynv6,owner=them,type=TXT": true,
+		"_dynv6-owner.api TXT heritage=dynv6,owner=me,type=A":     true,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("second sync: got %v, want %v (plan %+v)", got, want, plan)
+	}
+
+	// PruneOnly keeps the RRsets it doesn't report as owned
+	p2, api2 := newFakeProvider(t)
+	api2.Seed(testutil.NewZoneFixture("example.dynv6.net").WithID(1).WithA("manual", "192.0.2.9"))
+	plan, err = p2.Sync(WithOptions(ctx, DryRun(), PruneOnly(func(zone string, s RRSet) bool { return s.Name != "manual" })), "example.dynv6.net", nil, true)
+	if err != nil || len(plan.Delete) != 0 {
+		t.Fatalf("PruneOnly: got %+v, %v", plan, err)
+	}
+}
+
+// largeZone returns a fixture of a zone with n records of mixed types, like
+// the zones of providers hosting many customers.
+func largeZone(n int) *testutil.ZoneFixture {
+	f := testutil.NewZoneFixture("example.dynv6.net").WithID(1)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("host%d", i/2)
+		switch i % 4 {
+		case 0, 1:
+			f.WithA(name, fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255))
+		case 2:
+			f.WithTXT(name, fmt.Sprintf("v=spf1 ip4:10.0.0.%d -all", i&255))
+		case 3:
+			f.WithMX(name, uint16(i%20), fmt.Sprintf("mx%d.example.org.", i))
+		}
+	}
+	return f
+}
+
+func BenchmarkGetRecords(b *testing.B) {
+	p, api := newFakeProvider(b)
+	p.RecordCacheTTL = time.Hour
+	api.Seed(largeZone(10000))
+	if _, err := p.GetRecords(ctx, "example.dynv6.net"); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.GetRecords(ctx, "example.dynv6.net"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPlanSync(b *testing.B) {
+	p, api := newFakeProvider(b)
+	api.Seed(largeZone(10000))
+	current, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil {
+		b.Fatal(err)
+	}
+	// change one record in a hundred
+	desired := append([]libdns.Record(nil), current...)
+	for i := 0; i < len(desired); i += 100 {
+		rr := desired[i].RR()
+		desired[i] = libdns.TXT{Name: rr.Name, Text: fmt.Sprintf("changed %d", i)}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		PlanSync(current, desired, true)
+	}
+}
+
+func TestGetRecordChanges(t *testing.T) {
+	p, api := newFakeProvider(t)
+	api.Seed(testutil.NewZoneFixture("example.dynv6.net").WithID(1).
+		WithA("www", "192.0.2.1").
+		WithTXT("txt", "hello").
+		WithMX("@", 10, "mail.example.org."))
+	changes, err := p.GetRecordChanges(ctx, "example.dynv6.net.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changes.Initial || len(changes.Added) != 3 || len(changes.Changed)+len(changes.Removed) != 0 {
+		t.Fatalf("initial call: got %+v", changes)
+	}
+	if changes, err = p.GetRecordChanges(ctx, "example.dynv6.net"); err != nil || changes.Initial || !changes.Empty() {
+		t.Fatalf("unchanged zone: got %+v, %v", changes, err)
+	}
+
+	if _, err := p.AppendRecords(ctx, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: "new", Text: "added"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: "txt", Text: "hello"}}); err != nil {
+		t.Fatal(err)
+	}
+	api.Lock()
+	for i, r := range api.Records[1] {
+		if r.Type == "A" {
+			api.Records[1][i].Data = "192.0.2.2"
+		}
+	}
+	api.Unlock()
+	changes, err = p.GetRecordChanges(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprint(changes.Added, changes.Changed, changes.Removed)
+	want := fmt.Sprint(
+		[]libdns.Record{libdns.TXT{Name: "new", Text: "added"}},
+		[]RecordChange{{Old: libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")}, New: libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2")}}},
+		[]libdns.Record{libdns.TXT{Name: "txt", Text: "hello"}},
+	)
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	p.ResetRecordChanges("example.dynv6.net")
+	if changes, err = p.GetRecordChanges(ctx, "example.dynv6.net"); err != nil || !changes.Initial || len(changes.Added) != 3 {
+		t.Fatalf("after reset: got %+v, %v", changes, err)
+	}
+}
+
+func TestApexName(t *testing.T) {
+	// dynv6 lists the apex with an empty name
+	p, api := newFakeProvider(t)
+	api.Seed(testutil.NewZoneFixture("example.dynv6.net").WithID(1).WithTXT("", "v=spf1 -all"))
+	recs, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].RR().Name != "@" {
+		t.Fatalf("got %v, want the apex named @", recs)
+	}
+	desired := []libdns.Record{libdns.TXT{Name: "@", Text: "v=spf1 -all"}}
+	plan, err := p.Sync(ctx, "example.dynv6.net", desired, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Fatalf("in sync zone planned %+v", plan)
+	}
+	if _, err := p.SetRecords(ctx, "example.dynv6.net", []libdns.Record{libdns.TXT{Name: "@", Text: "v=spf1 mx -all"}}); err != nil {
+		t.Fatal(err)
+	}
+	api.Lock()
+	n := len(api.Records[1])
+	api.Unlock()
+	if n != 1 {
+		t.Fatalf("SetRecords left %d apex records, want 1", n)
+	}
+}
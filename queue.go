@@ -0,0 +1,143 @@
+package dynv6
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// ErrQueueClosed is returned when records are queued after Close.
+var ErrQueueClosed = errors.New("Write queue is closed")
+
+// WriteQueue collects RRset updates and writes them asynchronously with
+// SetRecords. Updates of the same RRset arriving before the queue is flushed
+// are coalesced, so only the latest one is written. That saves API calls for
+// callers which change records often, e.g. DDNS clients on a flapping link.
+// Create it with NewWriteQueue; it is safe for concurrent use.
+type WriteQueue struct {
+	// OnError, if set, is called for every zone whose update fails,
+	// including failures of background flushes nobody waits for.
+	OnError func(zone string, err error)
+
+	p     *Provider
+	delay time.Duration
+
+	mu      sync.Mutex
+	pending map[string]map[rrsetKey]RRSet
+	order   []string
+	timer   *time.Timer
+	closed  bool
+	// flushMu serializes flushes, so updates are written in order
+	flushMu sync.Mutex
+}
+
+// NewWriteQueue returns a queue which writes queued updates delay after the
+// first of them arrived.
+func (p *Provider) NewWriteQueue(delay time.Duration) *WriteQueue {
+	return &WriteQueue{p: p, delay: delay, pending: map[string]map[rrsetKey]RRSet{}}
+}
+
+// Set queues the records as the new contents of their RRsets, replacing
+// any queued update of the same RRsets.
+func (q *WriteQueue) Set(zone string, recs []libdns.Record) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	key := zoneKey(zone)
+	sets, ok := q.pending[key]
+	if !ok {
+		sets = map[rrsetKey]RRSet{}
+		q.pending[key] = sets
+		q.order = append(q.order, zone)
+	}
+	for _, s := range GroupRRSets(recs) {
+		sets[s.key()] = s
+	}
+	if q.timer == nil {
+		q.timer = time.AfterFunc(q.delay, q.flushBackground)
+	}
+	return nil
+}
+
+// Pending returns the number of queued RRset updates.
+func (q *WriteQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, sets := range q.pending {
+		n += len(sets)
+	}
+	return n
+}
+
+func (q *WriteQueue) flushBackground() {
+	q.Flush(context.Background())
+}
+
+// Flush writes all queued updates now. It returns the first error; the
+// updates of a zone which failed are queued again, unless newer updates of
+// the same RRsets arrived meanwhile, and written by the next flush. A failed
+// background flush isn't retried until the next Set or Flush.
+func (q *WriteQueue) Flush(ctx context.Context) error {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+	q.mu.Lock()
+	pending, order := q.pending, q.order
+	q.pending, q.order = map[string]map[rrsetKey]RRSet{}, nil
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+	q.mu.Unlock()
+	var firstErr error
+	for _, zone := range order {
+		var recs []libdns.Record
+		for _, s := range pending[zoneKey(zone)] {
+			recs = append(recs, s.Records...)
+		}
+		if _, err := q.p.SetRecords(ctx, zone, recs); err != nil {
+			q.requeue(zone, pending[zoneKey(zone)])
+			if q.OnError != nil {
+				q.OnError(zone, err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// requeue queues the RRset updates of a failed flush again, keeping those
+// which were queued since.
+func (q *WriteQueue) requeue(zone string, failed map[rrsetKey]RRSet) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := zoneKey(zone)
+	sets, ok := q.pending[key]
+	if !ok {
+		sets = map[rrsetKey]RRSet{}
+		q.pending[key] = sets
+		q.order = append(q.order, zone)
+	}
+	for k, s := range failed {
+		if _, newer := sets[k]; !newer {
+			sets[k] = s
+		}
+	}
+}
+
+// Close flushes the queued updates and rejects further ones. Call it on
+// shutdown so no update is lost. If it fails, the failed updates stay
+// queued for another Flush.
+func (q *WriteQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	return q.Flush(ctx)
+}
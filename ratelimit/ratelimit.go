@@ -0,0 +1,114 @@
+// Package ratelimit limits the requests of each client of the servers of
+// the module, so a misbehaving client can't use up the dynv6 API quota the
+// server draws on for all of them.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/libdns/dynv6/httpauth"
+)
+
+// Limiter allows each client Rate requests per second on average, with
+// bursts of up to Burst requests, by a token bucket per client.
+type Limiter struct {
+	// Rate is the number of requests per second allowed per client.
+	Rate float64
+
+	// Burst is the number of requests a client may send at once. Defaults
+	// to Rate rounded up, at least 1.
+	Burst int
+
+	mu      sync.Mutex
+	clients map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Allow reports whether the client may send a request now, taking a token
+// if so. Otherwise it returns how long until the next request is allowed.
+// A nil Limiter allows all requests.
+func (l *Limiter) Allow(client string) (bool, time.Duration) {
+	if l == nil || l.Rate <= 0 {
+		return true, 0
+	}
+	burst := float64(l.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(l.Rate))
+	}
+	now := time.Now()
+	if l.now != nil {
+		now = l.now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.clients == nil {
+		l.clients = map[string]*bucket{}
+	}
+	b, ok := l.clients[client]
+	if !ok {
+		l.evict(now, burst)
+		b = &bucket{tokens: burst, last: now}
+		l.clients[client] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// evict forgets the clients whose buckets are full again, so the map
+// doesn't grow with every address that ever sent a request.
+func (l *Limiter) evict(now time.Time, burst float64) {
+	if len(l.clients) < 1024 {
+		return
+	}
+	for k, b := range l.clients {
+		if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= burst {
+			delete(l.clients, k)
+		}
+	}
+}
+
+// Handler returns h, answering requests of clients over their rate with
+// 429 Too Many Requests. Clients are told apart by their httpauth ID, or
+// by their address if they weren't authenticated. A nil Limiter returns h
+// unchanged.
+func (l *Limiter) Handler(h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.Allow(Client(r)); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Client returns the httpauth ID of the client which sent r, or its IP
+// address if it wasn't authenticated.
+func Client(r *http.Request) string {
+	if id := httpauth.ClientID(r.Context()); id != "" {
+		return id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
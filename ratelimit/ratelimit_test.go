@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := &Limiter{Rate: 2, Burst: 3, now: func() time.Time { return now }}
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d of the burst was limited", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("over the burst: got %v, %v", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("other clients are limited")
+	}
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("the bucket didn't refill")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("the bucket refilled too much")
+	}
+
+	var nilLimiter *Limiter
+	if ok, _ := nilLimiter.Allow("a"); !ok {
+		t.Fatal("a nil limiter limited")
+	}
+}
+
+func TestLimiterEviction(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := &Limiter{Rate: 1, Burst: 1, now: func() time.Time { return now }}
+	for i := 0; i < 1024; i++ {
+		l.Allow(strconv.Itoa(i))
+	}
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("new"); !ok {
+		t.Fatal("the first request of a new client was limited")
+	}
+	if ok, _ := l.Allow("new"); ok {
+		t.Fatal("a new client wasn't limited once the clients were evicted")
+	}
+	if len(l.clients) != 1 {
+		t.Fatalf("%d clients left, want 1", len(l.clients))
+	}
+}
+
+func TestHandler(t *testing.T) {
+	l := &Limiter{Rate: 0.5, Burst: 1}
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	do := func(remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/update", nil)
+		r.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+	if rec := do("192.0.2.1:1000"); rec.Code != http.StatusOK {
+		t.Fatalf("first request: got %d", rec.Code)
+	}
+	// the port doesn't make another client
+	rec := do("192.0.2.1:1001")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Fatalf("second request: got %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := do("192.0.2.2:1000"); rec.Code != http.StatusOK {
+		t.Fatalf("other client: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,314 @@
+package dynv6
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+)
+
+// RawRecord is returned for records of types this package doesn't model,
+// and for records whose data couldn't be parsed into the corresponding
+// libdns type. Writing a RawRecord sends its type and data verbatim.
+type RawRecord struct {
+	Name string
+	TTL  time.Duration
+	Type string
+	Data string
+
+	// ProviderData holds the dynv6api.Record the record was read from.
+	ProviderData interface{}
+}
+
+// RR implements libdns.Record.
+func (r RawRecord) RR() libdns.RR {
+	return libdns.RR{
+		Name: r.Name,
+		TTL:  r.TTL,
+		Type: r.Type,
+		Data: r.Data,
+	}
+}
+
+// Helpfunction: extracts .Data from the libdns.Record
+func getDataFromRecord(r libdns.Record) string {
+	return r.RR().Data
+}
+
+// Converts a dynv6 record to the matching libdns record type. Records that
+// can't be represented by a libdns type are returned as RawRecord.
+func toLibdnsRecord(r *dynv6api.Record) libdns.Record {
+	if r.Name == "" {
+		// dynv6 returns the apex with an empty name, callers use "@"
+		apex := *r
+		apex.Name = "@"
+		rec := toLibdnsRecord(&apex)
+		if raw, ok := rec.(RawRecord); ok {
+			raw.ProviderData = *r
+			return raw
+		}
+		return rec
+	}
+	switch strings.ToUpper(r.Type) {
+	case "SRV":
+		return srvFromAPI(r)
+	case "CAA":
+		return caaFromAPI(r)
+	case "MX":
+		return libdns.MX{
+			Name:       r.Name,
+			Preference: uint16(intValue(r.Priority)),
+			Target:     r.Data,
+		}
+	}
+	rr := libdns.RR{
+		Name: r.Name,
+		Type: r.Type,
+		Data: r.Data,
+	}
+	parsed, err := rr.Parse()
+	if err != nil {
+		return rawRecord(r, rr)
+	}
+	if _, ok := parsed.(libdns.RR); ok {
+		// libdns doesn't know the type
+		return rawRecord(r, rr)
+	}
+	return parsed
+}
+
+func rawRecord(r *dynv6api.Record, rr libdns.RR) RawRecord {
+	return RawRecord{
+		Name:         rr.Name,
+		TTL:          rr.TTL,
+		Type:         rr.Type,
+		Data:         rr.Data,
+		ProviderData: *r,
+	}
+}
+
+// SupportedTypes are the record types dynv6 accepts in a zone.
+var SupportedTypes = []string{"A", "AAAA", "CAA", "CNAME", "MX", "SPF", "SRV", "TXT"}
+
+// rejectedTypes are managed by dynv6 itself and can't be written, so writes
+// fail without asking the API.
+var rejectedTypes = map[string]bool{"NS": true, "SOA": true}
+
+// UnsupportedTypeError is returned when a record of a type dynv6 doesn't
+// accept is written.
+type UnsupportedTypeError struct {
+	Name      string
+	Type      string
+	Supported []string
+
+	// Err is the API error, if the type was rejected by dynv6.
+	Err error
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("Unsupported record type %s for %q, dynv6 supports %s", e.Type, e.Name, strings.Join(e.Supported, ", "))
+}
+
+func (e *UnsupportedTypeError) Unwrap() error {
+	return e.Err
+}
+
+func isSupportedType(typ string) bool {
+	for _, t := range SupportedTypes {
+		if strings.EqualFold(t, typ) {
+			return true
+		}
+	}
+	return false
+}
+
+func unsupportedType(r *dynv6api.Record, err error) error {
+	return &UnsupportedTypeError{
+		Name:      r.Name,
+		Type:      r.Type,
+		Supported: append([]string(nil), SupportedTypes...),
+		Err:       err,
+	}
+}
+
+// Converts a validation error of the API for a record of an unknown type
+// into an UnsupportedTypeError.
+func writeError(r *dynv6api.Record, err error) error {
+	var apiErr *dynv6api.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity && !isSupportedType(r.Type) {
+		return unsupportedType(r, err)
+	}
+	return err
+}
+
+// Creates a dynv6 record from the libdns.Record
+func fromLibdnsRecord(zone string, r *libdns.Record) (*dynv6api.Record, error) {
+	if *r == nil {
+		return nil, fmt.Errorf("unsupported record type: %T", *r)
+	}
+	rr := (*r).RR()
+	if rejectedTypes[strings.ToUpper(rr.Type)] {
+		return nil, unsupportedType(&dynv6api.Record{Name: rr.Name, Type: rr.Type}, nil)
+	}
+	rec := &dynv6api.Record{
+		Name: rr.Name,
+		Type: rr.Type,
+		Data: rr.Data,
+	}
+	if _, ok := (*r).(RawRecord); ok {
+		return rec, nil
+	}
+	switch strings.ToUpper(rr.Type) {
+	case "MX":
+		mx, ok := (*r).(libdns.MX)
+		if !ok {
+			parsed, err := parseRR(rr)
+			if err != nil {
+				return nil, err
+			}
+			if mx, ok = parsed.(libdns.MX); !ok {
+				return nil, fmt.Errorf("cannot parse %s record %q", rr.Type, rr.Data)
+			}
+		}
+		rec.Data = mx.Target
+		rec.Priority = intPtr(int(mx.Preference))
+	case "SRV":
+		srv, ok := (*r).(libdns.SRV)
+		if !ok {
+			parsed, err := parseRR(rr)
+			if err != nil {
+				return nil, err
+			}
+			if srv, ok = parsed.(libdns.SRV); !ok {
+				return nil, fmt.Errorf("cannot parse %s record %q", rr.Type, rr.Data)
+			}
+		}
+		rec.Name = srv.RR().Name
+		rec.Data = srv.Target
+		rec.Priority = intPtr(int(srv.Priority))
+		rec.Weight = intPtr(int(srv.Weight))
+		rec.Port = intPtr(int(srv.Port))
+	case "CAA":
+		caa, ok := (*r).(libdns.CAA)
+		if !ok {
+			parsed, err := parseRR(rr)
+			if err != nil {
+				return nil, err
+			}
+			if caa, ok = parsed.(libdns.CAA); !ok {
+				return nil, fmt.Errorf("cannot parse %s record %q", rr.Type, rr.Data)
+			}
+		}
+		caa.Tag = strings.ToLower(caa.Tag)
+		if err := validateCAA(caa.Flags, caa.Tag); err != nil {
+			return nil, err
+		}
+		rec.Data = unquote(caa.Value)
+		rec.Flags = intPtr(int(caa.Flags))
+		rec.Tag = caa.Tag
+	}
+	return rec, nil
+}
+
+// parseRR parses a copy of rr with an upper-cased type, as libdns matches
+// the type case-sensitively and leaves an unknown type an RR.
+func parseRR(rr libdns.RR) (libdns.Record, error) {
+	rr.Type = strings.ToUpper(rr.Type)
+	return rr.Parse()
+}
+
+// caaFromAPI converts a CAA record, whose data is only the value of the
+// record.
+func caaFromAPI(r *dynv6api.Record) libdns.Record {
+	return libdns.CAA{
+		Name:  r.Name,
+		Flags: uint8(intValue(r.Flags)),
+		Tag:   r.Tag,
+		Value: unquote(r.Data),
+	}
+}
+
+func unquote(s string) string {
+	if v, err := strconv.Unquote(s); err == nil && strings.HasPrefix(s, `"`) {
+		return v
+	}
+	return s
+}
+
+// srvFromAPI converts an SRV record, whose name is _service._proto[.name]
+// and whose data is only the target of the record.
+func srvFromAPI(r *dynv6api.Record) libdns.Record {
+	labels := strings.SplitN(r.Name, ".", 3)
+	if len(labels) < 2 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+		return rawRecord(r, libdns.RR{Name: r.Name, Type: r.Type, Data: r.Data})
+	}
+	name := "@"
+	if len(labels) == 3 {
+		name = labels[2]
+	}
+	return libdns.SRV{
+		Service:   strings.TrimPrefix(labels[0], "_"),
+		Transport: strings.TrimPrefix(labels[1], "_"),
+		Name:      name,
+		Priority:  uint16(intValue(r.Priority)),
+		Weight:    uint16(intValue(r.Weight)),
+		Port:      uint16(intValue(r.Port)),
+		Target:    r.Data,
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func intValue(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// withTTL sets the TTL of r if it has none.
+func withTTL(r libdns.Record, ttl time.Duration) libdns.Record {
+	if ttl <= 0 || r.RR().TTL != 0 {
+		return r
+	}
+	switch v := r.(type) {
+	case libdns.Address:
+		v.TTL = ttl
+		return v
+	case libdns.CAA:
+		v.TTL = ttl
+		return v
+	case libdns.CNAME:
+		v.TTL = ttl
+		return v
+	case libdns.MX:
+		v.TTL = ttl
+		return v
+	case libdns.NS:
+		v.TTL = ttl
+		return v
+	case libdns.SRV:
+		v.TTL = ttl
+		return v
+	case libdns.ServiceBinding:
+		v.TTL = ttl
+		return v
+	case libdns.TXT:
+		v.TTL = ttl
+		return v
+	case libdns.RR:
+		v.TTL = ttl
+		return v
+	case RawRecord:
+		v.TTL = ttl
+		return v
+	}
+	return r
+}
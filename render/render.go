@@ -0,0 +1,173 @@
+// Package render formats record changes for humans. The CLI writes the
+// plans of sync and rollback with it, for confirmation and with -dry-run,
+// as well as the journal entries listed by history, and notify uses it for
+// the text of drift notifications. Changes are written as lines like
+// "+ A www 203.0.113.7" or "~ TXT _acme-challenge: 'old' -> 'new'", with
+// the columns aligned.
+package render
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/libdns"
+)
+
+// Kinds of a Change, used as the marker of its line.
+const (
+	Create = '+'
+	Update = '~'
+	Delete = '-'
+)
+
+// Change is a single record change.
+type Change struct {
+	Kind byte
+	Name string
+	Type string
+	// Old is the data before the change, empty for creates.
+	Old string
+	// New is the data after the change, empty for deletes.
+	New string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%c %s %s", c.Kind, c.Type, strings.Replace(c.describe(), "\t", " ", 1))
+}
+
+func (c Change) describe() string {
+	name := c.Name
+	if name == "" {
+		name = "@"
+	}
+	switch c.Kind {
+	case Update:
+		return fmt.Sprintf("%s:\t%s -> %s", name, quote(c.Old), quote(c.New))
+	case Delete:
+		return name + "\t" + c.Old
+	}
+	return name + "\t" + c.New
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+// Changes lists the changes of a plan. A delete and a create of the same
+// RRset are paired into an update, so replacing a value reads as one
+// change.
+func Changes(plan dynv6.Plan) []Change {
+	deletes := append([]libdns.Record(nil), plan.Delete...)
+	creates := append([]libdns.Record(nil), plan.Create...)
+	dynv6.SortRecords(deletes)
+	dynv6.SortRecords(creates)
+	var changes []Change
+	used := make([]bool, len(creates))
+	for _, d := range deletes {
+		old := d.RR()
+		c := Change{Kind: Delete, Name: old.Name, Type: old.Type, Old: old.Data}
+		for i, r := range creates {
+			if rr := r.RR(); !used[i] && sameRRSet(old, rr) {
+				used[i] = true
+				c.Kind, c.New = Update, rr.Data
+				break
+			}
+		}
+		changes = append(changes, c)
+	}
+	for i, r := range creates {
+		if !used[i] {
+			rr := r.RR()
+			changes = append(changes, Change{Kind: Create, Name: rr.Name, Type: rr.Type, New: rr.Data})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		return dynv6.CompareRecords(libdns.RR{Name: a.Name, Type: a.Type}, libdns.RR{Name: b.Name, Type: b.Type}) < 0
+	})
+	return changes
+}
+
+// Records lists the records as changes of the given kind.
+func Records(kind byte, recs []libdns.Record) []Change {
+	changes := make([]Change, 0, len(recs))
+	for _, r := range recs {
+		rr := r.RR()
+		c := Change{Kind: kind, Name: rr.Name, Type: rr.Type}
+		if kind == Delete {
+			c.Old = rr.Data
+		} else {
+			c.New = rr.Data
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func sameRRSet(a, b libdns.RR) bool {
+	return strings.EqualFold(a.Name, b.Name) && strings.EqualFold(a.Type, b.Type)
+}
+
+// Options control how changes are written.
+type Options struct {
+	// Color marks creates green, updates yellow and deletes red with ANSI
+	// escape codes.
+	Color bool
+}
+
+var colors = map[byte]string{
+	Create: "\x1b[32m",
+	Update: "\x1b[33m",
+	Delete: "\x1b[31m",
+}
+
+const colorReset = "\x1b[0m"
+
+// Text writes the changes as lines with aligned columns.
+func (o Options) Text(w io.Writer, changes []Change) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	for _, c := range changes {
+		// all colors have the same length, so the columns stay aligned
+		start, end := "", ""
+		if o.Color {
+			start, end = colors[c.Kind], colorReset
+		}
+		fmt.Fprintf(tw, "%s%c %s\t%s%s\n", start, c.Kind, c.Type, c.describe(), end)
+	}
+	return tw.Flush()
+}
+
+// Plan writes the changes of a plan, or "No changes." if it is empty.
+func (o Options) Plan(w io.Writer, plan dynv6.Plan) error {
+	if plan.Empty() {
+		_, err := io.WriteString(w, "No changes.\n")
+		return err
+	}
+	return o.Text(w, Changes(plan))
+}
+
+// Text writes the changes without colors, see Options.Text.
+func Text(w io.Writer, changes []Change) error {
+	return Options{}.Text(w, changes)
+}
+
+// Plan writes the changes of a plan without colors, see Options.Plan.
+func Plan(w io.Writer, plan dynv6.Plan) error {
+	return Options{}.Plan(w, plan)
+}
+
+// ColorEnabled reports whether output to f should be colored: f must be a
+// terminal, and neither NO_COLOR (https://no-color.org) nor TERM=dumb may
+// be set.
+func ColorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
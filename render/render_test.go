@@ -0,0 +1,65 @@
+package render
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/libdns"
+)
+
+func TestPlan(t *testing.T) {
+	plan := dynv6.Plan{
+		Create: []libdns.Record{
+			libdns.TXT{Name: "_acme-challenge", Text: "new"},
+			libdns.RR{Name: "www", Type: "A", Data: "203.0.113.7"},
+		},
+		Delete: []libdns.Record{
+			libdns.TXT{Name: "_acme-challenge", Text: "old"},
+			libdns.RR{Name: "@", Type: "MX", Data: "10 mail.example.org."},
+		},
+	}
+	var b strings.Builder
+	if err := Plan(&b, plan); err != nil {
+		t.Fatal(err)
+	}
+	want := "- MX  @                10 mail.example.org.\n" +
+		"~ TXT _acme-challenge: 'old' -> 'new'\n" +
+		"+ A   www              203.0.113.7\n"
+	if b.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	changes := Changes(plan)
+	if s := changes[1].String(); s != "~ TXT _acme-challenge: 'old' -> 'new'" {
+		t.Fatalf("unexpected string %q", s)
+	}
+
+	b.Reset()
+	Plan(&b, dynv6.Plan{})
+	if b.String() != "No changes.\n" {
+		t.Fatalf("got %q for an empty plan", b.String())
+	}
+}
+
+func TestColor(t *testing.T) {
+	var b strings.Builder
+	changes := []Change{
+		{Kind: Create, Name: "www", Type: "A", New: "203.0.113.7"},
+		{Kind: Delete, Name: "mail", Type: "AAAA", Old: "2001:db8::1"},
+	}
+	if err := (Options{Color: true}).Text(&b, changes); err != nil {
+		t.Fatal(err)
+	}
+	want := "\x1b[32m+ A    www  203.0.113.7\x1b[0m\n" +
+		"\x1b[31m- AAAA mail 2001:db8::1\x1b[0m\n"
+	if b.String() != want {
+		t.Fatalf("got %q, want %q", b.String(), want)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if ColorEnabled(os.Stdout) {
+		t.Fatal("color enabled despite NO_COLOR")
+	}
+}
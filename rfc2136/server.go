@@ -0,0 +1,483 @@
+// Package rfc2136 implements a small DNS server that accepts TSIG-authenticated
+// RFC 2136 UPDATE messages and applies them to dynv6 zones through a libdns
+// provider. It allows DHCP servers, Windows clients and tools like nsupdate to
+// update dynv6 zones without knowing about the dynv6 REST API.
+package rfc2136
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/dynv6/accesslog"
+	"github.com/libdns/dynv6/ratelimit"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// Provider is the set of libdns interfaces the server needs to apply updates.
+type Provider interface {
+	libdns.RecordGetter
+	libdns.RecordAppender
+	libdns.RecordDeleter
+}
+
+// Server translates RFC 2136 dynamic updates into provider calls.
+type Server struct {
+	// Provider applies the updates. It is required.
+	Provider Provider
+
+	// Keys maps TSIG key names (e.g. "dhcp.example.") to their base64 encoded
+	// secrets. Every UPDATE message must be signed with one of these keys.
+	Keys map[string]string
+
+	// Zones optionally restricts the zones that may be updated. If empty,
+	// every zone named in an UPDATE message is passed to the provider.
+	Zones []string
+
+	// Timeout bounds the provider calls made for a single UPDATE message.
+	// Defaults to 30 seconds.
+	Timeout time.Duration
+
+	// ErrorLog receives errors returned by the provider. If nil, the
+	// standard logger is used.
+	ErrorLog *log.Logger
+
+	// DrainTimeout is how long updates in progress may take to finish once
+	// ListenAndServe is stopped. Defaults to Timeout.
+	DrainTimeout time.Duration
+
+	// AccessLog, if set, receives a line per message in logfmt, with the
+	// TSIG key as the client.
+	AccessLog *log.Logger
+
+	// RateLimit, if set, limits the UPDATE messages of each TSIG key.
+	// Messages over the limit are answered with REFUSED without calling
+	// the provider.
+	RateLimit *ratelimit.Limiter
+
+	mu    sync.Mutex
+	zones map[string]*sync.Mutex
+}
+
+// ListenAndServe listens on addr for both UDP and TCP and serves UPDATE
+// messages until ctx is canceled.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	if s.Provider == nil {
+		return errors.New("rfc2136: no provider configured")
+	}
+	if len(s.Keys) == 0 {
+		return errors.New("rfc2136: no TSIG keys configured")
+	}
+	secrets := make(map[string]string, len(s.Keys))
+	for name, secret := range s.Keys {
+		secrets[dns.CanonicalName(name)] = secret
+	}
+	servers := []*dns.Server{
+		{Addr: addr, Net: "udp", Handler: s, TsigSecret: secrets, MsgAcceptFunc: acceptUpdate},
+		{Addr: addr, Net: "tcp", Handler: s, TsigSecret: secrets, MsgAcceptFunc: acceptUpdate},
+	}
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *dns.Server) {
+			errs <- srv.ListenAndServe()
+		}(srv)
+	}
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+	timeout := s.DrainTimeout
+	if timeout <= 0 {
+		timeout = s.Timeout
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, srv := range servers {
+		// servers that failed to start return an error here, which is expected
+		if shutdownErr := srv.ShutdownContext(shutdownCtx); errors.Is(shutdownErr, context.DeadlineExceeded) && err == nil {
+			err = fmt.Errorf("rfc2136: drain timeout of %v exceeded: %w", timeout, shutdownErr)
+		}
+	}
+	return err
+}
+
+// acceptUpdate extends dns.DefaultMsgAcceptFunc, which rejects UPDATE
+// messages, to let them through.
+func acceptUpdate(dh dns.Header) dns.MsgAcceptAction {
+	if int(dh.Bits>>11)&0xF == dns.OpcodeUpdate {
+		return dns.MsgAccept
+	}
+	return dns.DefaultMsgAcceptFunc(dh)
+}
+
+// ServeDNS implements dns.Handler.
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	start := time.Now()
+	m := new(dns.Msg)
+	m.SetReply(r)
+	tsig := r.IsTsig()
+	client := "-"
+	if tsig != nil && w.TsigStatus() == nil {
+		client = strings.TrimSuffix(tsig.Hdr.Name, ".")
+	}
+	switch {
+	case r.Opcode != dns.OpcodeUpdate:
+		m.Rcode = dns.RcodeNotImplemented
+	case tsig == nil || w.TsigStatus() != nil:
+		m.Rcode = dns.RcodeNotAuth
+	case !s.allow(client):
+		m.Rcode = dns.RcodeRefused
+	default:
+		timeout := s.Timeout
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		m.Rcode = s.update(ctx, r)
+		cancel()
+	}
+	if tsig != nil && w.TsigStatus() == nil {
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	}
+	_ = w.WriteMsg(m)
+	if s.AccessLog != nil {
+		zone := "-"
+		if len(r.Question) == 1 {
+			zone = strings.TrimSuffix(r.Question[0].Name, ".")
+		}
+		accesslog.Print(s.AccessLog, "time", start.UTC().Format(time.RFC3339), "client", client, "remote", w.RemoteAddr(),
+			"opcode", dns.OpcodeToString[r.Opcode], "zone", zone, "rcode", dns.RcodeToString[m.Rcode],
+			"duration", time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// allow reports whether the rate limit lets the TSIG key send another
+// message.
+func (s *Server) allow(key string) bool {
+	ok, _ := s.RateLimit.Allow(key)
+	return ok
+}
+
+// update processes the zone, prerequisite and update sections of r as
+// described in RFC 2136 section 3 and returns the response code.
+func (s *Server) update(ctx context.Context, r *dns.Msg) int {
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	zone := dns.CanonicalName(r.Question[0].Name)
+	if !s.allowedZone(zone) {
+		return dns.RcodeNotAuth
+	}
+	// updates of a zone are serialized (RFC 2136 section 3.7), so an update
+	// can't pass its prerequisites and then overwrite a concurrent one
+	unlock := s.lockZone(zone)
+	defer unlock()
+	existing, err := s.Provider.GetRecords(ctx, zone)
+	if err != nil {
+		s.logf("rfc2136: getting records of %s: %v", zone, err)
+		return dns.RcodeServerFailure
+	}
+	current := make([]libdns.RR, 0, len(existing))
+	for _, rec := range existing {
+		current = append(current, rec.RR())
+	}
+
+	if rcode := checkPrerequisites(zone, current, r.Answer); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+	if rcode := prescan(zone, r.Ns); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	desired := append([]libdns.RR(nil), current...)
+	for _, rr := range r.Ns {
+		desired = applyUpdate(zone, desired, rr)
+	}
+
+	var toDelete, toAppend []libdns.Record
+	for _, rr := range current {
+		if !containsRR(desired, rr) {
+			toDelete = append(toDelete, rr)
+		}
+	}
+	for _, rr := range desired {
+		if !containsRR(current, rr) {
+			toAppend = append(toAppend, rr)
+		}
+	}
+	if len(toDelete) > 0 {
+		if _, err := s.Provider.DeleteRecords(ctx, zone, toDelete); err != nil {
+			s.logf("rfc2136: deleting records from %s: %v", zone, err)
+			return dns.RcodeServerFailure
+		}
+	}
+	if len(toAppend) > 0 {
+		if _, err := s.Provider.AppendRecords(ctx, zone, toAppend); err != nil {
+			s.logf("rfc2136: appending records to %s: %v", zone, err)
+			return dns.RcodeServerFailure
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// lockZone locks the zone against other UPDATE messages and returns the
+// function releasing it.
+func (s *Server) lockZone(zone string) func() {
+	s.mu.Lock()
+	if s.zones == nil {
+		s.zones = map[string]*sync.Mutex{}
+	}
+	mu, ok := s.zones[zone]
+	if !ok {
+		mu = new(sync.Mutex)
+		s.zones[zone] = mu
+	}
+	s.mu.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (s *Server) allowedZone(zone string) bool {
+	if len(s.Zones) == 0 {
+		return true
+	}
+	for _, z := range s.Zones {
+		if dns.CanonicalName(z) == zone {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// checkPrerequisites evaluates the prerequisite section (RFC 2136 section
+// 3.2) against the current records of the zone.
+func checkPrerequisites(zone string, current []libdns.RR, prereqs []dns.RR) int {
+	var valueSets []libdns.RR
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		if hdr.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(zone, dns.CanonicalName(hdr.Name)) {
+			return dns.RcodeNotZone
+		}
+		name := relativeName(hdr.Name, zone)
+		typ := dns.TypeToString[hdr.Rrtype]
+		switch hdr.Class {
+		case dns.ClassANY:
+			if hdr.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if !nameInUse(current, name) {
+					return dns.RcodeNameError
+				}
+			} else if !rrsetExists(current, name, typ) {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if hdr.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if nameInUse(current, name) {
+					return dns.RcodeYXDomain
+				}
+			} else if rrsetExists(current, name, typ) {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			valueSets = append(valueSets, toLibdnsRR(zone, rr))
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	// value dependent prerequisites must match the RRsets exactly
+	for _, want := range valueSets {
+		var wantSet, haveSet []libdns.RR
+		for _, rr := range valueSets {
+			if sameNameType(rr, want.Name, want.Type) {
+				wantSet = append(wantSet, rr)
+			}
+		}
+		for _, rr := range current {
+			if sameNameType(rr, want.Name, want.Type) {
+				haveSet = append(haveSet, rr)
+			}
+		}
+		if len(haveSet) == 0 || !sameSet(wantSet, haveSet) {
+			return dns.RcodeNXRrset
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// prescan validates the update section (RFC 2136 section 3.4.1).
+func prescan(zone string, updates []dns.RR) int {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		if !dns.IsSubDomain(zone, dns.CanonicalName(hdr.Name)) {
+			return dns.RcodeNotZone
+		}
+		switch hdr.Class {
+		case dns.ClassINET:
+			switch hdr.Rrtype {
+			case dns.TypeANY, dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB:
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if hdr.Ttl != 0 || hdr.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// applyUpdate applies a single update RR (RFC 2136 section 3.4.2) to recs and
+// returns the result. The apex SOA and NS records are managed by dynv6 and
+// are never changed.
+func applyUpdate(zone string, recs []libdns.RR, rr dns.RR) []libdns.RR {
+	hdr := rr.Header()
+	name := normalizeName(relativeName(hdr.Name, zone))
+	typ := dns.TypeToString[hdr.Rrtype]
+	if hdr.Rrtype == dns.TypeSOA || (name == "@" && hdr.Rrtype == dns.TypeNS) {
+		return recs
+	}
+	switch hdr.Class {
+	case dns.ClassINET:
+		add := toLibdnsRR(zone, rr)
+		if !containsRR(recs, add) {
+			recs = append(recs, add)
+		}
+		return recs
+	case dns.ClassANY:
+		out := recs[:0:0]
+		for _, r := range recs {
+			if normalizeName(r.Name) == name && (hdr.Rrtype == dns.TypeANY || r.Type == typ) {
+				if name == "@" && (r.Type == "SOA" || r.Type == "NS") {
+					out = append(out, r)
+				}
+				continue
+			}
+			out = append(out, r)
+		}
+		return out
+	case dns.ClassNONE:
+		del := toLibdnsRR(zone, rr)
+		out := recs[:0:0]
+		for _, r := range recs {
+			if !sameRR(r, del) {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+	return recs
+}
+
+// toLibdnsRR converts a DNS resource record to a libdns.RR relative to zone.
+func toLibdnsRR(zone string, rr dns.RR) libdns.RR {
+	hdr := rr.Header()
+	var data string
+	switch v := rr.(type) {
+	case *dns.TXT:
+		data = strings.Join(v.Txt, "")
+	default:
+		data = strings.TrimPrefix(rr.String(), hdr.String())
+	}
+	return libdns.RR{
+		Name: relativeName(hdr.Name, zone),
+		Type: dns.TypeToString[hdr.Rrtype],
+		TTL:  time.Duration(hdr.Ttl) * time.Second,
+		Data: data,
+	}
+}
+
+func relativeName(fqdn, zone string) string {
+	return libdns.RelativeName(dns.CanonicalName(fqdn), zone)
+}
+
+func normalizeName(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" {
+		return "@"
+	}
+	return name
+}
+
+func normalizeData(data string) string {
+	return strings.TrimSuffix(strings.TrimSpace(data), ".")
+}
+
+func sameNameType(rr libdns.RR, name, typ string) bool {
+	return normalizeName(rr.Name) == normalizeName(name) && strings.EqualFold(rr.Type, typ)
+}
+
+func sameRR(a, b libdns.RR) bool {
+	return sameNameType(a, b.Name, b.Type) && normalizeData(a.Data) == normalizeData(b.Data)
+}
+
+func containsRR(recs []libdns.RR, rr libdns.RR) bool {
+	for _, r := range recs {
+		if sameRR(r, rr) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameSet(a, b []libdns.RR) bool {
+	for _, rr := range a {
+		if !containsRR(b, rr) {
+			return false
+		}
+	}
+	for _, rr := range b {
+		if !containsRR(a, rr) {
+			return false
+		}
+	}
+	return true
+}
+
+func nameInUse(recs []libdns.RR, name string) bool {
+	for _, r := range recs {
+		if normalizeName(r.Name) == normalizeName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func rrsetExists(recs []libdns.RR, name, typ string) bool {
+	for _, r := range recs {
+		if sameNameType(r, name, typ) {
+			return true
+		}
+	}
+	return false
+}
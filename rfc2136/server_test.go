@@ -0,0 +1,280 @@
+package rfc2136
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/dynv6/ratelimit"
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+type fakeProvider struct {
+	mu   sync.Mutex
+	recs []libdns.RR
+	// delay is how long GetRecords takes to return the records it read,
+	// to let concurrent updates overlap.
+	delay time.Duration
+}
+
+func (f *fakeProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	var out []libdns.Record
+	for _, r := range f.records() {
+		out = append(out, r)
+	}
+	time.Sleep(f.delay)
+	return out, nil
+}
+
+// records returns a copy of the records, for tests racing the server.
+func (f *fakeProvider) records() []libdns.RR {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]libdns.RR(nil), f.recs...)
+}
+
+func (f *fakeProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range recs {
+		f.recs = append(f.recs, r.RR())
+	}
+	return recs, nil
+}
+
+func (f *fakeProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range recs {
+		for i, v := range f.recs {
+			if sameRR(v, r.RR()) {
+				f.recs = append(f.recs[:i], f.recs[i+1:]...)
+				break
+			}
+		}
+	}
+	return recs, nil
+}
+
+func newUpdate(t *testing.T, zone string, prereq func(m *dns.Msg), updates []string, deletes []string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetUpdate(zone)
+	if prereq != nil {
+		prereq(m)
+	}
+	var ins []dns.RR
+	for _, s := range updates {
+		ins = append(ins, mustRR(t, s))
+	}
+	if len(ins) > 0 {
+		m.Insert(ins)
+	}
+	var del []dns.RR
+	for _, s := range deletes {
+		del = append(del, mustRR(t, s))
+	}
+	if len(del) > 0 {
+		m.RemoveRRset(del)
+	}
+	// round trip through the wire format so Rdlength is populated
+	buf, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(dns.Msg)
+	if err := out.Unpack(buf); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+func TestUpdateAddAndDeleteRRset(t *testing.T) {
+	p := &fakeProvider{recs: []libdns.RR{
+		{Name: "host", Type: "A", Data: "192.0.2.1"},
+		{Name: "host", Type: "TXT", Data: "keep"},
+	}}
+	s := &Server{Provider: p}
+	m := newUpdate(t, "example.dynv6.net.", nil,
+		[]string{`host.example.dynv6.net. 60 IN AAAA 2001:db8::1`, `_acme-challenge.example.dynv6.net. 60 IN TXT "token value"`},
+		[]string{`host.example.dynv6.net. 0 IN A 0.0.0.0`})
+	if rcode := s.update(context.Background(), m); rcode != dns.RcodeSuccess {
+		t.Fatalf("unexpected rcode %s", dns.RcodeToString[rcode])
+	}
+	want := []libdns.RR{
+		{Name: "host", Type: "TXT", Data: "keep"},
+		{Name: "host", Type: "AAAA", Data: "2001:db8::1"},
+		{Name: "_acme-challenge", Type: "TXT", Data: "token value"},
+	}
+	if got := p.records(); !sameSet(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestUpdatePrerequisites(t *testing.T) {
+	p := &fakeProvider{recs: []libdns.RR{
+		{Name: "host", Type: "A", Data: "192.0.2.1"},
+	}}
+	s := &Server{Provider: p}
+	tests := []struct {
+		rr    string
+		used  bool // value dependent prerequisite
+		rcode int
+	}{
+		{`host.example.dynv6.net. 0 IN A 0.0.0.0`, false, dns.RcodeSuccess},
+		{`other.example.dynv6.net. 0 IN A 0.0.0.0`, false, dns.RcodeNXRrset},
+		{`host.example.dynv6.net. 0 IN A 192.0.2.1`, true, dns.RcodeSuccess},
+		{`host.example.dynv6.net. 0 IN A 192.0.2.2`, true, dns.RcodeNXRrset},
+		{`host.example.other. 0 IN A 0.0.0.0`, false, dns.RcodeNotZone},
+	}
+	for _, test := range tests {
+		rr := mustRR(t, test.rr)
+		m := newUpdate(t, "example.dynv6.net.", func(m *dns.Msg) {
+			if test.used {
+				m.Used([]dns.RR{rr})
+			} else {
+				m.RRsetUsed([]dns.RR{rr})
+			}
+		}, nil, nil)
+		if rcode := s.update(context.Background(), m); rcode != test.rcode {
+			t.Errorf("%s: got rcode %s, want %s", test.rr, dns.RcodeToString[rcode], dns.RcodeToString[test.rcode])
+		}
+	}
+}
+
+func TestUpdateSerialized(t *testing.T) {
+	p := &fakeProvider{delay: 20 * time.Millisecond}
+	s := &Server{Provider: p}
+	// both updates add the A record only if the name has none yet
+	rcodes := make(chan int, 2)
+	for _, addr := range []string{"192.0.2.1", "192.0.2.2"} {
+		m := newUpdate(t, "example.dynv6.net.", func(m *dns.Msg) {
+			m.RRsetNotUsed([]dns.RR{mustRR(t, `host.example.dynv6.net. 0 IN A 0.0.0.0`)})
+		}, []string{`host.example.dynv6.net. 60 IN A ` + addr}, nil)
+		go func() {
+			rcodes <- s.update(context.Background(), m)
+		}()
+	}
+	var ok int
+	for i := 0; i < 2; i++ {
+		if <-rcodes == dns.RcodeSuccess {
+			ok++
+		}
+	}
+	if got := p.records(); ok != 1 || len(got) != 1 {
+		t.Fatalf("%d updates succeeded, records %+v", ok, got)
+	}
+}
+
+func TestUpdateIgnoresApexNS(t *testing.T) {
+	p := &fakeProvider{}
+	s := &Server{Provider: p}
+	m := newUpdate(t, "example.dynv6.net.", nil, []string{`example.dynv6.net. 60 IN NS ns.example.org.`}, nil)
+	if rcode := s.update(context.Background(), m); rcode != dns.RcodeSuccess {
+		t.Fatalf("unexpected rcode %s", dns.RcodeToString[rcode])
+	}
+	if len(p.records()) != 0 {
+		t.Fatalf("apex NS must not be written, got %+v", p.records())
+	}
+}
+
+func TestServeTSIG(t *testing.T) {
+	const (
+		keyName = "test-key."
+		secret  = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+	)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	p := &fakeProvider{}
+	logs := &syncBuffer{}
+	s := &Server{
+		Provider:  p,
+		Keys:      map[string]string{keyName: secret},
+		AccessLog: log.New(logs, "", 0),
+		RateLimit: &ratelimit.Limiter{Rate: 0.01, Burst: 1},
+	}
+	srv := &dns.Server{PacketConn: pc, Handler: s, TsigSecret: map[string]string{keyName: secret}, MsgAcceptFunc: acceptUpdate}
+	go srv.ActivateAndServe()
+	defer srv.Shutdown()
+
+	c := &dns.Client{TsigSecret: map[string]string{keyName: secret}, Timeout: 5 * time.Second}
+	m := new(dns.Msg)
+	m.SetUpdate("example.dynv6.net.")
+	m.Insert([]dns.RR{mustRR(t, `www.example.dynv6.net. 60 IN A 192.0.2.7`)})
+
+	// unsigned updates are refused
+	resp, _, err := c.Exchange(m.Copy(), pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Rcode != dns.RcodeNotAuth {
+		t.Fatalf("unsigned update: got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	m.SetTsig(keyName, dns.HmacSHA256, 300, time.Now().Unix())
+	resp, _, err = c.Exchange(m, pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("signed update: got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+	if recs := p.records(); len(recs) != 1 || recs[0].Data != "192.0.2.7" {
+		t.Fatalf("unexpected records %s", fmt.Sprint(recs))
+	}
+
+	// the key used up its burst
+	m.SetTsig(keyName, dns.HmacSHA256, 300, time.Now().Unix())
+	resp, _, err = c.Exchange(m, pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Rcode != dns.RcodeRefused {
+		t.Fatalf("update over the rate limit: got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+	if len(p.records()) != 1 {
+		t.Fatalf("update over the rate limit reached the provider: %v", p.records())
+	}
+	// the line is logged after the response is sent
+	for deadline := time.Now().Add(time.Second); strings.Count(logs.String(), "\n") < 3 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "client=- ") || !strings.Contains(lines[1], "client=test-key ") ||
+		!strings.Contains(lines[1], "zone=example.dynv6.net rcode=NOERROR") || !strings.Contains(lines[2], "rcode=REFUSED") {
+		t.Fatalf("unexpected access log:\n%s", logs.String())
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,150 @@
+package dynv6
+
+import (
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// RRSet is the set of records with the same name and type.
+type RRSet struct {
+	Name    string
+	Type    string
+	Records []libdns.Record
+}
+
+// rrsetKey identifies an RRset. Names and types are case-insensitive.
+type rrsetKey struct {
+	name, typ string
+}
+
+func keyOf(rr libdns.RR) rrsetKey {
+	return rrsetKey{keyName(rr.Name), strings.ToUpper(rr.Type)}
+}
+
+// keyName is the name of an RRset key. The apex is "@", whether it is named
+// so or, like dynv6 lists it, empty.
+func keyName(name string) string {
+	if name == "" {
+		return "@"
+	}
+	return strings.ToLower(name)
+}
+
+// GroupRRSets groups records into RRsets, in the order defined by
+// CompareRecords. Duplicate records are kept only once.
+func GroupRRSets(recs []libdns.Record) []RRSet {
+	keyed := groupKeyed(recs)
+	if len(keyed) == 0 {
+		return nil
+	}
+	sets := make([]RRSet, len(keyed))
+	for i := range keyed {
+		sets[i] = keyed[i].RRSet
+	}
+	return sets
+}
+
+// keyedSet is an RRSet with the sort keys of its records, so comparing
+// sets doesn't call RR again for every pair of records.
+type keyedSet struct {
+	RRSet
+	keys []sortKey
+}
+
+// groupKeyed is GroupRRSets keeping the keys. The records and keys of the
+// sets are windows of one sorted copy each, duplicates are dropped by
+// moving the following records up.
+func groupKeyed(recs []libdns.Record) []keyedSet {
+	if len(recs) == 0 {
+		return nil
+	}
+	sorted := append([]libdns.Record(nil), recs...)
+	keys := sortKeyed(sorted)
+	count := 0
+	for i := range keys {
+		if i == 0 || !keys[i].sameRRSet(keys[i-1]) {
+			count++
+		}
+	}
+	sets := make([]keyedSet, 0, count)
+	start, n := 0, 0
+	end := func() {
+		s := &sets[len(sets)-1]
+		s.Records, s.keys = sorted[start:n:n], keys[start:n:n]
+	}
+	var prev sortKey
+	for i, r := range sorted {
+		k := keys[i]
+		switch {
+		case i > 0 && k.sameRRSet(prev) && k.rr.Data == prev.rr.Data:
+			continue
+		case i == 0 || !k.sameRRSet(prev):
+			if i > 0 {
+				end()
+			}
+			sets = append(sets, keyedSet{RRSet: RRSet{Name: k.rr.Name, Type: k.rr.Type}})
+			start = n
+		}
+		sorted[n], keys[n] = r, k
+		n++
+		prev = k
+	}
+	end()
+	return sets
+}
+
+func (s keyedSet) key() rrsetKey {
+	return rrsetKey{s.keys[0].name, s.keys[0].typ}
+}
+
+// difference is RRSet.Difference.
+func (s keyedSet) difference(o keyedSet) []libdns.Record {
+	var diff []libdns.Record
+	for i, k := range s.keys {
+		found := false
+		for _, ko := range o.keys {
+			if k.compare(ko) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diff = append(diff, s.Records[i])
+		}
+	}
+	return diff
+}
+
+func (s RRSet) keyed() keyedSet {
+	ks := keyedSet{RRSet: s, keys: make([]sortKey, len(s.Records))}
+	for i, r := range s.Records {
+		ks.keys[i] = sortKeyOf(r)
+	}
+	return ks
+}
+
+func (s RRSet) key() rrsetKey {
+	return rrsetKey{keyName(s.Name), strings.ToUpper(s.Type)}
+}
+
+// Contains reports whether the set has a record with the same data as r.
+func (s RRSet) Contains(r libdns.Record) bool {
+	for _, v := range s.Records {
+		if CompareRecords(v, r) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Difference returns the records of s which are not in o.
+func (s RRSet) Difference(o RRSet) []libdns.Record {
+	return s.keyed().difference(o.keyed())
+}
+
+// Equal reports whether both sets have the same name, type and record data.
+// TTLs and the order of the records are ignored.
+func (s RRSet) Equal(o RRSet) bool {
+	return s.key() == o.key() && len(s.Difference(o)) == 0 && len(o.Difference(s)) == 0
+}
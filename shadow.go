@@ -0,0 +1,119 @@
+package dynv6
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+)
+
+// RecordChanges are the changes of the records of a zone since the last
+// call of GetRecordChanges.
+type RecordChanges struct {
+	Zone    string
+	Added   []libdns.Record
+	Changed []RecordChange
+	Removed []libdns.Record
+
+	// Initial is set for the first call for the zone, which returns all
+	// records as added.
+	Initial bool
+}
+
+// RecordChange is a record whose data changed.
+type RecordChange struct {
+	Old, New libdns.Record
+}
+
+// Empty reports whether nothing changed.
+func (c RecordChanges) Empty() bool {
+	return len(c.Added) == 0 && len(c.Changed) == 0 && len(c.Removed) == 0
+}
+
+// shadowCopy holds the records of the zones GetRecordChanges was called
+// for, by record ID.
+type shadowCopy struct {
+	mu    sync.Mutex
+	zones map[string]map[int64]dynv6api.Record
+}
+
+// GetRecordChanges returns the records of the zone which were added,
+// changed or removed since its last call for the zone, so pollers can skip
+// unchanged zones. The provider keeps a copy of the records of every zone
+// it is called for; the first call returns all records as added. Records
+// are identified by their dynv6 ID, so a record whose data was edited is
+// changed, not removed and added. Records managed by dynv6 are left out.
+// With RecordCacheTTL, changes show up once the cached listing expires.
+func (p *Provider) GetRecordChanges(ctx context.Context, zone string) (RecordChanges, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	zoneDetails, err := p.zone(ctx, zone)
+	if err != nil {
+		return RecordChanges{}, err
+	}
+	s := &p.shadow
+	// concurrent calls must not report the same changes twice
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := p.records(ctx, zoneDetails.ID)
+	if err != nil {
+		return RecordChanges{}, err
+	}
+	key := zoneKey(zone)
+	old, seen := s.zones[key]
+	changes := RecordChanges{Zone: zoneDetails.Name, Initial: !seen}
+	next := make(map[int64]dynv6api.Record, len(current))
+	for i := range current {
+		r := current[i]
+		next[r.ID] = r
+		prev, ok := old[r.ID]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, p.shadowRecord(&r))
+		case !sameRecord(prev, r):
+			changes.Changed = append(changes.Changed, RecordChange{Old: p.shadowRecord(&prev), New: p.shadowRecord(&r)})
+		}
+	}
+	for id, r := range old {
+		if _, ok := next[id]; !ok {
+			r := r
+			changes.Removed = append(changes.Removed, p.shadowRecord(&r))
+		}
+	}
+	SortRecords(changes.Added)
+	SortRecords(changes.Removed)
+	sort.SliceStable(changes.Changed, func(i, j int) bool {
+		return CompareRecords(changes.Changed[i].New, changes.Changed[j].New) < 0
+	})
+	if s.zones == nil {
+		s.zones = map[string]map[int64]dynv6api.Record{}
+	}
+	s.zones[key] = next
+	return changes, nil
+}
+
+// ResetRecordChanges drops the copy of the records of the zone, so the next
+// call of GetRecordChanges returns all records as added again.
+func (p *Provider) ResetRecordChanges(zone string) {
+	p.shadow.mu.Lock()
+	delete(p.shadow.zones, zoneKey(zone))
+	p.shadow.mu.Unlock()
+}
+
+func (p *Provider) shadowRecord(r *dynv6api.Record) libdns.Record {
+	return withTTL(toLibdnsRecord(r), p.TTL)
+}
+
+// sameRecord reports whether a and b have the same fields, comparing the
+// values of the optional ones rather than the pointers.
+func sameRecord(a, b dynv6api.Record) bool {
+	return a.Type == b.Type && a.Name == b.Name && a.Data == b.Data && a.Tag == b.Tag &&
+		sameInt(a.Priority, b.Priority) && sameInt(a.Weight, b.Weight) &&
+		sameInt(a.Port, b.Port) && sameInt(a.Flags, b.Flags)
+}
+
+func sameInt(a, b *int) bool {
+	return (a == nil) == (b == nil) && (a == nil || *a == *b)
+}
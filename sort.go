@@ -0,0 +1,87 @@
+package dynv6
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// CompareRecords orders records by name, then type, then data. It returns a
+// negative number if a sorts before b, a positive number if a sorts after b
+// and zero if they are equal in the ordering. Names and types are compared
+// case-insensitively.
+func CompareRecords(a, b libdns.Record) int {
+	return sortKeyOf(a).compare(sortKeyOf(b))
+}
+
+// SortRecords sorts records in the order defined by CompareRecords.
+func SortRecords(recs []libdns.Record) {
+	sortKeyed(recs)
+}
+
+// sortKey holds what CompareRecords compares. RR formats the data of typed
+// records on every call, so sorting large zones computes it once per record
+// rather than for every comparison.
+type sortKey struct {
+	rr        libdns.RR
+	name, typ string
+}
+
+func sortKeyOf(r libdns.Record) sortKey {
+	rr := r.RR()
+	return sortKey{rr: rr, name: keyName(rr.Name), typ: strings.ToUpper(rr.Type)}
+}
+
+func (k sortKey) compare(o sortKey) int {
+	if c := strings.Compare(k.name, o.name); c != 0 {
+		return c
+	}
+	if c := strings.Compare(k.typ, o.typ); c != 0 {
+		return c
+	}
+	return strings.Compare(k.rr.Data, o.rr.Data)
+}
+
+func (k sortKey) sameRRSet(o sortKey) bool {
+	return k.name == o.name && k.typ == o.typ
+}
+
+// sortKeyed sorts recs like SortRecords and returns their keys in the
+// sorted order. It sorts indexes rather than the keys themselves, whose
+// strings would make every swap go through the write barrier.
+func sortKeyed(recs []libdns.Record) []sortKey {
+	keys := make([]sortKey, len(recs))
+	order := make([]int, len(recs))
+	for i, r := range recs {
+		keys[i] = sortKeyOf(r)
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if c := keys[a].compare(keys[b]); c != 0 {
+			return c < 0
+		}
+		// keep equal records in their order, like a stable sort
+		return a < b
+	})
+	// move the records and keys along the cycles of the permutation
+	for i := range order {
+		if order[i] == i {
+			continue
+		}
+		r, k := recs[i], keys[i]
+		j := i
+		for {
+			next := order[j]
+			order[j] = j
+			if next == i {
+				recs[j], keys[j] = r, k
+				break
+			}
+			recs[j], keys[j] = recs[next], keys[next]
+			j = next
+		}
+	}
+	return keys
+}
@@ -0,0 +1,48 @@
+package dynv6
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// Values of Provider.SPFMode.
+const (
+	// SPFConvert writes SPF records as TXT records. This is the default,
+	// because resolvers only evaluate TXT records for SPF (RFC 7208 section
+	// 3.1).
+	SPFConvert = "convert"
+	// SPFKeep writes SPF records with the legacy SPF type as requested.
+	SPFKeep = "keep"
+	// SPFMirror writes both an SPF and a TXT record.
+	SPFMirror = "mirror"
+)
+
+// mapSPF applies the provider's SPFMode to the SPF-type records of recs.
+// Records read from dynv6 with the legacy SPF type are returned as
+// RawRecord values with Type "SPF", since libdns has no SPF type.
+func (p *Provider) mapSPF(zone string, recs []libdns.Record) []libdns.Record {
+	var out []libdns.Record
+	for _, r := range recs {
+		rr := r.RR()
+		if !strings.EqualFold(rr.Type, "SPF") {
+			out = append(out, r)
+			continue
+		}
+		txt := libdns.TXT{Name: rr.Name, TTL: rr.TTL, Text: rr.Data}
+		switch p.SPFMode {
+		case SPFKeep:
+			p.warn(Warning{Code: WarnSPFLegacy, Zone: zone, Name: rr.Name, Type: rr.Type,
+				Message: fmt.Sprintf("Writing legacy SPF record %s in %s, resolvers only honor TXT records; set spf_mode to %q or %q", rr.Name, zone, SPFConvert, SPFMirror)})
+			out = append(out, r)
+		case SPFMirror:
+			out = append(out, r, txt)
+		default:
+			p.warn(Warning{Code: WarnSPFConverted, Zone: zone, Name: rr.Name, Type: rr.Type,
+				Message: fmt.Sprintf("Converting legacy SPF record %s in %s to TXT", rr.Name, zone)})
+			out = append(out, txt)
+		}
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package dynv6
+
+import (
+	"expvar"
+	"sync/atomic"
+
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+// Stats is a snapshot of the provider's counters.
+type Stats struct {
+	dynv6api.Stats
+	// CacheHits counts lookups answered from the provider's cache.
+	CacheHits int64 `json:"cache_hits"`
+	// CacheMisses counts lookups that had to call the API.
+	CacheMisses int64 `json:"cache_misses"`
+	// Coalesced counts lookups that joined an identical request in flight.
+	Coalesced int64 `json:"coalesced"`
+}
+
+type providerStats struct {
+	cacheHits   int64
+	cacheMisses int64
+	coalesced   int64
+}
+
+func (s *providerStats) hit()  { atomic.AddInt64(&s.cacheHits, 1) }
+func (s *providerStats) miss() { atomic.AddInt64(&s.cacheMisses, 1) }
+
+func (s *providerStats) coalesce() { atomic.AddInt64(&s.coalesced, 1) }
+
+// Stats returns a snapshot of the provider's counters, so long-running
+// programs can introspect their dynv6 usage.
+func (p *Provider) Stats() Stats {
+	return Stats{
+		Stats:       p.client().Stats(),
+		CacheHits:   atomic.LoadInt64(&p.stats.cacheHits),
+		CacheMisses: atomic.LoadInt64(&p.stats.cacheMisses),
+		Coalesced:   atomic.LoadInt64(&p.stats.coalesced),
+	}
+}
+
+// PublishExpvar publishes the provider's Stats under the given name with the
+// expvar package. Like expvar.Publish, it panics if the name is already in use.
+func (p *Provider) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return p.Stats()
+	}))
+}
@@ -0,0 +1,131 @@
+package dynv6
+
+import (
+	"context"
+	"errors"
+
+	"github.com/libdns/libdns"
+)
+
+// ErrNotConfirmed is returned by Sync if the ConfirmFunc declined the plan.
+var ErrNotConfirmed = errors.New("Changes were not confirmed")
+
+// Plan lists the changes needed to bring a zone to the desired state.
+type Plan struct {
+	Zone   string
+	Create []libdns.Record
+	Delete []libdns.Record
+}
+
+// Empty reports whether the plan has no changes, i.e. the zone already
+// matches the desired records.
+func (p Plan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Delete) == 0
+}
+
+// PlanSync compares the current records of a zone with the desired records.
+// Every desired RRset replaces the current RRset with the same name and
+// type. RRsets which are not desired are only deleted if prune is set.
+// Read-only records managed by dynv6 are left alone.
+func PlanSync(current, desired []libdns.Record, prune bool) Plan {
+	return planSync(current, desired, prune, nil)
+}
+
+// planSync is PlanSync deleting only the records prunable returns of the
+// RRsets which are not desired, if it isn't nil.
+func planSync(current, desired []libdns.Record, prune bool, prunable func(RRSet) []libdns.Record) Plan {
+	var plan Plan
+	writable := make([]libdns.Record, 0, len(current))
+	for _, r := range current {
+		if !IsReadOnly(r) {
+			writable = append(writable, r)
+		}
+	}
+	currentSets := groupKeyed(writable)
+	have := make(map[rrsetKey]keyedSet, len(currentSets))
+	for _, s := range currentSets {
+		have[s.key()] = s
+	}
+	desiredSets := groupKeyed(desired)
+	want := make(map[rrsetKey]bool, len(desiredSets))
+	for _, s := range desiredSets {
+		want[s.key()] = true
+		cur := have[s.key()]
+		plan.Create = append(plan.Create, s.difference(cur)...)
+		plan.Delete = append(plan.Delete, cur.difference(s)...)
+	}
+	if prune {
+		for _, s := range currentSets {
+			switch {
+			case want[s.key()]:
+			case prunable != nil:
+				plan.Delete = append(plan.Delete, prunable(s.RRSet)...)
+			default:
+				plan.Delete = append(plan.Delete, s.Records...)
+			}
+		}
+		SortRecords(plan.Delete)
+	}
+	return plan
+}
+
+// Sync makes the records of the zone match desired, see PlanSync, and
+// returns the applied plan. Stale records are deleted before new ones are
+// created, so an RRset can be replaced by a CNAME. With the Confirm option
+// the plan is only applied once approved, which is advisable before
+// enabling prune. The OwnershipTXT and PruneOnly options keep prune from
+// deleting records the caller didn't create.
+func (p *Provider) Sync(ctx context.Context, zone string, desired []libdns.Record, prune bool) (Plan, error) {
+	ctx = p.withRetryBudget(ctx)
+	plan, err := p.planZone(ctx, zone, desired, prune)
+	if err != nil {
+		return plan, err
+	}
+	// the confirmation may wait for a person, so it doesn't count towards
+	// the OperationTimeout of the writes
+	if confirm := optionsFrom(ctx).confirm; confirm != nil && !plan.Empty() {
+		ok, err := confirm(ctx, plan)
+		if err != nil {
+			return plan, err
+		}
+		if !ok {
+			return plan, ErrNotConfirmed
+		}
+	}
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	if len(plan.Delete) > 0 {
+		if _, err := p.DeleteRecords(ctx, zone, plan.Delete); err != nil {
+			return plan, err
+		}
+	}
+	if len(plan.Create) > 0 {
+		if _, err := p.AppendRecords(ctx, zone, plan.Create); err != nil {
+			return plan, err
+		}
+	}
+	return plan, nil
+}
+
+// planZone lists the zone and plans the sync, see Sync.
+func (p *Provider) planZone(ctx context.Context, zone string, desired []libdns.Record, prune bool) (Plan, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	current, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return Plan{}, err
+	}
+	opts := optionsFrom(ctx)
+	if opts.owner != "" {
+		desired = withOwnership(current, desired, opts.owner, prune)
+	}
+	plan := planSync(current, desired, prune, opts.prunable(zone, current))
+	plan.Zone = zone
+	if err := p.checkPolicy(zone, "write", plan.Create); err != nil {
+		return plan, err
+	}
+	if err := p.checkPolicy(zone, "delete", plan.Delete); err != nil {
+		return plan, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,178 @@
+// Package testutil helps testing code built on the dynv6 provider without a
+// dynv6 account: API is an in-memory fake of the dynv6 REST API, and
+// ZoneFixture builds zones to seed it with, along with the libdns records
+// the provider is expected to return for them:
+//
+//	api, url := testutil.NewServer(t)
+//	zone := testutil.NewZoneFixture("example.dynv6.net").
+//		WithA("www", "203.0.113.7").
+//		WithMX("@", 10, "mail.example.org.")
+//	api.Seed(zone)
+//	p := &dynv6.Provider{Token: "test", BaseURL: url}
+//	got, err := p.GetRecords(ctx, "example.dynv6.net")
+//	// compare got with zone.Records()
+package testutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/libdns/dynv6/dynv6api"
+)
+
+// supportedTypes are the record types the fake accepts, like dynv6.
+var supportedTypes = map[string]bool{"A": true, "AAAA": true, "CAA": true, "CNAME": true, "MX": true, "SPF": true, "SRV": true, "TXT": true}
+
+// API is an in-memory implementation of the zones and records endpoints of
+// the dynv6 REST API. Its fields may be changed between requests, e.g. to
+// simulate changes made in the web interface; Lock guards them while the
+// server is in use.
+type API struct {
+	sync.Mutex
+	Zones   []dynv6api.Zone
+	Records map[int64][]dynv6api.Record
+
+	// NextID is the ID of the last record created. New records get the
+	// following ones.
+	NextID int64
+
+	calls map[string]int
+}
+
+// NewServer starts a server for a new API, stopped when the test ends, and
+// returns the API and the base URL of the server.
+func NewServer(t testing.TB) (*API, string) {
+	api := &API{Records: map[int64][]dynv6api.Record{}}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, srv.URL
+}
+
+// AddZone adds an empty zone.
+func (f *API) AddZone(id int64, name string) {
+	f.Lock()
+	defer f.Unlock()
+	if f.Records == nil {
+		f.Records = map[int64][]dynv6api.Record{}
+	}
+	f.Zones = append(f.Zones, dynv6api.Zone{ID: id, Name: name})
+}
+
+// CallCount returns how often an endpoint was called, e.g.
+// "GET /zones/1/records".
+func (f *API) CallCount(call string) int {
+	f.Lock()
+	defer f.Unlock()
+	return f.calls[call]
+}
+
+func (f *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if f.Records == nil {
+		f.Records = map[int64][]dynv6api.Record{}
+	}
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	f.calls[r.Method+" "+r.URL.Path]++
+	segs := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	writeJSON := func(v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	findZone := func(match func(z dynv6api.Zone) bool) *dynv6api.Zone {
+		for i := range f.Zones {
+			if match(f.Zones[i]) {
+				return &f.Zones[i]
+			}
+		}
+		return nil
+	}
+	switch {
+	case len(segs) == 1 && segs[0] == "zones":
+		zones := f.Zones
+		if zones == nil {
+			zones = []dynv6api.Zone{}
+		}
+		writeJSON(zones)
+		return
+	case len(segs) == 3 && segs[1] == "by-name":
+		if z := findZone(func(z dynv6api.Zone) bool { return z.Name == segs[2] }); z != nil {
+			writeJSON(z)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	case len(segs) < 2:
+		http.NotFound(w, r)
+		return
+	}
+	zoneID, _ := strconv.ParseInt(segs[1], 10, 64)
+	zone := findZone(func(z dynv6api.Zone) bool { return z.ID == zoneID })
+	if zone == nil {
+		http.NotFound(w, r)
+		return
+	}
+	recs := f.Records[zoneID]
+	switch {
+	case len(segs) == 2 && r.Method == "GET":
+		writeJSON(zone)
+	case len(segs) == 2 && r.Method == "PATCH":
+		var upd dynv6api.ZoneUpdate
+		json.NewDecoder(r.Body).Decode(&upd)
+		if upd.IPv4Address != "" {
+			zone.IPv4Address = upd.IPv4Address
+		}
+		if upd.IPv6Prefix != "" {
+			zone.IPv6Prefix = upd.IPv6Prefix
+		}
+		writeJSON(zone)
+	case len(segs) == 3 && r.Method == "GET":
+		if recs == nil {
+			recs = []dynv6api.Record{}
+		}
+		writeJSON(recs)
+	case len(segs) == 3 && r.Method == "POST":
+		var rec dynv6api.Record
+		json.NewDecoder(r.Body).Decode(&rec)
+		if !supportedTypes[strings.ToUpper(rec.Type)] {
+			http.Error(w, `{"type":["is not included in the list"]}`, http.StatusUnprocessableEntity)
+			return
+		}
+		f.NextID++
+		rec.ID = f.NextID
+		rec.ZoneID = zoneID
+		f.Records[zoneID] = append(recs, rec)
+		writeJSON(rec)
+	case len(segs) == 4:
+		recID, _ := strconv.ParseInt(segs[3], 10, 64)
+		for i, rec := range recs {
+			if rec.ID != recID {
+				continue
+			}
+			switch r.Method {
+			case "GET":
+				writeJSON(rec)
+			case "PATCH":
+				var upd dynv6api.Record
+				json.NewDecoder(r.Body).Decode(&upd)
+				upd.ID = rec.ID
+				upd.ZoneID = zoneID
+				recs[i] = upd
+				writeJSON(upd)
+			case "DELETE":
+				f.Records[zoneID] = append(recs[:i], recs[i+1:]...)
+			}
+			return
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
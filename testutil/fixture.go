@@ -0,0 +1,145 @@
+package testutil
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/libdns/dynv6/dynv6api"
+	"github.com/libdns/libdns"
+)
+
+// ZoneFixture is a zone and its records, in the form the dynv6 API stores
+// them and as the libdns records the provider returns for them. The With
+// methods add records and return the fixture, so calls can be chained.
+// They panic on invalid input, as fixtures are fixed test data.
+type ZoneFixture struct {
+	Zone dynv6api.Zone
+
+	api    []dynv6api.Record
+	libdns []libdns.Record
+}
+
+// NewZoneFixture returns a fixture of an empty zone. Its ID is assigned by
+// Seed, unless set with WithID.
+func NewZoneFixture(name string) *ZoneFixture {
+	return &ZoneFixture{Zone: dynv6api.Zone{Name: strings.TrimSuffix(name, ".")}}
+}
+
+// WithID sets the ID of the zone.
+func (f *ZoneFixture) WithID(id int64) *ZoneFixture {
+	f.Zone.ID = id
+	return f
+}
+
+// WithA adds an A record.
+func (f *ZoneFixture) WithA(name, ip string) *ZoneFixture {
+	return f.address(name, "A", ip)
+}
+
+// WithAAAA adds an AAAA record.
+func (f *ZoneFixture) WithAAAA(name, ip string) *ZoneFixture {
+	return f.address(name, "AAAA", ip)
+}
+
+func (f *ZoneFixture) address(name, typ, ip string) *ZoneFixture {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is4() != (typ == "A") {
+		panic(fmt.Sprintf("testutil: invalid %s address %q", typ, ip))
+	}
+	return f.add(dynv6api.Record{Name: name, Type: typ, Data: ip}, libdns.Address{Name: name, IP: addr})
+}
+
+// WithTXT adds a TXT record.
+func (f *ZoneFixture) WithTXT(name, text string) *ZoneFixture {
+	return f.add(dynv6api.Record{Name: name, Type: "TXT", Data: text}, libdns.TXT{Name: name, Text: text})
+}
+
+// WithCNAME adds a CNAME record.
+func (f *ZoneFixture) WithCNAME(name, target string) *ZoneFixture {
+	return f.add(dynv6api.Record{Name: name, Type: "CNAME", Data: target}, libdns.CNAME{Name: name, Target: target})
+}
+
+// WithMX adds an MX record. dynv6 stores the preference as the priority.
+func (f *ZoneFixture) WithMX(name string, preference uint16, target string) *ZoneFixture {
+	return f.add(dynv6api.Record{Name: name, Type: "MX", Data: target, Priority: intPtr(int(preference))},
+		libdns.MX{Name: name, Preference: preference, Target: target})
+}
+
+// WithSRV adds an SRV record for _service._proto.name; name is "@" for the
+// apex. dynv6 stores the service and protocol as part of the name.
+func (f *ZoneFixture) WithSRV(service, proto, name string, priority, weight, port uint16, target string) *ZoneFixture {
+	srv := libdns.SRV{
+		Service:   strings.TrimPrefix(service, "_"),
+		Transport: strings.TrimPrefix(proto, "_"),
+		Name:      name,
+		Priority:  priority,
+		Weight:    weight,
+		Port:      port,
+		Target:    target,
+	}
+	return f.add(dynv6api.Record{
+		Name:     srv.RR().Name,
+		Type:     "SRV",
+		Data:     target,
+		Priority: intPtr(int(priority)),
+		Weight:   intPtr(int(weight)),
+		Port:     intPtr(int(port)),
+	}, srv)
+}
+
+// WithCAA adds a CAA record. dynv6 stores the flags and tag separately and
+// the value as the data.
+func (f *ZoneFixture) WithCAA(name string, flags uint8, tag, value string) *ZoneFixture {
+	return f.add(dynv6api.Record{Name: name, Type: "CAA", Data: value, Flags: intPtr(int(flags)), Tag: tag},
+		libdns.CAA{Name: name, Flags: flags, Tag: tag, Value: value})
+}
+
+func (f *ZoneFixture) add(api dynv6api.Record, rec libdns.Record) *ZoneFixture {
+	f.api = append(f.api, api)
+	f.libdns = append(f.libdns, rec)
+	return f
+}
+
+// Records returns the libdns records the provider returns for the zone, in
+// the order they were added. The provider sorts them by
+// dynv6.CompareRecords; sort them with dynv6.SortRecords to compare.
+func (f *ZoneFixture) Records() []libdns.Record {
+	return append([]libdns.Record(nil), f.libdns...)
+}
+
+// APIRecords returns the records as the API stores them, without IDs.
+func (f *ZoneFixture) APIRecords() []dynv6api.Record {
+	return append([]dynv6api.Record(nil), f.api...)
+}
+
+// Seed adds the zone and its records to the API and returns the ID of the
+// zone. The records get new IDs.
+func (f *API) Seed(z *ZoneFixture) int64 {
+	f.Lock()
+	defer f.Unlock()
+	zone := z.Zone
+	if zone.ID == 0 {
+		for _, other := range f.Zones {
+			if other.ID > zone.ID {
+				zone.ID = other.ID
+			}
+		}
+		zone.ID++
+	}
+	f.Zones = append(f.Zones, zone)
+	if f.Records == nil {
+		f.Records = map[int64][]dynv6api.Record{}
+	}
+	for _, rec := range z.api {
+		f.NextID++
+		rec.ID = f.NextID
+		rec.ZoneID = zone.ID
+		f.Records[zone.ID] = append(f.Records[zone.ID], rec)
+	}
+	return zone.ID
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,52 @@
+package testutil_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/libdns/dynv6"
+	"github.com/libdns/dynv6/testutil"
+)
+
+func TestZoneFixture(t *testing.T) {
+	ctx := context.Background()
+	api, url := testutil.NewServer(t)
+	api.AddZone(1, "other.dynv6.net")
+	zone := testutil.NewZoneFixture("example.dynv6.net.").
+		WithA("www", "203.0.113.7").
+		WithAAAA("www", "2001:db8::7").
+		WithTXT("@", "v=spf1 -all").
+		WithCNAME("blog", "www.example.dynv6.net.").
+		WithMX("@", 10, "mail.example.org.").
+		WithSRV("_sip", "_tcp", "@", 10, 5, 5060, "sip.example.org.").
+		WithCAA("@", 0, "issue", "letsencrypt.org")
+	if id := api.Seed(zone); id != 2 {
+		t.Fatalf("seeded zone %d, want the next free ID 2", id)
+	}
+
+	p := &dynv6.Provider{Token: "test", BaseURL: url}
+	got, err := p.GetRecords(ctx, "example.dynv6.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := zone.Records()
+	dynv6.SortRecords(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got records\n%#v\nwant\n%#v", got, want)
+	}
+
+	// records written through the provider are stored like the fixture's
+	api.Seed(testutil.NewZoneFixture("written.dynv6.net").WithID(9))
+	if _, err := p.AppendRecords(ctx, "written.dynv6.net", zone.Records()); err != nil {
+		t.Fatal(err)
+	}
+	api.Lock()
+	defer api.Unlock()
+	for i, rec := range api.Records[9] {
+		rec.ID, rec.ZoneID = 0, 0
+		if want := zone.APIRecords()[i]; !reflect.DeepEqual(rec, want) {
+			t.Errorf("record %d: stored %+v, fixture has %+v", i, rec, want)
+		}
+	}
+}
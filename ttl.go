@@ -0,0 +1,109 @@
+package dynv6
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// Warning is a structured warning about a write, see Provider.OnWarning.
+type Warning struct {
+	// Code identifies the kind of warning, e.g. WarnChallengeTTL.
+	Code string
+	Zone string
+	Name string
+	Type string
+	// Message describes the problem and how to avoid it.
+	Message string
+	// SuggestedTTL is set by TTL warnings.
+	SuggestedTTL time.Duration
+}
+
+func (w Warning) String() string { return w.Message }
+
+// Codes of warnings.
+const (
+	WarnChallengeTTL = "challenge_ttl"
+	WarnDynamicTTL   = "dynamic_ttl"
+	WarnSPFLegacy    = "spf_legacy"
+	WarnSPFConverted = "spf_converted"
+	// WarnTokenNormalized is emitted once per token which had whitespace,
+	// quotes or a Bearer prefix removed, see dynv6api.NormalizeToken.
+	WarnTokenNormalized = "token_normalized"
+	// WarnUnknownFields is emitted once per set of fields of API responses
+	// the client doesn't know, which hints at a change of the API.
+	WarnUnknownFields = "unknown_fields"
+)
+
+// Purposes of records checked by CheckTTL.
+const (
+	// PurposeChallenge are ACME DNS-01 challenge TXT records.
+	PurposeChallenge = "challenge"
+	// PurposeDynamic are address records of dynamic DNS clients.
+	PurposeDynamic = "dynamic"
+)
+
+// Longest TTLs which don't cause problems for the purposes, and the TTLs
+// suggested instead.
+const (
+	MaxChallengeTTL       = 2 * time.Minute
+	SuggestedChallengeTTL = time.Minute
+	MaxDynamicTTL         = 10 * time.Minute
+	SuggestedDynamicTTL   = 2 * time.Minute
+)
+
+// CheckTTL returns a warning if the TTL of a record written for purpose is
+// likely to cause problems: resolvers caching an old challenge token of a
+// previous attempt, or keeping an outdated address long after it changed.
+// A zero TTL, i.e. the default of the provider, isn't checked.
+func CheckTTL(purpose, zone string, r libdns.Record) *Warning {
+	rr := r.RR()
+	w := &Warning{Zone: zone, Name: rr.Name, Type: rr.Type}
+	var max time.Duration
+	switch purpose {
+	case PurposeChallenge:
+		w.Code, max, w.SuggestedTTL = WarnChallengeTTL, MaxChallengeTTL, SuggestedChallengeTTL
+		w.Message = fmt.Sprintf("TTL %v of challenge record %s in %s is long, resolvers may serve the token of a previous attempt; use %v or less", rr.TTL, rr.Name, zone, w.SuggestedTTL)
+	case PurposeDynamic:
+		w.Code, max, w.SuggestedTTL = WarnDynamicTTL, MaxDynamicTTL, SuggestedDynamicTTL
+		w.Message = fmt.Sprintf("TTL %v of dynamic %s record %s in %s is long, clients keep the old address that long after it changes; use %v or less", rr.TTL, rr.Type, rr.Name, zone, w.SuggestedTTL)
+	default:
+		return nil
+	}
+	if rr.TTL <= max {
+		return nil
+	}
+	return w
+}
+
+// isChallenge reports whether r is an ACME DNS-01 challenge record.
+func isChallenge(rr libdns.RR) bool {
+	name := strings.ToLower(rr.Name)
+	return strings.EqualFold(rr.Type, "TXT") && (name == "_acme-challenge" || strings.HasPrefix(name, "_acme-challenge."))
+}
+
+// checkTTLs warns about challenge records with problematic TTLs. dynv6
+// serves its own TTLs, but callers like ACME clients rely on the TTL they
+// asked for.
+func (p *Provider) checkTTLs(zone string, recs []libdns.Record) {
+	for _, r := range recs {
+		if !isChallenge(r.RR()) {
+			continue
+		}
+		if w := CheckTTL(PurposeChallenge, zone, r); w != nil {
+			p.warn(*w)
+		}
+	}
+}
+
+// warn logs the warning and passes it to OnWarning.
+func (p *Provider) warn(w Warning) {
+	if p.Logger != nil {
+		p.Logger.Print(w.Message)
+	}
+	if p.OnWarning != nil {
+		p.OnWarning(w)
+	}
+}
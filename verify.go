@@ -0,0 +1,87 @@
+package dynv6
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// Verify makes AppendRecords and SetRecords read the written RRsets back
+// and compare them with the records passed in, returning a
+// VerificationError if dynv6 silently normalized or dropped something.
+// It costs one more request per call.
+func Verify() Option {
+	return func(o *callOptions) { o.verify = true }
+}
+
+// VerificationError is returned with the Verify option for an RRset dynv6
+// returns differently than it was written. The records were written.
+type VerificationError struct {
+	Zone string
+	Name string
+	Type string
+	// Want are the records written, for SetRecords the whole RRset.
+	Want []libdns.RR
+	// Got are the records of the RRset dynv6 returns.
+	Got []libdns.RR
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("Verifying the %s records %q in %s: wrote %s, dynv6 returns %s", e.Type, e.Name, e.Zone, rrData(e.Want), rrData(e.Got))
+}
+
+func rrData(rrs []libdns.RR) string {
+	if len(rrs) == 0 {
+		return "nothing"
+	}
+	data := make([]string, len(rrs))
+	for i, rr := range rrs {
+		data[i] = fmt.Sprintf("%q", rr.Data)
+	}
+	return "[" + strings.Join(data, " ") + "]"
+}
+
+// verify reads the records of the zone and returns an error for the first
+// RRset of written which doesn't have all of its records, or, if exact is
+// set, has others as well.
+func (p *Provider) verify(ctx context.Context, zone string, zoneID int64, written []libdns.Record, exact bool) error {
+	p.invalidateRecords(zoneID)
+	current, err := p.records(ctx, zoneID)
+	if err != nil {
+		return fmt.Errorf("Verifying the written records: %w", err)
+	}
+	got := map[rrsetKey][]libdns.Record{}
+	for i := range current {
+		r := toLibdnsRecord(&current[i])
+		got[keyOf(r.RR())] = append(got[keyOf(r.RR())], r)
+	}
+	for _, s := range GroupRRSets(written) {
+		have := got[s.key()]
+		SortRecords(have)
+		ok := !exact || len(have) == len(s.Records)
+		for _, want := range s.Records {
+			found := false
+			for _, r := range have {
+				if CompareRecords(r, want) == 0 {
+					found = true
+					break
+				}
+			}
+			ok = ok && found
+		}
+		if ok {
+			continue
+		}
+		e := &VerificationError{Zone: strings.TrimSuffix(zone, "."), Name: s.Name, Type: s.Type}
+		for _, r := range s.Records {
+			e.Want = append(e.Want, r.RR())
+		}
+		for _, r := range have {
+			e.Got = append(e.Got, r.RR())
+		}
+		return e
+	}
+	return nil
+}